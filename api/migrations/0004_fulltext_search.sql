@@ -0,0 +1,25 @@
+-- Full-text search over synced mail, notes and contacts.
+-- Bodies are capped so oversized emails can't exceed the tsvector size limit.
+
+ALTER TABLE email
+  ADD COLUMN IF NOT EXISTS search_tsv tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(subject, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(snippet, '')), 'B') ||
+    setweight(to_tsvector('english', left(coalesce(body_text, ''), 100000)), 'C')
+  ) STORED;
+
+ALTER TABLE note
+  ADD COLUMN IF NOT EXISTS search_tsv tsvector GENERATED ALWAYS AS (
+    to_tsvector('english', left(coalesce(body, ''), 100000))
+  ) STORED;
+
+-- Names don't stem well, so contacts use the 'simple' configuration.
+ALTER TABLE contact
+  ADD COLUMN IF NOT EXISTS search_tsv tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', coalesce(first_name, '') || ' ' || coalesce(last_name, '')), 'A') ||
+    setweight(to_tsvector('simple', replace(coalesce(email, ''), '@', ' ')), 'B')
+  ) STORED;
+
+CREATE INDEX IF NOT EXISTS email_search_idx ON email USING GIN (search_tsv);
+CREATE INDEX IF NOT EXISTS note_search_idx ON note USING GIN (search_tsv);
+CREATE INDEX IF NOT EXISTS contact_search_idx ON contact USING GIN (search_tsv);
@@ -0,0 +1,34 @@
+-- Replace the JSONB embedding columns (never populated) with pgvector columns
+-- and HNSW indexes for cosine nearest-neighbour search. The dimension must
+-- match EMBEDDING_DIMENSIONS (default 1536, text-embedding-3-small).
+
+CREATE EXTENSION IF NOT EXISTS vector;
+
+DROP TABLE IF EXISTS email_embedding;
+DROP TABLE IF EXISTS note_embedding;
+DROP TABLE IF EXISTS instruction_embedding;
+
+CREATE TABLE email_embedding (
+  email_id BIGINT PRIMARY KEY REFERENCES email(id) ON DELETE CASCADE,
+  model TEXT NOT NULL,
+  embedding vector(1536) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE note_embedding (
+  note_id BIGINT PRIMARY KEY REFERENCES note(id) ON DELETE CASCADE,
+  model TEXT NOT NULL,
+  embedding vector(1536) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE instruction_embedding (
+  instruction_id BIGINT PRIMARY KEY REFERENCES instruction(id) ON DELETE CASCADE,
+  model TEXT NOT NULL,
+  embedding vector(1536) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS email_embedding_hnsw ON email_embedding USING hnsw (embedding vector_cosine_ops);
+CREATE INDEX IF NOT EXISTS note_embedding_hnsw ON note_embedding USING hnsw (embedding vector_cosine_ops);
+CREATE INDEX IF NOT EXISTS instruction_embedding_hnsw ON instruction_embedding USING hnsw (embedding vector_cosine_ops);
@@ -0,0 +1,9 @@
+-- Lexical search over meeting titles for hybrid retrieval.
+
+ALTER TABLE meeting
+  ADD COLUMN IF NOT EXISTS search_tsv tsvector GENERATED ALWAYS AS (
+    to_tsvector('english', coalesce(title, ''))
+  ) STORED;
+
+CREATE INDEX IF NOT EXISTS meeting_search_idx ON meeting USING GIN (search_tsv);
+CREATE INDEX IF NOT EXISTS email_thread_idx ON email (user_id, thread_id);
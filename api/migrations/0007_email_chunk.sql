@@ -0,0 +1,26 @@
+-- Email bodies split into overlapping chunks (quoted history and signatures
+-- removed) for retrieval. Offsets are character positions in email.body_text.
+-- Chunk embeddings replace the whole-email email_embedding table.
+
+CREATE TABLE IF NOT EXISTS email_chunk (
+  id BIGSERIAL PRIMARY KEY,
+  email_id BIGINT NOT NULL REFERENCES email(id) ON DELETE CASCADE,
+  user_id UUID REFERENCES app_user(id) ON DELETE CASCADE,
+  seq INT NOT NULL,
+  start_offset INT NOT NULL,
+  end_offset INT NOT NULL,
+  content TEXT NOT NULL,
+  search_tsv tsvector GENERATED ALWAYS AS (to_tsvector('english', content)) STORED,
+  embedding vector(1536),
+  embedding_model TEXT,
+  UNIQUE (email_id, seq)
+);
+
+CREATE INDEX IF NOT EXISTS email_chunk_user_idx ON email_chunk (user_id);
+CREATE INDEX IF NOT EXISTS email_chunk_search_idx ON email_chunk USING GIN (search_tsv);
+CREATE INDEX IF NOT EXISTS email_chunk_embedding_hnsw ON email_chunk USING hnsw (embedding vector_cosine_ops);
+
+ALTER TABLE email ADD COLUMN IF NOT EXISTS chunked_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS email_unchunked_idx ON email (id) WHERE chunked_at IS NULL;
+
+DROP TABLE IF EXISTS email_embedding;
@@ -0,0 +1,12 @@
+-- Gmail incremental sync: per-user history cursor and label tracking.
+CREATE TABLE IF NOT EXISTS gmail_sync_state (
+  user_id UUID PRIMARY KEY REFERENCES app_user(id) ON DELETE CASCADE,
+  history_id BIGINT,
+  last_sync_at TIMESTAMPTZ,
+  last_full_sync_at TIMESTAMPTZ,
+  last_error TEXT
+);
+
+ALTER TABLE email ADD COLUMN IF NOT EXISTS labels TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE email ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ DEFAULT now();
+CREATE INDEX IF NOT EXISTS email_user_gmail_idx ON email (user_id, gmail_message_id);
@@ -0,0 +1,35 @@
+-- Google Calendar incremental sync: per-user/calendar sync tokens and the
+-- extra event fields the meeting table needs.
+CREATE TABLE IF NOT EXISTS calendar_sync_state (
+  user_id UUID REFERENCES app_user(id) ON DELETE CASCADE,
+  calendar_id TEXT NOT NULL DEFAULT 'primary',
+  sync_token TEXT,
+  last_sync_at TIMESTAMPTZ,
+  last_full_sync_at TIMESTAMPTZ,
+  last_error TEXT,
+  PRIMARY KEY (user_id, calendar_id)
+);
+
+ALTER TABLE meeting
+  ADD COLUMN IF NOT EXISTS calendar_id TEXT NOT NULL DEFAULT 'primary',
+  ADD COLUMN IF NOT EXISTS recurring_event_id TEXT,
+  ADD COLUMN IF NOT EXISTS description TEXT,
+  ADD COLUMN IF NOT EXISTS location TEXT,
+  ADD COLUMN IF NOT EXISTS html_link TEXT,
+  ADD COLUMN IF NOT EXISTS organizer_email TEXT,
+  ADD COLUMN IF NOT EXISTS status TEXT,
+  -- The calendar owner's own attendee response (accepted, declined, ...).
+  ADD COLUMN IF NOT EXISTS response_status TEXT,
+  ADD COLUMN IF NOT EXISTS transparent BOOLEAN NOT NULL DEFAULT false,
+  ADD COLUMN IF NOT EXISTS all_day BOOLEAN NOT NULL DEFAULT false,
+  ADD COLUMN IF NOT EXISTS synced_at TIMESTAMPTZ DEFAULT now();
+
+DELETE FROM meeting a USING meeting b
+WHERE a.id > b.id AND a.user_id = b.user_id AND a.calendar_id = b.calendar_id
+  AND a.gcal_event_id = b.gcal_event_id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS meeting_event_unique
+  ON meeting (user_id, calendar_id, gcal_event_id);
+CREATE INDEX IF NOT EXISTS meeting_user_start_idx ON meeting (user_id, start_time);
+CREATE INDEX IF NOT EXISTS meeting_recurring_idx ON meeting (user_id, recurring_event_id)
+  WHERE recurring_event_id IS NOT NULL;
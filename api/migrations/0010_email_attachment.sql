@@ -0,0 +1,21 @@
+-- Attachment metadata recorded by Gmail sync. gmail_attachment_id changes on
+-- every fetch of a message, so rows are keyed by the stable MIME part id.
+CREATE TABLE IF NOT EXISTS email_attachment (
+  id BIGSERIAL PRIMARY KEY,
+  email_id BIGINT NOT NULL REFERENCES email(id) ON DELETE CASCADE,
+  user_id UUID REFERENCES app_user(id) ON DELETE CASCADE,
+  part_id TEXT NOT NULL,
+  filename TEXT,
+  mime_type TEXT,
+  size_bytes BIGINT,
+  gmail_attachment_id TEXT,
+  content_id TEXT,
+  inline BOOLEAN NOT NULL DEFAULT false,
+  -- Small attachments Gmail delivers inside the message body.
+  data BYTEA,
+  created_at TIMESTAMPTZ DEFAULT now(),
+  updated_at TIMESTAMPTZ DEFAULT now(),
+  UNIQUE (email_id, part_id)
+);
+
+CREATE INDEX IF NOT EXISTS email_attachment_user_idx ON email_attachment (user_id);
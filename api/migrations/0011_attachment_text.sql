@@ -0,0 +1,15 @@
+-- Text extracted from email attachments, searchable alongside emails.
+ALTER TABLE email_attachment
+  ADD COLUMN IF NOT EXISTS extracted_text TEXT,
+  ADD COLUMN IF NOT EXISTS extracted_at TIMESTAMPTZ,
+  ADD COLUMN IF NOT EXISTS extract_error TEXT;
+
+ALTER TABLE email_attachment
+  ADD COLUMN IF NOT EXISTS search_tsv tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(filename, '')), 'A') ||
+    setweight(to_tsvector('english', left(coalesce(extracted_text, ''), 100000)), 'B')
+  ) STORED;
+
+CREATE INDEX IF NOT EXISTS email_attachment_search_idx ON email_attachment USING GIN (search_tsv);
+CREATE INDEX IF NOT EXISTS email_attachment_pending_idx ON email_attachment (user_id)
+  WHERE extracted_at IS NULL;
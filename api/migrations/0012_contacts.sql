@@ -0,0 +1,43 @@
+-- Contacts extracted from synced mail and meetings. normalized_email is the
+-- duplicate-detection key (lower case, no +tag, Gmail dots removed); every
+-- address seen for a contact is kept in contact_alias.
+ALTER TABLE contact
+  ADD COLUMN IF NOT EXISTS normalized_email TEXT,
+  ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ DEFAULT now(),
+  ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ DEFAULT now();
+
+UPDATE contact c SET normalized_email = CASE
+    WHEN split_part(n.e, '@', 2) IN ('gmail.com', 'googlemail.com')
+      THEN replace(split_part(n.e, '@', 1), '.', '') || '@gmail.com'
+    ELSE n.e END
+FROM (SELECT id, regexp_replace(lower(trim(email)), '\+[^@]*@', '@') AS e FROM contact) n
+WHERE c.id = n.id AND c.email IS NOT NULL AND c.normalized_email IS NULL;
+
+-- Fold existing duplicates into the oldest row before adding the unique index.
+WITH d AS (
+  SELECT id, min(id) OVER (PARTITION BY user_id, normalized_email) AS keep
+  FROM contact WHERE normalized_email IS NOT NULL
+)
+UPDATE note SET contact_id = d.keep FROM d WHERE note.contact_id = d.id AND d.id <> d.keep;
+WITH d AS (
+  SELECT id, min(id) OVER (PARTITION BY user_id, normalized_email) AS keep
+  FROM contact WHERE normalized_email IS NOT NULL
+)
+DELETE FROM contact c USING d WHERE c.id = d.id AND d.id <> d.keep;
+
+CREATE UNIQUE INDEX IF NOT EXISTS contact_normalized_unique ON contact (user_id, normalized_email);
+
+CREATE TABLE IF NOT EXISTS contact_alias (
+  user_id UUID REFERENCES app_user(id) ON DELETE CASCADE,
+  email TEXT NOT NULL,
+  contact_id BIGINT NOT NULL REFERENCES contact(id) ON DELETE CASCADE,
+  created_at TIMESTAMPTZ DEFAULT now(),
+  PRIMARY KEY (user_id, email)
+);
+CREATE INDEX IF NOT EXISTS contact_alias_contact_idx ON contact_alias (contact_id);
+
+-- Set once a row's participants have been counted, so resyncs don't recount.
+ALTER TABLE email ADD COLUMN IF NOT EXISTS contacts_at TIMESTAMPTZ;
+ALTER TABLE meeting ADD COLUMN IF NOT EXISTS contacts_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS email_contacts_pending_idx ON email (user_id) WHERE contacts_at IS NULL;
+CREATE INDEX IF NOT EXISTS meeting_contacts_pending_idx ON meeting (user_id, start_time) WHERE contacts_at IS NULL;
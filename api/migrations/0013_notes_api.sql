@@ -0,0 +1,7 @@
+-- Notes become editable through the REST API. updated_at records edits;
+-- an edited note's embedding is dropped so the indexer re-embeds it.
+ALTER TABLE note ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ DEFAULT now();
+UPDATE note SET updated_at = created_at WHERE updated_at IS DISTINCT FROM created_at;
+
+CREATE INDEX IF NOT EXISTS note_user_created_idx ON note (user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS note_contact_idx ON note (contact_id) WHERE contact_id IS NOT NULL;
@@ -0,0 +1,16 @@
+-- Conversation threads. agent_message.thread_id holds the thread id as text;
+-- messages without one belong to the user's original, unthreaded chat.
+CREATE TABLE IF NOT EXISTS thread (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES app_user(id) ON DELETE CASCADE,
+  title TEXT,
+  archived BOOLEAN NOT NULL DEFAULT false,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_message_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS thread_user_recent_idx
+  ON thread (user_id, archived, (coalesce(last_message_at, created_at)) DESC);
+CREATE INDEX IF NOT EXISTS agent_message_thread_idx
+  ON agent_message (user_id, thread_id, id DESC);
@@ -0,0 +1,4 @@
+-- Scheduling: the user's calendar time zone (learned from Calendar sync) and
+-- the video call link of meetings.
+ALTER TABLE app_user ADD COLUMN IF NOT EXISTS time_zone TEXT;
+ALTER TABLE meeting ADD COLUMN IF NOT EXISTS conference_url TEXT;
@@ -0,0 +1,4 @@
+-- Task retries: failed tasks are the dead-letter list, browsed per user.
+CREATE INDEX IF NOT EXISTS task_failed_idx
+  ON task (user_id, updated_at DESC)
+  WHERE status = 'failed';
@@ -0,0 +1,22 @@
+-- Embeddings of contacts and meetings for semantic search. content_hash is
+-- the md5 of the text that was embedded, so a row whose text changed since
+-- (a renamed contact, an edited event) is embedded again.
+
+CREATE TABLE IF NOT EXISTS contact_embedding (
+  contact_id BIGINT PRIMARY KEY REFERENCES contact(id) ON DELETE CASCADE,
+  model TEXT NOT NULL,
+  content_hash TEXT NOT NULL,
+  embedding vector(1536) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS meeting_embedding (
+  meeting_id BIGINT PRIMARY KEY REFERENCES meeting(id) ON DELETE CASCADE,
+  model TEXT NOT NULL,
+  content_hash TEXT NOT NULL,
+  embedding vector(1536) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS contact_embedding_hnsw ON contact_embedding USING hnsw (embedding vector_cosine_ops);
+CREATE INDEX IF NOT EXISTS meeting_embedding_hnsw ON meeting_embedding USING hnsw (embedding vector_cosine_ops);
@@ -0,0 +1,11 @@
+-- Messages sent with an idempotency key (mailsend.Email.Key), recorded as
+-- soon as Gmail accepts them so a retried send finds the message it already
+-- sent.
+CREATE TABLE IF NOT EXISTS sent_email (
+  user_id UUID NOT NULL REFERENCES app_user(id) ON DELETE CASCADE,
+  send_key TEXT NOT NULL,
+  gmail_message_id TEXT NOT NULL,
+  thread_id TEXT,
+  sent_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (user_id, send_key)
+);
@@ -3,9 +3,28 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"os"
 	"strings"
 	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"aiagentapi/internal/llm"
+	"aiagentapi/internal/when"
+)
+
+// ToolMode selects how tools are offered to the model.
+type ToolMode string
+
+const (
+	// ToolModeNative sends OpenAI-style tool definitions and consumes tool_calls.
+	ToolModeNative ToolMode = "native"
+	// ToolModeText asks the model to reply with a JSON object when it wants a tool.
+	// Kept for models and servers without function calling support.
+	ToolModeText ToolMode = "text"
 )
 
 type Config struct {
@@ -13,20 +32,95 @@ type Config struct {
 	SystemPrompt string
 	MaxTurns     int
 	Tools        Toolset
+	ToolMode     ToolMode
+
+	// Memory, when set, supplies prior thread history and stores new turns.
+	Memory Memory
+	// HistoryLimit caps how many stored messages are loaded per request.
+	HistoryLimit int
+	// HistoryTokens is the token budget for prior history in the prompt.
+	HistoryTokens int
+	// SummarizeHistory condenses turns that fall outside the budget into a
+	// short summary instead of dropping them.
+	SummarizeHistory bool
+	// ContextLimit, when positive, runs SearchContext on the incoming message
+	// and hands the results to the model before the first turn.
+	ContextLimit int
+	// Router, when set, replaces the providers configured from the
+	// environment.
+	Router *llm.Router
+	// Location returns the user's time zone, in which dates the model passes
+	// to calendar tools ("tomorrow at 10") are resolved. Nil means UTC.
+	Location func(ctx context.Context, userID string) *time.Location
+	// Now is the reference time for relative dates; nil means time.Now.
+	Now func() time.Time
+}
+
+// Result is the outcome of answering one message. Sources lists every
+// document shown to the model, numbered in the order it was first cited.
+type Result struct {
+	Reply   string       `json:"reply"`
+	Steps   []ToolStep   `json:"tool_calls"`
+	Sources []ContextDoc `json:"sources"`
+	// MessageID is the id Memory assigned to the stored reply, when it
+	// assigns ids.
+	MessageID int64 `json:"message_id,omitempty"`
+}
+
+// ToolStep records one tool invocation made while answering.
+type ToolStep struct {
+	ID     string          `json:"id,omitempty"`
+	Tool   string          `json:"tool"`
+	Args   json.RawMessage `json:"args"`
+	Output string          `json:"output"`
 }
 
 func DefaultSystemPrompt() string {
 	return strings.TrimSpace(`You are a helpful AI assistant for a financial advisor.
 You can answer questions about the user's clients using email and calendar data.
-When you need data, you can call tools by returning JSON: {"tool":"name","args":{...}}.
-Tools available: search_context, gmail_send, calendar_find_slots, calendar_create_event.
+Use the available tools when you need data or need to act (search_context, gmail_send, calendar_find_slots, calendar_create_event, schedule_meeting).
+Context documents are numbered; when you use one, cite it inline as [n].
 If no tool is needed, just answer.`)
 }
 
+const textToolInstructions = `When you need data, you can call a tool by replying with only a JSON object: {"tool":"name","args":{...}}.
+Tools available: search_context, gmail_send, calendar_find_slots, calendar_create_event, schedule_meeting.`
+
+const maxTurnsReply = "I reached the maximum steps. If you want me to continue, please ask again."
+
 func New(cfg Config) *Agent {
-	if cfg.MaxTurns == 0 { cfg.MaxTurns = 4 }
-	if cfg.Tools == nil { cfg.Tools = DefaultToolset{} }
-	return &Agent{cfg: cfg, llm: NewLLM()}
+	if cfg.MaxTurns == 0 {
+		cfg.MaxTurns = 4
+	}
+	if cfg.Tools == nil {
+		cfg.Tools = DefaultToolset{}
+	}
+	if cfg.SystemPrompt == "" {
+		cfg.SystemPrompt = DefaultSystemPrompt()
+	}
+	if cfg.HistoryLimit == 0 {
+		cfg.HistoryLimit = 40
+	}
+	if cfg.HistoryTokens == 0 {
+		cfg.HistoryTokens = 3000
+	}
+	if cfg.ToolMode == "" {
+		cfg.ToolMode = ToolMode(strings.ToLower(strings.TrimSpace(os.Getenv("AGENT_TOOL_MODE"))))
+	}
+	if cfg.ToolMode != ToolModeText {
+		cfg.ToolMode = ToolModeNative
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	l := NewLLM()
+	if cfg.Router != nil {
+		l.router = cfg.Router
+	}
+	if cfg.Model != "" {
+		l.router = l.router.WithModel(llm.Chat, cfg.Model)
+	}
+	return &Agent{cfg: cfg, llm: l}
 }
 
 type Agent struct {
@@ -39,58 +133,500 @@ type toolCall struct {
 	Args map[string]interface{} `json:"args"`
 }
 
-func (a *Agent) Handle(ctx context.Context, userID string, message string) (string, string, error) {
-	turns := 0
-	trace := &strings.Builder{}
-	for {
-		turns++
-		if turns > a.cfg.MaxTurns {
-			return "I reached the maximum steps. If you want me to continue, please ask again.", trace.String(), nil
+// Handle answers a message in the user's default (unthreaded) conversation.
+func (a *Agent) Handle(ctx context.Context, userID string, message string) (*Result, error) {
+	return a.HandleThread(ctx, userID, "", message)
+}
+
+// HandleThread answers a message within a thread. The prompt is the system
+// prompt, the thread's recent history fitted to the token budget and the new
+// message; the exchange is appended to Memory when one is configured. The user
+// message is stored first, even without a configured provider, and failing to
+// store it returns ErrSaveMessage. A failed exchange keeps only the user
+// message so stored threads stay replayable.
+func (a *Agent) HandleThread(ctx context.Context, userID, threadID, message string) (*Result, error) {
+	return a.handle(ctx, userID, threadID, message, nil)
+}
+
+// HandleThreadStream is HandleThread with progress reported to emit as it
+// happens: reply tokens as the model produces them, tool calls as they start
+// and finish, and context documents as they are retrieved. emit is called
+// from the calling goroutine. Cancelling ctx aborts the model request and any
+// running tool.
+func (a *Agent) HandleThreadStream(ctx context.Context, userID, threadID, message string, emit func(Event)) (*Result, error) {
+	return a.handle(ctx, userID, threadID, message, emit)
+}
+
+func (a *Agent) handle(ctx context.Context, userID, threadID, message string, emit func(Event)) (*Result, error) {
+	// History is loaded before the user message is stored so it isn't
+	// repeated in the prompt.
+	past := a.history(ctx, userID, threadID)
+	user := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: message}
+	if _, err := a.remember(ctx, userID, threadID, user); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSaveMessage, err)
+	}
+	if !a.llm.Configured() {
+		return nil, ErrNotConfigured
+	}
+	res := &Result{}
+	msgs := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: a.systemPrompt(ctx, userID)}}
+	msgs = append(msgs, past...)
+	if a.cfg.ContextLimit > 0 {
+		if docs := res.cite(a.prefetch(ctx, userID, message)); len(docs) > 0 {
+			emitSources(emit, docs)
+			msgs = append(msgs, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: contextPrompt(docs)})
 		}
-		reply, err := a.llm.Complete(ctx, a.cfg.SystemPrompt, message+`\n\nIf calling a tool, respond with only a JSON object: {"tool":"...","args":{...}}. Otherwise, reply normally.`)
-		if err != nil { return "", trace.String(), err }
+	}
+	msgs = append(msgs, user)
 
-		var call toolCall
-		if json.Unmarshal([]byte(reply), &call) == nil && call.Tool != "" {
-			out, err := a.execTool(ctx, userID, call)
-			if err != nil { return "", trace.String(), err }
-			fmt.Fprintf(trace, "→ tool:%s args:%v\n← %s\n", call.Tool, call.Args, out)
-			message = fmt.Sprintf("Tool result:\n%s\n\nPlease continue.", out)
+	var (
+		turn []openai.ChatCompletionMessage
+		err  error
+	)
+	if a.cfg.ToolMode == ToolModeText {
+		err = a.handleText(ctx, userID, msgs, res, emit)
+		turn = []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleAssistant, Content: res.Reply}}
+		if err == nil && emit != nil {
+			// Text-mode replies may be tool calls, so they are only shown once final.
+			emit(Event{Type: EventToken, Text: res.Reply})
+		}
+	} else {
+		turn, err = a.handleNative(ctx, userID, msgs, res, emit)
+	}
+	if err != nil {
+		return res, err
+	}
+	res.markCited()
+	ids, err := a.remember(ctx, userID, threadID, turn...)
+	if err != nil {
+		log.Printf("[agent] save reply: %v", err)
+	} else if len(ids) == len(turn) && len(ids) > 0 {
+		res.MessageID = ids[len(ids)-1]
+	}
+	return res, nil
+}
+
+// prefetch looks up context for the message up front so small models that
+// rarely call search_context still see relevant snippets.
+func (a *Agent) prefetch(ctx context.Context, userID, message string) []ContextDoc {
+	docs, err := a.cfg.Tools.SearchContext(ctx, userID, message, a.cfg.ContextLimit)
+	if err != nil {
+		log.Printf("[agent] prefetch context: %v", err)
+		return nil
+	}
+	return docs
+}
+
+func contextPrompt(docs []ContextDoc) string {
+	var b strings.Builder
+	b.WriteString("Context documents that may be relevant to the next message (cite as [n]):\n")
+	for _, d := range docs {
+		fmt.Fprintf(&b, "[%d] (%s", d.Ref, d.Kind)
+		if !d.When.IsZero() {
+			fmt.Fprintf(&b, ", %s", d.When.Format("2006-01-02"))
+		}
+		fmt.Fprintf(&b, ") %s\n", truncate(d.Snippet, 400))
+	}
+	return b.String()
+}
+
+// systemPrompt is the configured prompt plus the current time in the user's
+// time zone, so the model can tell what "tomorrow" means.
+func (a *Agent) systemPrompt(ctx context.Context, userID string) string {
+	now, loc := a.clock(ctx, userID)
+	prompt := a.cfg.SystemPrompt + "\n" + fmt.Sprintf("The current time is %s (%s).", now.Format("Monday 2 January 2006 15:04 MST"), loc)
+	if a.cfg.ToolMode == ToolModeText {
+		return prompt + "\n" + textToolInstructions
+	}
+	return prompt
+}
+
+// clock returns the reference time for date arguments, in the user's time
+// zone.
+func (a *Agent) clock(ctx context.Context, userID string) (time.Time, *time.Location) {
+	loc := time.UTC
+	if a.cfg.Location != nil {
+		if l := a.cfg.Location(ctx, userID); l != nil {
+			loc = l
+		}
+	}
+	return a.cfg.Now().In(loc), loc
+}
+
+// history loads the thread from Memory and fits it to the token budget.
+// Failing to load history degrades to a fresh conversation.
+func (a *Agent) history(ctx context.Context, userID, threadID string) []openai.ChatCompletionMessage {
+	if a.cfg.Memory == nil {
+		return nil
+	}
+	past, err := a.cfg.Memory.Load(ctx, userID, threadID, a.cfg.HistoryLimit)
+	if err != nil {
+		log.Printf("[agent] load history: %v", err)
+		return nil
+	}
+	if a.cfg.ToolMode == ToolModeText {
+		past = textOnly(past)
+	}
+	kept, dropped := fitWindow(past, a.cfg.HistoryTokens)
+	if len(dropped) == 0 || !a.cfg.SummarizeHistory || !a.llm.Configured() {
+		return kept
+	}
+	summary, err := a.summarize(ctx, dropped)
+	if err != nil {
+		log.Printf("[agent] summarize history: %v", err)
+		return kept
+	}
+	return append([]openai.ChatCompletionMessage{summary}, kept...)
+}
+
+// remember appends msgs to Memory and returns their ids when the memory
+// assigns them.
+func (a *Agent) remember(ctx context.Context, userID, threadID string, msgs ...openai.ChatCompletionMessage) ([]int64, error) {
+	if a.cfg.Memory == nil || len(msgs) == 0 {
+		return nil, nil
+	}
+	if m, ok := a.cfg.Memory.(messageIDs); ok {
+		return m.AppendIDs(ctx, userID, threadID, msgs...)
+	}
+	return nil, a.cfg.Memory.Append(ctx, userID, threadID, msgs...)
+}
+
+// textOnly drops tool traffic from history for models that cannot read it.
+func textOnly(msgs []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	out := make([]openai.ChatCompletionMessage, 0, len(msgs))
+	for _, m := range msgs {
+		if m.Role == openai.ChatMessageRoleTool || len(m.ToolCalls) > 0 {
 			continue
 		}
-		return reply, trace.String(), nil
+		out = append(out, m)
 	}
+	return out
 }
 
-func (a *Agent) execTool(ctx context.Context, userID string, call toolCall) (string, error) {
+// handleNative runs the loop with function calling: every tool call in a turn is
+// executed and answered with a tool message carrying the matching tool_call_id.
+// It returns the messages produced in this exchange after the user message.
+func (a *Agent) handleNative(ctx context.Context, userID string, msgs []openai.ChatCompletionMessage, res *Result, emit func(Event)) ([]openai.ChatCompletionMessage, error) {
+	start := len(msgs)
+	tools := toolDefinitions()
+	for turn := 1; turn <= a.cfg.MaxTurns; turn++ {
+		reply, err := a.chat(ctx, msgs, tools, emit)
+		if err != nil {
+			return nil, err
+		}
+		if len(reply.ToolCalls) == 0 {
+			res.Reply = reply.Content
+			msgs = append(msgs, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: reply.Content})
+			return msgs[start:], nil
+		}
+
+		for i := range reply.ToolCalls {
+			if reply.ToolCalls[i].ID == "" {
+				reply.ToolCalls[i].ID = fmt.Sprintf("call_%d_%d", turn, i)
+			}
+		}
+		msgs = append(msgs, reply)
+		for _, tc := range reply.ToolCalls {
+			step := ToolStep{ID: tc.ID, Tool: tc.Function.Name, Args: rawArgs(tc.Function.Arguments)}
+			emitTool(emit, EventToolStart, step, nil)
+			out, err := a.runToolCall(ctx, userID, tc, res, emit)
+			step.Output = out
+			emitTool(emit, EventToolEnd, step, err)
+			if err != nil {
+				return nil, err
+			}
+			res.Steps = append(res.Steps, step)
+			msgs = append(msgs, toolMessage(tc, out))
+		}
+	}
+	if emit != nil {
+		emit(Event{Type: EventToken, Text: maxTurnsReply})
+	}
+	res.Reply = maxTurnsReply
+	msgs = append(msgs, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: maxTurnsReply})
+	return msgs[start:], nil
+}
+
+// rawArgs keeps valid JSON arguments as-is for the trace and quotes anything else.
+func rawArgs(s string) json.RawMessage {
+	if json.Valid([]byte(s)) {
+		return json.RawMessage(s)
+	}
+	b, _ := json.Marshal(s)
+	return b
+}
+
+func toolMessage(tc openai.ToolCall, content string) openai.ChatCompletionMessage {
+	return openai.ChatCompletionMessage{
+		Role:       openai.ChatMessageRoleTool,
+		Content:    content,
+		Name:       tc.Function.Name,
+		ToolCallID: tc.ID,
+	}
+}
+
+// runToolCall decodes the arguments of a native tool call and executes it.
+// Malformed arguments are reported back to the model rather than aborting the loop.
+func (a *Agent) runToolCall(ctx context.Context, userID string, tc openai.ToolCall, res *Result, emit func(Event)) (string, error) {
+	args := map[string]interface{}{}
+	if raw := strings.TrimSpace(tc.Function.Arguments); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &args); err != nil {
+			return fmt.Sprintf("error: invalid arguments for %s: %v", tc.Function.Name, err), nil
+		}
+	}
+	return a.execTool(ctx, userID, toolCall{Tool: tc.Function.Name, Args: args}, res, emit)
+}
+
+// handleText is the fallback loop for models without tool support: the model is
+// asked to answer with a bare JSON object and the reply is scanned for one.
+// Tool results are fed back as user messages within the same exchange.
+func (a *Agent) handleText(ctx context.Context, userID string, msgs []openai.ChatCompletionMessage, res *Result, emit func(Event)) error {
+	hint := openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: `If calling a tool, respond with only a JSON object: {"tool":"...","args":{...}}. Otherwise, reply normally.`,
+	}
+	for turn := 1; turn <= a.cfg.MaxTurns; turn++ {
+		reply, err := a.llm.Chat(ctx, append(msgs, hint), nil)
+		if err != nil {
+			return err
+		}
+
+		call, ok := parseTextToolCall(reply.Content)
+		if !ok {
+			res.Reply = reply.Content
+			return nil
+		}
+		args, _ := json.Marshal(call.Args)
+		step := ToolStep{Tool: call.Tool, Args: args}
+		emitTool(emit, EventToolStart, step, nil)
+		out, err := a.execTool(ctx, userID, call, res, emit)
+		step.Output = out
+		emitTool(emit, EventToolEnd, step, err)
+		if err != nil {
+			return err
+		}
+		res.Steps = append(res.Steps, step)
+		msgs = append(msgs,
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: reply.Content},
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: fmt.Sprintf("Tool result (%s):\n%s\n\nPlease continue.", call.Tool, out)},
+		)
+	}
+	res.Reply = maxTurnsReply
+	return nil
+}
+
+// parseTextToolCall finds a {"tool":...} object in a reply, tolerating code
+// fences and surrounding prose.
+func parseTextToolCall(reply string) (toolCall, bool) {
+	var call toolCall
+	s := strings.TrimSpace(reply)
+	if json.Unmarshal([]byte(s), &call) == nil && call.Tool != "" {
+		return call, true
+	}
+	for start := strings.IndexByte(s, '{'); start >= 0; {
+		dec := json.NewDecoder(strings.NewReader(s[start:]))
+		call = toolCall{}
+		if dec.Decode(&call) == nil && call.Tool != "" {
+			return call, true
+		}
+		next := strings.IndexByte(s[start+1:], '{')
+		if next < 0 {
+			break
+		}
+		start += next + 1
+	}
+	return toolCall{}, false
+}
+
+// execTool runs one tool call. A failing tool (a bad address, a calendar
+// Google refused, a search error) is reported to the model as "error: ..."
+// output so it can correct the call or explain; only a cancelled request
+// ends the exchange.
+func (a *Agent) execTool(ctx context.Context, userID string, call toolCall, res *Result, emit func(Event)) (string, error) {
+	out, err := a.runTool(ctx, userID, call, res, emit)
+	if err == nil {
+		return out, nil
+	}
+	if ctx.Err() != nil {
+		return "", err
+	}
+	msg := err.Error()
+	if !strings.HasPrefix(msg, call.Tool+":") {
+		msg = call.Tool + ": " + msg
+	}
+	return "error: " + msg, nil
+}
+
+func (a *Agent) runTool(ctx context.Context, userID string, call toolCall, res *Result, emit func(Event)) (string, error) {
 	switch call.Tool {
 	case "search_context":
 		q, _ := call.Args["query"].(string)
 		limit := 6
-		if v, ok := call.Args["limit"].(float64); ok && v > 0 { limit = int(v) }
+		if v, ok := call.Args["limit"].(float64); ok && v > 0 {
+			limit = int(v)
+		}
 		docs, err := a.cfg.Tools.SearchContext(ctx, userID, q, limit)
-		if err != nil { return "", err }
+		if err != nil {
+			return "", err
+		}
+		docs = res.cite(docs)
+		emitSources(emit, docs)
 		b, _ := json.MarshalIndent(docs, "", "  ")
 		return string(b), nil
 	case "gmail_send":
-		to, _ := call.Args["to"].(string)
-		subject, _ := call.Args["subject"].(string)
-		text, _ := call.Args["text"].(string)
-		err := a.cfg.Tools.SendEmail(ctx, userID, to, subject, text); return "sent", err
+		var email Email
+		email.To, _ = call.Args["to"].(string)
+		email.Cc, _ = call.Args["cc"].(string)
+		email.Bcc, _ = call.Args["bcc"].(string)
+		email.Subject, _ = call.Args["subject"].(string)
+		email.Text, _ = call.Args["text"].(string)
+		email.ThreadID, _ = call.Args["thread_id"].(string)
+		err := a.cfg.Tools.SendEmail(ctx, userID, email)
+		return "sent", err
 	case "calendar_find_slots":
-		now := time.Now()
-		slots, err := a.cfg.Tools.FindSlots(ctx, userID, now, now.AddDate(0,0,7), nil)
-		if err != nil { return "", err }
+		req := SlotRequest{
+			Duration:  argMinutes(call.Args, "duration_minutes"),
+			Attendees: argStrings(call.Args, "attendees"),
+		}
+		if err := a.slotWindow(ctx, userID, call.Args, &req); err != nil {
+			return fmt.Sprintf("error: calendar_find_slots: %v", err), nil
+		}
+		slots, err := a.cfg.Tools.FindSlots(ctx, userID, req)
+		if err != nil {
+			return "", err
+		}
 		b, _ := json.MarshalIndent(slots, "", "  ")
 		return string(b), nil
 	case "calendar_create_event":
-		title, _ := call.Args["title"].(string)
-		whenStr, _ := call.Args["when"].(string)
-		desc, _ := call.Args["description"].(string)
-		when, _ := time.Parse(time.RFC3339, whenStr)
-		id, err := a.cfg.Tools.CreateEvent(ctx, userID, title, when, nil, desc)
-		if err != nil { return "", err }
-		return id, nil
-	}
-	return "", fmt.Errorf("unknown tool %q", call.Tool)
+		ev := EventRequest{
+			Duration:  argMinutes(call.Args, "duration_minutes"),
+			Attendees: argStrings(call.Args, "attendees"),
+		}
+		ev.Title, _ = call.Args["title"].(string)
+		ev.Description, _ = call.Args["description"].(string)
+		ev.Conference, _ = call.Args["conference"].(bool)
+		start, err := a.eventStart(ctx, userID, call.Args)
+		if err != nil {
+			return fmt.Sprintf("error: calendar_create_event: %v", err), nil
+		}
+		ev.Start = start
+		return a.cfg.Tools.CreateEvent(ctx, userID, ev)
+	case "schedule_meeting":
+		req := MeetingRequest{Duration: argMinutes(call.Args, "duration_minutes")}
+		req.Contact, _ = call.Args["contact"].(string)
+		req.Title, _ = call.Args["title"].(string)
+		req.Message, _ = call.Args["message"].(string)
+		req.Conference, _ = call.Args["conference"].(bool)
+		if strings.TrimSpace(req.Contact) == "" {
+			return "error: schedule_meeting: contact is required", nil
+		}
+		var window SlotRequest
+		if err := a.slotWindow(ctx, userID, call.Args, &window); err != nil {
+			return fmt.Sprintf("error: schedule_meeting: %v", err), nil
+		}
+		req.From, req.To = window.From, window.To
+		return a.cfg.Tools.ScheduleMeeting(ctx, userID, req)
+	}
+	return fmt.Sprintf("error: unknown tool %q", call.Tool), nil
+}
+
+// slotWindow sets the search window of a calendar_find_slots or
+// schedule_meeting call from its "when" period ("next week", "tomorrow afternoon") or its "from" and "to"
+// bounds. Errors are meant for the model.
+func (a *Agent) slotWindow(ctx context.Context, userID string, args map[string]interface{}, req *SlotRequest) error {
+	now, loc := a.clock(ctx, userID)
+	if r, ok, err := argWhen(args, "when", now, loc); err != nil {
+		return err
+	} else if ok {
+		req.From, req.To = r.Start, r.End
+		if r.HasTime {
+			// A moment starts the search, which runs to the end of that day.
+			d := r.Start
+			req.To = time.Date(d.Year(), d.Month(), d.Day()+1, 0, 0, 0, 0, loc)
+		}
+	}
+	if r, ok, err := argWhen(args, "from", now, loc); err != nil {
+		return err
+	} else if ok {
+		req.From = r.Start
+	}
+	if r, ok, err := argWhen(args, "to", now, loc); err != nil {
+		return err
+	} else if ok {
+		req.To = r.End
+		if r.HasTime {
+			req.To = r.Start
+		}
+	}
+	if !req.To.IsZero() && !req.To.After(now) {
+		return fmt.Errorf("the period ends %s, which is in the past", req.To.Format(time.RFC3339))
+	}
+	if !req.From.IsZero() && !req.To.IsZero() && !req.To.After(req.From) {
+		return errors.New("the period ends before it starts")
+	}
+	return nil
+}
+
+// eventStart resolves the "when" of a calendar_create_event call, which must
+// name a time of day in the future. Errors are meant for the model.
+func (a *Agent) eventStart(ctx context.Context, userID string, args map[string]interface{}) (time.Time, error) {
+	now, loc := a.clock(ctx, userID)
+	r, ok, err := argWhen(args, "when", now, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !ok {
+		return time.Time{}, errors.New(`"when" is required`)
+	}
+	if !r.HasTime {
+		w, _ := args["when"].(string)
+		return time.Time{}, fmt.Errorf("%q names a day but no start time; give one such as \"%s at 10am\" or use a slot from calendar_find_slots", w, w)
+	}
+	if !r.Start.After(now) {
+		return time.Time{}, fmt.Errorf("%s is in the past; it is now %s", r.Start.Format(time.RFC3339), now.Format(time.RFC3339))
+	}
+	return r.Start, nil
+}
+
+// argWhen resolves a date argument with package when. ok is false when the
+// argument is missing or empty.
+func argWhen(args map[string]interface{}, key string, now time.Time, loc *time.Location) (when.Range, bool, error) {
+	s, _ := args[key].(string)
+	if strings.TrimSpace(s) == "" {
+		return when.Range{}, false, nil
+	}
+	r, err := when.Resolve(s, now, loc)
+	if err != nil {
+		return when.Range{}, false, fmt.Errorf("%s: %w", key, err)
+	}
+	return r, true, nil
+}
+
+func argMinutes(args map[string]interface{}, key string) time.Duration {
+	v, _ := args[key].(float64)
+	if v <= 0 {
+		return 0
+	}
+	return time.Duration(v) * time.Minute
+}
+
+// argStrings reads a list argument given either as a JSON array or as a
+// comma-separated string.
+func argStrings(args map[string]interface{}, key string) []string {
+	var out []string
+	switch v := args[key].(type) {
+	case []interface{}:
+		for _, x := range v {
+			if s, ok := x.(string); ok && strings.TrimSpace(s) != "" {
+				out = append(out, strings.TrimSpace(s))
+			}
+		}
+	case string:
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
 }
@@ -0,0 +1,507 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"aiagentapi/internal/llm"
+	"aiagentapi/internal/llm/llmtest"
+)
+
+type fakeTools struct {
+	docs     []ContextDoc
+	err      error
+	sent     []string
+	booked   []EventRequest
+	searched []SlotRequest
+	meetings []MeetingRequest
+	// cancel, when set, is called by SendEmail before it fails.
+	cancel func()
+}
+
+func (f *fakeTools) SearchContext(ctx context.Context, userID, query string, limit int) ([]ContextDoc, error) {
+	return append([]ContextDoc(nil), f.docs...), f.err
+}
+
+func (f *fakeTools) SendEmail(ctx context.Context, userID string, email Email) error {
+	if f.cancel != nil {
+		f.cancel()
+	}
+	if f.err != nil {
+		return f.err
+	}
+	f.sent = append(f.sent, email.To+"|"+email.Subject+"|"+email.Text)
+	return nil
+}
+
+func (f *fakeTools) FindSlots(ctx context.Context, userID string, req SlotRequest) ([]TimeSlot, error) {
+	f.searched = append(f.searched, req)
+	return []TimeSlot{{Start: req.From, End: req.From.Add(30 * time.Minute)}}, f.err
+}
+
+func (f *fakeTools) CreateEvent(ctx context.Context, userID string, event EventRequest) (string, error) {
+	f.booked = append(f.booked, event)
+	return "evt_1", f.err
+}
+
+func (f *fakeTools) ScheduleMeeting(ctx context.Context, userID string, req MeetingRequest) (string, error) {
+	f.meetings = append(f.meetings, req)
+	return "proposing times to " + req.Contact, f.err
+}
+
+type fakeMemory struct {
+	msgs []openai.ChatCompletionMessage
+	err  error // returned by Append
+}
+
+func (m *fakeMemory) Load(ctx context.Context, userID, threadID string, limit int) ([]openai.ChatCompletionMessage, error) {
+	return m.msgs, nil
+}
+
+func (m *fakeMemory) Append(ctx context.Context, userID, threadID string, msgs ...openai.ChatCompletionMessage) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.msgs = append(m.msgs, msgs...)
+	return nil
+}
+
+func TestHandle(t *testing.T) {
+	doc := ContextDoc{Kind: "email", Snippet: "Alice asked to sell her AAPL shares.", Source: "email:1"}
+
+	tests := []struct {
+		name      string
+		script    func(s *llmtest.Server)
+		tools     *fakeTools
+		maxTurns  int
+		toolMode  ToolMode
+		wantReply string
+		wantSteps []string
+		wantErr   string
+		check     func(t *testing.T, s *llmtest.Server, res *Result, tools *fakeTools)
+	}{
+		{
+			name:      "plain reply",
+			script:    func(s *llmtest.Server) { s.On(llmtest.Any, llmtest.Text("Hello there.")) },
+			wantReply: "Hello there.",
+		},
+		{
+			name: "tool result fed back and cited",
+			script: func(s *llmtest.Server) {
+				s.On(llmtest.AfterTool("search_context"), llmtest.Text("Alice wants to sell AAPL [1]."))
+				s.On(llmtest.Any, llmtest.Call("search_context", `{"query":"AAPL"}`))
+			},
+			tools:     &fakeTools{docs: []ContextDoc{doc}},
+			wantReply: "Alice wants to sell AAPL [1].",
+			wantSteps: []string{"search_context"},
+			check: func(t *testing.T, s *llmtest.Server, res *Result, _ *fakeTools) {
+				reqs := s.Requests()
+				if len(reqs) != 2 {
+					t.Fatalf("got %d requests, want 2", len(reqs))
+				}
+				last := reqs[1].Messages[len(reqs[1].Messages)-1]
+				if last.Role != openai.ChatMessageRoleTool || last.ToolCallID != "call_search_context" {
+					t.Errorf("tool result message = %+v", last)
+				}
+				if !strings.Contains(last.Content, "AAPL shares") {
+					t.Errorf("tool result %q does not carry the document", last.Content)
+				}
+				if len(res.Sources) != 1 || !res.Sources[0].Cited || res.Sources[0].Ref != 1 {
+					t.Errorf("sources = %+v, want one cited [1]", res.Sources)
+				}
+			},
+		},
+		{
+			name: "email arguments reach the toolset",
+			script: func(s *llmtest.Server) {
+				s.On(llmtest.AfterTool("gmail_send"), llmtest.Text("Sent."))
+				s.On(llmtest.Any, llmtest.Call("gmail_send", `{"to":"alice@example.com","subject":"Hi","text":"See you soon"}`))
+			},
+			tools:     &fakeTools{},
+			wantReply: "Sent.",
+			wantSteps: []string{"gmail_send"},
+			check: func(t *testing.T, _ *llmtest.Server, _ *Result, tools *fakeTools) {
+				if len(tools.sent) != 1 || tools.sent[0] != "alice@example.com|Hi|See you soon" {
+					t.Errorf("sent = %q", tools.sent)
+				}
+			},
+		},
+		{
+			name: "event arguments reach the toolset",
+			script: func(s *llmtest.Server) {
+				s.On(llmtest.AfterTool("calendar_create_event"), llmtest.Text("Booked."))
+				s.On(llmtest.Any, llmtest.Call("calendar_create_event",
+					`{"title":"Review","when":"2030-03-04T10:00:00+01:00","duration_minutes":45,"attendees":["alice@example.com"],"conference":true}`))
+			},
+			tools:     &fakeTools{},
+			wantReply: "Booked.",
+			wantSteps: []string{"calendar_create_event"},
+			check: func(t *testing.T, _ *llmtest.Server, res *Result, tools *fakeTools) {
+				if len(tools.booked) != 1 {
+					t.Fatalf("booked %d events", len(tools.booked))
+				}
+				ev := tools.booked[0]
+				if ev.Title != "Review" || ev.Start.UTC().Hour() != 9 || ev.Duration != 45*time.Minute ||
+					len(ev.Attendees) != 1 || !ev.Conference {
+					t.Errorf("event = %+v", ev)
+				}
+				if res.Steps[0].Output != "evt_1" {
+					t.Errorf("output = %q, want the event id", res.Steps[0].Output)
+				}
+			},
+		},
+		{
+			name: "malformed arguments reported to the model",
+			script: func(s *llmtest.Server) {
+				s.On(llmtest.AfterTool("search_context"), llmtest.Text("Sorry, let me retry later."))
+				s.On(llmtest.Any, llmtest.Call("search_context", `{"query":`))
+			},
+			wantReply: "Sorry, let me retry later.",
+			wantSteps: []string{"search_context"},
+			check: func(t *testing.T, _ *llmtest.Server, res *Result, _ *fakeTools) {
+				if !strings.HasPrefix(res.Steps[0].Output, "error: invalid arguments") {
+					t.Errorf("output = %q", res.Steps[0].Output)
+				}
+			},
+		},
+		{
+			name:      "max turns cut off",
+			script:    func(s *llmtest.Server) { s.On(llmtest.Any, llmtest.Call("calendar_find_slots", `{}`)) },
+			maxTurns:  2,
+			wantReply: maxTurnsReply,
+			wantSteps: []string{"calendar_find_slots", "calendar_find_slots"},
+			check: func(t *testing.T, s *llmtest.Server, _ *Result, _ *fakeTools) {
+				if n := len(s.Requests()); n != 2 {
+					t.Errorf("got %d requests, want 2", n)
+				}
+			},
+		},
+		{
+			name: "text mode tool call",
+			script: func(s *llmtest.Server) {
+				s.On(llmtest.LastUser("Tool result (search_context)"), llmtest.Text("Found it [1]."))
+				s.On(llmtest.Any, llmtest.Text("```json\n{\"tool\":\"search_context\",\"args\":{\"query\":\"AAPL\"}}\n```"))
+			},
+			tools:     &fakeTools{docs: []ContextDoc{doc}},
+			toolMode:  ToolModeText,
+			wantReply: "Found it [1].",
+			wantSteps: []string{"search_context"},
+		},
+		{
+			name: "provider error",
+			script: func(s *llmtest.Server) {
+				s.On(llmtest.Any, llmtest.Fail(http.StatusInternalServerError, "model overloaded"))
+			},
+			wantErr: "model overloaded",
+		},
+		{
+			name: "tool error goes to the model",
+			script: func(s *llmtest.Server) {
+				s.On(llmtest.AfterTool("gmail_send"), llmtest.Text("Which address should I use?"))
+				s.On(llmtest.Any, llmtest.Call("gmail_send", `{"to":"alice","subject":"x","text":"y"}`))
+			},
+			tools:     &fakeTools{err: errors.New(`gmail_send: mail: missing '@' or angle-addr`)},
+			wantReply: "Which address should I use?",
+			wantSteps: []string{"gmail_send"},
+			check: func(t *testing.T, _ *llmtest.Server, res *Result, _ *fakeTools) {
+				if out := res.Steps[0].Output; out != `error: gmail_send: mail: missing '@' or angle-addr` {
+					t.Errorf("output = %q", out)
+				}
+			},
+		},
+		{
+			name: "search error named after the tool",
+			script: func(s *llmtest.Server) {
+				s.On(llmtest.AfterTool("search_context"), llmtest.Text("Search is down."))
+				s.On(llmtest.Any, llmtest.Call("search_context", `{"query":"AAPL"}`))
+			},
+			tools:     &fakeTools{err: errors.New("keyword search: connection reset")},
+			wantReply: "Search is down.",
+			wantSteps: []string{"search_context"},
+			check: func(t *testing.T, _ *llmtest.Server, res *Result, _ *fakeTools) {
+				if out := res.Steps[0].Output; out != "error: search_context: keyword search: connection reset" {
+					t.Errorf("output = %q", out)
+				}
+			},
+		},
+		{
+			name: "calendar error goes to the model",
+			script: func(s *llmtest.Server) {
+				s.On(llmtest.AfterTool("calendar_create_event"), llmtest.Text("Please reconnect Google Calendar."))
+				s.On(llmtest.Any, llmtest.Call("calendar_create_event", `{"title":"Review","when":"2099-03-05T15:00:00Z"}`))
+			},
+			tools:     &fakeTools{err: errors.New("calendar_create_event: no refresh token")},
+			wantReply: "Please reconnect Google Calendar.",
+			wantSteps: []string{"calendar_create_event"},
+			check: func(t *testing.T, _ *llmtest.Server, res *Result, _ *fakeTools) {
+				if out := res.Steps[0].Output; out != "error: calendar_create_event: no refresh token" {
+					t.Errorf("output = %q", out)
+				}
+			},
+		},
+		{
+			name: "unknown tool reported to the model",
+			script: func(s *llmtest.Server) {
+				s.On(llmtest.AfterTool("delete_everything"), llmtest.Text("I can't do that."))
+				s.On(llmtest.Any, llmtest.Call("delete_everything", `{}`))
+			},
+			wantReply: "I can't do that.",
+			wantSteps: []string{"delete_everything"},
+			check: func(t *testing.T, _ *llmtest.Server, res *Result, _ *fakeTools) {
+				if out := res.Steps[0].Output; out != `error: unknown tool "delete_everything"` {
+					t.Errorf("output = %q", out)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := llmtest.New(t)
+			tt.script(srv)
+			tools := tt.tools
+			if tools == nil {
+				tools = &fakeTools{}
+			}
+			mode := tt.toolMode
+			if mode == "" {
+				mode = ToolModeNative
+			}
+			a := New(Config{Router: srv.Router(), Tools: tools, MaxTurns: tt.maxTurns, ToolMode: mode})
+
+			res, err := a.Handle(context.Background(), "user-1", "What did Alice say about AAPL?")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Handle: %v", err)
+			}
+			if res.Reply != tt.wantReply {
+				t.Errorf("reply = %q, want %q", res.Reply, tt.wantReply)
+			}
+			var steps []string
+			for _, s := range res.Steps {
+				steps = append(steps, s.Tool)
+			}
+			if strings.Join(steps, ",") != strings.Join(tt.wantSteps, ",") {
+				t.Errorf("steps = %v, want %v", steps, tt.wantSteps)
+			}
+			if tt.check != nil {
+				tt.check(t, srv, res, tools)
+			}
+		})
+	}
+}
+
+func TestDateArguments(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	// Monday 4 March 2030, 09:00 in New York.
+	now := time.Date(2030, 3, 4, 14, 0, 0, 0, time.UTC)
+	newAgent := func(srv *llmtest.Server, tools *fakeTools) *Agent {
+		return New(Config{
+			Router:   srv.Router(),
+			Tools:    tools,
+			Location: func(context.Context, string) *time.Location { return ny },
+			Now:      func() time.Time { return now },
+		})
+	}
+
+	t.Run("natural language event time", func(t *testing.T) {
+		srv := llmtest.New(t)
+		srv.On(llmtest.AfterTool("calendar_create_event"), llmtest.Text("Booked."))
+		srv.On(llmtest.Any, llmtest.Call("calendar_create_event", `{"title":"Review","when":"tomorrow at 3pm"}`))
+		tools := &fakeTools{}
+		if _, err := newAgent(srv, tools).Handle(context.Background(), "user-1", "Book a review tomorrow at 3"); err != nil {
+			t.Fatal(err)
+		}
+		if len(tools.booked) != 1 || !tools.booked[0].Start.Equal(time.Date(2030, 3, 5, 15, 0, 0, 0, ny)) {
+			t.Errorf("booked = %+v", tools.booked)
+		}
+		if sys := srv.Requests()[0].Messages[0].Content; !strings.Contains(sys, "Monday 4 March 2030 09:00 EST (America/New_York)") {
+			t.Errorf("system prompt lacks the current time: %q", sys)
+		}
+	})
+
+	t.Run("invalid times are reported to the model", func(t *testing.T) {
+		for _, when := range []string{"next week", "whenever", "2030-03-01T10:00:00Z"} {
+			srv := llmtest.New(t)
+			srv.On(llmtest.AfterTool("calendar_create_event"), llmtest.Text("Which day?"))
+			srv.On(llmtest.Any, llmtest.Call("calendar_create_event", `{"title":"Review","when":"`+when+`"}`))
+			tools := &fakeTools{}
+			res, err := newAgent(srv, tools).Handle(context.Background(), "user-1", "Book a review")
+			if err != nil {
+				t.Fatalf("%s: %v", when, err)
+			}
+			if len(tools.booked) != 0 {
+				t.Errorf("%s: booked %+v", when, tools.booked)
+			}
+			if out := res.Steps[0].Output; !strings.HasPrefix(out, "error: calendar_create_event: ") {
+				t.Errorf("%s: output = %q", when, out)
+			}
+			if res.Reply != "Which day?" {
+				t.Errorf("%s: reply = %q", when, res.Reply)
+			}
+		}
+	})
+
+	t.Run("meeting arrangement", func(t *testing.T) {
+		srv := llmtest.New(t)
+		srv.On(llmtest.AfterTool("schedule_meeting"), llmtest.Text("I've emailed Sara some times."))
+		srv.On(llmtest.Any, llmtest.Call("schedule_meeting", `{"contact":"Sara Smith","when":"next week","title":"Annual review","conference":true}`))
+		tools := &fakeTools{}
+		res, err := newAgent(srv, tools).Handle(context.Background(), "user-1", "Schedule an appointment with Sara Smith next week")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tools.meetings) != 1 {
+			t.Fatalf("meetings = %+v", tools.meetings)
+		}
+		m := tools.meetings[0]
+		if m.Contact != "Sara Smith" || m.Title != "Annual review" || !m.Conference ||
+			!m.From.Equal(time.Date(2030, 3, 11, 0, 0, 0, 0, ny)) || !m.To.Equal(time.Date(2030, 3, 18, 0, 0, 0, 0, ny)) {
+			t.Errorf("meeting = %+v", m)
+		}
+		if res.Steps[0].Output != "proposing times to Sara Smith" {
+			t.Errorf("output = %q", res.Steps[0].Output)
+		}
+	})
+
+	t.Run("slot search period", func(t *testing.T) {
+		srv := llmtest.New(t)
+		srv.On(llmtest.AfterTool("calendar_find_slots"), llmtest.Text("Here are some times."))
+		srv.On(llmtest.Any, llmtest.Call("calendar_find_slots", `{"when":"tomorrow afternoon","duration_minutes":60}`))
+		tools := &fakeTools{}
+		if _, err := newAgent(srv, tools).Handle(context.Background(), "user-1", "When am I free tomorrow afternoon?"); err != nil {
+			t.Fatal(err)
+		}
+		if len(tools.searched) != 1 {
+			t.Fatalf("searched %d times", len(tools.searched))
+		}
+		req := tools.searched[0]
+		if !req.From.Equal(time.Date(2030, 3, 5, 12, 0, 0, 0, ny)) || !req.To.Equal(time.Date(2030, 3, 5, 17, 0, 0, 0, ny)) {
+			t.Errorf("window = %v – %v", req.From, req.To)
+		}
+	})
+}
+
+func TestHandleNotConfigured(t *testing.T) {
+	mem := &fakeMemory{}
+	a := New(Config{Router: llm.NewRouter(nil), Tools: &fakeTools{}, Memory: mem})
+	if _, err := a.Handle(context.Background(), "user-1", "hi"); !errors.Is(err, ErrNotConfigured) {
+		t.Fatalf("err = %v, want ErrNotConfigured", err)
+	}
+	if len(mem.msgs) != 1 || mem.msgs[0].Content != "hi" {
+		t.Errorf("stored %+v, want the user message", mem.msgs)
+	}
+}
+
+func TestHandleSaveFails(t *testing.T) {
+	srv := llmtest.New(t)
+	a := New(Config{Router: srv.Router(), Tools: &fakeTools{}, Memory: &fakeMemory{err: errors.New("db down")}})
+	if _, err := a.Handle(context.Background(), "user-1", "hi"); !errors.Is(err, ErrSaveMessage) {
+		t.Fatalf("err = %v, want ErrSaveMessage", err)
+	}
+	if n := len(srv.Requests()); n != 0 {
+		t.Errorf("%d model requests after the save failed", n)
+	}
+}
+
+func TestHandleProviderStatus(t *testing.T) {
+	srv := llmtest.New(t)
+	srv.On(llmtest.Any, llmtest.Fail(http.StatusTooManyRequests, "rate limited"))
+	a := New(Config{Router: srv.Router(), Tools: &fakeTools{}})
+	_, err := a.Handle(context.Background(), "user-1", "hi")
+	if code := llm.StatusCode(err); code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d (err %v), want 429", code, err)
+	}
+}
+
+func TestHandleToolCancelled(t *testing.T) {
+	srv := llmtest.New(t)
+	srv.On(llmtest.Any, llmtest.Call("gmail_send", `{"to":"a@example.com","subject":"x","text":"y"}`))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a := New(Config{Router: srv.Router(), Tools: &fakeTools{err: context.Canceled, cancel: cancel}})
+	if _, err := a.Handle(ctx, "user-1", "send it"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want the cancellation", err)
+	}
+	if n := len(srv.Requests()); n != 1 {
+		t.Errorf("%d model requests after the cancellation, want 1", n)
+	}
+}
+
+func TestHandleThreadStoresExchange(t *testing.T) {
+	srv := llmtest.New(t)
+	srv.On(llmtest.AfterTool("calendar_find_slots"), llmtest.Text("Tomorrow at 10 is free."))
+	srv.On(llmtest.Any, llmtest.Call("calendar_find_slots", `{}`))
+	mem := &fakeMemory{msgs: []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "Earlier question"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "Earlier answer"},
+	}}
+	a := New(Config{Router: srv.Router(), Tools: &fakeTools{}, Memory: mem})
+
+	if _, err := a.HandleThread(context.Background(), "user-1", "thread-1", "When am I free?"); err != nil {
+		t.Fatalf("HandleThread: %v", err)
+	}
+	first := srv.Requests()[0].Messages
+	if len(first) != 4 || first[1].Content != "Earlier question" {
+		t.Errorf("history not sent: %+v", first)
+	}
+	var roles []string
+	for _, m := range mem.msgs[2:] {
+		roles = append(roles, m.Role)
+	}
+	if got := strings.Join(roles, ","); got != "user,assistant,tool,assistant" {
+		t.Errorf("stored roles = %s", got)
+	}
+}
+
+func TestHandleThreadStream(t *testing.T) {
+	srv := llmtest.New(t)
+	srv.On(llmtest.AfterTool("search_context"), llmtest.Text("Alice wants to sell AAPL [1]."))
+	srv.On(llmtest.Any, llmtest.Call("search_context", `{"query":"AAPL"}`))
+	tools := &fakeTools{docs: []ContextDoc{{Kind: "email", Snippet: "sell AAPL", Source: "email:1"}}}
+	a := New(Config{Router: srv.Router(), Tools: tools})
+
+	var (
+		text  strings.Builder
+		types []EventType
+	)
+	res, err := a.HandleThreadStream(context.Background(), "user-1", "", "AAPL?", func(ev Event) {
+		if ev.Type == EventToken {
+			text.WriteString(ev.Text)
+			return
+		}
+		types = append(types, ev.Type)
+	})
+	if err != nil {
+		t.Fatalf("HandleThreadStream: %v", err)
+	}
+	if text.String() != res.Reply || res.Reply != "Alice wants to sell AAPL [1]." {
+		t.Errorf("streamed %q, reply %q", text.String(), res.Reply)
+	}
+	want := []EventType{EventToolStart, EventSources, EventToolEnd}
+	if len(types) != len(want) {
+		t.Fatalf("events = %v, want %v", types, want)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Fatalf("events = %v, want %v", types, want)
+		}
+	}
+	if len(res.Steps) != 1 || string(res.Steps[0].Args) != `{"query":"AAPL"}` {
+		t.Errorf("steps = %+v, want the reassembled search_context call", res.Steps)
+	}
+}
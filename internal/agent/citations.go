@@ -0,0 +1,37 @@
+package agent
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// cite numbers docs for the answer being built. Each distinct source gets the
+// next number the first time it is shown to the model and keeps it afterwards,
+// so the reply can refer to it as [n].
+func (res *Result) cite(docs []ContextDoc) []ContextDoc {
+	for i := range docs {
+		for _, s := range res.Sources {
+			if s.Source != "" && s.Source == docs[i].Source {
+				docs[i].Ref = s.Ref
+				break
+			}
+		}
+		if docs[i].Ref == 0 {
+			docs[i].Ref = len(res.Sources) + 1
+			res.Sources = append(res.Sources, docs[i])
+		}
+	}
+	return docs
+}
+
+var citationRef = regexp.MustCompile(`\[(\d+)\]`)
+
+// markCited flags the sources the final reply refers to.
+func (res *Result) markCited() {
+	for _, m := range citationRef.FindAllStringSubmatch(res.Reply, -1) {
+		n, _ := strconv.Atoi(m[1])
+		if n >= 1 && n <= len(res.Sources) {
+			res.Sources[n-1].Cited = true
+		}
+	}
+}
@@ -2,43 +2,73 @@ package agent
 
 import (
 	"context"
-	"os"
 
 	openai "github.com/sashabaranov/go-openai"
+
+	"aiagentapi/internal/llm"
 )
 
+// ErrNotConfigured is returned when no model provider is configured.
+var ErrNotConfigured = llm.ErrNotConfigured
+
+// LLM sends the agent's model requests through the provider router: chat
+// turns along the chat route, one-off completions along the route of their
+// purpose.
 type LLM struct {
-	client *openai.Client
-	model  string
+	router *llm.Router
 }
 
 func NewLLM() *LLM {
-	key := os.Getenv("GROQ_API_KEY")
-	model := os.Getenv("GROQ_MODEL")
-	if model == "" {
-		model = "llama-3.1-8b-instant"
-	}
+	return &LLM{router: llm.Default()}
+}
 
-	baseURL := os.Getenv("GROQ_BASE_URL")
-	if baseURL == "" {
-		baseURL = "https://api.groq.com/openai/v1"
-	}
+// Configured reports whether a chat provider is available.
+func (l *LLM) Configured() bool { return l.router.Configured(llm.Chat) }
 
-	cfg := openai.DefaultConfig(key)
-	cfg.BaseURL = baseURL
-	return &LLM{client: openai.NewClientWithConfig(cfg), model: model}
+// Complete runs a single system/user exchange on the summarization route.
+func (l *LLM) Complete(ctx context.Context, system, user string) (string, error) {
+	return l.CompleteFor(ctx, llm.Summarize, system, user)
 }
 
-func (l *LLM) Complete(ctx context.Context, system, user string) (string, error) {
-	resp, err := l.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-		Model: l.model,
+// CompleteFor runs a single system/user exchange on the route of purpose.
+func (l *LLM) CompleteFor(ctx context.Context, purpose llm.Purpose, system, user string) (string, error) {
+	resp, err := l.router.ChatCompletion(ctx, purpose, openai.ChatCompletionRequest{
 		Messages: []openai.ChatCompletionMessage{
 			{Role: "system", Content: system},
 			{Role: "user", Content: user},
 		},
 		Temperature: 0.2,
 	})
-	if err != nil { return "", err }
-	if len(resp.Choices) == 0 { return "", nil }
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", nil
+	}
 	return resp.Choices[0].Message.Content, nil
 }
+
+// Chat sends the full message list, advertising tools when given, and returns
+// the assistant message including any tool_calls it requested.
+func (l *LLM) Chat(ctx context.Context, messages []openai.ChatCompletionMessage, tools []openai.Tool) (openai.ChatCompletionMessage, error) {
+	resp, err := l.router.ChatCompletion(ctx, llm.Chat, chatRequest(messages, tools))
+	if err != nil {
+		return openai.ChatCompletionMessage{}, err
+	}
+	if len(resp.Choices) == 0 {
+		return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}, nil
+	}
+	return resp.Choices[0].Message, nil
+}
+
+func chatRequest(messages []openai.ChatCompletionMessage, tools []openai.Tool) openai.ChatCompletionRequest {
+	req := openai.ChatCompletionRequest{
+		Messages:    messages,
+		Temperature: 0.2,
+	}
+	if len(tools) > 0 {
+		req.Tools = tools
+		req.ToolChoice = "auto"
+	}
+	return req
+}
@@ -0,0 +1,206 @@
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Memory persists conversation turns so a thread can be resumed across requests.
+type Memory interface {
+	// Load returns up to limit of the most recent messages of a thread, oldest first.
+	Load(ctx context.Context, userID, threadID string, limit int) ([]openai.ChatCompletionMessage, error)
+	// Append stores messages at the end of a thread.
+	Append(ctx context.Context, userID, threadID string, msgs ...openai.ChatCompletionMessage) error
+}
+
+// ErrSaveMessage is returned when the user's message can't be stored in
+// Memory; the model is not asked.
+var ErrSaveMessage = errors.New("agent: failed to save message")
+
+// messageIDs is implemented by memories that assign ids to stored messages,
+// so the agent can report the id of the stored reply.
+type messageIDs interface {
+	AppendIDs(ctx context.Context, userID, threadID string, msgs ...openai.ChatCompletionMessage) ([]int64, error)
+}
+
+// PostgresMemory keeps the conversation in the agent_message table. Assistant
+// tool calls go to tool_calls as the OpenAI array; tool results store the
+// tool_call_id and name they answer there as well.
+type PostgresMemory struct {
+	DB *sql.DB
+}
+
+type toolResultRef struct {
+	ToolCallID string `json:"tool_call_id"`
+	Name       string `json:"name,omitempty"`
+}
+
+func (m PostgresMemory) Load(ctx context.Context, userID, threadID string, limit int) ([]openai.ChatCompletionMessage, error) {
+	if limit <= 0 {
+		limit = 40
+	}
+	rows, err := m.DB.QueryContext(ctx, `
+SELECT role, coalesce(content, ''), coalesce(tool_calls::text, '')
+FROM agent_message
+WHERE user_id IS NOT DISTINCT FROM $1 AND thread_id IS NOT DISTINCT FROM $2
+ORDER BY created_at DESC, id DESC
+LIMIT $3`, nullable(userID), nullable(threadID), limit)
+	if err != nil {
+		return nil, fmt.Errorf("select history: %w", err)
+	}
+	defer rows.Close()
+
+	var out []openai.ChatCompletionMessage
+	for rows.Next() {
+		var role, content, calls string
+		if err := rows.Scan(&role, &content, &calls); err != nil {
+			return nil, fmt.Errorf("scan history: %w", err)
+		}
+		msg := openai.ChatCompletionMessage{Role: role, Content: content}
+		switch {
+		case calls == "":
+		case role == openai.ChatMessageRoleAssistant:
+			_ = json.Unmarshal([]byte(calls), &msg.ToolCalls)
+		case role == openai.ChatMessageRoleTool:
+			var ref toolResultRef
+			_ = json.Unmarshal([]byte(calls), &ref)
+			msg.ToolCallID, msg.Name = ref.ToolCallID, ref.Name
+		}
+		out = append(out, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, nil
+}
+
+func (m PostgresMemory) Append(ctx context.Context, userID, threadID string, msgs ...openai.ChatCompletionMessage) error {
+	_, err := m.AppendIDs(ctx, userID, threadID, msgs...)
+	return err
+}
+
+// AppendIDs stores messages like Append and returns their agent_message ids.
+func (m PostgresMemory) AppendIDs(ctx context.Context, userID, threadID string, msgs ...openai.ChatCompletionMessage) ([]int64, error) {
+	ids := make([]int64, 0, len(msgs))
+	for _, msg := range msgs {
+		var calls any
+		switch {
+		case len(msg.ToolCalls) > 0:
+			b, _ := json.Marshal(msg.ToolCalls)
+			calls = string(b)
+		case msg.ToolCallID != "":
+			b, _ := json.Marshal(toolResultRef{ToolCallID: msg.ToolCallID, Name: msg.Name})
+			calls = string(b)
+		}
+		var id int64
+		if err := m.DB.QueryRowContext(ctx, `
+INSERT INTO agent_message (user_id, thread_id, role, content, tool_calls)
+VALUES ($1, $2, $3, $4, $5::jsonb)
+RETURNING id`, nullable(userID), nullable(threadID), msg.Role, msg.Content, calls).Scan(&id); err != nil {
+			return ids, fmt.Errorf("insert message: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func nullable(s string) any {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	return s
+}
+
+// estimateTokens is a cheap stand-in for a tokenizer (~4 bytes per token).
+func estimateTokens(msg openai.ChatCompletionMessage) int {
+	n := len(msg.Content)
+	for _, tc := range msg.ToolCalls {
+		n += len(tc.Function.Name) + len(tc.Function.Arguments)
+	}
+	return n/4 + 4
+}
+
+// fitWindow keeps the newest whole exchanges (a user message and everything
+// that followed it) that fit in budget tokens, so tool results are never
+// separated from the assistant message that requested them. It returns the
+// kept messages and the older ones that were dropped.
+func fitWindow(history []openai.ChatCompletionMessage, budget int) (kept, dropped []openai.ChatCompletionMessage) {
+	// Anything before the first user message is a truncated exchange.
+	first := len(history)
+	for i, m := range history {
+		if m.Role == openai.ChatMessageRoleUser {
+			first = i
+			break
+		}
+	}
+	history = history[first:]
+
+	used := 0
+	cut := len(history)
+	for end := len(history); end > 0; {
+		start := end - 1
+		for start > 0 && history[start].Role != openai.ChatMessageRoleUser {
+			start--
+		}
+		cost := 0
+		for _, m := range history[start:end] {
+			cost += estimateTokens(m)
+		}
+		if used+cost > budget {
+			break
+		}
+		used += cost
+		cut = start
+		end = start
+	}
+	return history[cut:], history[:cut]
+}
+
+const summarizePrompt = `Summarize the earlier part of a conversation between a financial advisor and their assistant.
+Keep names, dates, amounts, decisions and open requests. Reply with at most 8 short bullet points.`
+
+// summarize condenses dropped turns into a single system message.
+func (a *Agent) summarize(ctx context.Context, dropped []openai.ChatCompletionMessage) (openai.ChatCompletionMessage, error) {
+	var b strings.Builder
+	for _, m := range dropped {
+		switch {
+		case m.Role == openai.ChatMessageRoleTool:
+			fmt.Fprintf(&b, "tool %s returned: %s\n", m.Name, truncate(m.Content, 600))
+		case len(m.ToolCalls) > 0:
+			for _, tc := range m.ToolCalls {
+				fmt.Fprintf(&b, "assistant called %s(%s)\n", tc.Function.Name, tc.Function.Arguments)
+			}
+		default:
+			fmt.Fprintf(&b, "%s: %s\n", m.Role, m.Content)
+		}
+	}
+	text, err := a.llm.Complete(ctx, summarizePrompt, b.String())
+	if err != nil {
+		return openai.ChatCompletionMessage{}, err
+	}
+	return openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: "Summary of the earlier conversation:\n" + strings.TrimSpace(text),
+	}, nil
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "…"
+}
@@ -0,0 +1,37 @@
+package agent
+
+import (
+	"context"
+	"database/sql"
+
+	"aiagentapi/internal/embedding"
+	"aiagentapi/internal/retrieval"
+)
+
+// PostgresToolset answers SearchContext from the synced email, note, contact
+// and meeting tables through hybrid retrieval. The remaining Toolset methods
+// fall through to DefaultToolset; embed it to provide real implementations of
+// those.
+type PostgresToolset struct {
+	DefaultToolset
+	DB *sql.DB
+	// Embedder enables semantic search over the pgvector embedding tables.
+	Embedder embedding.Embedder
+	// MinSimilarity overrides retrieval.DefaultMinSimilarity.
+	MinSimilarity float64
+}
+
+// SearchContext returns up to limit documents for query, ranked by reciprocal
+// rank fusion of keyword and semantic search with one document per thread.
+func (t PostgresToolset) SearchContext(ctx context.Context, userID, query string, limit int) ([]ContextDoc, error) {
+	r := retrieval.Retriever{DB: t.DB, Embedder: t.Embedder, MinSimilarity: t.MinSimilarity}
+	found, err := r.Search(ctx, userID, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]ContextDoc, 0, len(found))
+	for _, d := range found {
+		docs = append(docs, ContextDoc{Kind: d.Kind, Snippet: d.Snippet, Source: d.Source, ThreadID: d.ThreadID, When: d.When})
+	}
+	return docs, nil
+}
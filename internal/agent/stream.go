@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"aiagentapi/internal/llm"
+)
+
+// EventType names the kinds of progress HandleThreadStream reports.
+type EventType string
+
+const (
+	// EventToken carries the next piece of the reply text.
+	EventToken EventType = "token"
+	// EventToolStart is sent before a tool runs, with its name and arguments.
+	EventToolStart EventType = "tool_start"
+	// EventToolEnd is sent after a tool ran, with its output or error.
+	EventToolEnd EventType = "tool_end"
+	// EventSources carries context documents as they are retrieved, numbered
+	// as the reply cites them.
+	EventSources EventType = "sources"
+)
+
+// Event is one progress report of a streamed reply.
+type Event struct {
+	Type    EventType    `json:"-"`
+	Text    string       `json:"text,omitempty"`
+	Tool    *ToolStep    `json:"tool,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	Sources []ContextDoc `json:"sources,omitempty"`
+}
+
+func emitSources(emit func(Event), docs []ContextDoc) {
+	if emit == nil || len(docs) == 0 {
+		return
+	}
+	emit(Event{Type: EventSources, Sources: docs})
+}
+
+func emitTool(emit func(Event), typ EventType, step ToolStep, err error) {
+	if emit == nil {
+		return
+	}
+	ev := Event{Type: typ, Tool: &step}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	emit(ev)
+}
+
+// chat runs one model turn, streaming the reply text to emit when set.
+func (a *Agent) chat(ctx context.Context, msgs []openai.ChatCompletionMessage, tools []openai.Tool, emit func(Event)) (openai.ChatCompletionMessage, error) {
+	if emit == nil {
+		return a.llm.Chat(ctx, msgs, tools)
+	}
+	return a.llm.ChatStream(ctx, msgs, tools, func(text string) {
+		emit(Event{Type: EventToken, Text: text})
+	})
+}
+
+// ChatStream is Chat over a streamed completion: content deltas are passed to
+// onText as they arrive and tool call fragments are reassembled by index. The
+// returned message is the same as Chat would have returned.
+func (l *LLM) ChatStream(ctx context.Context, messages []openai.ChatCompletionMessage, tools []openai.Tool, onText func(string)) (openai.ChatCompletionMessage, error) {
+	stream, err := l.router.ChatCompletionStream(ctx, llm.Chat, chatRequest(messages, tools))
+	if err != nil {
+		return openai.ChatCompletionMessage{}, err
+	}
+	defer stream.Close()
+
+	var acc streamAccumulator
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return openai.ChatCompletionMessage{}, err
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		delta := chunk.Choices[0].Delta
+		if delta.Content != "" && onText != nil {
+			onText(delta.Content)
+		}
+		acc.add(delta)
+	}
+	return acc.message(), nil
+}
+
+// streamAccumulator rebuilds an assistant message from stream deltas. Tool
+// calls arrive in fragments keyed by index: the first carries the id and
+// name, later ones append to the arguments.
+type streamAccumulator struct {
+	content []byte
+	calls   map[int]*openai.ToolCall
+}
+
+func (s *streamAccumulator) add(d openai.ChatCompletionStreamChoiceDelta) {
+	s.content = append(s.content, d.Content...)
+	for i, tc := range d.ToolCalls {
+		idx := i
+		if tc.Index != nil {
+			idx = *tc.Index
+		}
+		if s.calls == nil {
+			s.calls = map[int]*openai.ToolCall{}
+		}
+		cur, ok := s.calls[idx]
+		if !ok {
+			cur = &openai.ToolCall{Type: openai.ToolTypeFunction}
+			s.calls[idx] = cur
+		}
+		if tc.ID != "" {
+			cur.ID = tc.ID
+		}
+		if tc.Type != "" {
+			cur.Type = tc.Type
+		}
+		if tc.Function.Name != "" {
+			cur.Function.Name = tc.Function.Name
+		}
+		cur.Function.Arguments += tc.Function.Arguments
+	}
+}
+
+func (s *streamAccumulator) message() openai.ChatCompletionMessage {
+	msg := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: string(s.content)}
+	idx := make([]int, 0, len(s.calls))
+	for i := range s.calls {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+	for _, i := range idx {
+		msg.ToolCalls = append(msg.ToolCalls, *s.calls[i])
+	}
+	return msg
+}
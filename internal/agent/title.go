@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+)
+
+const titlePrompt = `Write a title for a conversation between a financial advisor and their assistant, based on its first exchange.
+Use at most 6 words. Reply with the title only: no quotes, no "Title:" prefix, no final punctuation.`
+
+const maxTitleLen = 80
+
+// Title suggests a short thread title from the first exchange of a
+// conversation.
+func (a *Agent) Title(ctx context.Context, message, reply string) (string, error) {
+	text, err := a.llm.Complete(ctx, titlePrompt, "User: "+truncate(message, 1500)+"\n\nAssistant: "+truncate(reply, 1500))
+	if err != nil {
+		return "", err
+	}
+	return cleanTitle(text), nil
+}
+
+// FallbackTitle names a thread after its first message, for when no title
+// can be generated.
+func FallbackTitle(message string) string {
+	return cleanTitle(strings.Join(strings.Fields(message), " "))
+}
+
+// cleanTitle keeps the first line of a model reply without decoration and
+// caps its length at a word boundary.
+func cleanTitle(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.Trim(s, "\"'`*#“”‘’ ")
+	for _, p := range []string{"Title:", "title:"} {
+		s = strings.TrimPrefix(s, p)
+	}
+	s = strings.Trim(s, "\"'`*#“”‘’ ")
+	s = strings.TrimRight(s, ".!:;, ")
+	if utf8.RuneCountInString(s) <= maxTitleLen {
+		return s
+	}
+	cut := truncate(s, maxTitleLen)
+	cut = strings.TrimSuffix(cut, "…")
+	if i := strings.LastIndexByte(cut, ' '); i > maxTitleLen/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, ".!:;, ") + "…"
+}
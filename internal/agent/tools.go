@@ -2,31 +2,156 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
 	"time"
+
+	openai "github.com/sashabaranov/go-openai"
 )
 
+// Toolset carries out the agent's tool calls. Errors are shown to the model
+// as the tool's output, prefixed with the tool name unless they already
+// start with it.
 type Toolset interface {
 	SearchContext(ctx context.Context, userID, query string, limit int) ([]ContextDoc, error)
-	SendEmail(ctx context.Context, userID, to, subject, text string) error
-	FindSlots(ctx context.Context, userID string, from, to time.Time, attendees []string) ([]TimeSlot, error)
-	CreateEvent(ctx context.Context, userID, title string, when time.Time, attendees []string, description string) (string, error)
+	SendEmail(ctx context.Context, userID string, email Email) error
+	FindSlots(ctx context.Context, userID string, req SlotRequest) ([]TimeSlot, error)
+	CreateEvent(ctx context.Context, userID string, event EventRequest) (string, error)
+	// ScheduleMeeting starts agreeing a meeting time with a contact by email
+	// and returns a status for the model.
+	ScheduleMeeting(ctx context.Context, userID string, req MeetingRequest) (string, error)
 }
 
 type DefaultToolset struct{}
 
 type ContextDoc struct {
-	Kind    string
-	Snippet string
-	Source  string
-	When    time.Time
+	// Ref is the citation number the reply uses for this document ("[2]").
+	Ref      int       `json:"ref,omitempty"`
+	Kind     string    `json:"kind"`
+	Snippet  string    `json:"snippet"`
+	Source   string    `json:"source,omitempty"`
+	ThreadID string    `json:"thread_id,omitempty"`
+	When     time.Time `json:"when,omitempty"`
+	// Cited is set on Result.Sources entries the final reply refers to.
+	Cited bool `json:"cited,omitempty"`
+}
+
+// Email is a message the agent asked to send. Address fields are
+// comma-separated lists; a ThreadID makes it a reply in that Gmail thread.
+type Email struct {
+	To, Cc, Bcc string
+	Subject     string
+	Text        string
+	ThreadID    string
+}
+
+// SlotRequest asks for free meeting slots. Zero fields mean the next week and
+// the advisor's usual meeting length.
+type SlotRequest struct {
+	From, To  time.Time
+	Duration  time.Duration
+	Attendees []string
+}
+
+// EventRequest is a meeting the agent asked to book. A zero Duration means
+// the advisor's usual meeting length.
+type EventRequest struct {
+	Title       string
+	Description string
+	Start       time.Time
+	Duration    time.Duration
+	Attendees   []string
+	// Conference adds a video call link.
+	Conference bool
+}
+
+// MeetingRequest asks to agree a meeting with a contact by email. Contact is
+// a name or an address; zero From and To mean the next week.
+type MeetingRequest struct {
+	Contact    string
+	Title      string
+	From, To   time.Time
+	Duration   time.Duration
+	Conference bool
+	Message    string
 }
 
 type TimeSlot struct {
-	Start time.Time
-	End   time.Time
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
 }
 
 func (DefaultToolset) SearchContext(ctx context.Context, userID, query string, limit int) ([]ContextDoc, error) { return []ContextDoc{}, nil }
-func (DefaultToolset) SendEmail(ctx context.Context, userID, to, subject, text string) error { return nil }
-func (DefaultToolset) FindSlots(ctx context.Context, userID string, from, to time.Time, attendees []string) ([]TimeSlot, error) { return []TimeSlot{}, nil }
-func (DefaultToolset) CreateEvent(ctx context.Context, userID, title string, when time.Time, attendees []string, description string) (string, error) { return "event_123", nil }
+func (DefaultToolset) SendEmail(ctx context.Context, userID string, email Email) error { return nil }
+func (DefaultToolset) FindSlots(ctx context.Context, userID string, req SlotRequest) ([]TimeSlot, error) { return []TimeSlot{}, nil }
+func (DefaultToolset) CreateEvent(ctx context.Context, userID string, event EventRequest) (string, error) { return "", nil }
+func (DefaultToolset) ScheduleMeeting(ctx context.Context, userID string, req MeetingRequest) (string, error) { return "", nil }
+
+// toolDefinitions describes the Toolset to models that support native function calling.
+func toolDefinitions() []openai.Tool {
+	fn := func(name, desc, schema string) openai.Tool {
+		return openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        name,
+				Description: desc,
+				Parameters:  json.RawMessage(schema),
+			},
+		}
+	}
+	return []openai.Tool{
+		fn("search_context", "Search the advisor's emails, attachments, notes, contacts and meetings for relevant context.", `{
+  "type": "object",
+  "properties": {
+    "query": {"type": "string", "description": "What to look for, in natural language or keywords."},
+    "limit": {"type": "integer", "description": "Maximum number of results (default 6)."}
+  },
+  "required": ["query"]
+}`),
+		fn("gmail_send", "Send an email from the advisor's Gmail account.", `{
+  "type": "object",
+  "properties": {
+    "to": {"type": "string", "description": "Recipient email addresses, comma-separated."},
+    "cc": {"type": "string", "description": "Cc addresses, comma-separated."},
+    "bcc": {"type": "string", "description": "Bcc addresses, comma-separated."},
+    "subject": {"type": "string", "description": "Subject; replies default to Re: the thread's subject."},
+    "text": {"type": "string", "description": "Plain text body."},
+    "thread_id": {"type": "string", "description": "Gmail thread id from search results, to send the email as a reply in that thread."}
+  },
+  "required": ["text"]
+}`),
+		fn("calendar_find_slots", "Find free meeting slots on the advisor's calendar within working hours, best first.", `{
+  "type": "object",
+  "properties": {
+    "when": {"type": "string", "description": "Period to search in the advisor's time zone, e.g. \"next week\", \"tomorrow afternoon\" or \"first Monday of December\" (default the next 7 days)."},
+    "from": {"type": "string", "description": "Earliest start instead of when: RFC 3339 or e.g. \"Tuesday 2pm\"."},
+    "to": {"type": "string", "description": "Latest end instead of when: RFC 3339 or e.g. \"Friday\"."},
+    "duration_minutes": {"type": "integer", "description": "Meeting length (default the advisor's usual length)."},
+    "attendees": {"type": "array", "items": {"type": "string"}, "description": "Attendee email addresses whose calendars should also be free."}
+  }
+}`),
+		fn("calendar_create_event", "Create an event on the advisor's calendar and invite the attendees. Returns the event id.", `{
+  "type": "object",
+  "properties": {
+    "title": {"type": "string"},
+    "when": {"type": "string", "description": "Start time in the advisor's time zone: RFC 3339 or e.g. \"next Tuesday at 3pm\", \"in two days at 10\"."},
+    "duration_minutes": {"type": "integer", "description": "Meeting length (default the advisor's usual length)."},
+    "attendees": {"type": "array", "items": {"type": "string"}, "description": "Attendee email addresses."},
+    "description": {"type": "string"},
+    "conference": {"type": "boolean", "description": "Add a Google Meet link."}
+  },
+  "required": ["title", "when"]
+}`),
+		fn("schedule_meeting", "Arrange a meeting with a contact by email: propose free times, wait for their reply, then book the meeting and confirm. Use this when the time isn't agreed yet.", `{
+  "type": "object",
+  "properties": {
+    "contact": {"type": "string", "description": "The contact's name or email address."},
+    "title": {"type": "string"},
+    "when": {"type": "string", "description": "Period to propose times in, e.g. \"next week\" (default the next 7 days)."},
+    "duration_minutes": {"type": "integer", "description": "Meeting length (default the advisor's usual length)."},
+    "conference": {"type": "boolean", "description": "Add a Google Meet link."},
+    "message": {"type": "string", "description": "Optional note to include before the proposed times."}
+  },
+  "required": ["contact"]
+}`),
+	}
+}
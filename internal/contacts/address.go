@@ -0,0 +1,57 @@
+package contacts
+
+import (
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+// automated matches the local part of addresses that don't belong to a
+// person: no-reply senders, bounces, notification and list robots.
+var automated = regexp.MustCompile(`(?i)^(no-?reply|do-?not-?reply|donotreply|mailer-daemon|postmaster|bounces?|notifications?|notify|alerts?|automated|mailer|newsletter|calendar-notification)([+._-].*)?$|noreply|no-reply`)
+
+// Normalize reduces an address to the form used to detect duplicates:
+// lower case, without +tags, and for Gmail without dots in the local part.
+func Normalize(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok {
+		return email
+	}
+	local, _, _ = strings.Cut(local, "+")
+	if domain == "googlemail.com" {
+		domain = "gmail.com"
+	}
+	if domain == "gmail.com" {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	return local + "@" + domain
+}
+
+// IsAutomated reports whether an address is a robot or a calendar resource
+// rather than a person.
+func IsAutomated(email string) bool {
+	local, domain, ok := strings.Cut(strings.ToLower(strings.TrimSpace(email)), "@")
+	if !ok || local == "" {
+		return true
+	}
+	if strings.HasSuffix(domain, "calendar.google.com") {
+		return true
+	}
+	return automated.MatchString(local)
+}
+
+// parseAddress accepts "Name <addr>" or a bare address.
+func parseAddress(s string) (name, email string, ok bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", "", false
+	}
+	if a, err := mail.ParseAddress(s); err == nil {
+		return a.Name, a.Address, true
+	}
+	if strings.Count(s, "@") == 1 && !strings.ContainsAny(s, " <>") {
+		return "", s, true
+	}
+	return "", "", false
+}
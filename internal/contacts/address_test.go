@@ -0,0 +1,66 @@
+package contacts
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Bob@Example.COM", "bob@example.com"},
+		{" Jane.Doe+news@GoogleMail.com ", "janedoe@gmail.com"},
+		{"j.a.n.e@gmail.com", "jane@gmail.com"},
+		{"first.last+tag@example.com", "first.last@example.com"},
+		{"no-at-sign", "no-at-sign"},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.in); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIsAutomated(t *testing.T) {
+	tests := []struct {
+		email string
+		want  bool
+	}{
+		{"alice@example.com", false},
+		{"mailbox@example.com", false},
+		{"replyall@example.com", false},
+		{"no-reply@example.com", true},
+		{"NoReply+abc123@example.com", true},
+		{"notifications@github.com", true},
+		{"alerts.team@example.com", true},
+		{"bounces+1234@mail.example.com", true},
+		{"calendar-notification@google.com", true},
+		{"c_1889@resource.calendar.google.com", true},
+		{"@example.com", true},
+		{"nobody", true},
+	}
+	for _, tt := range tests {
+		if got := IsAutomated(tt.email); got != tt.want {
+			t.Errorf("IsAutomated(%q) = %v, want %v", tt.email, got, tt.want)
+		}
+	}
+}
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		in          string
+		name, email string
+		ok          bool
+	}{
+		{"Jane Doe <jane@example.com>", "Jane Doe", "jane@example.com", true},
+		{`"Doe, Jane" <jane@example.com>`, "Doe, Jane", "jane@example.com", true},
+		{"=?UTF-8?Q?Zo=C3=AB_M=C3=BCller?= <zoe@example.com>", "Zoë Müller", "zoe@example.com", true},
+		{" jane@example.com ", "", "jane@example.com", true},
+		{"jane@localhost", "", "jane@localhost", true},
+		{"", "", "", false},
+		{"not an address", "", "", false},
+		{"Jane <jane@>", "", "", false},
+	}
+	for _, tt := range tests {
+		name, email, ok := parseAddress(tt.in)
+		if name != tt.name || email != tt.email || ok != tt.ok {
+			t.Errorf("parseAddress(%q) = %q, %q, %v; want %q, %q, %v", tt.in, name, email, ok, tt.name, tt.email, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,417 @@
+// Package contacts builds the contact table from synced mail and meetings:
+// people the advisor emails or meets are created (or matched to an existing
+// contact) and their interaction history is kept in contact.metadata.
+package contacts
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Interaction kinds counted in metadata.interactions.
+const (
+	EmailSent     = "emails_sent"
+	EmailReceived = "emails_received"
+	Meeting       = "meetings"
+)
+
+// ProcessPending records the contacts of emails and past meetings that
+// haven't been processed yet and returns how many rows it handled. Each email
+// or meeting is counted once, in the same transaction that marks it done.
+func ProcessPending(ctx context.Context, db *sql.DB, userID string, batch int) (int, error) {
+	if batch <= 0 {
+		batch = 200
+	}
+	own, err := ownAddresses(ctx, db, userID)
+	if err != nil {
+		return 0, err
+	}
+	r := &resolver{db: db, userID: userID, own: own}
+	n, err := r.emails(ctx, batch)
+	if err != nil {
+		return n, err
+	}
+	m, err := r.meetings(ctx, batch)
+	return n + m, err
+}
+
+type resolver struct {
+	db     *sql.DB
+	userID string
+	own    map[string]bool
+}
+
+// ownAddresses is the advisor's login plus every address they have sent
+// mail from, so aliases and send-as addresses are never made contacts.
+func ownAddresses(ctx context.Context, db *sql.DB, userID string) (map[string]bool, error) {
+	own := map[string]bool{}
+	rows, err := db.QueryContext(ctx, `
+SELECT email FROM app_user WHERE id=$1
+UNION
+SELECT DISTINCT sender FROM email
+WHERE user_id=$1 AND 'SENT' = ANY(labels) AND sender IS NOT NULL`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("load own addresses: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		if _, addr, ok := parseAddress(s); ok {
+			own[Normalize(addr)] = true
+		}
+	}
+	return own, rows.Err()
+}
+
+// person is one participant of an email or meeting.
+type person struct {
+	name, email string
+}
+
+func (r *resolver) emails(ctx context.Context, batch int) (int, error) {
+	rows, err := r.db.QueryContext(ctx, `
+SELECT id, coalesce(sender, ''), coalesce(array_to_json(recipients), '[]')::text,
+       'SENT' = ANY(labels), coalesce(sent_at, now())
+FROM email
+WHERE user_id=$1 AND contacts_at IS NULL
+ORDER BY sent_at NULLS LAST, id
+LIMIT $2`, r.userID, batch)
+	if err != nil {
+		return 0, fmt.Errorf("select emails: %w", err)
+	}
+	type pending struct {
+		id         int64
+		sender     string
+		recipients []string
+		sent       bool
+		at         time.Time
+	}
+	var list []pending
+	for rows.Next() {
+		var (
+			p          pending
+			recipients string
+		)
+		if err := rows.Scan(&p.id, &p.sender, &recipients, &p.sent, &p.at); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		_ = json.Unmarshal([]byte(recipients), &p.recipients)
+		list = append(list, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, p := range list {
+		kind, people := emailPeople(p.sender, p.recipients, p.sent, r.own)
+		if err := r.record(ctx, "email", p.id, kind, people, p.at); err != nil {
+			return 0, err
+		}
+	}
+	return len(list), nil
+}
+
+// emailPeople returns the interaction kind of an email and who it was with:
+// everyone it went to (To, Cc and Bcc alike) when the advisor sent it,
+// otherwise only the sender. Unparseable addresses are skipped.
+func emailPeople(sender string, recipients []string, sent bool, own map[string]bool) (string, []person) {
+	var people []person
+	_, from, _ := parseAddress(sender)
+	if sent || own[Normalize(from)] {
+		for _, rcpt := range recipients {
+			if name, addr, ok := parseAddress(rcpt); ok {
+				people = append(people, person{name, addr})
+			}
+		}
+		return EmailSent, people
+	}
+	if name, addr, ok := parseAddress(sender); ok {
+		people = append(people, person{name, addr})
+		return EmailReceived, people
+	}
+	return "", nil
+}
+
+func (r *resolver) meetings(ctx context.Context, batch int) (int, error) {
+	rows, err := r.db.QueryContext(ctx, `
+SELECT id, coalesce(attendees::text, '[]'), start_time, coalesce(response_status, '')
+FROM meeting
+WHERE user_id=$1 AND contacts_at IS NULL AND start_time <= now()
+ORDER BY start_time, id
+LIMIT $2`, r.userID, batch)
+	if err != nil {
+		return 0, fmt.Errorf("select meetings: %w", err)
+	}
+	type pending struct {
+		id        int64
+		attendees string
+		at        time.Time
+		response  string
+	}
+	var list []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.attendees, &p.at, &p.response); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		list = append(list, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, p := range list {
+		var attendees []struct {
+			Email          string `json:"email"`
+			Name           string `json:"name"`
+			ResponseStatus string `json:"response_status"`
+			Self           bool   `json:"self"`
+		}
+		_ = json.Unmarshal([]byte(p.attendees), &attendees)
+		var people []person
+		// A meeting the advisor declined didn't happen for them.
+		if p.response != "declined" {
+			for _, a := range attendees {
+				if a.Self || a.ResponseStatus == "declined" {
+					continue
+				}
+				people = append(people, person{a.Name, a.Email})
+			}
+		}
+		if err := r.record(ctx, "meeting", p.id, Meeting, people, p.at); err != nil {
+			return 0, err
+		}
+	}
+	return len(list), nil
+}
+
+// record counts one interaction for each person and marks the source row
+// (table email or meeting) processed.
+func (r *resolver) record(ctx context.Context, table string, id int64, kind string, people []person, at time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, p := range distinct(people, r.own) {
+		contactID, err := resolve(ctx, tx, r.userID, p)
+		if err != nil {
+			return err
+		}
+		if err := touch(ctx, tx, contactID, kind, at); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE `+table+` SET contacts_at=now() WHERE id=$1`, id); err != nil {
+		return fmt.Errorf("mark %s %d: %w", table, id, err)
+	}
+	return tx.Commit()
+}
+
+// distinct drops the advisor's own and automated addresses from people and
+// keeps the first of those sharing a normalized address, so someone listed
+// in both To and Cc, or under a Gmail dot or +tag variant, counts once.
+func distinct(people []person, own map[string]bool) []person {
+	var out []person
+	seen := map[string]bool{}
+	for _, p := range people {
+		norm := Normalize(p.email)
+		if seen[norm] || own[norm] || IsAutomated(p.email) {
+			continue
+		}
+		seen[norm] = true
+		out = append(out, p)
+	}
+	return out
+}
+
+// resolve finds the contact for an address by its normalized form or a
+// known alias, creating one when there is none, and records the address as
+// an alias. Names are only filled in, never overwritten.
+func resolve(ctx context.Context, tx *sql.Tx, userID string, p person) (int64, error) {
+	addr := strings.ToLower(strings.TrimSpace(p.email))
+	norm := Normalize(addr)
+	first, last := ParseName(p.name, addr)
+
+	var id int64
+	err := tx.QueryRowContext(ctx, `
+SELECT id FROM contact WHERE user_id=$1 AND normalized_email=$2
+UNION ALL
+SELECT contact_id FROM contact_alias WHERE user_id=$1 AND (email=$2 OR email=$3)
+LIMIT 1`, userID, norm, addr).Scan(&id)
+	switch {
+	case err == sql.ErrNoRows:
+		err = tx.QueryRowContext(ctx, `
+INSERT INTO contact (user_id, email, normalized_email, first_name, last_name)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (user_id, normalized_email) DO UPDATE SET updated_at = now()
+RETURNING id`, userID, addr, norm, nullable(first), nullable(last)).Scan(&id)
+		if err != nil {
+			return 0, fmt.Errorf("create contact %s: %w", addr, err)
+		}
+	case err != nil:
+		return 0, fmt.Errorf("find contact %s: %w", addr, err)
+	default:
+		if _, err := tx.ExecContext(ctx, `
+UPDATE contact SET
+  first_name = coalesce(nullif(first_name, ''), $2),
+  last_name = coalesce(nullif(last_name, ''), $3)
+WHERE id=$1 AND (coalesce(first_name, '') = '' OR coalesce(last_name, '') = '')`,
+			id, nullable(first), nullable(last)); err != nil {
+			return 0, fmt.Errorf("update contact name: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO contact_alias (contact_id, user_id, email) VALUES ($1, $2, $3)
+ON CONFLICT (user_id, email) DO NOTHING`, id, userID, addr); err != nil {
+		return 0, fmt.Errorf("store alias %s: %w", addr, err)
+	}
+	return id, nil
+}
+
+// touchSQL bumps metadata.interactions.<kind> and .total, and moves
+// metadata.last_contacted_at forward to $3 when it is newer.
+const touchSQL = `
+UPDATE contact SET
+  metadata = coalesce(metadata, '{}'::jsonb) || jsonb_build_object(
+    'interactions', coalesce(metadata->'interactions', '{}'::jsonb) || jsonb_build_object(
+      $2::text, coalesce((metadata->'interactions'->>$2::text)::int, 0) + 1,
+      'total', coalesce((metadata->'interactions'->>'total')::int, 0) + 1),
+    'last_contacted_at', CASE
+      WHEN metadata->>'last_contacted_at' IS NULL
+        OR (metadata->>'last_contacted_at')::timestamptz < $3::timestamptz THEN $4
+      ELSE metadata->>'last_contacted_at' END),
+  updated_at = now()
+WHERE id=$1`
+
+func touch(ctx context.Context, tx *sql.Tx, contactID int64, kind string, at time.Time) error {
+	at = at.UTC()
+	if _, err := tx.ExecContext(ctx, touchSQL, contactID, kind, at, at.Format(time.RFC3339)); err != nil {
+		return fmt.Errorf("record interaction: %w", err)
+	}
+	return nil
+}
+
+// Merge folds contact dropID into keepID: aliases and notes move over,
+// interaction counts are added up, the later last_contacted_at wins and
+// missing names are filled in. Both contacts must belong to userID.
+func Merge(ctx context.Context, db *sql.DB, userID string, keepID, dropID int64) error {
+	if keepID == dropID {
+		return nil
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := merge(ctx, tx, userID, keepID, dropID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func merge(ctx context.Context, tx *sql.Tx, userID string, keepID, dropID int64) error {
+	var n int
+	if err := tx.QueryRowContext(ctx, `
+SELECT count(*) FROM contact WHERE user_id=$1 AND id IN ($2, $3)`, userID, keepID, dropID).Scan(&n); err != nil {
+		return err
+	}
+	if n != 2 {
+		return sql.ErrNoRows
+	}
+	stmts := []string{
+		`UPDATE note SET contact_id=$1 WHERE contact_id=$2`,
+		`UPDATE contact_alias SET contact_id=$1 WHERE contact_id=$2`,
+		`INSERT INTO contact_alias (contact_id, user_id, email)
+		 SELECT $1, user_id, email FROM contact WHERE id=$2 AND email IS NOT NULL
+		 ON CONFLICT (user_id, email) DO UPDATE SET contact_id = EXCLUDED.contact_id`,
+		`UPDATE contact k SET
+		   first_name = coalesce(nullif(k.first_name, ''), d.first_name),
+		   last_name = coalesce(nullif(k.last_name, ''), d.last_name),
+		   metadata = coalesce(d.metadata, '{}'::jsonb) || coalesce(k.metadata, '{}'::jsonb) || jsonb_build_object(
+		     'interactions', (
+		       SELECT coalesce(jsonb_object_agg(key, total), '{}'::jsonb) FROM (
+		         SELECT key, sum(value::int) AS total
+		         FROM (SELECT * FROM jsonb_each_text(coalesce(k.metadata->'interactions', '{}'::jsonb))
+		               UNION ALL
+		               SELECT * FROM jsonb_each_text(coalesce(d.metadata->'interactions', '{}'::jsonb))) kv
+		         GROUP BY key) sums),
+		     'last_contacted_at', (
+		       SELECT max(v) FROM unnest(ARRAY[k.metadata->>'last_contacted_at', d.metadata->>'last_contacted_at']) v)),
+		   updated_at = now()
+		 FROM contact d WHERE k.id=$1 AND d.id=$2`,
+		`DELETE FROM contact WHERE id=$2`,
+	}
+	for _, q := range stmts {
+		if _, err := tx.ExecContext(ctx, q, keepID, dropID); err != nil {
+			return fmt.Errorf("merge contact %d into %d: %w", dropID, keepID, err)
+		}
+	}
+	return nil
+}
+
+// MergeDuplicates merges contacts that share a normalized address or whose
+// address is a known alias of another contact, keeping the oldest. It
+// returns the number of contacts removed.
+func MergeDuplicates(ctx context.Context, db *sql.DB, userID string) (int, error) {
+	rows, err := db.QueryContext(ctx, `
+SELECT keep_id, drop_id FROM (
+  SELECT min(id) OVER (PARTITION BY normalized_email) AS keep_id, id AS drop_id
+  FROM contact WHERE user_id=$1 AND normalized_email IS NOT NULL
+  UNION
+  SELECT least(a.contact_id, c.id), greatest(a.contact_id, c.id)
+  FROM contact c JOIN contact_alias a ON a.user_id = c.user_id AND a.email = lower(c.email)
+  WHERE c.user_id=$1 AND a.contact_id <> c.id
+) pairs
+WHERE keep_id <> drop_id
+ORDER BY drop_id`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("find duplicates: %w", err)
+	}
+	var pairs [][2]int64
+	for rows.Next() {
+		var p [2]int64
+		if err := rows.Scan(&p[0], &p[1]); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		pairs = append(pairs, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	merged := 0
+	gone := map[int64]bool{}
+	for _, p := range pairs {
+		if gone[p[0]] || gone[p[1]] {
+			continue
+		}
+		if err := Merge(ctx, db, userID, p[0], p[1]); err != nil {
+			return merged, err
+		}
+		gone[p[1]] = true
+		merged++
+	}
+	return merged, nil
+}
+
+func nullable(s string) any {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,74 @@
+package contacts
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEmailPeople(t *testing.T) {
+	own := map[string]bool{"advisor@gmail.com": true}
+	tests := []struct {
+		name       string
+		sender     string
+		recipients []string
+		sent       bool
+		kind       string
+		want       []person
+	}{
+		{
+			name:       "received counts only the sender",
+			sender:     "Alice Smith <alice@example.com>",
+			recipients: []string{"advisor@gmail.com", "bob@example.com"},
+			kind:       EmailReceived,
+			want:       []person{{"Alice Smith", "alice@example.com"}},
+		},
+		{
+			name:       "sent counts every recipient",
+			sender:     "advisor@gmail.com",
+			recipients: []string{"Alice Smith <alice@example.com>", "bob@example.com"},
+			sent:       true,
+			kind:       EmailSent,
+			want:       []person{{"Alice Smith", "alice@example.com"}, {"", "bob@example.com"}},
+		},
+		{
+			name:       "sent from an own address variant without the SENT label",
+			sender:     "Advisor <Advisor+clients@googlemail.com>",
+			recipients: []string{"carol@example.com"},
+			kind:       EmailSent,
+			want:       []person{{"", "carol@example.com"}},
+		},
+		{
+			name:   "duplicates across To, Cc and Bcc count once",
+			sender: "advisor@gmail.com",
+			recipients: []string{
+				"Jane Doe <jane.doe@gmail.com>",  // To
+				"JANEDOE+clients@googlemail.com", // Cc, same mailbox
+				"Bob <bob@example.com>",          // Cc
+				"bob@example.com",                // Bcc
+				"advisor@gmail.com",              // the advisor copied themselves
+				"Updates <no-reply@example.com>", // a robot
+				"undisclosed recipients",         // not an address
+			},
+			sent: true,
+			kind: EmailSent,
+			want: []person{{"Jane Doe", "jane.doe@gmail.com"}, {"Bob", "bob@example.com"}},
+		},
+		{
+			name:   "automated sender",
+			sender: "GitHub <notifications@github.com>",
+			kind:   EmailReceived,
+		},
+		{
+			name:   "unparseable sender",
+			sender: "Mail Delivery System",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, people := emailPeople(tt.sender, tt.recipients, tt.sent, own)
+			if got := distinct(people, own); kind != tt.kind || !slices.Equal(got, tt.want) {
+				t.Errorf("got %q %v, want %q %v", kind, got, tt.kind, tt.want)
+			}
+		})
+	}
+}
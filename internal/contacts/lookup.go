@@ -0,0 +1,104 @@
+package contacts
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// Lookup errors. Their messages are meant to be shown to the advisor (or the
+// model acting for them), who can retry with an email address.
+var (
+	ErrNotFound  = errors.New("no matching contact")
+	ErrAmbiguous = errors.New("several contacts match")
+)
+
+// Match is a contact found by Lookup.
+type Match struct {
+	ID    int64
+	Name  string
+	Email string
+}
+
+// Address formats the match as "Name <email>".
+func (m Match) Address() string {
+	return (&mail.Address{Name: m.Name, Address: m.Email}).String()
+}
+
+// Lookup finds who to write to for who: an email address (matched against
+// every alias), a full name or a first or last name. A better kind of match
+// wins, and among equals the most recently contacted; names that still match
+// several people are ambiguous. An address that isn't a contact yet is
+// returned as is.
+func Lookup(ctx context.Context, db *sql.DB, userID, who string) (Match, error) {
+	who = strings.TrimSpace(who)
+	if who == "" {
+		return Match{}, fmt.Errorf("%w: no name or address given", ErrNotFound)
+	}
+	var addr *mail.Address
+	if strings.Contains(who, "@") {
+		a, err := mail.ParseAddress(who)
+		if err != nil {
+			return Match{}, fmt.Errorf("%w: %q is not a valid address", ErrNotFound, who)
+		}
+		addr = a
+		who = a.Address
+	}
+	rows, err := db.QueryContext(ctx, `
+SELECT c.id, c.email, coalesce(c.first_name, ''), coalesce(c.last_name, ''),
+       CASE WHEN lower(c.email) = lower($2)
+              OR EXISTS (SELECT 1 FROM contact_alias a WHERE a.contact_id = c.id AND lower(a.email) = lower($2)) THEN 0
+            WHEN lower(trim(coalesce(c.first_name, '') || ' ' || coalesce(c.last_name, ''))) = lower($2) THEN 1
+            ELSE 2 END AS rank
+FROM contact c
+WHERE c.user_id = $1 AND coalesce(c.email, '') <> ''
+  AND (lower(c.email) = lower($2)
+       OR EXISTS (SELECT 1 FROM contact_alias a WHERE a.contact_id = c.id AND lower(a.email) = lower($2))
+       OR lower(trim(coalesce(c.first_name, '') || ' ' || coalesce(c.last_name, ''))) = lower($2)
+       OR lower(c.first_name) = lower($2) OR lower(c.last_name) = lower($2))
+ORDER BY rank, (c.metadata->>'last_contacted_at') DESC NULLS LAST, c.id
+LIMIT 6`, userID, who)
+	if err != nil {
+		return Match{}, fmt.Errorf("lookup contact: %w", err)
+	}
+	defer rows.Close()
+	var best []Match
+	bestRank := -1
+	for rows.Next() {
+		var (
+			m           Match
+			first, last string
+			rank        int
+		)
+		if err := rows.Scan(&m.ID, &m.Email, &first, &last, &rank); err != nil {
+			return Match{}, err
+		}
+		if bestRank >= 0 && rank > bestRank {
+			break
+		}
+		bestRank = rank
+		m.Name = strings.TrimSpace(first + " " + last)
+		best = append(best, m)
+	}
+	if err := rows.Err(); err != nil {
+		return Match{}, err
+	}
+	switch {
+	case len(best) == 1:
+		return best[0], nil
+	case len(best) > 1 && bestRank > 0:
+		var names []string
+		for _, m := range best {
+			names = append(names, m.Address())
+		}
+		return Match{}, fmt.Errorf("%w %q: %s", ErrAmbiguous, who, strings.Join(names, ", "))
+	case len(best) > 1:
+		return best[0], nil
+	case addr != nil:
+		return Match{Name: addr.Name, Email: addr.Address}, nil
+	}
+	return Match{}, fmt.Errorf("%w named %q; give their email address", ErrNotFound, who)
+}
@@ -0,0 +1,102 @@
+package contacts
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	nameNoise    = regexp.MustCompile(`\([^)]*\)|\[[^\]]*\]|<[^>]*>`)
+	honorifics   = set("mr", "mrs", "ms", "miss", "mx", "dr", "prof", "sir")
+	nameSuffixes = set("jr", "sr", "ii", "iii", "iv", "phd", "md", "cfa", "cfp", "cpa", "esq", "mba")
+	// Surname particles kept with the last name ("Ludwig van Beethoven").
+	particles = set("van", "von", "de", "del", "della", "der", "den", "da", "di", "du", "la", "le", "st", "bin", "al")
+)
+
+func set(words ...string) map[string]bool {
+	m := make(map[string]bool, len(words))
+	for _, w := range words {
+		m[w] = true
+	}
+	return m
+}
+
+// ParseName splits a display name into first and last name. "Last, First"
+// is reordered, honorifics, credentials and parenthesised notes are dropped,
+// and an address like "jane.doe@..." is used when there is no display name.
+func ParseName(display, email string) (first, last string) {
+	name := strings.TrimSpace(strings.Trim(strings.TrimSpace(display), `"'`))
+	if name == "" || strings.Contains(name, "@") {
+		name = nameFromEmail(email)
+	}
+	name = nameNoise.ReplaceAllString(name, " ")
+	if before, after, ok := strings.Cut(name, ","); ok {
+		rest := strings.TrimSpace(after)
+		if !nameSuffixes[normalizeWord(rest)] && rest != "" {
+			name = rest + " " + before
+		} else {
+			name = before
+		}
+	}
+
+	var words []string
+	for _, w := range strings.Fields(name) {
+		n := normalizeWord(w)
+		if n == "" || nameSuffixes[n] || (len(words) == 0 && honorifics[n]) {
+			continue
+		}
+		words = append(words, w)
+	}
+	switch len(words) {
+	case 0:
+		return "", ""
+	case 1:
+		return fixCase(words[0]), ""
+	}
+	split := len(words) - 1
+	for split > 1 && particles[normalizeWord(words[split-1])] {
+		split--
+	}
+	return fixCase(strings.Join(words[:split], " ")), fixCase(strings.Join(words[split:], " "))
+}
+
+// nameFromEmail turns "jane.doe" or "jane_doe" into "jane doe"; other local
+// parts (initials, role accounts) give no name.
+func nameFromEmail(email string) string {
+	local, _, _ := strings.Cut(strings.TrimSpace(email), "@")
+	local, _, _ = strings.Cut(local, "+")
+	parts := strings.FieldsFunc(local, func(r rune) bool { return r == '.' || r == '_' || r == '-' })
+	if len(parts) < 2 || len(parts) > 3 {
+		return ""
+	}
+	for _, p := range parts {
+		if len(p) < 2 || strings.IndexFunc(p, func(r rune) bool { return !unicode.IsLetter(r) }) >= 0 {
+			return ""
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func normalizeWord(w string) string {
+	return strings.ToLower(strings.Trim(w, ".,'\""))
+}
+
+// fixCase title-cases names written all in lower or upper case and leaves
+// mixed case ("McDonald", "DeShawn") alone.
+func fixCase(s string) string {
+	if s != strings.ToLower(s) && s != strings.ToUpper(s) {
+		return s
+	}
+	var b strings.Builder
+	upper := true
+	for _, r := range strings.ToLower(s) {
+		if upper {
+			b.WriteRune(unicode.ToUpper(r))
+		} else {
+			b.WriteRune(r)
+		}
+		upper = r == ' ' || r == '-' || r == '\''
+	}
+	return b.String()
+}
@@ -0,0 +1,32 @@
+package contacts
+
+import "testing"
+
+func TestParseName(t *testing.T) {
+	tests := []struct {
+		display, email string
+		first, last    string
+	}{
+		{"Jane Doe", "jane@example.com", "Jane", "Doe"},
+		{"Doe, Jane", "jane@example.com", "Jane", "Doe"},
+		{`"Dr. Jane Doe, PhD"`, "jane@example.com", "Jane", "Doe"},
+		{"Martin Luther King Jr.", "", "Martin Luther", "King"},
+		{"Ludwig van Beethoven", "", "Ludwig", "van Beethoven"},
+		{"JOHN SMITH (Acme Capital)", "", "John", "Smith"},
+		{"mary-jane o'neil", "", "Mary-Jane", "O'Neil"},
+		{"Kevin McDonald", "", "Kevin", "McDonald"},
+		{"Madonna", "", "Madonna", ""},
+		{"", "jane.doe@example.com", "Jane", "Doe"},
+		{"", "jane_doe+news@example.com", "Jane", "Doe"},
+		{"ops@example.com", "ops@example.com", "", ""},
+		{"", "jd@example.com", "", ""},
+		{"", "j.doe@example.com", "", ""},
+		{"", "", "", ""},
+	}
+	for _, tt := range tests {
+		first, last := ParseName(tt.display, tt.email)
+		if first != tt.first || last != tt.last {
+			t.Errorf("ParseName(%q, %q) = %q, %q; want %q, %q", tt.display, tt.email, first, last, tt.first, tt.last)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package embedding
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// source describes one kind of row to embed. selectSQL returns (id, text) for
+// rows without an embedding from model $1 (limit $2); storeSQL saves one
+// embedding as ($1 id, $2 model, $3 vector).
+type source struct {
+	name, selectSQL, storeSQL string
+}
+
+// The text embedded for a contact and for a meeting. Their embedding rows
+// keep its md5 so edited rows are picked up again.
+const (
+	contactText = `trim(coalesce(c.first_name, '') || ' ' || coalesce(c.last_name, '')) || E'\n' || coalesce(c.email, '')`
+	meetingText = `coalesce(m.title, '') || E'\n' || coalesce(m.location, '') || E'\n' || left(coalesce(m.description, ''), 8000)`
+)
+
+var sources = []source{
+	{"email_chunk", `
+SELECT c.id, coalesce(e.subject, '') || E'\n\n' || c.content
+FROM email_chunk c
+JOIN email e ON e.id = c.email_id
+WHERE c.embedding_model IS DISTINCT FROM $1
+ORDER BY c.id DESC
+LIMIT $2`, `
+UPDATE email_chunk SET embedding = $3::vector, embedding_model = $2 WHERE id = $1`},
+	{"note", `
+SELECT n.id, left(n.body, 8000)
+FROM note n
+LEFT JOIN note_embedding x ON x.note_id = n.id AND x.model = $1
+WHERE x.note_id IS NULL AND coalesce(n.body, '') <> ''
+ORDER BY n.id DESC
+LIMIT $2`, `
+INSERT INTO note_embedding (note_id, model, embedding) VALUES ($1, $2, $3::vector)
+ON CONFLICT (note_id) DO UPDATE SET model = EXCLUDED.model, embedding = EXCLUDED.embedding, created_at = now()`},
+	{"instruction", `
+SELECT i.id, i.text
+FROM instruction i
+LEFT JOIN instruction_embedding x ON x.instruction_id = i.id AND x.model = $1
+WHERE x.instruction_id IS NULL AND i.active AND i.text <> ''
+ORDER BY i.id DESC
+LIMIT $2`, `
+INSERT INTO instruction_embedding (instruction_id, model, embedding) VALUES ($1, $2, $3::vector)
+ON CONFLICT (instruction_id) DO UPDATE SET model = EXCLUDED.model, embedding = EXCLUDED.embedding, created_at = now()`},
+	{"contact", `
+SELECT c.id, ` + contactText + `
+FROM contact c
+LEFT JOIN contact_embedding x ON x.contact_id = c.id AND x.model = $1 AND x.content_hash = md5(` + contactText + `)
+WHERE x.contact_id IS NULL AND coalesce(c.email, '') || coalesce(c.first_name, '') || coalesce(c.last_name, '') <> ''
+ORDER BY c.id DESC
+LIMIT $2`, `
+INSERT INTO contact_embedding (contact_id, model, content_hash, embedding)
+SELECT c.id, $2, md5(` + contactText + `), $3::vector FROM contact c WHERE c.id = $1
+ON CONFLICT (contact_id) DO UPDATE SET model = EXCLUDED.model, content_hash = EXCLUDED.content_hash,
+  embedding = EXCLUDED.embedding, created_at = now()`},
+	{"meeting", `
+SELECT m.id, ` + meetingText + `
+FROM meeting m
+LEFT JOIN meeting_embedding x ON x.meeting_id = m.id AND x.model = $1 AND x.content_hash = md5(` + meetingText + `)
+WHERE x.meeting_id IS NULL AND coalesce(m.title, '') || coalesce(m.description, '') <> ''
+ORDER BY m.id DESC
+LIMIT $2`, `
+INSERT INTO meeting_embedding (meeting_id, model, content_hash, embedding)
+SELECT m.id, $2, md5(` + meetingText + `), $3::vector FROM meeting m WHERE m.id = $1
+ON CONFLICT (meeting_id) DO UPDATE SET model = EXCLUDED.model, content_hash = EXCLUDED.content_hash,
+  embedding = EXCLUDED.embedding, created_at = now()`},
+}
+
+// Backfill embeds up to batch rows per source that have no embedding for the
+// embedder's model yet (rows embedded by another model are re-embedded) and
+// returns how many embeddings were stored.
+func Backfill(ctx context.Context, db *sql.DB, e Embedder, batch int) (int, error) {
+	if batch <= 0 {
+		batch = 32
+	}
+	if err := CheckDimensions(ctx, db, e); err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, src := range sources {
+		n, err := backfillSource(ctx, db, e, src, batch)
+		total += n
+		if err != nil {
+			return total, fmt.Errorf("backfill %s: %w", src.name, err)
+		}
+	}
+	return total, nil
+}
+
+func backfillSource(ctx context.Context, db *sql.DB, e Embedder, src source, batch int) (int, error) {
+	rows, err := db.QueryContext(ctx, src.selectSQL, e.Model(), batch)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		ids   []int64
+		texts []string
+	)
+	for rows.Next() {
+		var id int64
+		var text string
+		if err := rows.Scan(&id, &text); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+		texts = append(texts, text)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	vecs, err := e.Embed(ctx, texts)
+	if err != nil {
+		return 0, err
+	}
+	for i, id := range ids {
+		if _, err := db.ExecContext(ctx, src.storeSQL, id, e.Model(), Literal(vecs[i])); err != nil {
+			return i, err
+		}
+	}
+	return len(ids), nil
+}
+
+// CheckDimensions verifies the embedder produces vectors that fit the
+// embedding columns, so a misconfigured EMBEDDING_DIMENSIONS fails loudly
+// instead of on every insert.
+func CheckDimensions(ctx context.Context, db *sql.DB, e Embedder) error {
+	var dims int
+	err := db.QueryRowContext(ctx, `
+SELECT atttypmod FROM pg_attribute
+WHERE attrelid = 'email_chunk'::regclass AND attname = 'embedding'`).Scan(&dims)
+	if err != nil {
+		return fmt.Errorf("read embedding column: %w", err)
+	}
+	if dims > 0 && dims != e.Dimensions() {
+		return fmt.Errorf("embedder %s produces %d dimensions but the embedding columns are vector(%d)", e.Model(), e.Dimensions(), dims)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"aiagentapi/internal/llm"
+)
+
+// DefaultDimensions matches the vector(n) columns created by the pgvector migration.
+const DefaultDimensions = 1536
+
+// Embedder turns text into fixed-size vectors.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	Model() string
+	Dimensions() int
+}
+
+// OpenAI calls OpenAI-compatible /embeddings endpoints through the
+// embeddings route of the provider router.
+type OpenAI struct {
+	router *llm.Router
+	model  string
+	dims   int
+	// sendDims asks the server to shorten vectors; only text-embedding-3
+	// style models accept the parameter.
+	sendDims bool
+}
+
+// NewFromEnv configures an embedder from the embeddings route (LLM_EMBEDDINGS,
+// or the EMBEDDING_* variables falling back to OPENAI_API_KEY). It returns nil
+// when no provider is configured so callers can skip semantic search entirely.
+func NewFromEnv() Embedder {
+	router := llm.Default()
+	if !router.Configured(llm.Embeddings) {
+		return nil
+	}
+
+	model := router.Model(llm.Embeddings)
+	dims := DefaultDimensions
+	if v, err := strconv.Atoi(strings.TrimSpace(os.Getenv("EMBEDDING_DIMENSIONS"))); err == nil && v > 0 {
+		dims = v
+	}
+	return &OpenAI{router: router, model: model, dims: dims, sendDims: shortens(model, dims)}
+}
+
+// nativeDimensions are the vector sizes of common embedding models.
+var nativeDimensions = map[string]int{
+	"text-embedding-3-small": 1536,
+	"text-embedding-3-large": 3072,
+	"text-embedding-ada-002": 1536,
+	"nomic-embed-text":       768,
+	"mxbai-embed-large":      1024,
+	"all-minilm":             384,
+}
+
+// shortens reports whether dims has to be requested from model: only for a
+// text-embedding-3 model asked for fewer dimensions than it natively has.
+// Other models reject the parameter, and get dims checked against what they
+// return instead.
+func shortens(model string, dims int) bool {
+	name := model[strings.LastIndex(model, "/")+1:]
+	name, _, _ = strings.Cut(name, ":")
+	native, ok := nativeDimensions[name]
+	return ok && strings.HasPrefix(name, "text-embedding-3") && dims != native
+}
+
+func (e *OpenAI) Model() string   { return e.model }
+func (e *OpenAI) Dimensions() int { return e.dims }
+
+func (e *OpenAI) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	req := openai.EmbeddingRequest{Input: texts, Model: openai.EmbeddingModel(e.model)}
+	if e.sendDims {
+		req.Dimensions = e.dims
+	}
+	resp, err := e.router.CreateEmbeddings(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("embedding: got %d vectors for %d inputs", len(resp.Data), len(texts))
+	}
+	out := make([][]float32, len(texts))
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= len(out) {
+			return nil, fmt.Errorf("embedding: index %d out of range", d.Index)
+		}
+		if len(d.Embedding) != e.dims {
+			return nil, fmt.Errorf("embedding: model %s returned %d dimensions, expected %d", e.model, len(d.Embedding), e.dims)
+		}
+		out[d.Index] = d.Embedding
+	}
+	return out, nil
+}
+
+// Literal formats v as a pgvector input literal, e.g. "[0.1,0.2]", for use
+// with a $n::vector parameter.
+func Literal(v []float32) string {
+	var b strings.Builder
+	b.Grow(len(v) * 10)
+	b.WriteByte('[')
+	for i, f := range v {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(f), 'g', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
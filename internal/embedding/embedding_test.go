@@ -0,0 +1,25 @@
+package embedding
+
+import "testing"
+
+func TestShortens(t *testing.T) {
+	tests := []struct {
+		model string
+		dims  int
+		want  bool
+	}{
+		{"text-embedding-3-small", 1536, false},
+		{"text-embedding-3-small", 512, true},
+		{"openai/text-embedding-3-large", 1536, true},
+		{"text-embedding-3-large", 3072, false},
+		{"text-embedding-ada-002", 1536, false},
+		{"nomic-embed-text", 1536, false},
+		{"nomic-embed-text:latest", 768, false},
+		{"some-local-model", 1536, false},
+	}
+	for _, tt := range tests {
+		if got := shortens(tt.model, tt.dims); got != tt.want {
+			t.Errorf("shortens(%q, %d) = %v, want %v", tt.model, tt.dims, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+
+	"aiagentapi/internal/mailparse"
+)
+
+// CSV renders each record as a line of " | " separated fields, so column
+// values stay searchable and readable in a snippet.
+func CSV(data []byte, comma rune) (string, error) {
+	text := mailparse.ToUTF8(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), "", "text/csv")
+	r := csv.NewReader(strings.NewReader(text))
+	r.Comma = comma
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	r.ReuseRecord = true
+
+	var b strings.Builder
+	for b.Len() < MaxTextLen {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var perr *csv.ParseError
+			if errors.As(err, &perr) && b.Len() > 0 {
+				// Keep the rows before a malformed one.
+				break
+			}
+			return "", err
+		}
+		empty := true
+		for i, f := range rec {
+			rec[i] = strings.TrimSpace(f)
+			if rec[i] != "" {
+				empty = false
+			}
+		}
+		if empty {
+			continue
+		}
+		b.WriteString(strings.Join(rec, " | "))
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,79 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DOCX returns the text of a Word document's body: paragraphs on their own
+// lines, tabs and explicit breaks preserved.
+func DOCX(data []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("docx: %w", err)
+	}
+	for _, f := range zr.File {
+		if f.Name != "word/document.xml" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return "", fmt.Errorf("docx: %w", err)
+		}
+		defer rc.Close()
+		return wordXMLText(io.LimitReader(rc, 64<<20))
+	}
+	return "", errors.New("docx: word/document.xml not found")
+}
+
+func wordXMLText(r io.Reader) (string, error) {
+	const ns = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+	var (
+		b      strings.Builder
+		inText bool
+	)
+	d := xml.NewDecoder(r)
+	for b.Len() < MaxTextLen {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("docx: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space != ns {
+				continue
+			}
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				b.WriteByte('\t')
+			case "br", "cr":
+				b.WriteByte('\n')
+			}
+		case xml.EndElement:
+			if t.Name.Space != ns {
+				continue
+			}
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				b.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				b.Write(t)
+			}
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,88 @@
+// Package extract pulls plain text out of email attachments (PDF, DOCX, CSV
+// and plain text) without external tools.
+package extract
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"aiagentapi/internal/mailparse"
+)
+
+// ErrUnsupported means the attachment's format has no text extractor.
+var ErrUnsupported = errors.New("extract: unsupported attachment type")
+
+// MaxTextLen caps the stored text of one attachment, in bytes.
+const MaxTextLen = 200000
+
+// Kind names the extractor for a MIME type or, failing that, the file
+// extension: "pdf", "docx", "csv", "text", or "" when unsupported.
+func Kind(mimeType, filename string) string {
+	switch strings.ToLower(mimeType) {
+	case "application/pdf", "application/x-pdf":
+		return "pdf"
+	case "application/vnd.openxmlformats-officedocument.wordprocessingml.document":
+		return "docx"
+	case "text/csv", "application/csv", "text/comma-separated-values", "text/tab-separated-values":
+		return "csv"
+	case "text/plain", "text/markdown", "text/x-markdown":
+		return "text"
+	}
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".pdf":
+		return "pdf"
+	case ".docx":
+		return "docx"
+	case ".csv", ".tsv":
+		return "csv"
+	case ".txt", ".md", ".text", ".log":
+		return "text"
+	}
+	return ""
+}
+
+// Supported reports whether Text can handle the attachment.
+func Supported(mimeType, filename string) bool {
+	return Kind(mimeType, filename) != ""
+}
+
+// Text extracts readable text from an attachment's bytes. The result is
+// valid UTF-8 and at most MaxTextLen bytes.
+func Text(mimeType, filename string, data []byte) (string, error) {
+	var (
+		s   string
+		err error
+	)
+	switch Kind(mimeType, filename) {
+	case "pdf":
+		s, err = PDF(data)
+	case "docx":
+		s, err = DOCX(data)
+	case "csv":
+		comma := ','
+		if strings.EqualFold(path.Ext(filename), ".tsv") || strings.Contains(mimeType, "tab-separated") {
+			comma = '\t'
+		}
+		s, err = CSV(data, comma)
+	case "text":
+		s = mailparse.ToUTF8(data, "", "text/plain")
+	default:
+		return "", ErrUnsupported
+	}
+	if err != nil {
+		return "", err
+	}
+	return limit(strings.TrimSpace(s), MaxTextLen), nil
+}
+
+func limit(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
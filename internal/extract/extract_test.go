@@ -0,0 +1,112 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func docxFile(t *testing.T, document string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for name, body := range map[string]string{
+		"[Content_Types].xml": `<?xml version="1.0"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"/>`,
+		"word/document.xml":   document,
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestDOCX(t *testing.T) {
+	data := docxFile(t, `<?xml version="1.0" encoding="UTF-8"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:body>
+<w:p><w:r><w:t>Portfolio </w:t></w:r><w:r><w:t>review</w:t></w:r></w:p>
+<w:p><w:r><w:t>AAPL</w:t><w:tab/><w:t>sell</w:t><w:br/><w:t>Q3 &amp; Q4</w:t></w:r></w:p>
+<w:sectPr><w:pgSz w:w="12240"/></w:sectPr>
+</w:body>
+</w:document>`)
+	got, err := DOCX(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Portfolio review\nAAPL\tsell\nQ3 & Q4\n"; got != want {
+		t.Errorf("DOCX = %q, want %q", got, want)
+	}
+
+	if _, err := DOCX([]byte("not a zip")); err == nil {
+		t.Error("a non-zip file was accepted")
+	}
+	var empty bytes.Buffer
+	zip.NewWriter(&empty).Close()
+	if _, err := DOCX(empty.Bytes()); err == nil {
+		t.Error("a zip without word/document.xml was accepted")
+	}
+}
+
+func TestCSV(t *testing.T) {
+	tests := []struct {
+		data  string
+		comma rune
+		want  string
+	}{
+		{"\xef\xbb\xbfname,ticker\n Greg , AAPL \n,\n", ',', "name | ticker\nGreg | AAPL\n"},
+		{"a\tb\n1\t\"two, quoted\"\n", '\t', "a | b\n1 | two, quoted\n"},
+		{"caf\xe9,1\n", ',', "café | 1\n"},
+		{"a,b,c\n1,2\n", ',', "a | b | c\n1 | 2\n"},
+	}
+	for _, tt := range tests {
+		got, err := CSV([]byte(tt.data), tt.comma)
+		if err != nil {
+			t.Errorf("CSV(%q): %v", tt.data, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("CSV(%q) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestKind(t *testing.T) {
+	tests := []struct{ mimeType, filename, want string }{
+		{"application/pdf", "", "pdf"},
+		{"application/octet-stream", "Statement.PDF", "pdf"},
+		{"application/vnd.openxmlformats-officedocument.wordprocessingml.document", "", "docx"},
+		{"text/tab-separated-values", "", "csv"},
+		{"", "notes.md", "text"},
+		{"image/png", "scan.png", ""},
+	}
+	for _, tt := range tests {
+		if got := Kind(tt.mimeType, tt.filename); got != tt.want {
+			t.Errorf("Kind(%q, %q) = %q, want %q", tt.mimeType, tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestText(t *testing.T) {
+	if got, err := Text("application/octet-stream", "trades.tsv", []byte("a\tb\n")); err != nil || got != "a | b" {
+		t.Errorf("Text(tsv) = %q, %v", got, err)
+	}
+	if got, err := Text("text/plain", "", []byte("  caf\xe9 \n")); err != nil || got != "café" {
+		t.Errorf("Text(text) = %q, %v", got, err)
+	}
+	if _, err := Text("image/png", "", nil); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Text(png) err = %v", err)
+	}
+	long := strings.Repeat("é", MaxTextLen)
+	got, err := Text("text/plain", "", []byte(long))
+	if err != nil || len(got) > MaxTextLen || !strings.HasPrefix(long, got) {
+		t.Errorf("Text of %d bytes came back as %d bytes, %v", len(long), len(got), err)
+	}
+}
@@ -0,0 +1,108 @@
+package extract
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"aiagentapi/internal/google"
+)
+
+// MaxAttachmentSize is the largest attachment that is downloaded for extraction.
+const MaxAttachmentSize = 20 << 20
+
+// Attachment downloads one email_attachment row, extracts its text and
+// stores it. Download failures are returned so the task can be retried;
+// documents that can't be read are recorded in extract_error instead.
+func Attachment(ctx context.Context, db *sql.DB, cfg google.Config, id int64) error {
+	var (
+		userID, messageID, partID string
+		filename, mimeType, attID sql.NullString
+		size                      sql.NullInt64
+		data                      []byte
+	)
+	err := db.QueryRowContext(ctx, `
+SELECT a.user_id, e.gmail_message_id, a.part_id, a.filename, a.mime_type, a.size_bytes,
+       a.gmail_attachment_id, a.data
+FROM email_attachment a JOIN email e ON e.id = a.email_id
+WHERE a.id=$1`, id).Scan(&userID, &messageID, &partID, &filename, &mimeType, &size, &attID, &data)
+	if err == sql.ErrNoRows {
+		// The message was deleted since the task was queued.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("load attachment %d: %w", id, err)
+	}
+	if !Supported(mimeType.String, filename.String) {
+		return record(ctx, db, id, "", ErrUnsupported)
+	}
+	if size.Int64 > MaxAttachmentSize {
+		return record(ctx, db, id, "", fmt.Errorf("extract: attachment is larger than %d bytes", MaxAttachmentSize))
+	}
+
+	if len(data) == 0 {
+		g, err := cfg.ForUser(ctx, db, userID)
+		if err != nil {
+			return err
+		}
+		if data, err = download(ctx, g, messageID, partID, attID.String); err != nil {
+			return fmt.Errorf("download attachment %d: %w", id, err)
+		}
+	}
+	text, err := Text(mimeType.String, filename.String, data)
+	return record(ctx, db, id, text, err)
+}
+
+// download fetches an attachment, refreshing its (short-lived) attachment id
+// from the message when the stored one is no longer accepted.
+func download(ctx context.Context, g *google.Client, messageID, partID, attID string) ([]byte, error) {
+	if attID != "" {
+		data, err := g.GetAttachment(ctx, messageID, attID)
+		if err == nil || !(google.IsStatus(err, http.StatusBadRequest) || google.IsStatus(err, http.StatusNotFound)) {
+			return data, err
+		}
+	}
+	m, err := g.GetMessage(ctx, messageID, "full")
+	if err != nil {
+		return nil, err
+	}
+	p := findPart(m.Payload, partID)
+	if p == nil {
+		return nil, errors.New("attachment part no longer in message")
+	}
+	if p.Body.AttachmentID == "" {
+		return google.DecodeData(p.Body.Data)
+	}
+	return g.GetAttachment(ctx, messageID, p.Body.AttachmentID)
+}
+
+func findPart(p *google.MessagePart, id string) *google.MessagePart {
+	if p == nil {
+		return nil
+	}
+	if p.PartID == id {
+		return p
+	}
+	for i := range p.Parts {
+		if found := findPart(&p.Parts[i], id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func record(ctx context.Context, db *sql.DB, id int64, text string, extractErr error) error {
+	var msg, body any
+	if extractErr != nil {
+		msg = extractErr.Error()
+	} else {
+		body = text
+	}
+	_, err := db.ExecContext(ctx, `
+UPDATE email_attachment
+SET extracted_text=$2, extract_error=$3, extracted_at=now(), updated_at=now()
+WHERE id=$1`, id, body, msg)
+	return err
+}
@@ -0,0 +1,721 @@
+package extract
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/ascii85"
+	"errors"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+var (
+	errPDFEncrypted = errors.New("pdf: encrypted documents are not supported")
+	errPDFNoText    = errors.New("pdf: no extractable text (scanned or image-only document?)")
+
+	pdfObjHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+	pdfEncrypt   = regexp.MustCompile(`/Encrypt\s*(<<|\d+\s+\d+\s+R)`)
+)
+
+// PDF returns the text of each page, in page order, separated by blank
+// lines. Text drawn with fonts that carry no Unicode mapping (common in
+// scanned documents) is skipped.
+func PDF(data []byte) (string, error) {
+	if !bytes.Contains(data[:min(len(data), 1024)], []byte("%PDF-")) {
+		return "", errors.New("pdf: missing %PDF header")
+	}
+	if pdfEncrypt.Match(data) {
+		return "", errPDFEncrypted
+	}
+	doc := parsePDF(data)
+	var pages []string
+	for _, page := range doc.pages() {
+		if s := strings.TrimSpace(doc.pageText(page)); s != "" {
+			pages = append(pages, s)
+		}
+	}
+	if len(pages) == 0 {
+		return "", errPDFNoText
+	}
+	return strings.Join(pages, "\n\n"), nil
+}
+
+type pdfDoc struct {
+	objects map[int]any
+	fonts   map[pdfRef]*pdfFont
+}
+
+// parsePDF indexes every "n g obj" in the file, later definitions winning
+// as with incremental updates, then unpacks compressed object streams. The
+// xref table is ignored, which also makes damaged files readable.
+func parsePDF(data []byte) *pdfDoc {
+	doc := &pdfDoc{objects: map[int]any{}, fonts: map[pdfRef]*pdfFont{}}
+	for _, m := range pdfObjHeader.FindAllSubmatchIndex(data, -1) {
+		num, _ := strconv.Atoi(string(data[m[2]:m[3]]))
+		l := &pdfLexer{b: data, pos: m[1]}
+		v, err := l.next()
+		if err != nil {
+			continue
+		}
+		if d, ok := v.(pdfDict); ok {
+			save := l.pos
+			if kw, _ := l.next(); kw == pdfKeyword("stream") {
+				length, _ := d["Length"].(float64)
+				v = &pdfStream{dict: d, raw: l.streamData(int(length))}
+			} else {
+				l.pos = save
+			}
+		}
+		doc.objects[num] = v
+	}
+
+	for _, v := range doc.objects {
+		s, ok := v.(*pdfStream)
+		if !ok || s.dict["Type"] != pdfName("ObjStm") {
+			continue
+		}
+		doc.unpackObjectStream(s)
+	}
+	return doc
+}
+
+func (doc *pdfDoc) unpackObjectStream(s *pdfStream) {
+	data, err := doc.decode(s)
+	if err != nil {
+		return
+	}
+	n, _ := doc.resolve(s.dict["N"]).(float64)
+	first, _ := doc.resolve(s.dict["First"]).(float64)
+	l := &pdfLexer{b: data}
+	type entry struct{ num, off int }
+	var entries []entry
+	for i := 0; i < int(n); i++ {
+		a, err1 := l.next()
+		b, err2 := l.next()
+		num, ok1 := a.(float64)
+		off, ok2 := b.(float64)
+		if err1 != nil || err2 != nil || !ok1 || !ok2 {
+			break
+		}
+		entries = append(entries, entry{int(num), int(off)})
+	}
+	for _, e := range entries {
+		if _, exists := doc.objects[e.num]; exists {
+			continue
+		}
+		pos := int(first) + e.off
+		if pos < 0 || pos >= len(data) {
+			continue
+		}
+		ol := &pdfLexer{b: data, pos: pos}
+		if v, err := ol.next(); err == nil {
+			doc.objects[e.num] = v
+		}
+	}
+}
+
+func (doc *pdfDoc) resolve(v any) any {
+	for i := 0; i < 8; i++ {
+		r, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		v = doc.objects[r.num]
+	}
+	return nil
+}
+
+func (doc *pdfDoc) dict(v any) pdfDict {
+	switch t := doc.resolve(v).(type) {
+	case pdfDict:
+		return t
+	case *pdfStream:
+		return t.dict
+	}
+	return nil
+}
+
+// decode applies a stream's filters. Only the filters used for text content
+// are supported; image codecs are not.
+func (doc *pdfDoc) decode(s *pdfStream) ([]byte, error) {
+	data := s.raw
+	var filters []any
+	switch f := doc.resolve(s.dict["Filter"]).(type) {
+	case pdfName:
+		filters = []any{f}
+	case pdfArray:
+		filters = f
+	}
+	parms := doc.resolve(s.dict["DecodeParms"])
+	for i, f := range filters {
+		var p pdfDict
+		switch t := parms.(type) {
+		case pdfDict:
+			p = t
+		case pdfArray:
+			if i < len(t) {
+				p = doc.dict(t[i])
+			}
+		}
+		var err error
+		switch doc.resolve(f) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			data, err = inflate(data)
+			if err == nil {
+				data, err = unpredict(data, p)
+			}
+		case pdfName("ASCIIHexDecode"), pdfName("AHx"):
+			data = (&pdfLexer{b: append(append([]byte{'<'}, data...), '>')}).hex()
+		case pdfName("ASCII85Decode"), pdfName("A85"):
+			data, err = decodeASCII85(data)
+		default:
+			return nil, errors.New("pdf: unsupported filter")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// inflate decompresses zlib data, keeping whatever decoded before a
+// truncated or corrupt tail.
+func inflate(data []byte) ([]byte, error) {
+	var r io.Reader
+	if zr, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+		r = zr
+	} else {
+		r = flate.NewReader(bytes.NewReader(data))
+	}
+	out, err := io.ReadAll(io.LimitReader(r, 64<<20))
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+// unpredict reverses PNG row predictors (Predictor >= 10).
+func unpredict(data []byte, p pdfDict) ([]byte, error) {
+	pred, _ := p["Predictor"].(float64)
+	if pred < 10 {
+		return data, nil
+	}
+	cols := 1
+	if c, ok := p["Columns"].(float64); ok && c > 0 {
+		cols = int(c)
+	}
+	row := cols + 1
+	var out []byte
+	prev := make([]byte, cols)
+	for i := 0; i+row <= len(data); i += row {
+		typ, cur := data[i], append([]byte(nil), data[i+1:i+row]...)
+		for j := range cur {
+			var left, upLeft byte
+			if j > 0 {
+				left, upLeft = cur[j-1], prev[j-1]
+			}
+			switch typ {
+			case 1:
+				cur[j] += left
+			case 2:
+				cur[j] += prev[j]
+			case 3:
+				cur[j] += byte((int(left) + int(prev[j])) / 2)
+			case 4:
+				cur[j] += paeth(left, prev[j], upLeft)
+			}
+		}
+		out = append(out, cur...)
+		prev = cur
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func decodeASCII85(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	data = bytes.TrimPrefix(data, []byte("<~"))
+	if i := bytes.Index(data, []byte("~>")); i >= 0 {
+		data = data[:i]
+	}
+	out := make([]byte, 4*len(data)/5+4)
+	n, _, err := ascii85.Decode(out, data, true)
+	return out[:n], err
+}
+
+// pdfPage is a leaf of the page tree with its (possibly inherited) resources.
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+}
+
+// pages walks the page tree from the document catalog. Files without a
+// readable catalog fall back to every /Page object in object-number order.
+func (doc *pdfDoc) pages() []pdfPage {
+	var nums []int
+	for n := range doc.objects {
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+
+	var root pdfDict
+	for _, n := range nums {
+		if d := doc.dict(doc.objects[n]); d != nil && d["Type"] == pdfName("Catalog") {
+			root = d
+		}
+	}
+	var out []pdfPage
+	seen := map[int]bool{}
+	var walk func(v any, inherited pdfDict, depth int)
+	walk = func(v any, inherited pdfDict, depth int) {
+		if r, ok := v.(pdfRef); ok {
+			if seen[r.num] {
+				return
+			}
+			seen[r.num] = true
+		}
+		d := doc.dict(v)
+		if d == nil || depth > 32 {
+			return
+		}
+		res := inherited
+		if r := doc.dict(d["Resources"]); r != nil {
+			res = r
+		}
+		if kids, ok := doc.resolve(d["Kids"]).(pdfArray); ok {
+			for _, k := range kids {
+				walk(k, res, depth+1)
+			}
+			return
+		}
+		if d["Type"] == pdfName("Page") || d["Contents"] != nil {
+			out = append(out, pdfPage{dict: d, resources: res})
+		}
+	}
+	if root != nil {
+		walk(root["Pages"], nil, 0)
+	}
+	if len(out) > 0 {
+		return out
+	}
+	for _, n := range nums {
+		if d := doc.dict(doc.objects[n]); d != nil && d["Type"] == pdfName("Page") {
+			out = append(out, pdfPage{dict: d, resources: doc.dict(d["Resources"])})
+		}
+	}
+	return out
+}
+
+func (doc *pdfDoc) pageText(p pdfPage) string {
+	var content []byte
+	switch c := doc.resolve(p.dict["Contents"]).(type) {
+	case *pdfStream:
+		content, _ = doc.decode(c)
+	case pdfArray:
+		for _, part := range c {
+			if s, ok := doc.resolve(part).(*pdfStream); ok {
+				if b, err := doc.decode(s); err == nil {
+					content = append(append(content, b...), '\n')
+				}
+			}
+		}
+	}
+	var w pdfTextWriter
+	doc.runContent(content, p.resources, &w, 0)
+	return w.String()
+}
+
+// pdfTextWriter joins shown strings with the separator the interpreter asked
+// for since the last one: a newline after a vertical move, a space after a
+// horizontal gap.
+type pdfTextWriter struct {
+	b       strings.Builder
+	pending string
+}
+
+func (w *pdfTextWriter) show(s string) {
+	if s == "" {
+		return
+	}
+	if w.b.Len() > 0 {
+		w.b.WriteString(w.pending)
+	}
+	w.pending = ""
+	w.b.WriteString(s)
+}
+
+func (w *pdfTextWriter) newline() { w.pending = "\n" }
+
+func (w *pdfTextWriter) space() {
+	if w.pending == "" {
+		w.pending = " "
+	}
+}
+
+func (w *pdfTextWriter) String() string { return w.b.String() }
+
+// runContent interprets the text operators of a content stream, descending
+// into form XObjects. The pen position is tracked from glyph widths so that
+// text placed glyph by glyph still comes out as words.
+func (doc *pdfDoc) runContent(content []byte, resources pdfDict, w *pdfTextWriter, depth int) {
+	var (
+		l        = &pdfLexer{b: content}
+		operands []any
+		font     *pdfFont
+		size     = 10.0
+		// Line start, pen position and baseline in text space.
+		lineX, x, y float64
+	)
+	fonts := doc.dict(resources["Font"])
+	moveTo := func(nx, ny float64) {
+		switch {
+		case ny != y:
+			w.newline()
+		case nx-x > 0.2*size || x-nx > size:
+			w.space()
+		}
+		lineX, x, y = nx, nx, ny
+	}
+	show := func(v any) {
+		text, width := font.decode(v)
+		w.show(text)
+		x += width * size
+	}
+	num := func(i int) float64 {
+		if i < len(operands) {
+			f, _ := operands[i].(float64)
+			return f
+		}
+		return 0
+	}
+	for {
+		v, err := l.next()
+		if err != nil {
+			return
+		}
+		op, ok := v.(pdfKeyword)
+		if !ok {
+			operands = append(operands, v)
+			continue
+		}
+		switch op {
+		case "BT":
+			lineX, x, y = 0, 0, 0
+		case "ET":
+			w.space()
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[0].(pdfName); ok && fonts != nil {
+					font = doc.font(fonts[name])
+				}
+				if s := math.Abs(num(1)); s > 0 {
+					size = s
+				}
+			}
+		case "Td", "TD":
+			moveTo(lineX+num(0), y+num(1))
+		case "Tm":
+			if len(operands) >= 6 {
+				moveTo(num(4), num(5))
+			}
+		case "T*":
+			w.newline()
+			x = lineX
+		case "Tj":
+			if len(operands) >= 1 {
+				show(operands[0])
+			}
+		case "'":
+			w.newline()
+			x = lineX
+			if len(operands) >= 1 {
+				show(operands[0])
+			}
+		case "\"":
+			w.newline()
+			x = lineX
+			if len(operands) >= 3 {
+				show(operands[2])
+			}
+		case "TJ":
+			if len(operands) >= 1 {
+				arr, _ := operands[0].(pdfArray)
+				for _, item := range arr {
+					switch t := item.(type) {
+					case pdfString:
+						show(t)
+					case float64:
+						if t < -180 {
+							w.space()
+						}
+						x -= t / 1000 * size
+					}
+				}
+			}
+		case "Do":
+			if len(operands) >= 1 && depth < 4 {
+				name, _ := operands[0].(pdfName)
+				xobjs := doc.dict(resources["XObject"])
+				if s, ok := doc.resolve(xobjs[name]).(*pdfStream); ok && s.dict["Subtype"] == pdfName("Form") {
+					if b, err := doc.decode(s); err == nil {
+						res := resources
+						if r := doc.dict(s.dict["Resources"]); r != nil {
+							res = r
+						}
+						doc.runContent(b, res, w, depth+1)
+					}
+				}
+			}
+		case "ID":
+			// Inline image data runs to the next "EI".
+			if i := bytes.Index(content[l.pos:], []byte("EI")); i >= 0 {
+				l.pos += i + 2
+			} else {
+				return
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+// pdfFont maps string bytes to Unicode via the font's ToUnicode CMap, or via
+// WinAnsi for simple fonts without one, and knows each code's advance width
+// (in thousandths of the font size).
+type pdfFont struct {
+	cmap         map[uint32]string
+	codeLen      int
+	composite    bool
+	widths       map[uint32]float64
+	defaultWidth float64
+}
+
+func (doc *pdfDoc) font(v any) *pdfFont {
+	r, isRef := v.(pdfRef)
+	if isRef {
+		if f, ok := doc.fonts[r]; ok {
+			return f
+		}
+	}
+	d := doc.dict(v)
+	f := &pdfFont{codeLen: 1, widths: map[uint32]float64{}, defaultWidth: 500}
+	if d != nil {
+		f.composite = d["Subtype"] == pdfName("Type0")
+		if f.composite {
+			f.codeLen, f.defaultWidth = 2, 1000
+			if desc, ok := doc.resolve(d["DescendantFonts"]).(pdfArray); ok && len(desc) > 0 {
+				doc.cidWidths(f, doc.dict(desc[0]))
+			}
+		} else if ws, ok := doc.resolve(d["Widths"]).(pdfArray); ok {
+			first, _ := doc.resolve(d["FirstChar"]).(float64)
+			for i, w := range ws {
+				if w, ok := doc.resolve(w).(float64); ok {
+					f.widths[uint32(int(first)+i)] = w
+				}
+			}
+		}
+		if s, ok := doc.resolve(d["ToUnicode"]).(*pdfStream); ok {
+			if b, err := doc.decode(s); err == nil {
+				f.cmap, f.codeLen = parseToUnicode(b, f.codeLen)
+			}
+		}
+	}
+	if isRef {
+		doc.fonts[r] = f
+	}
+	return f
+}
+
+// cidWidths reads a CID font's /DW and /W arrays ("c [w1 w2 ...]" and
+// "cfirst clast w" entries).
+func (doc *pdfDoc) cidWidths(f *pdfFont, d pdfDict) {
+	if d == nil {
+		return
+	}
+	if dw, ok := doc.resolve(d["DW"]).(float64); ok {
+		f.defaultWidth = dw
+	}
+	ws, _ := doc.resolve(d["W"]).(pdfArray)
+	for i := 0; i+1 < len(ws); {
+		first, ok := doc.resolve(ws[i]).(float64)
+		if !ok {
+			return
+		}
+		switch next := doc.resolve(ws[i+1]).(type) {
+		case pdfArray:
+			for j, w := range next {
+				if w, ok := doc.resolve(w).(float64); ok {
+					f.widths[uint32(first)+uint32(j)] = w
+				}
+			}
+			i += 2
+		case float64:
+			if i+2 >= len(ws) {
+				return
+			}
+			w, _ := doc.resolve(ws[i+2]).(float64)
+			for c := first; c <= next && c-first < 0xffff; c++ {
+				f.widths[uint32(c)] = w
+			}
+			i += 3
+		default:
+			return
+		}
+	}
+}
+
+// decode returns the text of a shown string and its advance width in units
+// of the font size.
+func (f *pdfFont) decode(v any) (string, float64) {
+	s, ok := v.(pdfString)
+	if !ok || len(s) == 0 {
+		return "", 0
+	}
+	if f == nil {
+		f = &pdfFont{codeLen: 1, defaultWidth: 500}
+	}
+	var (
+		b     strings.Builder
+		width float64
+	)
+	for i := 0; i+f.codeLen <= len(s); i += f.codeLen {
+		code := bytesToCode(s[i : i+f.codeLen])
+		if w, ok := f.widths[code]; ok {
+			width += w
+		} else {
+			width += f.defaultWidth
+		}
+		switch {
+		case f.cmap != nil:
+			b.WriteString(f.cmap[code])
+		case !f.composite:
+			// Without a ToUnicode map, read simple fonts as WinAnsi. Glyph
+			// ids of composite fonts can't be read.
+			if r, err := charmap.Windows1252.NewDecoder().Bytes([]byte{byte(code)}); err == nil {
+				b.Write(r)
+			}
+		}
+	}
+	return strings.Map(printable, b.String()), width / 1000
+}
+
+func printable(r rune) rune {
+	if r < 0x20 && r != '\t' && r != '\n' {
+		return -1
+	}
+	return r
+}
+
+// parseToUnicode reads the bfchar and bfrange sections of a ToUnicode CMap.
+// The code length comes from the codespace range.
+func parseToUnicode(b []byte, codeLen int) (map[uint32]string, int) {
+	m := map[uint32]string{}
+	l := &pdfLexer{b: b}
+	var operands []any
+	for {
+		v, err := l.next()
+		if err != nil {
+			break
+		}
+		kw, ok := v.(pdfKeyword)
+		if !ok {
+			operands = append(operands, v)
+			continue
+		}
+		switch kw {
+		case "begincodespacerange", "beginbfchar", "beginbfrange":
+			operands = operands[:0]
+			continue
+		case "endcodespacerange":
+			if len(operands) > 0 {
+				if lo, ok := operands[0].(pdfString); ok && len(lo) > 0 {
+					codeLen = len(lo)
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(pdfString)
+				dst, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 {
+					m[bytesToCode(src)] = utf16BE(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 {
+					continue
+				}
+				start, end := bytesToCode(lo), bytesToCode(hi)
+				if end < start || end-start > 0xffff {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case pdfString:
+					base := []rune(utf16BE(dst))
+					if len(base) == 0 {
+						continue
+					}
+					for c := start; c <= end; c++ {
+						r := append([]rune(nil), base...)
+						r[len(r)-1] += rune(c - start)
+						m[c] = string(r)
+					}
+				case pdfArray:
+					for j, d := range dst {
+						if s, ok := d.(pdfString); ok && start+uint32(j) <= end {
+							m[start+uint32(j)] = utf16BE(s)
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+	return m, codeLen
+}
+
+func bytesToCode(b []byte) uint32 {
+	var c uint32
+	for _, x := range b {
+		c = c<<8 | uint32(x)
+	}
+	return c
+}
+
+func utf16BE(b []byte) string {
+	if len(b)%2 == 1 {
+		b = append([]byte{0}, b...)
+	}
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(u))
+}
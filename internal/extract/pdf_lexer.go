@@ -0,0 +1,304 @@
+package extract
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+)
+
+// PDF object model: just enough of ISO 32000 to walk pages and read content
+// streams. Numbers are float64, names pdfName, strings pdfString.
+type (
+	pdfName    string
+	pdfString  []byte
+	pdfKeyword string
+	pdfArray   []any
+	pdfDict    map[pdfName]any
+	pdfRef     struct{ num, gen int }
+	pdfStream  struct {
+		dict pdfDict
+		raw  []byte
+	}
+)
+
+var errPDFSyntax = errors.New("pdf: syntax error")
+
+type pdfLexer struct {
+	b   []byte
+	pos int
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelim(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.b) {
+		c := l.b[l.pos]
+		switch {
+		case isPDFSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.b) && l.b[l.pos] != '\n' && l.b[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// next reads one value. Keywords (operators, obj, stream, R...) come back as
+// pdfKeyword; "n g R" references are folded into a pdfRef.
+func (l *pdfLexer) next() (any, error) {
+	l.skipSpace()
+	if l.pos >= len(l.b) {
+		return nil, errPDFSyntax
+	}
+	c := l.b[l.pos]
+	switch {
+	case c == '/':
+		return l.name(), nil
+	case c == '(':
+		return l.literal(), nil
+	case c == '<' && l.pos+1 < len(l.b) && l.b[l.pos+1] == '<':
+		l.pos += 2
+		return l.dict()
+	case c == '<':
+		return l.hex(), nil
+	case c == '[':
+		l.pos++
+		return l.array()
+	case c == ']' || c == '>' || c == ')' || c == '{' || c == '}':
+		l.pos++
+		if c == '>' && l.pos < len(l.b) && l.b[l.pos] == '>' {
+			l.pos++
+			return pdfKeyword(">>"), nil
+		}
+		return pdfKeyword(string(c)), nil
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return l.number(), nil
+	}
+	start := l.pos
+	for l.pos < len(l.b) && !isPDFSpace(l.b[l.pos]) && !isPDFDelim(l.b[l.pos]) {
+		l.pos++
+	}
+	if l.pos == start {
+		l.pos++
+	}
+	switch kw := string(l.b[start:l.pos]); kw {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	default:
+		return pdfKeyword(kw), nil
+	}
+}
+
+func (l *pdfLexer) name() pdfName {
+	l.pos++
+	var b []byte
+	for l.pos < len(l.b) && !isPDFSpace(l.b[l.pos]) && !isPDFDelim(l.b[l.pos]) {
+		c := l.b[l.pos]
+		if c == '#' && l.pos+2 < len(l.b) {
+			if v, err := strconv.ParseUint(string(l.b[l.pos+1:l.pos+3]), 16, 8); err == nil {
+				b = append(b, byte(v))
+				l.pos += 3
+				continue
+			}
+		}
+		b = append(b, c)
+		l.pos++
+	}
+	return pdfName(b)
+}
+
+func (l *pdfLexer) number() any {
+	start := l.pos
+	l.pos++
+	for l.pos < len(l.b) && (l.b[l.pos] == '.' || (l.b[l.pos] >= '0' && l.b[l.pos] <= '9')) {
+		l.pos++
+	}
+	tok := string(l.b[start:l.pos])
+	v, err := strconv.ParseFloat(tok, 64)
+	if err != nil {
+		return float64(0)
+	}
+	// "num gen R" is an indirect reference.
+	if n, err := strconv.Atoi(tok); err == nil && n >= 0 {
+		save := l.pos
+		l.skipSpace()
+		gstart := l.pos
+		for l.pos < len(l.b) && l.b[l.pos] >= '0' && l.b[l.pos] <= '9' {
+			l.pos++
+		}
+		if l.pos > gstart {
+			gen, _ := strconv.Atoi(string(l.b[gstart:l.pos]))
+			l.skipSpace()
+			if l.pos < len(l.b) && l.b[l.pos] == 'R' && (l.pos+1 == len(l.b) || isPDFSpace(l.b[l.pos+1]) || isPDFDelim(l.b[l.pos+1])) {
+				l.pos++
+				return pdfRef{n, gen}
+			}
+		}
+		l.pos = save
+	}
+	return v
+}
+
+func (l *pdfLexer) literal() pdfString {
+	l.pos++
+	var out []byte
+	depth := 1
+	for l.pos < len(l.b) {
+		c := l.b[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+		case '\\':
+			if l.pos >= len(l.b) {
+				return out
+			}
+			e := l.b[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.b) && l.b[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.b) && l.b[l.pos] >= '0' && l.b[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.b[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func (l *pdfLexer) hex() pdfString {
+	l.pos++
+	var digits []byte
+	for l.pos < len(l.b) && l.b[l.pos] != '>' {
+		if c := l.b[l.pos]; !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+		l.pos++
+	}
+	l.pos++
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, 0, len(digits)/2)
+	for i := 0; i+1 < len(digits); i += 2 {
+		v, err := strconv.ParseUint(string(digits[i:i+2]), 16, 8)
+		if err != nil {
+			break
+		}
+		out = append(out, byte(v))
+	}
+	return out
+}
+
+func (l *pdfLexer) array() (pdfArray, error) {
+	var out pdfArray
+	for {
+		v, err := l.next()
+		if err != nil {
+			return out, err
+		}
+		if v == pdfKeyword("]") {
+			return out, nil
+		}
+		out = append(out, v)
+	}
+}
+
+func (l *pdfLexer) dict() (pdfDict, error) {
+	out := pdfDict{}
+	for {
+		k, err := l.next()
+		if err != nil {
+			return out, err
+		}
+		if k == pdfKeyword(">>") {
+			return out, nil
+		}
+		key, ok := k.(pdfName)
+		if !ok {
+			continue
+		}
+		v, err := l.next()
+		if err != nil {
+			return out, err
+		}
+		if v == pdfKeyword(">>") {
+			return out, nil
+		}
+		out[key] = v
+	}
+}
+
+// streamData reads the bytes after a "stream" keyword. A direct /Length is
+// trusted when it lands on "endstream"; otherwise the data runs to the next
+// "endstream".
+func (l *pdfLexer) streamData(length int) []byte {
+	if l.pos < len(l.b) && l.b[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(l.b) && l.b[l.pos] == '\n' {
+		l.pos++
+	}
+	start := l.pos
+	if length > 0 && start+length <= len(l.b) {
+		rest := bytes.TrimLeft(l.b[start+length:min(len(l.b), start+length+32)], "\r\n \t")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			l.pos = start + length
+			return l.b[start : start+length]
+		}
+	}
+	end := bytes.Index(l.b[start:], []byte("endstream"))
+	if end < 0 {
+		l.pos = len(l.b)
+		return l.b[start:]
+	}
+	l.pos = start + end
+	return bytes.TrimRight(l.b[start:start+end], "\r\n")
+}
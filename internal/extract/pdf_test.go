@@ -0,0 +1,129 @@
+package extract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// pdfFile lays out numbered objects as a PDF body. Objects are written in
+// the order given; no xref table is needed since the parser ignores it.
+func pdfFile(objs ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.5\n")
+	for i, o := range objs {
+		if o == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	b.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return b.Bytes()
+}
+
+func pdfStreamObj(dict string, data []byte) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func deflate(s string) []byte {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	w.Write([]byte(s))
+	w.Close()
+	return b.Bytes()
+}
+
+// pdfObjStm packs objects, keyed by number, into a compressed object stream.
+func pdfObjStm(nums []int, objs []string) string {
+	var head, body strings.Builder
+	for i, o := range objs {
+		fmt.Fprintf(&head, "%d %d ", nums[i], body.Len())
+		body.WriteString(o + "\n")
+	}
+	dict := fmt.Sprintf("/Type /ObjStm /N %d /First %d /Filter /FlateDecode", len(objs), head.Len())
+	return pdfStreamObj(dict, deflate(head.String()+body.String()))
+}
+
+// samplePDF has two pages: one in a simple font without a ToUnicode map and
+// inherited resources, and one whose page, font and CMap objects sit in a
+// compressed object stream and use two-byte codes.
+func samplePDF() []byte {
+	cmap := `/CIDInit /ProcSet findresource begin
+begincmap
+1 begincodespacerange <0000> <FFFF> endcodespacerange
+2 beginbfchar <0001> <0043> <0004> <00E9> endbfchar
+1 beginbfrange <0002> <0003> [<0061> <0066>] endbfrange
+endcmap`
+	return pdfFile(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 5 0 R] /Count 2 /Resources << /Font << /F1 4 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 6 0 R >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		"",
+		pdfStreamObj("", []byte("BT /F1 12 Tf 72 720 Td (Hello) Tj ( world) Tj 0 -14 Td [(Sell)-250(AAPL)] TJ ET")),
+		"",
+		pdfStreamObj("/Filter /FlateDecode", deflate("BT /F2 11 Tf 1 0 0 1 72 700 Tm <0001000200030004> Tj ET")),
+		"",
+		pdfStreamObj("/Filter /FlateDecode", deflate(cmap)),
+		pdfObjStm([]int{5, 7, 9}, []string{
+			"<< /Type /Page /Parent 2 0 R /Resources << /Font << /F2 7 0 R >> >> /Contents 8 0 R >>",
+			"<< /Type /Font /Subtype /Type0 /DescendantFonts [9 0 R] /ToUnicode 10 0 R >>",
+			"<< /Type /Font /Subtype /CIDFontType2 /DW 1000 >>",
+		}),
+	)
+}
+
+func TestPDF(t *testing.T) {
+	got, err := PDF(samplePDF())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Hello world\nSell AAPL\n\nCafé"; got != want {
+		t.Errorf("PDF = %q, want %q", got, want)
+	}
+}
+
+func TestPDFErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"encrypted", pdfFile("<< /Type /Catalog >>", "<< /Filter /Standard >>", "<< /Encrypt 2 0 R >>"), errPDFEncrypted},
+		{"image only", pdfFile(
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] >>",
+			"<< /Type /Page /Contents 4 0 R >>",
+			pdfStreamObj("", []byte("q 100 0 0 100 0 0 cm /Im1 Do Q")),
+		), errPDFNoText},
+	}
+	for _, tt := range tests {
+		if _, err := PDF(tt.data); !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	if _, err := PDF([]byte("PK\x03\x04 not a pdf")); err == nil {
+		t.Error("a file without a %PDF header was accepted")
+	}
+}
+
+func TestPDFDamaged(t *testing.T) {
+	// Attachments are untrusted: truncated or corrupted files must come back
+	// as text or an error, never a panic.
+	data := samplePDF()
+	for n := range data {
+		PDF(data[:n])
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		b := bytes.Clone(data)
+		for j := 0; j < 1+rng.Intn(8); j++ {
+			b[rng.Intn(len(b))] = byte(rng.Intn(256))
+		}
+		PDF(b)
+	}
+}
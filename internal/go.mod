@@ -0,0 +1,9 @@
+module aiagentapi/internal
+
+go 1.23
+
+require (
+	github.com/sashabaranov/go-openai v1.41.2
+	golang.org/x/net v0.25.0
+	golang.org/x/text v0.15.0
+)
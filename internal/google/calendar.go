@@ -0,0 +1,276 @@
+package google
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type EventDateTime struct {
+	// DateTime is RFC 3339; Date (yyyy-mm-dd) is set instead for all-day events.
+	DateTime string `json:"dateTime,omitempty"`
+	Date     string `json:"date,omitempty"`
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// Time resolves the start or end of an event. All-day dates are taken as
+// midnight in the event's time zone, falling back to def.
+func (d EventDateTime) Time(def *time.Location) (time.Time, bool) {
+	if d.DateTime != "" {
+		t, err := time.Parse(time.RFC3339, d.DateTime)
+		return t, err == nil
+	}
+	if d.Date == "" {
+		return time.Time{}, false
+	}
+	loc := def
+	if d.TimeZone != "" {
+		if l, err := time.LoadLocation(d.TimeZone); err == nil {
+			loc = l
+		}
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	t, err := time.ParseInLocation("2006-01-02", d.Date, loc)
+	return t, err == nil
+}
+
+type EventAttendee struct {
+	Email          string `json:"email"`
+	DisplayName    string `json:"displayName,omitempty"`
+	ResponseStatus string `json:"responseStatus,omitempty"`
+	Organizer      bool   `json:"organizer,omitempty"`
+	Self           bool   `json:"self,omitempty"`
+	Optional       bool   `json:"optional,omitempty"`
+	Resource       bool   `json:"resource,omitempty"`
+}
+
+type EventPerson struct {
+	Email       string `json:"email,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+	Self        bool   `json:"self,omitempty"`
+}
+
+type Event struct {
+	ID               string          `json:"id,omitempty"`
+	Status           string          `json:"status,omitempty"`
+	HTMLLink         string          `json:"htmlLink,omitempty"`
+	Summary          string          `json:"summary,omitempty"`
+	Description      string          `json:"description,omitempty"`
+	Location         string          `json:"location,omitempty"`
+	Transparency     string          `json:"transparency,omitempty"`
+	Organizer        *EventPerson    `json:"organizer,omitempty"`
+	Start            *EventDateTime  `json:"start,omitempty"`
+	End              *EventDateTime  `json:"end,omitempty"`
+	RecurringEventID string          `json:"recurringEventId,omitempty"`
+	Attendees        []EventAttendee `json:"attendees,omitempty"`
+	HangoutLink      string          `json:"hangoutLink,omitempty"`
+	ConferenceData   *ConferenceData `json:"conferenceData,omitempty"`
+	Updated          string          `json:"updated,omitempty"`
+}
+
+// ConferenceData is an event's video call. Setting CreateRequest on insert
+// (with WriteOptions.ConferenceDataVersion 1) asks Google to create one.
+type ConferenceData struct {
+	ConferenceID  string                   `json:"conferenceId,omitempty"`
+	CreateRequest *CreateConferenceRequest `json:"createRequest,omitempty"`
+	EntryPoints   []EntryPoint             `json:"entryPoints,omitempty"`
+}
+
+type CreateConferenceRequest struct {
+	// RequestID makes retried inserts create a single conference.
+	RequestID             string                `json:"requestId"`
+	ConferenceSolutionKey ConferenceSolutionKey `json:"conferenceSolutionKey"`
+}
+
+type ConferenceSolutionKey struct {
+	// Type is "hangoutsMeet" for Google Meet.
+	Type string `json:"type"`
+}
+
+type EntryPoint struct {
+	// EntryPointType is "video", "phone", "sip" or "more".
+	EntryPointType string `json:"entryPointType"`
+	URI            string `json:"uri"`
+}
+
+// ConferenceURL is the link to join the event's video call, or "".
+func (e *Event) ConferenceURL() string {
+	if e.ConferenceData != nil {
+		for _, ep := range e.ConferenceData.EntryPoints {
+			if ep.EntryPointType == "video" {
+				return ep.URI
+			}
+		}
+	}
+	return e.HangoutLink
+}
+
+// SelfResponse is the calendar owner's own response status, or "" when the
+// owner is not listed as an attendee (e.g. events they created alone).
+func (e *Event) SelfResponse() string {
+	for _, a := range e.Attendees {
+		if a.Self {
+			return a.ResponseStatus
+		}
+	}
+	return ""
+}
+
+type EventList struct {
+	Items         []Event `json:"items"`
+	TimeZone      string  `json:"timeZone"`
+	NextPageToken string  `json:"nextPageToken"`
+	NextSyncToken string  `json:"nextSyncToken"`
+}
+
+// EventQuery selects events for ListEvents. SyncToken cannot be combined with
+// TimeMin or TimeMax; Calendar answers 410 Gone when the token has expired.
+type EventQuery struct {
+	SyncToken    string
+	PageToken    string
+	TimeMin      time.Time
+	TimeMax      time.Time
+	SingleEvents bool
+	MaxResults   int
+}
+
+// ListEvents returns one page of events. Deleted events are always included
+// (status "cancelled") so incremental syncs see removals.
+func (c *Client) ListEvents(ctx context.Context, calendarID string, q EventQuery) (*EventList, error) {
+	v := url.Values{}
+	v.Set("showDeleted", "true")
+	if q.SingleEvents {
+		v.Set("singleEvents", "true")
+	}
+	if q.SyncToken != "" {
+		v.Set("syncToken", q.SyncToken)
+	}
+	if q.PageToken != "" {
+		v.Set("pageToken", q.PageToken)
+	}
+	if !q.TimeMin.IsZero() {
+		v.Set("timeMin", q.TimeMin.UTC().Format(time.RFC3339))
+	}
+	if !q.TimeMax.IsZero() {
+		v.Set("timeMax", q.TimeMax.UTC().Format(time.RFC3339))
+	}
+	if q.MaxResults > 0 {
+		v.Set("maxResults", strconv.Itoa(q.MaxResults))
+	}
+	var out EventList
+	if err := c.do(ctx, http.MethodGet, calendarPath(calendarID)+"/events", v, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func calendarPath(calendarID string) string {
+	if calendarID == "" {
+		calendarID = "primary"
+	}
+	return "/calendar/v3/calendars/" + url.PathEscape(calendarID)
+}
+
+// WriteOptions are the query parameters of event inserts and patches.
+type WriteOptions struct {
+	// SendUpdates is "all", "externalOnly" or "none" (the default).
+	SendUpdates string
+	// ConferenceDataVersion must be 1 for ConferenceData to be written.
+	ConferenceDataVersion int
+}
+
+func (o WriteOptions) values() url.Values {
+	v := url.Values{}
+	if o.SendUpdates != "" {
+		v.Set("sendUpdates", o.SendUpdates)
+	}
+	if o.ConferenceDataVersion > 0 {
+		v.Set("conferenceDataVersion", strconv.Itoa(o.ConferenceDataVersion))
+	}
+	return v
+}
+
+// InsertEvent creates an event and returns it as stored, with its id.
+func (c *Client) InsertEvent(ctx context.Context, calendarID string, e *Event, opt WriteOptions) (*Event, error) {
+	var out Event
+	if err := c.do(ctx, http.MethodPost, calendarPath(calendarID)+"/events", opt.values(), e, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetEvent returns one event by id.
+func (c *Client) GetEvent(ctx context.Context, calendarID, eventID string) (*Event, error) {
+	var out Event
+	if err := c.do(ctx, http.MethodGet, calendarPath(calendarID)+"/events/"+url.PathEscape(eventID), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PatchEvent updates the fields set in patch.
+func (c *Client) PatchEvent(ctx context.Context, calendarID, eventID string, patch *Event, opt WriteOptions) (*Event, error) {
+	var out Event
+	if err := c.do(ctx, http.MethodPatch, calendarPath(calendarID)+"/events/"+url.PathEscape(eventID), opt.values(), patch, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// BusyPeriod is one busy interval reported by FreeBusy.
+type BusyPeriod struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+type freeBusyCalendar struct {
+	Busy   []BusyPeriod `json:"busy"`
+	Errors []struct {
+		Domain string `json:"domain"`
+		Reason string `json:"reason"`
+	} `json:"errors"`
+}
+
+// FreeBusy returns the busy periods of each calendar between min and max.
+// Calendars Google can't read (unknown, or not shared with the user) are
+// reported as an error naming them.
+func (c *Client) FreeBusy(ctx context.Context, min, max time.Time, calendarIDs []string) (map[string][]BusyPeriod, error) {
+	type item struct {
+		ID string `json:"id"`
+	}
+	in := struct {
+		TimeMin string `json:"timeMin"`
+		TimeMax string `json:"timeMax"`
+		Items   []item `json:"items"`
+	}{TimeMin: min.UTC().Format(time.RFC3339), TimeMax: max.UTC().Format(time.RFC3339)}
+	for _, id := range calendarIDs {
+		in.Items = append(in.Items, item{id})
+	}
+	var out struct {
+		Calendars map[string]freeBusyCalendar `json:"calendars"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/calendar/v3/freeBusy", nil, in, &out); err != nil {
+		return nil, err
+	}
+	busy := make(map[string][]BusyPeriod, len(out.Calendars))
+	var bad []string
+	for id, cal := range out.Calendars {
+		if len(cal.Errors) > 0 {
+			bad = append(bad, id+" ("+cal.Errors[0].Reason+")")
+			continue
+		}
+		busy[id] = cal.Busy
+	}
+	if len(bad) > 0 {
+		sort.Strings(bad)
+		return busy, fmt.Errorf("freebusy: cannot read %s", strings.Join(bad, ", "))
+	}
+	return busy, nil
+}
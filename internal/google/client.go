@@ -0,0 +1,181 @@
+// Package google is a small REST client for the Gmail and Calendar APIs used
+// by sync and the agent tools. All endpoints are configurable so the client can
+// be pointed at a local fake server.
+package google
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultAPIBaseURL = "https://www.googleapis.com"
+	DefaultTokenURL   = "https://oauth2.googleapis.com/token"
+	DefaultAuthURL    = "https://accounts.google.com/o/oauth2/v2/auth"
+)
+
+// Config holds the OAuth client credentials and endpoints.
+type Config struct {
+	ClientID     string
+	ClientSecret string
+	// APIBaseURL is the root of the Gmail (/gmail/v1) and Calendar
+	// (/calendar/v3) REST APIs.
+	APIBaseURL string
+	TokenURL   string
+	// AuthURL is the consent page users are sent to when connecting.
+	AuthURL string
+	// UserInfoURL defaults to APIBaseURL + "/oauth2/v2/userinfo".
+	UserInfoURL string
+	HTTP        *http.Client
+}
+
+// ConfigFromEnv reads GOOGLE_CLIENT_ID, GOOGLE_CLIENT_SECRET and the optional
+// GOOGLE_API_BASE_URL, GOOGLE_TOKEN_URL, GOOGLE_AUTH_URL and
+// GOOGLE_USERINFO_URL overrides.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
+		ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
+		APIBaseURL:   strings.TrimRight(strings.TrimSpace(os.Getenv("GOOGLE_API_BASE_URL")), "/"),
+		TokenURL:     strings.TrimSpace(os.Getenv("GOOGLE_TOKEN_URL")),
+		AuthURL:      strings.TrimSpace(os.Getenv("GOOGLE_AUTH_URL")),
+		UserInfoURL:  strings.TrimSpace(os.Getenv("GOOGLE_USERINFO_URL")),
+	}
+	if cfg.APIBaseURL == "" {
+		cfg.APIBaseURL = DefaultAPIBaseURL
+	}
+	if cfg.TokenURL == "" {
+		cfg.TokenURL = DefaultTokenURL
+	}
+	if cfg.AuthURL == "" {
+		cfg.AuthURL = DefaultAuthURL
+	}
+	return cfg
+}
+
+func (c Config) httpClient() *http.Client {
+	if c.HTTP != nil {
+		return c.HTTP
+	}
+	return &http.Client{Timeout: 30 * time.Second}
+}
+
+// Client calls Google APIs on behalf of one user, refreshing the access token
+// from the stored refresh token as needed. It is safe for concurrent use.
+type Client struct {
+	cfg          Config
+	refreshToken string
+
+	mu          sync.Mutex
+	accessToken string
+	expiry      time.Time
+}
+
+func (c Config) NewClient(refreshToken string) *Client {
+	return &Client{cfg: c, refreshToken: refreshToken}
+}
+
+// ErrNoRefreshToken means the user has not connected Google (or revoked it).
+var ErrNoRefreshToken = errors.New("google: user has no refresh token")
+
+// ForUser builds a client from the refresh token stored on app_user.
+func (c Config) ForUser(ctx context.Context, db *sql.DB, userID string) (*Client, error) {
+	var token sql.NullString
+	if err := db.QueryRowContext(ctx, `SELECT google_refresh_token FROM app_user WHERE id=$1`, userID).Scan(&token); err != nil {
+		return nil, fmt.Errorf("load refresh token: %w", err)
+	}
+	if strings.TrimSpace(token.String) == "" {
+		return nil, ErrNoRefreshToken
+	}
+	return c.NewClient(token.String), nil
+}
+
+// APIError is a non-2xx response from Google.
+type APIError struct {
+	Status int
+	Body   string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("google: HTTP %d: %s", e.Status, strings.TrimSpace(e.Body))
+}
+
+// IsStatus reports whether err is an APIError with the given HTTP status.
+func IsStatus(err error, status int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Status == status
+}
+
+func (c *Client) token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.accessToken != "" && time.Now().Before(c.expiry.Add(-time.Minute)) {
+		return c.accessToken, nil
+	}
+
+	form := url.Values{}
+	form.Set("client_id", c.cfg.ClientID)
+	form.Set("client_secret", c.cfg.ClientSecret)
+	form.Set("refresh_token", c.refreshToken)
+	form.Set("grant_type", "refresh_token")
+	tok, err := c.cfg.postToken(ctx, form)
+	if err != nil {
+		return "", fmt.Errorf("refresh token: %w", err)
+	}
+	c.accessToken = tok.AccessToken
+	c.expiry = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	return c.accessToken, nil
+}
+
+// do sends a JSON request to path (relative to APIBaseURL) and decodes a JSON
+// response into out when it is non-nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	tok, err := c.token(ctx)
+	if err != nil {
+		return err
+	}
+	u := c.cfg.APIBaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+tok)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.cfg.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return &APIError{Status: resp.StatusCode, Body: string(b)}
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
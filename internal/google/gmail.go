@@ -0,0 +1,309 @@
+package google
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type Header struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type MessagePartBody struct {
+	AttachmentID string `json:"attachmentId,omitempty"`
+	Size         int64  `json:"size"`
+	// Data is base64url encoded.
+	Data string `json:"data,omitempty"`
+}
+
+type MessagePart struct {
+	PartID   string          `json:"partId"`
+	MimeType string          `json:"mimeType"`
+	Filename string          `json:"filename"`
+	Headers  []Header        `json:"headers"`
+	Body     MessagePartBody `json:"body"`
+	Parts    []MessagePart   `json:"parts,omitempty"`
+}
+
+// Header returns the first header with the given name (case-insensitive).
+func (p *MessagePart) Header(name string) string {
+	for _, h := range p.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+type Message struct {
+	ID           string       `json:"id"`
+	ThreadID     string       `json:"threadId"`
+	LabelIDs     []string     `json:"labelIds"`
+	Snippet      string       `json:"snippet"`
+	HistoryID    string       `json:"historyId"`
+	InternalDate string       `json:"internalDate"`
+	Payload      *MessagePart `json:"payload,omitempty"`
+}
+
+// HasLabel reports whether the message carries a Gmail label id.
+func (m *Message) HasLabel(label string) bool {
+	for _, l := range m.LabelIDs {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+type Profile struct {
+	EmailAddress string `json:"emailAddress"`
+	HistoryID    string `json:"historyId"`
+}
+
+func (c *Client) Profile(ctx context.Context) (*Profile, error) {
+	var p Profile
+	if err := c.do(ctx, http.MethodGet, "/gmail/v1/users/me/profile", nil, nil, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+type MessageList struct {
+	Messages      []Message `json:"messages"`
+	NextPageToken string    `json:"nextPageToken"`
+}
+
+// ListMessages returns one page of message ids matching a Gmail search query.
+func (c *Client) ListMessages(ctx context.Context, q, pageToken string, max int) (*MessageList, error) {
+	v := url.Values{}
+	if q != "" {
+		v.Set("q", q)
+	}
+	if pageToken != "" {
+		v.Set("pageToken", pageToken)
+	}
+	if max > 0 {
+		v.Set("maxResults", strconv.Itoa(max))
+	}
+	var out MessageList
+	if err := c.do(ctx, http.MethodGet, "/gmail/v1/users/me/messages", v, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetMessage fetches a message; format is "full", "metadata" or "minimal".
+func (c *Client) GetMessage(ctx context.Context, id, format string) (*Message, error) {
+	v := url.Values{}
+	if format != "" {
+		v.Set("format", format)
+	}
+	var m Message
+	if err := c.do(ctx, http.MethodGet, "/gmail/v1/users/me/messages/"+url.PathEscape(id), v, nil, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+type HistoryMessage struct {
+	Message Message `json:"message"`
+}
+
+type HistoryLabel struct {
+	Message  Message  `json:"message"`
+	LabelIDs []string `json:"labelIds"`
+}
+
+type History struct {
+	ID              string           `json:"id"`
+	MessagesAdded   []HistoryMessage `json:"messagesAdded"`
+	MessagesDeleted []HistoryMessage `json:"messagesDeleted"`
+	LabelsAdded     []HistoryLabel   `json:"labelsAdded"`
+	LabelsRemoved   []HistoryLabel   `json:"labelsRemoved"`
+}
+
+type HistoryList struct {
+	History       []History `json:"history"`
+	NextPageToken string    `json:"nextPageToken"`
+	HistoryID     string    `json:"historyId"`
+}
+
+// ListHistory returns one page of mailbox changes after startHistoryID. Gmail
+// answers 404 when the start id is too old; callers must then resync fully.
+func (c *Client) ListHistory(ctx context.Context, startHistoryID, pageToken string) (*HistoryList, error) {
+	v := url.Values{}
+	v.Set("startHistoryId", startHistoryID)
+	for _, t := range []string{"messageAdded", "messageDeleted", "labelAdded", "labelRemoved"} {
+		v.Add("historyTypes", t)
+	}
+	if pageToken != "" {
+		v.Set("pageToken", pageToken)
+	}
+	var out HistoryList
+	if err := c.do(ctx, http.MethodGet, "/gmail/v1/users/me/history", v, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DecodeData decodes Gmail's base64url body data, tolerating missing padding.
+func DecodeData(s string) ([]byte, error) {
+	s = strings.TrimRight(s, "=")
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// GetAttachment downloads the content of an attachment. Attachment ids are
+// only valid for the message fetch that returned them; callers holding an
+// old id should refetch the message when this returns 400 or 404.
+func (c *Client) GetAttachment(ctx context.Context, messageID, attachmentID string) ([]byte, error) {
+	var out struct {
+		Size int64  `json:"size"`
+		Data string `json:"data"`
+	}
+	path := "/gmail/v1/users/me/messages/" + url.PathEscape(messageID) + "/attachments/" + url.PathEscape(attachmentID)
+	if err := c.do(ctx, http.MethodGet, path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return DecodeData(out.Data)
+}
+
+type Thread struct {
+	ID        string    `json:"id"`
+	HistoryID string    `json:"historyId"`
+	Messages  []Message `json:"messages"`
+}
+
+// GetThread fetches a thread with its messages, oldest first; format is as
+// for GetMessage.
+func (c *Client) GetThread(ctx context.Context, id, format string) (*Thread, error) {
+	v := url.Values{}
+	if format != "" {
+		v.Set("format", format)
+	}
+	var t Thread
+	if err := c.do(ctx, http.MethodGet, "/gmail/v1/users/me/threads/"+url.PathEscape(id), v, nil, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// EncodeData encodes a raw RFC 5322 message for the Gmail API.
+func EncodeData(b []byte) string {
+	return base64.URLEncoding.EncodeToString(b)
+}
+
+// SendMessage sends a raw RFC 5322 message. A non-empty threadID files it in
+// an existing thread; the message's References and In-Reply-To headers must
+// then match that thread, and its Subject too.
+func (c *Client) SendMessage(ctx context.Context, raw []byte, threadID string) (*Message, error) {
+	in := map[string]string{"raw": EncodeData(raw)}
+	if threadID != "" {
+		in["threadId"] = threadID
+	}
+	var m Message
+	if err := c.do(ctx, http.MethodPost, "/gmail/v1/users/me/messages/send", nil, in, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ModifyLabels adds and removes labels on a message.
+func (c *Client) ModifyLabels(ctx context.Context, id string, add, remove []string) (*Message, error) {
+	in := struct {
+		Add    []string `json:"addLabelIds,omitempty"`
+		Remove []string `json:"removeLabelIds,omitempty"`
+	}{add, remove}
+	var m Message
+	if err := c.do(ctx, http.MethodPost, "/gmail/v1/users/me/messages/"+url.PathEscape(id)+"/modify", nil, in, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+type Draft struct {
+	ID      string   `json:"id"`
+	Message *Message `json:"message,omitempty"`
+}
+
+type DraftList struct {
+	Drafts        []Draft `json:"drafts"`
+	NextPageToken string  `json:"nextPageToken"`
+}
+
+type draftRequest struct {
+	ID      string `json:"id,omitempty"`
+	Message struct {
+		Raw      string `json:"raw"`
+		ThreadID string `json:"threadId,omitempty"`
+	} `json:"message"`
+}
+
+// CreateDraft saves a raw RFC 5322 message as a draft.
+func (c *Client) CreateDraft(ctx context.Context, raw []byte, threadID string) (*Draft, error) {
+	var in draftRequest
+	in.Message.Raw, in.Message.ThreadID = EncodeData(raw), threadID
+	var d Draft
+	if err := c.do(ctx, http.MethodPost, "/gmail/v1/users/me/drafts", nil, in, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// ListDrafts returns one page of drafts.
+func (c *Client) ListDrafts(ctx context.Context, pageToken string) (*DraftList, error) {
+	v := url.Values{}
+	if pageToken != "" {
+		v.Set("pageToken", pageToken)
+	}
+	var out DraftList
+	if err := c.do(ctx, http.MethodGet, "/gmail/v1/users/me/drafts", v, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SendDraft sends a saved draft and returns the sent message.
+func (c *Client) SendDraft(ctx context.Context, id string) (*Message, error) {
+	var m Message
+	if err := c.do(ctx, http.MethodPost, "/gmail/v1/users/me/drafts/send", nil, map[string]string{"id": id}, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// DeleteDraft discards a draft.
+func (c *Client) DeleteDraft(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/gmail/v1/users/me/drafts/"+url.PathEscape(id), nil, nil, nil)
+}
+
+type Label struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Type is "system" or "user".
+	Type string `json:"type,omitempty"`
+}
+
+// ListLabels returns the mailbox's system and user labels.
+func (c *Client) ListLabels(ctx context.Context) ([]Label, error) {
+	var out struct {
+		Labels []Label `json:"labels"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/gmail/v1/users/me/labels", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Labels, nil
+}
+
+// CreateLabel adds a user label. Gmail answers 409 when the name is taken.
+func (c *Client) CreateLabel(ctx context.Context, name string) (*Label, error) {
+	var l Label
+	if err := c.do(ctx, http.MethodPost, "/gmail/v1/users/me/labels", nil, Label{Name: name}, &l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
@@ -0,0 +1,457 @@
+package googletest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"aiagentapi/internal/google"
+)
+
+// Events are kept as decoded JSON objects so fields the google package does
+// not model survive inserts and patches, as they would on Google's side.
+type storedEvent struct {
+	fields map[string]any
+	seq    int64 // sync sequence of the last change
+}
+
+func (e *storedEvent) event() google.Event {
+	var ev google.Event
+	b, _ := json.Marshal(e.fields)
+	_ = json.Unmarshal(b, &ev)
+	return ev
+}
+
+type calendar struct {
+	events map[string]*storedEvent
+	// minSync is the oldest sync sequence a token may name.
+	minSync int64
+}
+
+func newCalendar() *calendar {
+	return &calendar{events: map[string]*storedEvent{}}
+}
+
+// Invitation records an insert or patch made with sendUpdates=all, i.e. one
+// that had Google email the attendees.
+type Invitation struct {
+	CalendarID string
+	EventID    string
+	Attendees  []string
+}
+
+// AddEvent stores an event on a calendar, creating the calendar if needed,
+// and returns it as stored.
+func (s *Server) AddEvent(calendarID string, e google.Event) google.Event {
+	b, _ := json.Marshal(e)
+	var fields map[string]any
+	_ = json.Unmarshal(b, &fields)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.putEvent(calendarID, fields).event()
+}
+
+// AddBusy blocks [start, end) on a calendar, e.g. an attendee's, for
+// freeBusy queries.
+func (s *Server) AddBusy(calendarID string, start, end time.Time) {
+	s.AddEvent(calendarID, google.Event{
+		Summary: "Busy",
+		Start:   &google.EventDateTime{DateTime: start.Format(time.RFC3339)},
+		End:     &google.EventDateTime{DateTime: end.Format(time.RFC3339)},
+	})
+}
+
+// Event returns a stored event.
+func (s *Server) Event(calendarID, eventID string) (google.Event, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cal, ok := s.calendars[calendarID]
+	if !ok {
+		return google.Event{}, false
+	}
+	e, ok := cal.events[eventID]
+	if !ok {
+		return google.Event{}, false
+	}
+	return e.event(), true
+}
+
+// Invitations returns the invitations sent so far.
+func (s *Server) Invitations() []Invitation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Invitation(nil), s.invitations...)
+}
+
+// ExpireSyncTokens makes Calendar answer 410 Gone for every sync token
+// issued so far.
+func (s *Server) ExpireSyncTokens(calendarID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cal, ok := s.calendars[calendarID]; ok {
+		s.syncSeq++
+		cal.minSync = s.syncSeq
+	}
+}
+
+func (s *Server) calendarRoutes(mux *http.ServeMux) {
+	const base = "/calendar/v3/calendars/{cal}/events"
+	mux.HandleFunc("GET "+base, s.authed(s.listEvents))
+	mux.HandleFunc("POST "+base, s.authed(s.insertEvent))
+	mux.HandleFunc("GET "+base+"/{id}", s.authed(s.getEvent))
+	mux.HandleFunc("PATCH "+base+"/{id}", s.authed(s.patchEvent))
+	mux.HandleFunc("DELETE "+base+"/{id}", s.authed(s.deleteEvent))
+	mux.HandleFunc("POST /calendar/v3/freeBusy", s.authed(s.freeBusy))
+}
+
+// putEvent stores fields as a new or replaced event. Callers hold s.mu.
+func (s *Server) putEvent(calendarID string, fields map[string]any) *storedEvent {
+	cal, ok := s.calendars[calendarID]
+	if !ok {
+		cal = newCalendar()
+		s.calendars[calendarID] = cal
+	}
+	id, _ := fields["id"].(string)
+	if id == "" {
+		s.seq++
+		id = fmt.Sprintf("evt%06d", s.seq)
+		fields["id"] = id
+	}
+	now := s.Now().UTC().Format(time.RFC3339)
+	if _, ok := fields["status"]; !ok {
+		fields["status"] = "confirmed"
+	}
+	if _, ok := fields["created"]; !ok {
+		fields["created"] = now
+	}
+	if _, ok := fields["organizer"]; !ok && calendarID == "primary" {
+		fields["organizer"] = map[string]any{"email": s.email, "self": true}
+	}
+	fields["updated"] = now
+	fields["htmlLink"] = "https://calendar.google.com/calendar/event?eid=" + id
+	s.syncSeq++
+	e := &storedEvent{fields: fields, seq: s.syncSeq}
+	cal.events[id] = e
+	return e
+}
+
+func (s *Server) listEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	token := q.Get("syncToken")
+	if token != "" && (q.Get("timeMin") != "" || q.Get("timeMax") != "") {
+		writeError(w, http.StatusBadRequest, "Sync token cannot be combined with timeMin or timeMax.")
+		return
+	}
+	var min, max time.Time
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"timeMin", &min}, {"timeMax", &max}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "Bad Request: "+p.name)
+				return
+			}
+			*p.t = t
+		}
+	}
+
+	s.mu.Lock()
+	cal, ok := s.calendars[r.PathValue("cal")]
+	if !ok {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	var since int64 = -1
+	if token != "" {
+		n, err := strconv.ParseInt(strings.TrimPrefix(token, "sync-"), 10, 64)
+		if err != nil || n < cal.minSync {
+			s.mu.Unlock()
+			writeError(w, http.StatusGone, "Sync token is no longer valid, a full sync is required.")
+			return
+		}
+		since = n
+	}
+	showDeleted := q.Get("showDeleted") == "true" || token != ""
+	var items []google.Event
+	for _, e := range cal.events {
+		ev := e.event()
+		if since >= 0 && e.seq <= since {
+			continue
+		}
+		if ev.Status == "cancelled" && !showDeleted {
+			continue
+		}
+		if since < 0 && !overlapsRange(ev, min, max) {
+			continue
+		}
+		items = append(items, ev)
+	}
+	next := "sync-" + strconv.FormatInt(s.syncSeq, 10)
+	s.mu.Unlock()
+
+	sort.Slice(items, func(i, j int) bool {
+		a, b := startOf(items[i]), startOf(items[j])
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return items[i].ID < items[j].ID
+	})
+	page, nextPage := paginate(items, q.Get("pageToken"), q.Get("maxResults"), 250, 2500)
+	out := google.EventList{Items: page, TimeZone: s.TimeZone, NextPageToken: nextPage}
+	if nextPage == "" {
+		out.NextSyncToken = next
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func startOf(e google.Event) time.Time {
+	if e.Start == nil {
+		return time.Time{}
+	}
+	t, _ := e.Start.Time(time.UTC)
+	return t
+}
+
+func overlapsRange(e google.Event, min, max time.Time) bool {
+	if e.Start == nil || e.End == nil {
+		return true
+	}
+	start, ok1 := e.Start.Time(time.UTC)
+	end, ok2 := e.End.Time(time.UTC)
+	if !ok1 || !ok2 {
+		return true
+	}
+	return (min.IsZero() || end.After(min)) && (max.IsZero() || start.Before(max))
+}
+
+func (s *Server) insertEvent(w http.ResponseWriter, r *http.Request) {
+	var fields map[string]any
+	if !decodeJSON(w, r, &fields) {
+		return
+	}
+	for _, k := range []string{"start", "end"} {
+		if _, ok := fields[k].(map[string]any); !ok {
+			writeError(w, http.StatusBadRequest, "Missing "+k+" time.")
+			return
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id, _ := fields["id"].(string); id != "" {
+		if cal, ok := s.calendars[r.PathValue("cal")]; ok && cal.events[id] != nil {
+			writeError(w, http.StatusConflict, "The requested identifier already exists.")
+			return
+		}
+	}
+	s.conference(r, fields)
+	e := s.putEvent(r.PathValue("cal"), fields)
+	ev := e.event()
+	s.invite(r, r.PathValue("cal"), ev)
+	writeJSON(w, http.StatusOK, e.fields)
+}
+
+// conference answers a conferenceData.createRequest with a Meet link, as
+// Google does when the request has conferenceDataVersion=1; otherwise
+// conference data is ignored.
+func (s *Server) conference(r *http.Request, fields map[string]any) {
+	cd, ok := fields["conferenceData"].(map[string]any)
+	if !ok {
+		return
+	}
+	if r.URL.Query().Get("conferenceDataVersion") != "1" {
+		delete(fields, "conferenceData")
+		return
+	}
+	req, ok := cd["createRequest"].(map[string]any)
+	if !ok {
+		return
+	}
+	s.seq++
+	code := fmt.Sprintf("abc-defg-%03d", s.seq%1000)
+	uri := "https://meet.google.com/" + code
+	req["status"] = map[string]any{"statusCode": "success"}
+	fields["conferenceData"] = map[string]any{
+		"conferenceId":       code,
+		"createRequest":      req,
+		"conferenceSolution": map[string]any{"key": map[string]any{"type": "hangoutsMeet"}, "name": "Google Meet"},
+		"entryPoints":        []any{map[string]any{"entryPointType": "video", "uri": uri, "label": "meet.google.com/" + code}},
+	}
+	fields["hangoutLink"] = uri
+}
+
+func (s *Server) invite(r *http.Request, calendarID string, ev google.Event) {
+	if r.URL.Query().Get("sendUpdates") != "all" || len(ev.Attendees) == 0 {
+		return
+	}
+	inv := Invitation{CalendarID: calendarID, EventID: ev.ID}
+	for _, a := range ev.Attendees {
+		inv.Attendees = append(inv.Attendees, a.Email)
+	}
+	s.invitations = append(s.invitations, inv)
+}
+
+func (s *Server) lookupEvent(w http.ResponseWriter, r *http.Request) (*storedEvent, bool) {
+	cal, ok := s.calendars[r.PathValue("cal")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return nil, false
+	}
+	e, ok := cal.events[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return nil, false
+	}
+	return e, true
+}
+
+func (s *Server) getEvent(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.lookupEvent(w, r); ok {
+		writeJSON(w, http.StatusOK, e.fields)
+	}
+}
+
+func (s *Server) patchEvent(w http.ResponseWriter, r *http.Request) {
+	var patch map[string]any
+	if !decodeJSON(w, r, &patch) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.lookupEvent(w, r)
+	if !ok {
+		return
+	}
+	delete(patch, "id")
+	merge(e.fields, patch)
+	e = s.putEvent(r.PathValue("cal"), e.fields)
+	s.invite(r, r.PathValue("cal"), e.event())
+	writeJSON(w, http.StatusOK, e.fields)
+}
+
+// merge applies a patch the way Calendar does: objects are merged field by
+// field, arrays and scalars replaced, and nulls clear a field.
+func merge(dst, patch map[string]any) {
+	for k, v := range patch {
+		switch v := v.(type) {
+		case nil:
+			delete(dst, k)
+		case map[string]any:
+			if cur, ok := dst[k].(map[string]any); ok {
+				merge(cur, v)
+			} else {
+				dst[k] = v
+			}
+		default:
+			dst[k] = v
+		}
+	}
+}
+
+func (s *Server) deleteEvent(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.lookupEvent(w, r)
+	if !ok {
+		return
+	}
+	if e.fields["status"] == "cancelled" {
+		writeError(w, http.StatusGone, "Resource has been deleted")
+		return
+	}
+	e.fields["status"] = "cancelled"
+	s.putEvent(r.PathValue("cal"), e.fields)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) freeBusy(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		TimeMin time.Time `json:"timeMin"`
+		TimeMax time.Time `json:"timeMax"`
+		Items   []struct {
+			ID string `json:"id"`
+		} `json:"items"`
+	}
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+	if !in.TimeMax.After(in.TimeMin) {
+		writeError(w, http.StatusBadRequest, "The specified time range is empty.")
+		return
+	}
+	type calErr struct {
+		Domain string `json:"domain"`
+		Reason string `json:"reason"`
+	}
+	type calOut struct {
+		Busy   []google.BusyPeriod `json:"busy"`
+		Errors []calErr            `json:"errors,omitempty"`
+	}
+	out := map[string]calOut{}
+
+	s.mu.Lock()
+	for _, item := range in.Items {
+		id := item.ID
+		if id == s.email {
+			id = "primary"
+		}
+		cal, ok := s.calendars[id]
+		if !ok {
+			out[item.ID] = calOut{Busy: []google.BusyPeriod{}, Errors: []calErr{{"global", "notFound"}}}
+			continue
+		}
+		var busy []google.BusyPeriod
+		for _, e := range cal.events {
+			ev := e.event()
+			if ev.Status == "cancelled" || ev.Transparency == "transparent" || ev.Start == nil || ev.End == nil {
+				continue
+			}
+			start, ok1 := ev.Start.Time(time.UTC)
+			end, ok2 := ev.End.Time(time.UTC)
+			if !ok1 || !ok2 || !end.After(in.TimeMin) || !start.Before(in.TimeMax) {
+				continue
+			}
+			if start.Before(in.TimeMin) {
+				start = in.TimeMin
+			}
+			if end.After(in.TimeMax) {
+				end = in.TimeMax
+			}
+			busy = append(busy, google.BusyPeriod{Start: start.UTC(), End: end.UTC()})
+		}
+		out[item.ID] = calOut{Busy: mergeBusy(busy)}
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"kind":      "calendar#freeBusy",
+		"timeMin":   in.TimeMin.UTC().Format(time.RFC3339),
+		"timeMax":   in.TimeMax.UTC().Format(time.RFC3339),
+		"calendars": out,
+	})
+}
+
+// mergeBusy sorts periods and joins overlapping ones, as freeBusy reports
+// them.
+func mergeBusy(busy []google.BusyPeriod) []google.BusyPeriod {
+	sort.Slice(busy, func(i, j int) bool { return busy[i].Start.Before(busy[j].Start) })
+	out := []google.BusyPeriod{}
+	for _, b := range busy {
+		if n := len(out); n > 0 && !b.Start.After(out[n-1].End) {
+			if b.End.After(out[n-1].End) {
+				out[n-1].End = b.End
+			}
+			continue
+		}
+		out = append(out, b)
+	}
+	return out
+}
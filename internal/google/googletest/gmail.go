@@ -0,0 +1,634 @@
+package googletest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"aiagentapi/internal/google"
+)
+
+type message struct {
+	google.Message
+	raw         []byte
+	date        time.Time
+	attachments map[string][]byte
+}
+
+func (m *message) summary() google.Message {
+	return google.Message{ID: m.ID, ThreadID: m.ThreadID, LabelIDs: append([]string(nil), m.LabelIDs...)}
+}
+
+func (m *message) header(name string) string {
+	if m.Payload == nil {
+		return ""
+	}
+	return m.Payload.Header(name)
+}
+
+// AddMail stores a message as if it had just arrived, recording a
+// messageAdded history entry so incremental syncs pick it up.
+func (s *Server) AddMail(m Mail) google.Message {
+	raw := m.Raw()
+	labels := m.Labels
+	if labels == nil {
+		labels = []string{"INBOX", "UNREAD"}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msg, err := s.insert(m.ID, m.ThreadID, raw, labels, m.Date)
+	if err != nil {
+		panic("googletest: " + err.Error())
+	}
+	return msg.Message
+}
+
+// Message returns a stored message in full format.
+func (s *Server) Message(id string) (google.Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.messages[id]
+	if !ok {
+		return google.Message{}, false
+	}
+	return m.Message, true
+}
+
+// Raw returns the RFC 5322 source of a stored message.
+func (s *Server) Raw(id string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m, ok := s.messages[id]; ok {
+		return append([]byte(nil), m.raw...)
+	}
+	return nil
+}
+
+// Sent returns the messages sent through the API, oldest first.
+func (s *Server) Sent() []google.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []google.Message
+	for _, id := range s.order {
+		if m := s.messages[id]; m.HasLabel("SENT") && !m.HasLabel("DRAFT") {
+			out = append(out, m.Message)
+		}
+	}
+	return out
+}
+
+// DeleteMail removes a message, recording a messageDeleted history entry.
+func (s *Server) DeleteMail(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(id)
+}
+
+// ExpireHistory forgets all history so far: history.list answers 404 for
+// any earlier start id, forcing a full resync.
+func (s *Server) ExpireHistory() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.minHistoryID = s.historyID
+	s.history = nil
+}
+
+// HistoryID is the mailbox's current history id.
+func (s *Server) HistoryID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return strconv.FormatInt(s.historyID, 10)
+}
+
+func (s *Server) gmailRoutes(mux *http.ServeMux) {
+	const base = "/gmail/v1/users/me"
+	mux.HandleFunc("GET "+base+"/profile", s.authed(s.profile))
+	mux.HandleFunc("GET "+base+"/messages", s.authed(s.listMessages))
+	mux.HandleFunc("GET "+base+"/messages/{id}", s.authed(s.getMessage))
+	mux.HandleFunc("DELETE "+base+"/messages/{id}", s.authed(s.deleteMessage))
+	mux.HandleFunc("POST "+base+"/messages/{id}/modify", s.authed(s.modifyMessage))
+	mux.HandleFunc("GET "+base+"/messages/{id}/attachments/{att}", s.authed(s.getAttachment))
+	mux.HandleFunc("POST "+base+"/messages/send", s.authed(s.sendMessage))
+	mux.HandleFunc("GET "+base+"/threads/{id}", s.authed(s.getThread))
+	mux.HandleFunc("GET "+base+"/history", s.authed(s.listHistory))
+	mux.HandleFunc("GET "+base+"/drafts", s.authed(s.listDrafts))
+	mux.HandleFunc("POST "+base+"/drafts", s.authed(s.createDraft))
+	mux.HandleFunc("GET "+base+"/drafts/{id}", s.authed(s.getDraft))
+	mux.HandleFunc("PUT "+base+"/drafts/{id}", s.authed(s.updateDraft))
+	mux.HandleFunc("DELETE "+base+"/drafts/{id}", s.authed(s.deleteDraft))
+	mux.HandleFunc("POST "+base+"/drafts/send", s.authed(s.sendDraft))
+	mux.HandleFunc("GET "+base+"/labels", s.authed(s.listLabels))
+	mux.HandleFunc("POST "+base+"/labels", s.authed(s.createLabel))
+}
+
+// insert parses and stores a message. Callers hold s.mu.
+func (s *Server) insert(id, threadID string, raw []byte, labels []string, date time.Time) (*message, error) {
+	if id == "" {
+		s.seq++
+		id = fmt.Sprintf("18f%013x", s.seq)
+	}
+	if _, dup := s.messages[id]; dup {
+		return nil, fmt.Errorf("message %s already exists", id)
+	}
+	if threadID == "" {
+		threadID = id
+	}
+	payload, text, atts, err := parseMessage(id, raw)
+	if err != nil {
+		return nil, err
+	}
+	if date.IsZero() {
+		date = s.Now()
+	}
+	m := &message{raw: raw, date: date, attachments: atts}
+	m.Message = google.Message{
+		ID:           id,
+		ThreadID:     threadID,
+		LabelIDs:     append([]string(nil), labels...),
+		Snippet:      snippet(text),
+		InternalDate: strconv.FormatInt(date.UnixMilli(), 10),
+		Payload:      payload,
+	}
+	s.messages[id] = m
+	s.order = append(s.order, id)
+	s.addHistory(google.History{MessagesAdded: []google.HistoryMessage{{Message: m.summary()}}})
+	m.HistoryID = strconv.FormatInt(s.historyID, 10)
+	return m, nil
+}
+
+func (s *Server) remove(id string) bool {
+	m, ok := s.messages[id]
+	if !ok {
+		return false
+	}
+	delete(s.messages, id)
+	for i, o := range s.order {
+		if o == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	s.addHistory(google.History{MessagesDeleted: []google.HistoryMessage{{Message: m.summary()}}})
+	return true
+}
+
+// relabel applies label changes, recording them in history.
+func (s *Server) relabel(m *message, add, remove []string) {
+	var added, removed []string
+	for _, l := range remove {
+		for i, have := range m.LabelIDs {
+			if have == l {
+				m.LabelIDs = append(m.LabelIDs[:i], m.LabelIDs[i+1:]...)
+				removed = append(removed, l)
+				break
+			}
+		}
+	}
+	for _, l := range add {
+		if !m.HasLabel(l) {
+			m.LabelIDs = append(m.LabelIDs, l)
+			added = append(added, l)
+		}
+	}
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+	h := google.History{}
+	if len(added) > 0 {
+		h.LabelsAdded = []google.HistoryLabel{{Message: m.summary(), LabelIDs: added}}
+	}
+	if len(removed) > 0 {
+		h.LabelsRemoved = []google.HistoryLabel{{Message: m.summary(), LabelIDs: removed}}
+	}
+	s.addHistory(h)
+	m.HistoryID = strconv.FormatInt(s.historyID, 10)
+}
+
+func (s *Server) addHistory(h google.History) {
+	s.historyID++
+	h.ID = strconv.FormatInt(s.historyID, 10)
+	s.history = append(s.history, h)
+}
+
+func (s *Server) profile(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"emailAddress":  s.email,
+		"messagesTotal": len(s.messages),
+		"historyId":     strconv.FormatInt(s.historyID, 10),
+	})
+}
+
+func (s *Server) listMessages(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	match, err := parseQuery(q.Get("q"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	for _, l := range q["labelIds"] {
+		match.match = append(match.match, hasLabel(l))
+	}
+
+	s.mu.Lock()
+	var ids []google.Message
+	for i := len(s.order) - 1; i >= 0; i-- {
+		m := s.messages[s.order[i]]
+		if matchAll(m, match) {
+			ids = append(ids, google.Message{ID: m.ID, ThreadID: m.ThreadID})
+		}
+	}
+	s.mu.Unlock()
+
+	page, next := paginate(ids, q.Get("pageToken"), q.Get("maxResults"), 100, 500)
+	out := map[string]any{"messages": page, "resultSizeEstimate": len(ids)}
+	if next != "" {
+		out["nextPageToken"] = next
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) getMessage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	m, ok := s.messages[r.PathValue("id")]
+	var out google.Message
+	if ok {
+		out = m.view(r.URL.Query().Get("format"))
+	}
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "Requested entity was not found.")
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// view returns a copy of the message in a messages.get format.
+func (m *message) view(format string) google.Message {
+	out := m.Message
+	out.LabelIDs = append([]string(nil), m.LabelIDs...)
+	switch format {
+	case "minimal":
+		out.Payload = nil
+	case "metadata":
+		if out.Payload != nil {
+			out.Payload = &google.MessagePart{MimeType: out.Payload.MimeType, Headers: out.Payload.Headers}
+		}
+	}
+	return out
+}
+
+func (s *Server) getThread(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	format := r.URL.Query().Get("format")
+	s.mu.Lock()
+	t := google.Thread{ID: id}
+	for _, mid := range s.order {
+		if m := s.messages[mid]; m.ThreadID == id {
+			t.Messages = append(t.Messages, m.view(format))
+			t.HistoryID = m.HistoryID
+		}
+	}
+	s.mu.Unlock()
+	if len(t.Messages) == 0 {
+		writeError(w, http.StatusNotFound, "Requested entity was not found.")
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+func (s *Server) deleteMessage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	ok := s.remove(r.PathValue("id"))
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "Requested entity was not found.")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) modifyMessage(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Add    []string `json:"addLabelIds"`
+		Remove []string `json:"removeLabelIds"`
+	}
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.messages[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Requested entity was not found.")
+		return
+	}
+	for _, l := range append(append([]string(nil), in.Add...), in.Remove...) {
+		if !s.labelExists(l) {
+			writeError(w, http.StatusBadRequest, "Invalid label: "+l)
+			return
+		}
+	}
+	s.relabel(m, in.Add, in.Remove)
+	writeJSON(w, http.StatusOK, m.summary())
+}
+
+func (s *Server) getAttachment(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	m, ok := s.messages[r.PathValue("id")]
+	var data []byte
+	if ok {
+		data, ok = m.attachments[r.PathValue("att")]
+	}
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "Requested entity was not found.")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"size": len(data), "data": google.EncodeData(data)})
+}
+
+type rawMessage struct {
+	Raw      string `json:"raw"`
+	ThreadID string `json:"threadId"`
+}
+
+// decodeRaw decodes and checks a message supplied by the client.
+func (s *Server) decodeRaw(w http.ResponseWriter, in rawMessage) ([]byte, bool) {
+	raw, err := google.DecodeData(strings.TrimRight(in.Raw, "="))
+	if err != nil || len(raw) == 0 {
+		writeError(w, http.StatusBadRequest, "Invalid value for ByteString: raw")
+		return nil, false
+	}
+	if in.ThreadID != "" {
+		s.mu.Lock()
+		found := false
+		for _, m := range s.messages {
+			if m.ThreadID == in.ThreadID {
+				found = true
+				break
+			}
+		}
+		s.mu.Unlock()
+		if !found {
+			writeError(w, http.StatusNotFound, "Requested entity was not found.")
+			return nil, false
+		}
+	}
+	return raw, true
+}
+
+func (s *Server) sendMessage(w http.ResponseWriter, r *http.Request) {
+	var in rawMessage
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+	raw, ok := s.decodeRaw(w, in)
+	if !ok {
+		return
+	}
+	if err := checkRecipients(raw); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, err := s.insert("", in.ThreadID, raw, []string{"SENT"}, time.Time{})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, m.summary())
+}
+
+func (s *Server) listHistory(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	start, err := strconv.ParseInt(q.Get("startHistoryId"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid startHistoryId")
+		return
+	}
+	s.mu.Lock()
+	if start < s.minHistoryID {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, "Requested entity was not found.")
+		return
+	}
+	var recs []google.History
+	for _, h := range s.history {
+		if id, _ := strconv.ParseInt(h.ID, 10, 64); id > start {
+			recs = append(recs, h)
+		}
+	}
+	current := strconv.FormatInt(s.historyID, 10)
+	s.mu.Unlock()
+
+	page, next := paginate(recs, q.Get("pageToken"), q.Get("maxResults"), 100, 500)
+	out := google.HistoryList{History: page, HistoryID: current, NextPageToken: next}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) draftJSON(id string, full bool) google.Draft {
+	m := s.messages[s.drafts[id]]
+	msg := m.summary()
+	if full {
+		msg = m.Message
+	}
+	return google.Draft{ID: id, Message: &msg}
+}
+
+func (s *Server) listDrafts(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	var drafts []google.Draft
+	for i := len(s.draftOrder) - 1; i >= 0; i-- {
+		drafts = append(drafts, s.draftJSON(s.draftOrder[i], false))
+	}
+	s.mu.Unlock()
+	q := r.URL.Query()
+	page, next := paginate(drafts, q.Get("pageToken"), q.Get("maxResults"), 100, 500)
+	writeJSON(w, http.StatusOK, google.DraftList{Drafts: page, NextPageToken: next})
+}
+
+func (s *Server) createDraft(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Message rawMessage `json:"message"`
+	}
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+	raw, ok := s.decodeRaw(w, in.Message)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, err := s.insert("", in.Message.ThreadID, raw, []string{"DRAFT"}, time.Time{})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.seq++
+	id := fmt.Sprintf("r%d", s.seq)
+	s.drafts[id] = m.ID
+	s.draftOrder = append(s.draftOrder, id)
+	writeJSON(w, http.StatusOK, s.draftJSON(id, false))
+}
+
+func (s *Server) getDraft(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := r.PathValue("id")
+	if _, ok := s.drafts[id]; !ok {
+		writeError(w, http.StatusNotFound, "Requested entity was not found.")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.draftJSON(id, true))
+}
+
+func (s *Server) updateDraft(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Message rawMessage `json:"message"`
+	}
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+	raw, ok := s.decodeRaw(w, in.Message)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := r.PathValue("id")
+	old, ok := s.drafts[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Requested entity was not found.")
+		return
+	}
+	m, err := s.insert("", in.Message.ThreadID, raw, []string{"DRAFT"}, time.Time{})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.remove(old)
+	s.drafts[id] = m.ID
+	writeJSON(w, http.StatusOK, s.draftJSON(id, false))
+}
+
+func (s *Server) deleteDraft(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := r.PathValue("id")
+	msgID, ok := s.drafts[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Requested entity was not found.")
+		return
+	}
+	s.dropDraft(id)
+	s.remove(msgID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) dropDraft(id string) {
+	delete(s.drafts, id)
+	for i, d := range s.draftOrder {
+		if d == id {
+			s.draftOrder = append(s.draftOrder[:i], s.draftOrder[i+1:]...)
+			break
+		}
+	}
+}
+
+func (s *Server) sendDraft(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		ID string `json:"id"`
+	}
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msgID, ok := s.drafts[in.ID]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Requested entity was not found.")
+		return
+	}
+	m := s.messages[msgID]
+	if err := checkRecipients(m.raw); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.dropDraft(in.ID)
+	s.relabel(m, []string{"SENT"}, []string{"DRAFT"})
+	writeJSON(w, http.StatusOK, m.summary())
+}
+
+func (s *Server) labelExists(id string) bool {
+	for _, l := range s.labels {
+		if l.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) listLabels(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{"labels": s.labels})
+}
+
+func (s *Server) createLabel(w http.ResponseWriter, r *http.Request) {
+	var in google.Label
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+	if strings.TrimSpace(in.Name) == "" {
+		writeError(w, http.StatusBadRequest, "Invalid label name")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, l := range s.labels {
+		if strings.EqualFold(l.Name, in.Name) {
+			writeError(w, http.StatusConflict, "Label name exists or conflicts")
+			return
+		}
+	}
+	s.seq++
+	l := google.Label{ID: fmt.Sprintf("Label_%d", s.seq), Name: in.Name, Type: "user"}
+	s.labels = append(s.labels, l)
+	writeJSON(w, http.StatusOK, l)
+}
+
+// paginate returns the page of items selected by an offset page token.
+func paginate[T any](items []T, token, maxResults string, def, limit int) ([]T, string) {
+	off, _ := strconv.Atoi(token)
+	n, err := strconv.Atoi(maxResults)
+	if err != nil || n <= 0 {
+		n = def
+	}
+	n = min(n, limit)
+	if off >= len(items) {
+		return []T{}, ""
+	}
+	end := min(off+n, len(items))
+	next := ""
+	if end < len(items) {
+		next = strconv.Itoa(end)
+	}
+	return items[off:end], next
+}
+
+// sortedKeys is used to give maps a stable order in responses.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
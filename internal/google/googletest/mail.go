@@ -0,0 +1,349 @@
+package googletest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"aiagentapi/internal/google"
+)
+
+// Mail is a message fixture. Zero fields get plausible defaults: the
+// message is addressed to UserEmail, dated now and labelled INBOX and UNREAD.
+type Mail struct {
+	ID, ThreadID string
+	From, To, Cc string
+	Subject      string
+	// Body is the text/plain part; HTML, when set, is sent as an alternative.
+	Body, HTML  string
+	Date        time.Time
+	Labels      []string
+	Headers     map[string]string
+	Attachments []Attachment
+}
+
+var messageIDSeq atomic.Int64
+
+type Attachment struct {
+	Filename string
+	MimeType string
+	Data     []byte
+}
+
+// Raw renders the fixture as an RFC 5322 message.
+func (m Mail) Raw() []byte {
+	var b bytes.Buffer
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	to := m.To
+	if to == "" {
+		to = UserEmail
+	}
+	from := m.From
+	if from == "" {
+		from = "sender@example.com"
+	}
+	header := func(k, v string) {
+		if v != "" {
+			fmt.Fprintf(&b, "%s: %s\r\n", k, v)
+		}
+	}
+	header("From", from)
+	header("To", to)
+	header("Cc", m.Cc)
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	if _, ok := m.Headers["Message-ID"]; !ok {
+		header("Message-ID", fmt.Sprintf("<%d.%d@example.com>", date.UnixNano(), messageIDSeq.Add(1)))
+	}
+	for _, k := range sortedKeys(m.Headers) {
+		header(k, m.Headers[k])
+	}
+	header("MIME-Version", "1.0")
+
+	text := func(w io.Writer, body string) {
+		qp := quotedprintable.NewWriter(w)
+		qp.Write([]byte(body))
+		qp.Close()
+	}
+	if m.HTML == "" && len(m.Attachments) == 0 {
+		header("Content-Type", `text/plain; charset="UTF-8"`)
+		header("Content-Transfer-Encoding", "quoted-printable")
+		b.WriteString("\r\n")
+		text(&b, m.Body)
+		return b.Bytes()
+	}
+
+	mixed := multipart.NewWriter(&b)
+	header("Content-Type", "multipart/mixed; boundary="+mixed.Boundary())
+	b.WriteString("\r\n")
+	textPart := func(w *multipart.Writer, typ, body string) {
+		p, _ := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {typ + `; charset="UTF-8"`},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		text(p, body)
+	}
+	if m.HTML != "" {
+		var alt bytes.Buffer
+		aw := multipart.NewWriter(&alt)
+		textPart(aw, "text/plain", m.Body)
+		textPart(aw, "text/html", m.HTML)
+		aw.Close()
+		p, _ := mixed.CreatePart(textproto.MIMEHeader{"Content-Type": {"multipart/alternative; boundary=" + aw.Boundary()}})
+		p.Write(alt.Bytes())
+	} else {
+		textPart(mixed, "text/plain", m.Body)
+	}
+	for _, a := range m.Attachments {
+		typ := a.MimeType
+		if typ == "" {
+			typ = "application/octet-stream"
+		}
+		p, _ := mixed.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(typ, map[string]string{"name": a.Filename})},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		enc := base64.NewEncoder(base64.StdEncoding, p)
+		enc.Write(a.Data)
+		enc.Close()
+	}
+	mixed.Close()
+	return b.Bytes()
+}
+
+var wordDecoder = mime.WordDecoder{CharsetReader: func(charset string, r io.Reader) (io.Reader, error) {
+	if strings.EqualFold(charset, "utf-8") || strings.EqualFold(charset, "us-ascii") {
+		return r, nil
+	}
+	return nil, fmt.Errorf("unsupported charset %s", charset)
+}}
+
+// parseMessage builds the Gmail payload of a raw message, the way Gmail
+// presents it: decoded headers, base64url bodies and attachment bodies
+// replaced by attachment ids. It also returns the first text/plain body and
+// the attachment contents by id.
+func parseMessage(id string, raw []byte) (*google.MessagePart, string, map[string][]byte, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("parse message: %w", err)
+	}
+	p := &parser{id: id, attachments: map[string][]byte{}}
+	part, err := p.part("", textproto.MIMEHeader(msg.Header), msg.Body)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return part, p.text, p.attachments, nil
+}
+
+type parser struct {
+	id          string
+	text        string
+	attachments map[string][]byte
+}
+
+func (p *parser) part(partID string, h textproto.MIMEHeader, body io.Reader) (*google.MessagePart, error) {
+	out := &google.MessagePart{PartID: partID}
+	for _, k := range sortedKeys(h) {
+		for _, v := range h[k] {
+			if dec, err := wordDecoder.DecodeHeader(v); err == nil {
+				v = dec
+			}
+			out.Headers = append(out.Headers, google.Header{Name: k, Value: v})
+		}
+	}
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	out.MimeType = mediaType
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		r := multipart.NewReader(body, params["boundary"])
+		for i := 0; ; i++ {
+			child, err := r.NextRawPart()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("parse part: %w", err)
+			}
+			id := strconv.Itoa(i)
+			if partID != "" {
+				id = partID + "." + id
+			}
+			cp, err := p.part(id, child.Header, child)
+			if err != nil {
+				return nil, err
+			}
+			out.Parts = append(out.Parts, *cp)
+		}
+		return out, nil
+	}
+
+	data, err := io.ReadAll(decodeTransfer(h.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return nil, fmt.Errorf("decode part %s: %w", partID, err)
+	}
+	out.Filename = params["name"]
+	if _, dp, err := mime.ParseMediaType(h.Get("Content-Disposition")); err == nil && dp["filename"] != "" {
+		out.Filename = dp["filename"]
+	}
+	out.Body.Size = int64(len(data))
+	if out.Filename != "" {
+		attID := "ANGjdJ_" + p.id + "_" + strings.ReplaceAll(partID, ".", "_")
+		p.attachments[attID] = data
+		out.Body.AttachmentID = attID
+		return out, nil
+	}
+	out.Body.Data = google.EncodeData(data)
+	if mediaType == "text/plain" && p.text == "" {
+		p.text = string(data)
+	}
+	return out, nil
+}
+
+func decodeTransfer(enc string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(enc)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &stripSpace{r: r})
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// stripSpace drops the line breaks of wrapped base64.
+type stripSpace struct{ r io.Reader }
+
+func (s *stripSpace) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	j := 0
+	for _, c := range p[:n] {
+		if c != '\r' && c != '\n' && c != ' ' && c != '\t' {
+			p[j] = c
+			j++
+		}
+	}
+	return j, err
+}
+
+func snippet(text string) string {
+	s := strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(s) <= 100 {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:100])
+}
+
+// checkRecipients rejects messages without a To, Cc or Bcc address, as Gmail
+// does.
+func checkRecipients(raw []byte) error {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("parse message: %w", err)
+	}
+	for _, k := range []string{"To", "Cc", "Bcc"} {
+		if v := msg.Header.Get(k); v != "" {
+			if _, err := mail.ParseAddressList(v); err != nil {
+				return fmt.Errorf("Invalid %s header", k)
+			}
+			return nil
+		}
+	}
+	return errors.New("Recipient address required")
+}
+
+type matcher func(*message) bool
+
+type query struct {
+	match []matcher
+	// hidden is set when the query asks for spam or trash.
+	hidden bool
+}
+
+// parseQuery supports the Gmail search operators sync and tests rely on:
+// after:, before: (unix seconds or yyyy/mm/dd), label:, in:, is:unread,
+// from:, to:, subject:, rfc822msgid: and bare words matched against subject
+// and snippet.
+func parseQuery(q string) (query, error) {
+	var out query
+	for _, term := range strings.Fields(q) {
+		op, val, ok := strings.Cut(term, ":")
+		if !ok {
+			word := strings.ToLower(term)
+			out.match = append(out.match, func(m *message) bool {
+				return strings.Contains(strings.ToLower(m.header("Subject")+" "+m.Snippet), word)
+			})
+			continue
+		}
+		switch strings.ToLower(op) {
+		case "after", "before":
+			t, err := parseQueryTime(val)
+			if err != nil {
+				return query{}, err
+			}
+			if op == "after" {
+				out.match = append(out.match, func(m *message) bool { return m.date.After(t) })
+			} else {
+				out.match = append(out.match, func(m *message) bool { return m.date.Before(t) })
+			}
+		case "label", "in":
+			label := strings.ToUpper(val)
+			out.hidden = out.hidden || label == "SPAM" || label == "TRASH"
+			out.match = append(out.match, hasLabel(label))
+		case "is":
+			out.match = append(out.match, hasLabel(strings.ToUpper(val)))
+		case "from", "to", "subject":
+			field, want := map[string]string{"from": "From", "to": "To", "subject": "Subject"}[strings.ToLower(op)], strings.ToLower(val)
+			out.match = append(out.match, func(m *message) bool { return strings.Contains(strings.ToLower(m.header(field)), want) })
+		case "rfc822msgid":
+			want := strings.Trim(val, "<>")
+			out.match = append(out.match, func(m *message) bool { return strings.Trim(m.header("Message-ID"), "<>") == want })
+		default:
+			return query{}, fmt.Errorf("unsupported search operator %q", op)
+		}
+	}
+	return out, nil
+}
+
+func parseQueryTime(v string) (time.Time, error) {
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(n, 0), nil
+	}
+	return time.ParseInLocation("2006/01/02", v, time.UTC)
+}
+
+func hasLabel(label string) matcher {
+	return func(m *message) bool { return m.HasLabel(label) }
+}
+
+// matchAll applies the query. Spam and trash are only listed when the query
+// names them.
+func matchAll(m *message, q query) bool {
+	if (m.HasLabel("SPAM") || m.HasLabel("TRASH")) && !q.hidden {
+		return false
+	}
+	for _, f := range q.match {
+		if !f(m) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,265 @@
+// Package googletest is an in-memory fake of the Google APIs the project
+// uses: the OAuth consent, token and userinfo endpoints, Gmail messages,
+// history, drafts and labels, and Calendar events and freeBusy. Tests seed
+// it with fixtures, point a google.Config at it and inspect what was sent.
+//
+//	srv := googletest.New(t)
+//	srv.AddMail(googletest.Mail{From: "alice@example.com", Subject: "Lunch?", Body: "Tuesday?"})
+//	client := srv.Config().NewClient(googletest.RefreshToken)
+package googletest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"aiagentapi/internal/google"
+)
+
+// Credentials the fake accepts.
+const (
+	ClientID     = "test-client"
+	ClientSecret = "test-secret"
+	RefreshToken = "test-refresh-token"
+	AuthCode     = "test-code"
+	UserEmail    = "advisor@example.com"
+)
+
+// Server is the fake. All state is guarded by one mutex, so handlers and
+// test code may use it concurrently.
+type Server struct {
+	*httptest.Server
+
+	// Now is the clock used for timestamps; tests may replace it before
+	// making requests.
+	Now func() time.Time
+	// TimeZone is the calendars' time zone reported by event listings.
+	TimeZone string
+
+	mu       sync.Mutex
+	email    string
+	tokens   map[string]bool // issued access tokens
+	failures []failure
+	requests []string
+
+	// Gmail
+	historyID    int64
+	minHistoryID int64
+	history      []google.History
+	messages     map[string]*message
+	order        []string // message ids, oldest first
+	drafts       map[string]string
+	draftOrder   []string
+	labels       []google.Label
+	seq          int64
+
+	// Calendar
+	calendars   map[string]*calendar
+	syncSeq     int64
+	invitations []Invitation
+}
+
+type failure struct {
+	method, path string
+	status       int
+	times        int
+}
+
+// New starts a fake for the account UserEmail that is closed when the test
+// ends.
+func New(t testing.TB) *Server {
+	t.Helper()
+	s := &Server{
+		Now:          time.Now,
+		TimeZone:     "UTC",
+		email:        UserEmail,
+		tokens:       map[string]bool{},
+		historyID:    1000,
+		minHistoryID: 1000,
+		messages:     map[string]*message{},
+		drafts:       map[string]string{},
+		calendars:    map[string]*calendar{"primary": newCalendar()},
+	}
+	for _, id := range []string{"INBOX", "SENT", "DRAFT", "SPAM", "TRASH", "UNREAD", "STARRED", "IMPORTANT", "CHAT"} {
+		s.labels = append(s.labels, google.Label{ID: id, Name: id, Type: "system"})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /o/oauth2/v2/auth", s.authorize)
+	mux.HandleFunc("POST /token", s.token)
+	mux.HandleFunc("GET /oauth2/v2/userinfo", s.authed(s.userinfo))
+	s.gmailRoutes(mux)
+	s.calendarRoutes(mux)
+	s.Server = httptest.NewServer(s.record(mux))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Config returns a google.Config whose endpoints all point at the fake.
+func (s *Server) Config() google.Config {
+	return google.Config{
+		ClientID:     ClientID,
+		ClientSecret: ClientSecret,
+		APIBaseURL:   s.URL,
+		TokenURL:     s.URL + "/token",
+		AuthURL:      s.URL + "/o/oauth2/v2/auth",
+		UserInfoURL:  s.URL + "/oauth2/v2/userinfo",
+	}
+}
+
+// Env returns the environment variables that point google.ConfigFromEnv at
+// the fake, for t.Setenv.
+func (s *Server) Env() map[string]string {
+	return map[string]string{
+		"GOOGLE_CLIENT_ID":     ClientID,
+		"GOOGLE_CLIENT_SECRET": ClientSecret,
+		"GOOGLE_API_BASE_URL":  s.URL,
+		"GOOGLE_TOKEN_URL":     s.URL + "/token",
+		"GOOGLE_AUTH_URL":      s.URL + "/o/oauth2/v2/auth",
+		"GOOGLE_USERINFO_URL":  s.URL + "/oauth2/v2/userinfo",
+	}
+}
+
+// FailNext makes the next times requests to method and path (a prefix, e.g.
+// "/gmail/v1/users/me/messages/send") fail with status.
+func (s *Server) FailNext(method, path string, status, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, failure{method, path, status, times})
+}
+
+// Requests returns "METHOD /path" for every request served so far.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (s *Server) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		for i := range s.failures {
+			f := &s.failures[i]
+			if f.times > 0 && f.method == r.Method && strings.HasPrefix(r.URL.Path, f.path) {
+				f.times--
+				s.mu.Unlock()
+				writeError(w, f.status, "injected failure")
+				return
+			}
+		}
+		s.mu.Unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorize stands in for the consent page: it approves immediately and
+// redirects back with AuthCode.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != ClientID {
+		http.Error(w, "invalid_client", http.StatusBadRequest)
+		return
+	}
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirect.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	v := redirect.Query()
+	v.Set("code", AuthCode)
+	if state := q.Get("state"); state != "" {
+		v.Set("state", state)
+	}
+	redirect.RawQuery = v.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, "invalid_request")
+		return
+	}
+	if r.PostForm.Get("client_id") != ClientID || r.PostForm.Get("client_secret") != ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	tok := google.Token{ExpiresIn: 3599, TokenType: "Bearer"}
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		if r.PostForm.Get("code") != AuthCode {
+			writeOAuthError(w, "invalid_grant")
+			return
+		}
+		tok.RefreshToken = RefreshToken
+	case "refresh_token":
+		if r.PostForm.Get("refresh_token") != RefreshToken {
+			writeOAuthError(w, "invalid_grant")
+			return
+		}
+	default:
+		writeOAuthError(w, "unsupported_grant_type")
+		return
+	}
+	s.mu.Lock()
+	s.seq++
+	tok.AccessToken = fmt.Sprintf("ya29.test-%d", s.seq)
+	s.tokens[tok.AccessToken] = true
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, tok)
+}
+
+func (s *Server) userinfo(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	email := s.email
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, google.UserInfo{ID: "1000000001", Email: email, VerifiedEmail: true, Name: "Test Advisor"})
+}
+
+// authed rejects requests without an access token issued by the fake.
+func (s *Server) authed(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tok, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		s.mu.Lock()
+		valid := ok && s.tokens[tok]
+		s.mu.Unlock()
+		if !valid {
+			writeError(w, http.StatusUnauthorized, "Request had invalid authentication credentials.")
+			return
+		}
+		h(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers in the Google API error format.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]any{"error": map[string]any{
+		"code":    status,
+		"message": message,
+		"status":  strings.ToUpper(strings.ReplaceAll(http.StatusText(status), " ", "_")),
+	}})
+}
+
+func writeOAuthError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON payload: "+err.Error())
+		return false
+	}
+	return true
+}
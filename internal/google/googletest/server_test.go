@@ -0,0 +1,256 @@
+package googletest_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"aiagentapi/internal/google"
+	"aiagentapi/internal/google/googletest"
+)
+
+func newClient(t *testing.T) (*googletest.Server, *google.Client) {
+	t.Helper()
+	srv := googletest.New(t)
+	return srv, srv.Config().NewClient(googletest.RefreshToken)
+}
+
+func TestOAuthFlow(t *testing.T) {
+	srv := googletest.New(t)
+	cfg := srv.Config()
+	ctx := context.Background()
+
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := noRedirect.Get(cfg.AuthCodeURL("http://localhost:8080/oauth/google/callback", "xyz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	loc, _ := url.Parse(resp.Header.Get("Location"))
+	if loc.Query().Get("code") != googletest.AuthCode || loc.Query().Get("state") != "xyz" {
+		t.Fatalf("redirected to %s", loc)
+	}
+
+	tok, err := cfg.Exchange(ctx, loc.Query().Get("code"), "http://localhost:8080/oauth/google/callback")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if tok.RefreshToken != googletest.RefreshToken {
+		t.Errorf("refresh token = %q", tok.RefreshToken)
+	}
+	ui, err := cfg.UserInfo(ctx, tok.AccessToken)
+	if err != nil || ui.Email != googletest.UserEmail {
+		t.Fatalf("UserInfo = %+v, %v", ui, err)
+	}
+
+	if _, err := cfg.Exchange(ctx, "wrong", "http://localhost"); !google.IsStatus(err, http.StatusBadRequest) {
+		t.Errorf("bad code: err = %v, want 400", err)
+	}
+	if _, err := cfg.NewClient("revoked").Profile(ctx); !google.IsStatus(err, http.StatusBadRequest) {
+		t.Errorf("bad refresh token: err = %v, want 400", err)
+	}
+}
+
+func TestGmailListGetAndHistory(t *testing.T) {
+	srv, g := newClient(t)
+	ctx := context.Background()
+	old := srv.AddMail(googletest.Mail{From: "bob@example.com", Subject: "Old", Body: "from last year", Date: time.Now().AddDate(-1, 0, 0)})
+	start := srv.HistoryID()
+	m := srv.AddMail(googletest.Mail{
+		From:        "Alice <alice@example.com>",
+		Subject:     "Portfolio review ✓",
+		Body:        "Can we meet on Tuesday?",
+		HTML:        "<p>Can we meet on <b>Tuesday</b>?</p>",
+		Attachments: []googletest.Attachment{{Filename: "statement.pdf", MimeType: "application/pdf", Data: []byte("%PDF-1.4 test")}},
+	})
+
+	list, err := g.ListMessages(ctx, "after:"+strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10), "", 10)
+	if err != nil {
+		t.Fatalf("ListMessages: %v", err)
+	}
+	if len(list.Messages) != 1 || list.Messages[0].ID != m.ID {
+		t.Fatalf("listed %+v, want only %s", list.Messages, m.ID)
+	}
+
+	full, err := g.GetMessage(ctx, m.ID, "full")
+	if err != nil {
+		t.Fatalf("GetMessage: %v", err)
+	}
+	if got := full.Payload.Header("Subject"); got != "Portfolio review ✓" {
+		t.Errorf("subject = %q", got)
+	}
+	if full.Snippet != "Can we meet on Tuesday?" {
+		t.Errorf("snippet = %q", full.Snippet)
+	}
+	var att *google.MessagePart
+	for i := range full.Payload.Parts {
+		if full.Payload.Parts[i].Filename == "statement.pdf" {
+			att = &full.Payload.Parts[i]
+		}
+	}
+	if att == nil || att.Body.AttachmentID == "" {
+		t.Fatalf("attachment part missing: %+v", full.Payload.Parts)
+	}
+	data, err := g.GetAttachment(ctx, m.ID, att.Body.AttachmentID)
+	if err != nil || string(data) != "%PDF-1.4 test" {
+		t.Fatalf("GetAttachment = %q, %v", data, err)
+	}
+	if min, _ := g.GetMessage(ctx, m.ID, "minimal"); min.Payload != nil {
+		t.Errorf("minimal format returned a payload")
+	}
+
+	if _, err := g.ModifyLabels(ctx, m.ID, nil, []string{"UNREAD"}); err != nil {
+		t.Fatalf("ModifyLabels: %v", err)
+	}
+	srv.DeleteMail(old.ID)
+	h, err := g.ListHistory(ctx, start, "")
+	if err != nil {
+		t.Fatalf("ListHistory: %v", err)
+	}
+	if len(h.History) != 3 || len(h.History[0].MessagesAdded) != 1 || len(h.History[1].LabelsRemoved) != 1 || len(h.History[2].MessagesDeleted) != 1 {
+		t.Fatalf("history = %+v", h.History)
+	}
+	if h.HistoryID != srv.HistoryID() {
+		t.Errorf("historyId = %s, want %s", h.HistoryID, srv.HistoryID())
+	}
+
+	srv.ExpireHistory()
+	if _, err := g.ListHistory(ctx, start, ""); !google.IsStatus(err, http.StatusNotFound) {
+		t.Errorf("expired history: err = %v, want 404", err)
+	}
+	if _, err := g.GetMessage(ctx, old.ID, "full"); !google.IsStatus(err, http.StatusNotFound) {
+		t.Errorf("deleted message: err = %v, want 404", err)
+	}
+}
+
+func TestGmailSendDraftsAndLabels(t *testing.T) {
+	srv, g := newClient(t)
+	ctx := context.Background()
+	in := srv.AddMail(googletest.Mail{From: "alice@example.com", Subject: "Question"})
+
+	raw := "From: advisor@example.com\r\nTo: alice@example.com\r\nSubject: Re: Question\r\n\r\nHere is the answer.\r\n"
+	sent, err := g.SendMessage(ctx, []byte(raw), in.ThreadID)
+	if err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if sent.ThreadID != in.ThreadID || !sent.HasLabel("SENT") {
+		t.Errorf("sent = %+v", sent)
+	}
+	if got := srv.Sent(); len(got) != 1 || got[0].Snippet != "Here is the answer." {
+		t.Errorf("Sent() = %+v", got)
+	}
+	if _, err := g.SendMessage(ctx, []byte("Subject: nobody\r\n\r\nhi"), ""); !google.IsStatus(err, http.StatusBadRequest) {
+		t.Errorf("no recipient: err = %v, want 400", err)
+	}
+	if _, err := g.SendMessage(ctx, []byte(raw), "no-such-thread"); !google.IsStatus(err, http.StatusNotFound) {
+		t.Errorf("unknown thread: err = %v, want 404", err)
+	}
+
+	d, err := g.CreateDraft(ctx, []byte(strings.Replace(raw, "the answer", "a draft", 1)), "")
+	if err != nil {
+		t.Fatalf("CreateDraft: %v", err)
+	}
+	drafts, err := g.ListDrafts(ctx, "")
+	if err != nil || len(drafts.Drafts) != 1 || drafts.Drafts[0].ID != d.ID {
+		t.Fatalf("ListDrafts = %+v, %v", drafts, err)
+	}
+	if _, err := g.SendDraft(ctx, d.ID); err != nil {
+		t.Fatalf("SendDraft: %v", err)
+	}
+	if len(srv.Sent()) != 2 {
+		t.Errorf("sent %d messages, want 2", len(srv.Sent()))
+	}
+	if err := g.DeleteDraft(ctx, d.ID); !google.IsStatus(err, http.StatusNotFound) {
+		t.Errorf("sent draft still deletable: %v", err)
+	}
+
+	l, err := g.CreateLabel(ctx, "Clients")
+	if err != nil {
+		t.Fatalf("CreateLabel: %v", err)
+	}
+	if _, err := g.CreateLabel(ctx, "clients"); !google.IsStatus(err, http.StatusConflict) {
+		t.Errorf("duplicate label: err = %v, want 409", err)
+	}
+	labels, err := g.ListLabels(ctx)
+	if err != nil || labels[len(labels)-1].ID != l.ID {
+		t.Fatalf("ListLabels = %+v, %v", labels, err)
+	}
+}
+
+func TestCalendar(t *testing.T) {
+	srv, g := newClient(t)
+	ctx := context.Background()
+	day := time.Date(2030, 3, 4, 0, 0, 0, 0, time.UTC)
+	at := func(h int) *google.EventDateTime {
+		return &google.EventDateTime{DateTime: day.Add(time.Duration(h) * time.Hour).Format(time.RFC3339)}
+	}
+
+	list, err := g.ListEvents(ctx, "primary", google.EventQuery{SingleEvents: true})
+	if err != nil || len(list.Items) != 0 || list.NextSyncToken == "" {
+		t.Fatalf("initial list = %+v, %v", list, err)
+	}
+	token := list.NextSyncToken
+
+	ev, err := g.InsertEvent(ctx, "primary", &google.Event{
+		Summary:   "Review",
+		Start:     at(10),
+		End:       at(11),
+		Attendees: []google.EventAttendee{{Email: "alice@example.com"}},
+	}, google.WriteOptions{SendUpdates: "all"})
+	if err != nil {
+		t.Fatalf("InsertEvent: %v", err)
+	}
+	if ev.ID == "" || ev.Status != "confirmed" || ev.Organizer == nil || !ev.Organizer.Self {
+		t.Errorf("inserted = %+v", ev)
+	}
+	if inv := srv.Invitations(); len(inv) != 1 || inv[0].Attendees[0] != "alice@example.com" {
+		t.Errorf("invitations = %+v", inv)
+	}
+
+	patched, err := g.PatchEvent(ctx, "primary", ev.ID, &google.Event{Description: "Bring statements"}, google.WriteOptions{})
+	if err != nil {
+		t.Fatalf("PatchEvent: %v", err)
+	}
+	if patched.Summary != "Review" || patched.Description != "Bring statements" {
+		t.Errorf("patched = %+v", patched)
+	}
+
+	changes, err := g.ListEvents(ctx, "primary", google.EventQuery{SyncToken: token})
+	if err != nil || len(changes.Items) != 1 || changes.Items[0].Description != "Bring statements" {
+		t.Fatalf("incremental list = %+v, %v", changes, err)
+	}
+	srv.ExpireSyncTokens("primary")
+	if _, err := g.ListEvents(ctx, "primary", google.EventQuery{SyncToken: changes.NextSyncToken}); !google.IsStatus(err, http.StatusGone) {
+		t.Errorf("expired token: err = %v, want 410", err)
+	}
+
+	srv.AddBusy("alice@example.com", day.Add(10*time.Hour+30*time.Minute), day.Add(12*time.Hour))
+	busy, err := g.FreeBusy(ctx, day, day.Add(24*time.Hour), []string{"primary", "alice@example.com"})
+	if err != nil {
+		t.Fatalf("FreeBusy: %v", err)
+	}
+	if len(busy["primary"]) != 1 || !busy["primary"][0].Start.Equal(day.Add(10*time.Hour)) {
+		t.Errorf("primary busy = %+v", busy["primary"])
+	}
+	if len(busy["alice@example.com"]) != 1 {
+		t.Errorf("alice busy = %+v", busy["alice@example.com"])
+	}
+	if _, err := g.FreeBusy(ctx, day, day.Add(time.Hour), []string{"stranger@example.com"}); err == nil || !strings.Contains(err.Error(), "notFound") {
+		t.Errorf("unknown calendar: err = %v", err)
+	}
+}
+
+func TestFailNext(t *testing.T) {
+	srv, g := newClient(t)
+	srv.FailNext(http.MethodGet, "/gmail/v1/users/me/profile", http.StatusServiceUnavailable, 1)
+	if _, err := g.Profile(context.Background()); !google.IsStatus(err, http.StatusServiceUnavailable) {
+		t.Fatalf("err = %v, want 503", err)
+	}
+	if p, err := g.Profile(context.Background()); err != nil || p.EmailAddress != googletest.UserEmail {
+		t.Fatalf("Profile = %+v, %v", p, err)
+	}
+}
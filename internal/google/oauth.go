@@ -0,0 +1,120 @@
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Scopes are the permissions requested when a user connects Google.
+var Scopes = []string{
+	"https://www.googleapis.com/auth/userinfo.email",
+	"https://www.googleapis.com/auth/userinfo.profile",
+	"https://www.googleapis.com/auth/gmail.modify",
+	"https://www.googleapis.com/auth/calendar",
+}
+
+// AuthCodeURL returns the consent page for the offline code flow. prompt=consent
+// makes Google issue a refresh token on every connect, not just the first.
+func (c Config) AuthCodeURL(redirectURI, state string) string {
+	params := url.Values{}
+	params.Set("client_id", c.ClientID)
+	params.Set("redirect_uri", redirectURI)
+	params.Set("response_type", "code")
+	params.Set("access_type", "offline")
+	params.Set("prompt", "consent")
+	params.Set("scope", strings.Join(Scopes, " "))
+	if state != "" {
+		params.Set("state", state)
+	}
+	return c.AuthURL + "?" + params.Encode()
+}
+
+// Token is a token endpoint response.
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	IDToken      string `json:"id_token"`
+	TokenType    string `json:"token_type"`
+}
+
+// Exchange trades an authorization code for tokens.
+func (c Config) Exchange(ctx context.Context, code, redirectURI string) (*Token, error) {
+	form := url.Values{}
+	form.Set("code", code)
+	form.Set("client_id", c.ClientID)
+	form.Set("client_secret", c.ClientSecret)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("grant_type", "authorization_code")
+	tok, err := c.postToken(ctx, form)
+	if err != nil {
+		return nil, fmt.Errorf("exchange code: %w", err)
+	}
+	return tok, nil
+}
+
+func (c Config) postToken(ctx context.Context, form url.Values) (*Token, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode/100 != 2 {
+		return nil, &APIError{Status: resp.StatusCode, Body: string(body)}
+	}
+	var tok Token
+	if err := json.Unmarshal(body, &tok); err != nil {
+		return nil, err
+	}
+	if tok.AccessToken == "" {
+		return nil, fmt.Errorf("empty access_token")
+	}
+	return &tok, nil
+}
+
+// UserInfo is the profile of the account that granted access.
+type UserInfo struct {
+	ID            string `json:"id"`
+	Email         string `json:"email"`
+	VerifiedEmail bool   `json:"verified_email"`
+	Name          string `json:"name,omitempty"`
+	Picture       string `json:"picture,omitempty"`
+}
+
+// UserInfo fetches the profile behind an access token.
+func (c Config) UserInfo(ctx context.Context, accessToken string) (*UserInfo, error) {
+	u := c.UserInfoURL
+	if u == "" {
+		u = strings.TrimRight(c.APIBaseURL, "/") + "/oauth2/v2/userinfo"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("userinfo: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return nil, fmt.Errorf("userinfo: %w", &APIError{Status: resp.StatusCode, Body: string(b)})
+	}
+	var ui UserInfo
+	if err := json.NewDecoder(resp.Body).Decode(&ui); err != nil {
+		return nil, fmt.Errorf("userinfo: %w", err)
+	}
+	return &ui, nil
+}
@@ -0,0 +1,197 @@
+package llm
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// knownProvider holds the defaults of a provider that can be enabled by
+// name alone.
+type knownProvider struct {
+	baseURL, model, embeddingModel string
+	// needsKey providers are only enabled implicitly when <NAME>_API_KEY is set;
+	// the others when <NAME>_BASE_URL is.
+	needsKey bool
+}
+
+var knownProviders = map[string]knownProvider{
+	"groq":   {baseURL: "https://api.groq.com/openai/v1", model: "llama-3.1-8b-instant", needsKey: true},
+	"openai": {baseURL: "https://api.openai.com/v1", model: "gpt-4o-mini", embeddingModel: "text-embedding-3-small", needsKey: true},
+	"ollama": {baseURL: "http://localhost:11434/v1", model: "llama3.1"},
+}
+
+// implicitOrder is the fallback order when LLM_PROVIDERS is not set.
+var implicitOrder = []string{"groq", "openai", "ollama"}
+
+var (
+	defaultOnce   sync.Once
+	defaultRouter *Router
+)
+
+// Default returns the router configured from the environment, built once.
+func Default() *Router {
+	defaultOnce.Do(func() { defaultRouter = FromEnv() })
+	return defaultRouter
+}
+
+// FromEnv builds a router from the environment.
+//
+// LLM_PROVIDERS lists providers in fallback order, e.g. "groq,openai". By
+// default every provider with credentials is used, in the order groq, openai,
+// ollama. A provider named NAME reads NAME_API_KEY, NAME_BASE_URL, NAME_MODEL
+// and NAME_EMBEDDING_MODEL; groq, openai and ollama have default URLs and
+// models, any other name (a llama.cpp server, say) needs NAME_BASE_URL.
+//
+// LLM_CHAT, LLM_SUMMARIZE, LLM_CLASSIFY and LLM_EMBEDDINGS override a
+// purpose's route with "provider[:model]" entries, e.g.
+// LLM_SUMMARIZE=groq:llama-3.1-8b-instant,ollama. Without one, chat,
+// summarization and classification use every provider's model in order.
+// Embeddings keep reading EMBEDDING_API_KEY (or OPENAI_API_KEY),
+// EMBEDDING_BASE_URL and EMBEDDING_MODEL.
+//
+// LLM_MAX_RETRIES sets how often a request is retried before falling back.
+func FromEnv() *Router {
+	policy := DefaultRetryPolicy
+	if v, err := strconv.Atoi(strings.TrimSpace(os.Getenv("LLM_MAX_RETRIES"))); err == nil && v >= 0 {
+		policy.MaxRetries = v
+	}
+
+	providers := map[string]*Provider{}
+	var order []string
+	explicit := splitList(os.Getenv("LLM_PROVIDERS"))
+	names := explicit
+	if len(names) == 0 {
+		names = implicitOrder
+	}
+	for _, name := range names {
+		name = strings.ToLower(name)
+		p, err := providerFromEnv(name, len(explicit) > 0, policy)
+		if err != nil {
+			log.Printf("[llm] %v", err)
+			continue
+		}
+		if p != nil {
+			providers[name] = p
+			order = append(order, name)
+		}
+	}
+
+	routes := map[Purpose][]Target{}
+	for _, purpose := range []Purpose{Chat, Summarize, Classify} {
+		spec := splitList(os.Getenv("LLM_" + strings.ToUpper(string(purpose))))
+		if len(spec) == 0 {
+			for _, name := range order {
+				routes[purpose] = append(routes[purpose], Target{Provider: providers[name], Model: providers[name].Model})
+			}
+			continue
+		}
+		routes[purpose] = parseRoute(purpose, spec, providers, policy, func(p *Provider) string { return p.Model })
+	}
+
+	if spec := splitList(os.Getenv("LLM_EMBEDDINGS")); len(spec) > 0 {
+		routes[Embeddings] = parseRoute(Embeddings, spec, providers, policy, func(p *Provider) string { return p.EmbeddingModel })
+	} else if p := embeddingProviderFromEnv(policy); p != nil {
+		routes[Embeddings] = []Target{{Provider: p, Model: p.EmbeddingModel}}
+	}
+	return NewRouter(routes)
+}
+
+// providerFromEnv configures the provider name. Unless it was listed
+// explicitly, a provider without credentials is skipped (nil, nil).
+func providerFromEnv(name string, explicit bool, policy RetryPolicy) (*Provider, error) {
+	prefix := strings.ToUpper(name) + "_"
+	key := strings.TrimSpace(os.Getenv(prefix + "API_KEY"))
+	baseURL := strings.TrimSpace(os.Getenv(prefix + "BASE_URL"))
+	def, known := knownProviders[name]
+	switch {
+	case !known && baseURL == "":
+		return nil, fmt.Errorf("provider %s: %sBASE_URL is not set", name, prefix)
+	case known && !explicit && def.needsKey && key == "":
+		return nil, nil
+	case known && !explicit && !def.needsKey && baseURL == "":
+		return nil, nil
+	case def.needsKey && key == "":
+		return nil, fmt.Errorf("provider %s: %sAPI_KEY is not set", name, prefix)
+	}
+	if baseURL == "" {
+		baseURL = def.baseURL
+	}
+	model := strings.TrimSpace(os.Getenv(prefix + "MODEL"))
+	if model == "" {
+		model = def.model
+	}
+	if model == "" {
+		return nil, fmt.Errorf("provider %s: %sMODEL is not set", name, prefix)
+	}
+	p := NewProvider(name, baseURL, key, model, policy)
+	p.EmbeddingModel = strings.TrimSpace(os.Getenv(prefix + "EMBEDDING_MODEL"))
+	if p.EmbeddingModel == "" {
+		p.EmbeddingModel = def.embeddingModel
+	}
+	return p, nil
+}
+
+// embeddingProviderFromEnv is the embeddings endpoint configured by the
+// EMBEDDING_* variables, or nil when there is no key.
+func embeddingProviderFromEnv(policy RetryPolicy) *Provider {
+	key := strings.TrimSpace(os.Getenv("EMBEDDING_API_KEY"))
+	if key == "" {
+		key = strings.TrimSpace(os.Getenv("OPENAI_API_KEY"))
+	}
+	if key == "" {
+		return nil
+	}
+	baseURL := strings.TrimSpace(os.Getenv("EMBEDDING_BASE_URL"))
+	if baseURL == "" {
+		baseURL = knownProviders["openai"].baseURL
+	}
+	p := NewProvider("embedding", baseURL, key, "", policy)
+	p.EmbeddingModel = strings.TrimSpace(os.Getenv("EMBEDDING_MODEL"))
+	if p.EmbeddingModel == "" {
+		p.EmbeddingModel = knownProviders["openai"].embeddingModel
+	}
+	return p
+}
+
+// parseRoute resolves "provider[:model]" entries. Provider names are not
+// case-sensitive; the model is sent exactly as written. A provider named in a
+// route but not in LLM_PROVIDERS is configured on the spot.
+func parseRoute(purpose Purpose, spec []string, providers map[string]*Provider, policy RetryPolicy, defModel func(*Provider) string) []Target {
+	var out []Target
+	for _, entry := range spec {
+		name, model, _ := strings.Cut(entry, ":")
+		name = strings.ToLower(name)
+		p, ok := providers[name]
+		if !ok {
+			var err error
+			if p, err = providerFromEnv(name, true, policy); err != nil || p == nil {
+				log.Printf("[llm] route %s: %v", purpose, err)
+				continue
+			}
+			providers[name] = p
+		}
+		if model == "" {
+			model = defModel(p)
+		}
+		if model == "" {
+			log.Printf("[llm] route %s: no model for provider %s", purpose, name)
+			continue
+		}
+		out = append(out, Target{Provider: p, Model: model})
+	}
+	return out
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			out = append(out, f)
+		}
+	}
+	return out
+}
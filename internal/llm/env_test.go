@@ -0,0 +1,34 @@
+package llm
+
+import "testing"
+
+func TestFromEnvRoutes(t *testing.T) {
+	for _, k := range []string{"GROQ_API_KEY", "OPENAI_API_KEY", "OLLAMA_BASE_URL", "EMBEDDING_API_KEY",
+		"LLM_SUMMARIZE", "LLM_CLASSIFY", "LLM_EMBEDDINGS", "LLM_MAX_RETRIES"} {
+		t.Setenv(k, "")
+	}
+	t.Setenv("LLM_PROVIDERS", "Together, OLLAMA")
+	t.Setenv("TOGETHER_BASE_URL", "http://together.test/v1")
+	t.Setenv("TOGETHER_MODEL", "Qwen/Qwen2.5-7B-Instruct")
+	t.Setenv("LLM_CHAT", "TOGETHER:meta-llama/Llama-3.3-70B-Instruct, ollama:llama3.1:8b, together")
+
+	r := FromEnv()
+	var got []string
+	for _, tg := range r.Route(Chat) {
+		got = append(got, tg.String())
+	}
+	want := []string{"together:meta-llama/Llama-3.3-70B-Instruct", "ollama:llama3.1:8b", "together:Qwen/Qwen2.5-7B-Instruct"}
+	if len(got) != len(want) {
+		t.Fatalf("chat route = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("chat route = %v, want %v", got, want)
+			break
+		}
+	}
+	// Purposes without a route use every provider's model, in order.
+	if ts := r.Route(Summarize); len(ts) != 2 || ts[0].Model != "Qwen/Qwen2.5-7B-Instruct" || ts[1].String() != "ollama:llama3.1" {
+		t.Errorf("summarize route = %v", ts)
+	}
+}
@@ -0,0 +1,205 @@
+// Package llm routes model requests to OpenAI-compatible providers (Groq,
+// OpenAI, a local Ollama or llama.cpp server, ...). Each purpose — chat,
+// summarization, classification, embeddings — has an ordered list of
+// provider/model targets: requests go to the first, are retried with jittered
+// backoff on 429 and 5xx responses, and fall back to the next target when the
+// retries run out.
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Purpose selects a route.
+type Purpose string
+
+const (
+	Chat       Purpose = "chat"
+	Summarize  Purpose = "summarize"
+	Classify   Purpose = "classify"
+	Embeddings Purpose = "embeddings"
+)
+
+// Purposes lists every routable purpose.
+var Purposes = []Purpose{Chat, Summarize, Classify, Embeddings}
+
+// ErrNotConfigured is returned when a purpose has no provider.
+var ErrNotConfigured = errors.New("llm: no provider configured (set GROQ_API_KEY, OPENAI_API_KEY or OLLAMA_BASE_URL)")
+
+// Provider is an OpenAI-compatible endpoint.
+type Provider struct {
+	Name    string
+	BaseURL string
+	APIKey  string
+	// Model is used for chat, summarization and classification unless a
+	// route names another.
+	Model string
+	// EmbeddingModel is used for embeddings unless a route names another.
+	EmbeddingModel string
+
+	client *openai.Client
+}
+
+// NewProvider creates a provider whose requests are retried per policy.
+func NewProvider(name, baseURL, apiKey, model string, policy RetryPolicy) *Provider {
+	cfg := openai.DefaultConfig(apiKey)
+	cfg.BaseURL = strings.TrimRight(baseURL, "/")
+	cfg.HTTPClient = newRetryDoer(policy)
+	return &Provider{Name: name, BaseURL: cfg.BaseURL, APIKey: apiKey, Model: model, client: openai.NewClientWithConfig(cfg)}
+}
+
+// Target is one provider/model pair of a route.
+type Target struct {
+	Provider *Provider
+	Model    string
+}
+
+func (t Target) String() string { return t.Provider.Name + ":" + t.Model }
+
+// Router sends requests along the route of their purpose.
+type Router struct {
+	routes map[Purpose][]Target
+}
+
+// NewRouter creates a router from explicit routes.
+func NewRouter(routes map[Purpose][]Target) *Router {
+	r := &Router{routes: map[Purpose][]Target{}}
+	for p, ts := range routes {
+		r.routes[p] = append([]Target(nil), ts...)
+	}
+	return r
+}
+
+// Route returns the targets for a purpose, primary first.
+func (r *Router) Route(p Purpose) []Target {
+	if r == nil {
+		return nil
+	}
+	return r.routes[p]
+}
+
+// Configured reports whether a purpose has at least one target.
+func (r *Router) Configured(p Purpose) bool { return len(r.Route(p)) > 0 }
+
+// Model returns the primary model for a purpose, or "" when there is none.
+func (r *Router) Model(p Purpose) string {
+	if ts := r.Route(p); len(ts) > 0 {
+		return ts[0].Model
+	}
+	return ""
+}
+
+// WithModel returns a copy of the router whose primary target for p uses
+// model instead.
+func (r *Router) WithModel(p Purpose, model string) *Router {
+	out := NewRouter(r.routes)
+	if ts := out.routes[p]; len(ts) > 0 && model != "" {
+		ts[0].Model = model
+	}
+	return out
+}
+
+// ChatCompletion sends req with the model of each target in turn until one
+// succeeds or fails with an error a fallback can't help with.
+func (r *Router) ChatCompletion(ctx context.Context, p Purpose, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	var resp openai.ChatCompletionResponse
+	err := r.each(ctx, p, func(t Target) error {
+		req.Model = t.Model
+		var err error
+		resp, err = t.Provider.client.CreateChatCompletion(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+// ChatCompletionStream opens a streamed completion. Fallback only happens
+// while opening the stream; once tokens flow, errors go to the caller.
+func (r *Router) ChatCompletionStream(ctx context.Context, p Purpose, req openai.ChatCompletionRequest) (*openai.ChatCompletionStream, error) {
+	var stream *openai.ChatCompletionStream
+	err := r.each(ctx, p, func(t Target) error {
+		req.Model = t.Model
+		var err error
+		stream, err = t.Provider.client.CreateChatCompletionStream(ctx, req)
+		return err
+	})
+	return stream, err
+}
+
+// CreateEmbeddings embeds with the embeddings route. Vectors from different
+// models can't be compared, so it only falls back to targets serving the same
+// model as the primary.
+func (r *Router) CreateEmbeddings(ctx context.Context, req openai.EmbeddingRequest) (openai.EmbeddingResponse, error) {
+	var resp openai.EmbeddingResponse
+	model := r.Model(Embeddings)
+	err := r.each(ctx, Embeddings, func(t Target) error {
+		if t.Model != model {
+			return errSkip
+		}
+		req.Model = openai.EmbeddingModel(t.Model)
+		var err error
+		resp, err = t.Provider.client.CreateEmbeddings(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+var errSkip = errors.New("llm: target skipped")
+
+func (r *Router) each(ctx context.Context, p Purpose, call func(Target) error) error {
+	targets := r.Route(p)
+	if len(targets) == 0 {
+		return ErrNotConfigured
+	}
+	var last error
+	for i, t := range targets {
+		err := call(t)
+		if errors.Is(err, errSkip) {
+			continue
+		}
+		if err == nil {
+			return nil
+		}
+		last = fmt.Errorf("%s: %w", t, err)
+		if ctx.Err() != nil || !Fallbackable(err) {
+			return last
+		}
+		if i < len(targets)-1 {
+			log.Printf("[llm] %s %s failed, falling back to %s: %v", p, t, targets[i+1], err)
+		}
+	}
+	return last
+}
+
+// Fallbackable reports whether another provider might succeed where this
+// error occurred: rate limits, server errors and network failures.
+func Fallbackable(err error) bool {
+	if code := StatusCode(err); code != 0 {
+		return retryableStatus(code)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
+
+// StatusCode returns the HTTP status of a provider error, or 0.
+func StatusCode(err error) int {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode
+	}
+	return 0
+}
@@ -0,0 +1,199 @@
+package llmtest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Fixture is one recorded exchange. Requests are matched by Key, a hash of
+// their messages and tool names; the model and sampling settings are left out
+// so fixtures replay against any configuration.
+type Fixture struct {
+	Key string `json:"key"`
+	// Last is the final message of the request, kept to make fixture files
+	// readable.
+	Last  openai.ChatCompletionMessage `json:"last"`
+	Reply Reply                        `json:"reply"`
+}
+
+type fixtures struct {
+	mu      sync.Mutex
+	path    string
+	byKey   map[string]Fixture
+	client  *openai.Client // set in record mode
+	model   string
+	changed bool
+}
+
+// Replay answers requests nothing else matches from the fixture file at path.
+func (s *Server) Replay(path string) {
+	s.t.Helper()
+	f, err := loadFixtures(path)
+	if err != nil {
+		s.t.Fatalf("llmtest: %v", err)
+	}
+	s.mu.Lock()
+	s.fixtures = f
+	s.mu.Unlock()
+}
+
+// Record answers requests nothing else matches with the fixture file at path
+// and forwards the rest to a real provider, adding the exchanges to the file
+// when the test ends.
+func (s *Server) Record(path, baseURL, apiKey, model string) {
+	s.t.Helper()
+	f, err := loadFixtures(path)
+	if errors.Is(err, os.ErrNotExist) {
+		f, err = &fixtures{path: path, byKey: map[string]Fixture{}}, nil
+	}
+	if err != nil {
+		s.t.Fatalf("llmtest: %v", err)
+	}
+	cfg := openai.DefaultConfig(apiKey)
+	cfg.BaseURL = baseURL
+	f.client, f.model = openai.NewClientWithConfig(cfg), model
+	s.mu.Lock()
+	s.fixtures = f
+	s.mu.Unlock()
+	s.t.Cleanup(func() {
+		if err := f.save(); err != nil {
+			s.t.Errorf("llmtest: %v", err)
+		}
+	})
+}
+
+// UseFixtures replays the fixture file at path, or records it when
+// LLMTEST_RECORD is set. Recording talks to LLMTEST_BASE_URL (Groq by
+// default) with LLMTEST_API_KEY or GROQ_API_KEY and LLMTEST_MODEL.
+func (s *Server) UseFixtures(path string) {
+	s.t.Helper()
+	if os.Getenv("LLMTEST_RECORD") == "" {
+		s.Replay(path)
+		return
+	}
+	baseURL := envOr("LLMTEST_BASE_URL", "https://api.groq.com/openai/v1")
+	key := envOr("LLMTEST_API_KEY", os.Getenv("GROQ_API_KEY"))
+	if key == "" {
+		s.t.Fatalf("llmtest: recording needs LLMTEST_API_KEY or GROQ_API_KEY")
+	}
+	s.Record(path, baseURL, key, envOr("LLMTEST_MODEL", "llama-3.1-8b-instant"))
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func loadFixtures(path string) (*fixtures, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var list []Fixture
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	f := &fixtures{path: path, byKey: map[string]Fixture{}}
+	for _, fx := range list {
+		f.byKey[fx.Key] = fx
+	}
+	return f, nil
+}
+
+func (f *fixtures) answer(t testing.TB, req openai.ChatCompletionRequest) (Reply, bool) {
+	key := Key(req)
+	f.mu.Lock()
+	fx, ok := f.byKey[key]
+	f.mu.Unlock()
+	if ok {
+		return fx.Reply, true
+	}
+	if f.client == nil {
+		return Reply{}, false
+	}
+
+	up := req
+	up.Model, up.Stream, up.StreamOptions = f.model, false, nil
+	resp, err := f.client.CreateChatCompletion(context.Background(), up)
+	if err != nil {
+		t.Errorf("llmtest: record: %v", err)
+		return Reply{}, false
+	}
+	var reply Reply
+	if len(resp.Choices) > 0 {
+		reply = Reply{Content: resp.Choices[0].Message.Content, ToolCalls: resp.Choices[0].Message.ToolCalls}
+	}
+	fx = Fixture{Key: key, Reply: reply}
+	if n := len(req.Messages); n > 0 {
+		fx.Last = req.Messages[n-1]
+	}
+	f.mu.Lock()
+	f.byKey[key] = fx
+	f.changed = true
+	f.mu.Unlock()
+	return reply, true
+}
+
+func (f *fixtures) save() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.changed {
+		return nil
+	}
+	list := make([]Fixture, 0, len(f.byKey))
+	for _, fx := range f.byKey {
+		list = append(list, fx)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(f.path, append(b, '\n'), 0o644)
+}
+
+// Key identifies a request for fixture lookup.
+func Key(req openai.ChatCompletionRequest) string {
+	type call struct {
+		ID, Name, Arguments string
+	}
+	type message struct {
+		Role, Content, Name, ToolCallID string
+		ToolCalls                       []call
+	}
+	var v struct {
+		Messages []message
+		Tools    []string
+	}
+	for _, m := range req.Messages {
+		msg := message{Role: m.Role, Content: m.Content, Name: m.Name, ToolCallID: m.ToolCallID}
+		for _, tc := range m.ToolCalls {
+			msg.ToolCalls = append(msg.ToolCalls, call{tc.ID, tc.Function.Name, tc.Function.Arguments})
+		}
+		v.Messages = append(v.Messages, msg)
+	}
+	for _, t := range req.Tools {
+		if t.Function != nil {
+			v.Tools = append(v.Tools, t.Function.Name)
+		}
+	}
+	b, _ := json.Marshal(v)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:12])
+}
@@ -0,0 +1,350 @@
+// Package llmtest provides an in-process OpenAI-compatible server for tests.
+// It answers chat completions, streamed or not, from scripted replies or from
+// fixture files recorded against a real provider, and embeddings with
+// deterministic vectors, so code built on llm.Router runs without network
+// access or API keys.
+//
+//	srv := llmtest.New(t)
+//	srv.On(llmtest.LastUser("meeting"), llmtest.Call("calendar_find_slots", `{}`), llmtest.Text("Tuesday works."))
+//	router := srv.Router()
+package llmtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"aiagentapi/internal/llm"
+)
+
+// Model and EmbeddingModel are the model names the router returned by
+// Server.Router sends.
+const (
+	Model          = "fake-model"
+	EmbeddingModel = "fake-embedding"
+)
+
+// Reply is one scripted answer to a chat completion.
+type Reply struct {
+	Content   string            `json:"content,omitempty"`
+	ToolCalls []openai.ToolCall `json:"tool_calls,omitempty"`
+	// Status, when set, fails the request with this HTTP status and Error as
+	// the message.
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// Chunks splits Content for streamed requests. By default the content is
+	// streamed word by word.
+	Chunks []string `json:"-"`
+}
+
+// Text is a plain assistant reply.
+func Text(content string) Reply { return Reply{Content: content} }
+
+// Call is a reply requesting one tool call with the given JSON arguments.
+// The call id is derived from the name; use Calls for several calls.
+func Call(name, args string) Reply {
+	return Calls(openai.ToolCall{ID: "call_" + name, Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: name, Arguments: args}})
+}
+
+// Calls is a reply requesting the given tool calls.
+func Calls(calls ...openai.ToolCall) Reply { return Reply{ToolCalls: calls} }
+
+// Fail is a reply failing with an HTTP status.
+func Fail(status int, message string) Reply { return Reply{Status: status, Error: message} }
+
+// Matcher selects the requests a rule answers.
+type Matcher func(openai.ChatCompletionRequest) bool
+
+// Any matches every request.
+func Any(openai.ChatCompletionRequest) bool { return true }
+
+// LastUser matches requests whose last user message contains s.
+func LastUser(s string) Matcher {
+	return func(req openai.ChatCompletionRequest) bool {
+		for i := len(req.Messages) - 1; i >= 0; i-- {
+			if req.Messages[i].Role == openai.ChatMessageRoleUser {
+				return strings.Contains(req.Messages[i].Content, s)
+			}
+		}
+		return false
+	}
+}
+
+// AfterTool matches requests ending with the result of the named tool.
+func AfterTool(name string) Matcher {
+	return func(req openai.ChatCompletionRequest) bool {
+		n := len(req.Messages)
+		return n > 0 && req.Messages[n-1].Role == openai.ChatMessageRoleTool && req.Messages[n-1].Name == name
+	}
+}
+
+// System matches requests with a system message containing s.
+func System(s string) Matcher {
+	return func(req openai.ChatCompletionRequest) bool {
+		for _, m := range req.Messages {
+			if m.Role == openai.ChatMessageRoleSystem && strings.Contains(m.Content, s) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+type rule struct {
+	match   Matcher
+	replies []Reply
+	used    int
+}
+
+// Server is a fake provider. Requests are answered by the first rule that
+// matches, then by fixtures, then, in record mode, by the upstream provider.
+// A request nothing answers fails the test.
+type Server struct {
+	*httptest.Server
+
+	t        testing.TB
+	mu       sync.Mutex
+	rules    []*rule
+	requests []openai.ChatCompletionRequest
+	fixtures *fixtures
+}
+
+// New starts a server that is closed when the test ends.
+func New(t testing.TB) *Server {
+	t.Helper()
+	s := &Server{t: t}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/chat/completions", s.chatCompletions)
+	mux.HandleFunc("POST /v1/embeddings", s.embeddings)
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// BaseURL is the OpenAI-style base URL of the server.
+func (s *Server) BaseURL() string { return s.URL + "/v1" }
+
+// Router returns a router sending every purpose to this server, without
+// retries.
+func (s *Server) Router() *llm.Router {
+	p := llm.NewProvider("fake", s.BaseURL(), "test-key", Model, llm.RetryPolicy{})
+	p.EmbeddingModel = EmbeddingModel
+	routes := map[llm.Purpose][]llm.Target{}
+	for _, purpose := range llm.Purposes {
+		model := Model
+		if purpose == llm.Embeddings {
+			model = EmbeddingModel
+		}
+		routes[purpose] = []llm.Target{{Provider: p, Model: model}}
+	}
+	return llm.NewRouter(routes)
+}
+
+// On adds a rule answering matching requests with replies in order. Once
+// they are used up the last reply is repeated. Rules are tried in the order
+// they were added.
+func (s *Server) On(m Matcher, replies ...Reply) {
+	if len(replies) == 0 {
+		s.t.Fatalf("llmtest: On needs at least one reply")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = append(s.rules, &rule{match: m, replies: replies})
+}
+
+// Requests returns the chat completion requests received so far.
+func (s *Server) Requests() []openai.ChatCompletionRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]openai.ChatCompletionRequest(nil), s.requests...)
+}
+
+func (s *Server) chatCompletions(w http.ResponseWriter, r *http.Request) {
+	var req openai.ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	s.mu.Unlock()
+
+	reply, ok := s.answer(req)
+	if !ok {
+		s.t.Errorf("llmtest: no reply scripted for request ending with %s", describe(req))
+		writeError(w, http.StatusInternalServerError, "llmtest: no reply scripted")
+		return
+	}
+	if reply.Status != 0 {
+		writeError(w, reply.Status, reply.Error)
+		return
+	}
+	if req.Stream {
+		writeStream(w, req.Model, reply)
+		return
+	}
+	finish := openai.FinishReasonStop
+	if len(reply.ToolCalls) > 0 {
+		finish = openai.FinishReasonToolCalls
+	}
+	writeJSON(w, http.StatusOK, openai.ChatCompletionResponse{
+		ID:      "chatcmpl-test",
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   req.Model,
+		Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: reply.Content, ToolCalls: reply.ToolCalls},
+			FinishReason: finish,
+		}},
+	})
+}
+
+func (s *Server) answer(req openai.ChatCompletionRequest) (Reply, bool) {
+	s.mu.Lock()
+	for _, r := range s.rules {
+		if !r.match(req) {
+			continue
+		}
+		reply := r.replies[min(r.used, len(r.replies)-1)]
+		r.used++
+		s.mu.Unlock()
+		return reply, true
+	}
+	f := s.fixtures
+	s.mu.Unlock()
+	if f == nil {
+		return Reply{}, false
+	}
+	return f.answer(s.t, req)
+}
+
+// writeStream sends reply as chat.completion.chunk events. Tool call
+// arguments are split in two fragments, as real providers do.
+func writeStream(w http.ResponseWriter, model string, reply Reply) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	send := func(delta openai.ChatCompletionStreamChoiceDelta, finish openai.FinishReason) {
+		b, _ := json.Marshal(openai.ChatCompletionStreamResponse{
+			ID:      "chatcmpl-test",
+			Object:  "chat.completion.chunk",
+			Created: time.Now().Unix(),
+			Model:   model,
+			Choices: []openai.ChatCompletionStreamChoice{{Delta: delta, FinishReason: finish}},
+		})
+		fmt.Fprintf(w, "data: %s\n\n", b)
+	}
+
+	send(openai.ChatCompletionStreamChoiceDelta{Role: openai.ChatMessageRoleAssistant}, "")
+	chunks := reply.Chunks
+	if chunks == nil {
+		chunks = splitWords(reply.Content)
+	}
+	for _, c := range chunks {
+		send(openai.ChatCompletionStreamChoiceDelta{Content: c}, "")
+	}
+	for i, tc := range reply.ToolCalls {
+		idx := i
+		half := len(tc.Function.Arguments) / 2
+		first := openai.ToolCall{Index: &idx, ID: tc.ID, Type: tc.Type, Function: openai.FunctionCall{Name: tc.Function.Name, Arguments: tc.Function.Arguments[:half]}}
+		rest := openai.ToolCall{Index: &idx, Function: openai.FunctionCall{Arguments: tc.Function.Arguments[half:]}}
+		send(openai.ChatCompletionStreamChoiceDelta{ToolCalls: []openai.ToolCall{first}}, "")
+		send(openai.ChatCompletionStreamChoiceDelta{ToolCalls: []openai.ToolCall{rest}}, "")
+	}
+	finish := openai.FinishReasonStop
+	if len(reply.ToolCalls) > 0 {
+		finish = openai.FinishReasonToolCalls
+	}
+	send(openai.ChatCompletionStreamChoiceDelta{}, finish)
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// splitWords cuts s after each space, keeping the spaces.
+func splitWords(s string) []string {
+	var out []string
+	for s != "" {
+		i := strings.IndexByte(s, ' ')
+		if i < 0 {
+			return append(out, s)
+		}
+		out = append(out, s[:i+1])
+		s = s[i+1:]
+	}
+	return out
+}
+
+// embeddings answers with vectors derived from a hash of each input, so equal
+// texts get equal vectors.
+func (s *Server) embeddings(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Input      any    `json:"input"`
+		Model      string `json:"model"`
+		Dimensions int    `json:"dimensions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+	var inputs []string
+	switch in := req.Input.(type) {
+	case string:
+		inputs = []string{in}
+	case []any:
+		for _, v := range in {
+			s, _ := v.(string)
+			inputs = append(inputs, s)
+		}
+	}
+	dims := req.Dimensions
+	if dims <= 0 {
+		dims = 8
+	}
+	resp := openai.EmbeddingResponse{Object: "list", Model: openai.EmbeddingModel(req.Model)}
+	for i, text := range inputs {
+		resp.Data = append(resp.Data, openai.Embedding{Object: "embedding", Index: i, Embedding: Vector(text, dims)})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Vector is the embedding the server returns for text.
+func Vector(text string, dims int) []float32 {
+	h := fnv.New64a()
+	h.Write([]byte(text))
+	seed := h.Sum64()
+	v := make([]float32, dims)
+	for i := range v {
+		seed = seed*6364136223846793005 + 1442695040888963407
+		v[i] = float32(int32(seed>>33)) / (1 << 31)
+	}
+	return v
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]any{"error": map[string]any{"message": message, "type": "llmtest_error"}})
+}
+
+// describe summarizes the last message of req for failure messages.
+func describe(req openai.ChatCompletionRequest) string {
+	if len(req.Messages) == 0 {
+		return "no messages"
+	}
+	m := req.Messages[len(req.Messages)-1]
+	content := m.Content
+	if len(content) > 120 {
+		content = content[:120] + "..."
+	}
+	return fmt.Sprintf("%s message %q", m.Role, content)
+}
@@ -0,0 +1,137 @@
+package llmtest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"aiagentapi/internal/llm"
+)
+
+func chat(t *testing.T, r *llm.Router, content string) openai.ChatCompletionMessage {
+	t.Helper()
+	resp, err := r.ChatCompletion(context.Background(), llm.Chat, openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: content}},
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+	return resp.Choices[0].Message
+}
+
+func TestRulesInOrder(t *testing.T) {
+	s := New(t)
+	s.On(LastUser("weather"), Text("Sunny."))
+	s.On(Any, Text("first"), Text("second"))
+	r := s.Router()
+
+	for _, tc := range []struct{ in, want string }{
+		{"what's the weather", "Sunny."},
+		{"hello", "first"},
+		{"hello", "second"},
+		{"hello", "second"},
+	} {
+		if got := chat(t, r, tc.in).Content; got != tc.want {
+			t.Errorf("%q: got %q, want %q", tc.in, got, tc.want)
+		}
+	}
+	if n := len(s.Requests()); n != 4 {
+		t.Errorf("recorded %d requests, want 4", n)
+	}
+}
+
+func TestStreamToolCall(t *testing.T) {
+	s := New(t)
+	s.On(Any, Reply{Content: "Looking that up.", ToolCalls: Call("search_context", `{"query":"AAPL"}`).ToolCalls})
+
+	stream, err := s.Router().ChatCompletionStream(context.Background(), llm.Chat, openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "AAPL?"}},
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletionStream: %v", err)
+	}
+	defer stream.Close()
+
+	var content, args string
+	var chunks int
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+		chunks++
+		d := chunk.Choices[0].Delta
+		content += d.Content
+		for _, tc := range d.ToolCalls {
+			args += tc.Function.Arguments
+		}
+	}
+	if content != "Looking that up." || args != `{"query":"AAPL"}` {
+		t.Errorf("content %q, args %q", content, args)
+	}
+	if chunks < 5 {
+		t.Errorf("got %d chunks, want the reply split up", chunks)
+	}
+}
+
+func TestFailure(t *testing.T) {
+	s := New(t)
+	s.On(Any, Fail(503, "down for maintenance"))
+	_, err := s.Router().ChatCompletion(context.Background(), llm.Chat, openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+	})
+	if llm.StatusCode(err) != 503 {
+		t.Fatalf("err = %v, want a 503", err)
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	upstream := New(t)
+	upstream.On(LastUser("capital"), Text("Paris."))
+	path := filepath.Join(t.TempDir(), "fixtures.json")
+
+	t.Run("record", func(t *testing.T) {
+		s := New(t)
+		s.Record(path, upstream.BaseURL(), "key", "upstream-model")
+		if got := chat(t, s.Router(), "capital of France?").Content; got != "Paris." {
+			t.Fatalf("got %q", got)
+		}
+	})
+	if n := len(upstream.Requests()); n != 1 || upstream.Requests()[0].Model != "upstream-model" {
+		t.Fatalf("upstream saw %d requests", n)
+	}
+
+	t.Run("replay", func(t *testing.T) {
+		s := New(t)
+		s.Replay(path)
+		if got := chat(t, s.Router(), "capital of France?").Content; got != "Paris." {
+			t.Fatalf("got %q", got)
+		}
+	})
+	if n := len(upstream.Requests()); n != 1 {
+		t.Errorf("replay reached upstream (%d requests)", n)
+	}
+}
+
+func TestEmbeddings(t *testing.T) {
+	s := New(t)
+	resp, err := s.Router().CreateEmbeddings(context.Background(), openai.EmbeddingRequest{Input: []string{"a", "b", "a"}, Dimensions: 4})
+	if err != nil {
+		t.Fatalf("CreateEmbeddings: %v", err)
+	}
+	if len(resp.Data) != 3 || len(resp.Data[0].Embedding) != 4 {
+		t.Fatalf("got %+v", resp.Data)
+	}
+	for i := range resp.Data[0].Embedding {
+		if resp.Data[0].Embedding[i] != resp.Data[2].Embedding[i] {
+			t.Fatalf("equal inputs got different vectors")
+		}
+	}
+}
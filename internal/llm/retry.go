@@ -0,0 +1,155 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy controls how a provider request is retried after a 429, a 5xx
+// or a network error.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt.
+	MaxRetries int
+	// BaseDelay is the backoff before the first retry; it doubles for each
+	// further retry up to MaxDelay. The actual wait is drawn uniformly from
+	// [delay/2, delay] so concurrent clients don't retry in lockstep.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// MaxRetryAfter caps how long a Retry-After header is honoured. A server
+	// asking for a longer wait gets no retry, so the router can move on to a
+	// fallback provider instead.
+	MaxRetryAfter time.Duration
+}
+
+// DefaultRetryPolicy retries twice, starting at half a second.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:    2,
+	BaseDelay:     500 * time.Millisecond,
+	MaxDelay:      8 * time.Second,
+	MaxRetryAfter: 20 * time.Second,
+}
+
+// retryDoer is the HTTP client handed to go-openai. It replays requests that
+// failed with a retryable status, so retries happen below the SDK and also
+// cover the initial response of a stream.
+type retryDoer struct {
+	client *http.Client
+	policy RetryPolicy
+	// sleep is replaced in tests.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func newRetryDoer(policy RetryPolicy) *retryDoer {
+	return &retryDoer{client: &http.Client{}, policy: policy, sleep: sleepCtx}
+}
+
+func (d *retryDoer) Do(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return d.client.Do(req)
+	}
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+		resp, err := d.client.Do(req)
+		if attempt >= d.policy.MaxRetries || ctx.Err() != nil {
+			return resp, err
+		}
+
+		var wait time.Duration
+		switch {
+		case err != nil:
+			if !retryableNetError(err) {
+				return resp, err
+			}
+			wait = d.backoff(attempt)
+		case retryableStatus(resp.StatusCode):
+			wait = d.backoff(attempt)
+			if ra, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				if ra > d.policy.MaxRetryAfter {
+					return resp, nil
+				}
+				wait = ra
+			}
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		default:
+			return resp, nil
+		}
+		if err := d.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// backoff returns the jittered delay before retry number attempt+1.
+func (d *retryDoer) backoff(attempt int) time.Duration {
+	delay := d.policy.BaseDelay << attempt
+	if delay <= 0 || delay > d.policy.MaxDelay {
+		delay = d.policy.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+func retryableNetError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	// Malformed URLs and the like fail the same way every time.
+	return !strings.Contains(err.Error(), "unsupported protocol scheme")
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func retryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs * float64(time.Second)), true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,252 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2025, 10, 13, 7, 0, 0, 0, time.UTC)
+	tests := []struct {
+		v    string
+		want time.Duration
+		ok   bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{" 0.5 ", 500 * time.Millisecond, true},
+		{"-1", 0, false},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := retryAfter(tt.v, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %v, %v; want %v, %v", tt.v, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := newRetryDoer(RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second})
+	for attempt, want := range []time.Duration{100, 200, 400, 800, 1000, 1000, 1000} {
+		want *= time.Millisecond
+		for i := 0; i < 50; i++ {
+			if got := d.backoff(attempt); got < want/2 || got > want {
+				t.Fatalf("backoff(%d) = %v, want within [%v, %v]", attempt, got, want/2, want)
+			}
+		}
+	}
+	// A shift past the width of time.Duration must not wrap to a tiny delay.
+	if got := d.backoff(70); got < 500*time.Millisecond {
+		t.Errorf("backoff(70) = %v", got)
+	}
+}
+
+// scripted answers each request with the next status in statuses (the last
+// one repeats) and records the request bodies.
+type scripted struct {
+	statuses   []int
+	retryAfter string
+	bodies     []string
+}
+
+func (s *scripted) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := io.ReadAll(r.Body)
+	s.bodies = append(s.bodies, string(b))
+	code := s.statuses[min(len(s.bodies), len(s.statuses))-1]
+	if s.retryAfter != "" {
+		w.Header().Set("Retry-After", s.retryAfter)
+	}
+	w.WriteHeader(code)
+	fmt.Fprintf(w, `{"status": %d}`, code)
+}
+
+func TestRetryDoer(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 2, BaseDelay: time.Second, MaxDelay: 4 * time.Second, MaxRetryAfter: 10 * time.Second}
+	tests := []struct {
+		name       string
+		statuses   []int
+		retryAfter string
+		wantStatus int
+		wantCalls  int
+		wantWaits  []time.Duration
+	}{
+		{name: "success", statuses: []int{200}, wantStatus: 200, wantCalls: 1},
+		{name: "client error not retried", statuses: []int{400}, wantStatus: 400, wantCalls: 1},
+		{name: "recovers", statuses: []int{503, 429, 200}, wantStatus: 200, wantCalls: 3},
+		{name: "retries run out", statuses: []int{500}, wantStatus: 500, wantCalls: 3},
+		{name: "retry-after honoured", statuses: []int{429, 200}, retryAfter: "7", wantStatus: 200, wantCalls: 2, wantWaits: []time.Duration{7 * time.Second}},
+		{name: "long retry-after left to fallback", statuses: []int{429, 200}, retryAfter: "60", wantStatus: 429, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &scripted{statuses: tt.statuses, retryAfter: tt.retryAfter}
+			srv := httptest.NewServer(s)
+			defer srv.Close()
+
+			var waits []time.Duration
+			d := newRetryDoer(policy)
+			d.sleep = func(ctx context.Context, w time.Duration) error {
+				waits = append(waits, w)
+				return nil
+			}
+			req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"model":"m"}`))
+			resp, err := d.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus || !strings.Contains(string(body), fmt.Sprint(tt.wantStatus)) {
+				t.Errorf("response %d %s, want %d", resp.StatusCode, body, tt.wantStatus)
+			}
+			if len(s.bodies) != tt.wantCalls {
+				t.Errorf("%d calls, want %d", len(s.bodies), tt.wantCalls)
+			}
+			for i, b := range s.bodies {
+				if b != `{"model":"m"}` {
+					t.Errorf("call %d body = %q, want the request replayed", i, b)
+				}
+			}
+			if len(waits) != tt.wantCalls-1 {
+				t.Errorf("waits = %v for %d calls", waits, tt.wantCalls)
+			}
+			for i, w := range tt.wantWaits {
+				if i < len(waits) && waits[i] != w {
+					t.Errorf("wait %d = %v, want %v", i, waits[i], w)
+				}
+			}
+			for _, w := range waits[len(tt.wantWaits):] {
+				if w < policy.BaseDelay/2 || w > policy.MaxDelay {
+					t.Errorf("backoff wait %v outside the policy", w)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryDoerStopsWhenCancelled(t *testing.T) {
+	s := &scripted{statuses: []int{503}}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	d := newRetryDoer(RetryPolicy{MaxRetries: 5, BaseDelay: time.Second, MaxDelay: time.Second})
+	d.sleep = func(context.Context, time.Duration) error { return context.Canceled }
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if _, err := d.Do(req); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if len(s.bodies) != 1 {
+		t.Errorf("%d calls after cancellation, want 1", len(s.bodies))
+	}
+}
+
+func TestFallbackable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&openai.APIError{HTTPStatusCode: 429}, true},
+		{fmt.Errorf("groq: %w", &openai.APIError{HTTPStatusCode: 502}), true},
+		{&openai.RequestError{HTTPStatusCode: 503}, true},
+		{&openai.APIError{HTTPStatusCode: 401}, false},
+		{&openai.APIError{HTTPStatusCode: 400}, false},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{errors.New("decode response"), false},
+	}
+	for _, tt := range tests {
+		if got := Fallbackable(tt.err); got != tt.want {
+			t.Errorf("Fallbackable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// chatServer fails every request with status, or answers a chat completion
+// when status is 200, counting the requests in calls.
+func chatServer(t *testing.T, status int, calls *atomic.Int32) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			fmt.Fprintf(w, `{"error": {"message": "status %d", "type": "server_error"}}`, status)
+			return
+		}
+		fmt.Fprint(w, `{"id": "c1", "object": "chat.completion",
+			"choices": [{"index": 0, "message": {"role": "assistant", "content": "ok"}, "finish_reason": "stop"}]}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRouterFallback(t *testing.T) {
+	tests := []struct {
+		name            string
+		primary         int
+		wantErr         bool
+		wantSecondCalls int32
+	}{
+		{"primary answers", http.StatusOK, false, 0},
+		{"rate limit falls back", http.StatusTooManyRequests, false, 1},
+		{"outage falls back", http.StatusBadGateway, false, 1},
+		{"bad key does not", http.StatusUnauthorized, true, 0},
+		{"bad request does not", http.StatusBadRequest, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var first, second atomic.Int32
+			a := NewProvider("a", chatServer(t, tt.primary, &first).URL, "k", "model-a", RetryPolicy{})
+			b := NewProvider("b", chatServer(t, http.StatusOK, &second).URL, "k", "model-b", RetryPolicy{})
+			r := NewRouter(map[Purpose][]Target{Chat: {{a, "model-a"}, {b, "model-b"}}})
+
+			resp, err := r.ChatCompletion(context.Background(), Chat, openai.ChatCompletionRequest{
+				Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.HasPrefix(err.Error(), "a:model-a: ") {
+				t.Errorf("err = %q, want it to name the target", err)
+			}
+			if first.Load() != 1 || second.Load() != tt.wantSecondCalls {
+				t.Errorf("calls = %d, %d; want 1, %d", first.Load(), second.Load(), tt.wantSecondCalls)
+			}
+			if err == nil && len(resp.Choices) != 1 {
+				t.Errorf("response = %+v", resp)
+			}
+		})
+	}
+
+	if _, err := NewRouter(nil).ChatCompletion(context.Background(), Chat, openai.ChatCompletionRequest{}); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("empty route: err = %v", err)
+	}
+}
+
+func TestEmbeddingsFallBackOnlyToTheSameModel(t *testing.T) {
+	var first, second, third atomic.Int32
+	a := NewProvider("a", chatServer(t, http.StatusServiceUnavailable, &first).URL, "k", "", RetryPolicy{})
+	b := NewProvider("b", chatServer(t, http.StatusServiceUnavailable, &second).URL, "k", "", RetryPolicy{})
+	c := NewProvider("c", chatServer(t, http.StatusServiceUnavailable, &third).URL, "k", "", RetryPolicy{})
+	r := NewRouter(map[Purpose][]Target{Embeddings: {{a, "embed-1"}, {b, "embed-2"}, {c, "embed-1"}}})
+
+	_, err := r.CreateEmbeddings(context.Background(), openai.EmbeddingRequest{Input: []string{"x"}})
+	if StatusCode(err) != http.StatusServiceUnavailable || !strings.HasPrefix(err.Error(), "c:embed-1: ") {
+		t.Errorf("err = %v, want the last same-model target's 503", err)
+	}
+	if first.Load() != 1 || second.Load() != 0 || third.Load() != 1 {
+		t.Errorf("calls = %d, %d, %d; want 1, 0, 1", first.Load(), second.Load(), third.Load())
+	}
+}
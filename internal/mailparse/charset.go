@@ -0,0 +1,93 @@
+package mailparse
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// ToUTF8 converts body bytes in the named charset to UTF-8. An unknown or
+// missing charset falls back to UTF-8 when the bytes are valid and to
+// Windows-1252 otherwise; HTML without a declared charset is sniffed from
+// its <meta> tags.
+func ToUTF8(data []byte, label, mediaType string) string {
+	label = strings.ToLower(strings.Trim(strings.TrimSpace(label), `"`))
+	if label == "" && mediaType == "text/html" {
+		if _, name, certain := charset.DetermineEncoding(data, "text/html"); certain {
+			label = name
+		}
+	}
+	switch label {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		if utf8.Valid(data) {
+			return string(data)
+		}
+		label = "windows-1252"
+	}
+	enc, _ := charset.Lookup(label)
+	if enc == nil {
+		if utf8.Valid(data) {
+			return string(data)
+		}
+		enc = charmap.Windows1252
+	}
+	out, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return strings.ToValidUTF8(string(data), "\ufffd")
+	}
+	return string(bytes.TrimPrefix(out, []byte("\ufeff")))
+}
+
+var wordDecoder = &mime.WordDecoder{
+	CharsetReader: func(label string, input io.Reader) (io.Reader, error) {
+		r, err := charset.NewReaderLabel(label, input)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported charset %q", label)
+		}
+		return r, nil
+	},
+}
+
+// DecodeHeader decodes RFC 2047 encoded words in a header value, leaving the
+// value unchanged when it can't be decoded.
+func DecodeHeader(v string) string {
+	if s, err := wordDecoder.DecodeHeader(v); err == nil {
+		return s
+	}
+	return v
+}
+
+// AddressList formats each address of an address header as "Name <addr>",
+// or just "addr" when there is no display name. Unparseable headers are
+// split on commas.
+func AddressList(v string) []string {
+	if strings.TrimSpace(v) == "" {
+		return nil
+	}
+	list, err := (&mail.AddressParser{WordDecoder: wordDecoder}).ParseList(v)
+	if err != nil {
+		var out []string
+		for _, s := range strings.Split(DecodeHeader(v), ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	out := make([]string, 0, len(list))
+	for _, a := range list {
+		if a.Name != "" {
+			out = append(out, fmt.Sprintf("%s <%s>", a.Name, a.Address))
+		} else {
+			out = append(out, a.Address)
+		}
+	}
+	return out
+}
@@ -0,0 +1,160 @@
+package mailparse
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HTMLToText renders an HTML email body as plain text: scripts, styles and
+// the document head are dropped, block elements become line breaks, list
+// items are prefixed with "- " and runs of whitespace are collapsed.
+func HTMLToText(s string) string {
+	var (
+		z    = html.NewTokenizer(strings.NewReader(s))
+		t    textBuilder
+		skip int
+		pre  int
+	)
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			return t.String()
+		case html.TextToken:
+			if skip > 0 {
+				continue
+			}
+			if pre > 0 {
+				t.preformatted(string(z.Text()))
+			} else {
+				t.text(string(z.Text()))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			switch a := atom.Lookup(name); a {
+			case atom.Script, atom.Style, atom.Head, atom.Title, atom.Noscript, atom.Template:
+				if tt == html.StartTagToken {
+					skip++
+				}
+			case atom.Pre:
+				t.breakLine(2)
+				if tt == html.StartTagToken {
+					pre++
+				}
+			case atom.Br:
+				t.breakLine(1)
+			case atom.Li:
+				t.breakLine(1)
+				t.prefix = "- "
+			case atom.Td, atom.Th:
+				t.space = true
+			default:
+				if n := blockBreak(a); n > 0 {
+					t.breakLine(n)
+				}
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch a := atom.Lookup(name); a {
+			case atom.Script, atom.Style, atom.Head, atom.Title, atom.Noscript, atom.Template:
+				if skip > 0 {
+					skip--
+				}
+			case atom.Pre:
+				if pre > 0 {
+					pre--
+				}
+				t.breakLine(2)
+			default:
+				if n := blockBreak(a); n > 0 {
+					t.breakLine(n)
+				}
+			}
+		}
+	}
+}
+
+// blockBreak is the number of newlines separating a block element from its
+// surroundings: paragraphs and headings get a blank line.
+func blockBreak(a atom.Atom) int {
+	switch a {
+	case atom.P, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6,
+		atom.Blockquote, atom.Table, atom.Ul, atom.Ol, atom.Hr:
+		return 2
+	case atom.Div, atom.Tr, atom.Section, atom.Article, atom.Header, atom.Footer,
+		atom.Dt, atom.Dd, atom.Center, atom.Address:
+		return 1
+	}
+	return 0
+}
+
+// textBuilder joins words with single spaces and defers line breaks until
+// the next word, so leading and trailing breaks never appear.
+type textBuilder struct {
+	b        strings.Builder
+	started  bool
+	space    bool
+	newlines int
+	prefix   string
+}
+
+func (t *textBuilder) text(s string) {
+	s = strings.ReplaceAll(s, "\u00a0", " ")
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		if s != "" {
+			t.space = true
+		}
+		return
+	}
+	if unicode.IsSpace(rune(s[0])) {
+		t.space = true
+	}
+	for i, w := range words {
+		if i > 0 {
+			t.space = true
+		}
+		t.word(w)
+	}
+	if unicode.IsSpace(rune(s[len(s)-1])) {
+		t.space = true
+	}
+}
+
+func (t *textBuilder) preformatted(s string) {
+	for i, line := range strings.Split(s, "\n") {
+		if i > 0 {
+			t.breakLine(1)
+		}
+		if line = strings.TrimRight(line, " \t\r"); line != "" {
+			t.word(line)
+		}
+	}
+}
+
+func (t *textBuilder) word(w string) {
+	if t.started {
+		if t.newlines > 0 {
+			t.b.WriteString(strings.Repeat("\n", t.newlines))
+		} else if t.space {
+			t.b.WriteByte(' ')
+		}
+	}
+	if t.prefix != "" {
+		t.b.WriteString(t.prefix)
+		t.prefix = ""
+	}
+	t.b.WriteString(w)
+	t.started, t.space, t.newlines = true, false, 0
+}
+
+func (t *textBuilder) breakLine(n int) {
+	if n > t.newlines {
+		t.newlines = n
+	}
+}
+
+func (t *textBuilder) String() string { return t.b.String() }
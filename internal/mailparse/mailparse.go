@@ -0,0 +1,333 @@
+// Package mailparse turns Gmail message payloads and raw RFC 822 messages
+// into clean UTF-8 text and HTML bodies plus attachment metadata.
+package mailparse
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"aiagentapi/internal/google"
+)
+
+// Message is the readable content of an email.
+type Message struct {
+	// Text is the plain text body, converted from HTML when the message has
+	// no text part. Forwarded (message/rfc822) messages are appended to it.
+	Text        string
+	HTML        string
+	Attachments []Attachment
+}
+
+// Attachment describes a part that is not part of the readable body.
+type Attachment struct {
+	// PartID is Gmail's part id ("1", "1.2", ...); unlike AttachmentID it is
+	// stable across fetches of the same message.
+	PartID       string
+	Filename     string
+	MimeType     string
+	Size         int64
+	AttachmentID string
+	ContentID    string
+	Inline       bool
+	// Data holds the content when it was delivered with the message rather
+	// than behind an AttachmentID.
+	Data []byte
+}
+
+// maxRawSize bounds how much of a raw message or part is read.
+const maxRawSize = 32 << 20
+
+// part is the common form of Gmail and raw MIME parts: bodies are fully
+// decoded bytes in their declared charset.
+type part struct {
+	id           string
+	mediaType    string
+	charset      string
+	filename     string
+	disposition  string
+	contentID    string
+	attachmentID string
+	size         int64
+	header       textproto.MIMEHeader
+	data         []byte
+	parts        []*part
+}
+
+// FromGmail parses a Gmail format=full payload.
+func FromGmail(p *google.MessagePart) *Message {
+	if p == nil {
+		return &Message{}
+	}
+	return build(gmailPart(p))
+}
+
+// ParseRaw parses a raw RFC 822 message, e.g. from format=raw or an attached .eml.
+func ParseRaw(r io.Reader) (*Message, error) {
+	root, err := rawMessage(r, "")
+	if err != nil {
+		return nil, err
+	}
+	return build(root), nil
+}
+
+func gmailPart(p *google.MessagePart) *part {
+	h := textproto.MIMEHeader{}
+	for _, kv := range p.Headers {
+		h.Add(kv.Name, kv.Value)
+	}
+	out := newPart(p.PartID, h, p.MimeType)
+	if p.Filename != "" {
+		out.filename = p.Filename
+	}
+	out.attachmentID = p.Body.AttachmentID
+	out.size = p.Body.Size
+	// Gmail has already undone the Content-Transfer-Encoding of body.data;
+	// decoding it again would mangle bodies that merely look encoded.
+	if p.Body.Data != "" {
+		if b, err := google.DecodeData(p.Body.Data); err == nil {
+			out.data = b
+		}
+	}
+	for i := range p.Parts {
+		out.parts = append(out.parts, gmailPart(&p.Parts[i]))
+	}
+	return out
+}
+
+func newPart(id string, h textproto.MIMEHeader, fallbackType string) *part {
+	p := &part{id: id, header: h}
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil || mediaType == "" {
+		mediaType = strings.ToLower(fallbackType)
+	}
+	if mediaType == "" {
+		mediaType = "text/plain"
+	}
+	p.mediaType = mediaType
+	p.charset = params["charset"]
+	if disp, dparams, err := mime.ParseMediaType(h.Get("Content-Disposition")); err == nil {
+		p.disposition = disp
+		p.filename = DecodeHeader(dparams["filename"])
+	}
+	if p.filename == "" && params["name"] != "" {
+		p.filename = DecodeHeader(params["name"])
+	}
+	p.contentID = strings.Trim(h.Get("Content-Id"), "<> ")
+	return p
+}
+
+func rawMessage(r io.Reader, id string) (*part, error) {
+	m, err := mail.ReadMessage(bufio.NewReader(io.LimitReader(r, maxRawSize)))
+	if err != nil {
+		return nil, err
+	}
+	return rawPart(textproto.MIMEHeader(m.Header), m.Body, id)
+}
+
+func rawPart(h textproto.MIMEHeader, body io.Reader, id string) (*part, error) {
+	p := newPart(id, h, "text/plain")
+	if strings.HasPrefix(p.mediaType, "multipart/") {
+		_, params, _ := mime.ParseMediaType(h.Get("Content-Type"))
+		mr := multipart.NewReader(body, params["boundary"])
+		for i := 0; ; i++ {
+			np, err := mr.NextRawPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				// Keep what parsed cleanly from a truncated or malformed message.
+				break
+			}
+			child, err := rawPart(np.Header, np, childID(id, i))
+			if err != nil {
+				continue
+			}
+			p.parts = append(p.parts, child)
+		}
+		return p, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, maxRawSize))
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(strings.TrimSpace(h.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		if out, err := decodeBase64(data); err == nil {
+			data = out
+		}
+	case "quoted-printable":
+		if out, err := io.ReadAll(quotedprintable.NewReader(bytes.NewReader(data))); err == nil {
+			data = out
+		}
+	}
+	p.data, p.size = data, int64(len(data))
+	if p.mediaType == "message/rfc822" && p.disposition != "attachment" {
+		if inner, err := rawMessage(bytes.NewReader(data), childID(id, 0)); err == nil {
+			p.parts = []*part{inner}
+		}
+	}
+	return p, nil
+}
+
+func childID(parent string, i int) string {
+	if parent == "" {
+		return strconv.Itoa(i)
+	}
+	return parent + "." + strconv.Itoa(i)
+}
+
+func decodeBase64(b []byte) ([]byte, error) {
+	clean := bytes.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' || r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, b)
+	clean = bytes.TrimRight(clean, "=")
+	return base64.RawStdEncoding.DecodeString(string(clean))
+}
+
+// collector accumulates the readable parts of a message tree.
+type collector struct {
+	text, html  []string
+	forwarded   []string
+	attachments []Attachment
+}
+
+func build(root *part) *Message {
+	var c collector
+	c.walk(root)
+	m := &Message{
+		Text:        strings.TrimSpace(strings.Join(c.text, "\n\n")),
+		HTML:        strings.Join(c.html, "\n"),
+		Attachments: c.attachments,
+	}
+	if m.Text == "" && m.HTML != "" {
+		m.Text = HTMLToText(m.HTML)
+	}
+	for _, f := range c.forwarded {
+		if m.Text != "" {
+			m.Text += "\n\n"
+		}
+		m.Text += f
+	}
+	return m
+}
+
+func (c *collector) walk(p *part) {
+	switch {
+	case p.mediaType == "message/rfc822":
+		c.nested(p)
+	case strings.HasPrefix(p.mediaType, "multipart/"):
+		if p.mediaType == "multipart/alternative" {
+			c.alternative(p)
+			return
+		}
+		for _, child := range p.parts {
+			c.walk(child)
+		}
+	case isAttachment(p):
+		c.attach(p)
+	case p.mediaType == "text/plain":
+		if s := ToUTF8(p.data, p.charset, p.mediaType); strings.TrimSpace(s) != "" {
+			c.text = append(c.text, strings.ReplaceAll(s, "\r\n", "\n"))
+		}
+	case p.mediaType == "text/html":
+		if s := ToUTF8(p.data, p.charset, p.mediaType); strings.TrimSpace(s) != "" {
+			c.html = append(c.html, s)
+		}
+	default:
+		// Calendar invites, inline images without names and the like.
+		c.attach(p)
+	}
+}
+
+// alternative keeps the richest (last) text and HTML renderings of the same
+// content, while attachments from every branch are kept.
+func (c *collector) alternative(p *part) {
+	var text, html []string
+	for _, child := range p.parts {
+		var sub collector
+		sub.walk(child)
+		if len(sub.text) > 0 {
+			text = sub.text
+		}
+		if len(sub.html) > 0 {
+			html = sub.html
+		}
+		c.forwarded = append(c.forwarded, sub.forwarded...)
+		c.attachments = append(c.attachments, sub.attachments...)
+	}
+	c.text = append(c.text, text...)
+	c.html = append(c.html, html...)
+}
+
+// nested renders an attached or forwarded message as text after the body.
+// Attached .eml files are also recorded as attachments.
+func (c *collector) nested(p *part) {
+	if p.attachmentID != "" || p.disposition == "attachment" {
+		c.attach(p)
+	}
+	if len(p.parts) == 0 {
+		return
+	}
+	inner := p.parts[0]
+	if len(p.parts) > 1 {
+		inner = &part{mediaType: "multipart/mixed", header: p.header, parts: p.parts}
+	}
+	h := inner.header
+	if h.Get("From") == "" && h.Get("Subject") == "" {
+		h = p.header
+	}
+	sub := build(inner)
+	c.attachments = append(c.attachments, sub.Attachments...)
+	if strings.TrimSpace(sub.Text) == "" {
+		return
+	}
+	var b strings.Builder
+	b.WriteString("---------- Forwarded message ----------\n")
+	for _, name := range []string{"From", "Date", "Subject", "To"} {
+		if v := h.Get(name); v != "" {
+			b.WriteString(name + ": " + DecodeHeader(v) + "\n")
+		}
+	}
+	b.WriteString("\n" + sub.Text)
+	c.forwarded = append(c.forwarded, b.String())
+}
+
+func isAttachment(p *part) bool {
+	return p.disposition == "attachment" || p.filename != "" || p.attachmentID != ""
+}
+
+func (c *collector) attach(p *part) {
+	if p.attachmentID == "" && len(p.data) == 0 {
+		return
+	}
+	size := p.size
+	if size == 0 {
+		size = int64(len(p.data))
+	}
+	a := Attachment{
+		PartID:       p.id,
+		Filename:     p.filename,
+		MimeType:     p.mediaType,
+		Size:         size,
+		AttachmentID: p.attachmentID,
+		ContentID:    p.contentID,
+		Inline:       p.disposition == "inline" || (p.disposition == "" && p.contentID != ""),
+	}
+	if p.attachmentID == "" {
+		a.Data = p.data
+	}
+	c.attachments = append(c.attachments, a)
+}
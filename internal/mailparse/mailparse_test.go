@@ -0,0 +1,173 @@
+package mailparse
+
+import (
+	"strings"
+	"testing"
+
+	"aiagentapi/internal/google"
+)
+
+func gmailText(id, mediaType, cte, text string) google.MessagePart {
+	p := google.MessagePart{
+		PartID:   id,
+		MimeType: mediaType,
+		Headers:  []google.Header{{Name: "Content-Type", Value: mediaType + "; charset=UTF-8"}},
+		Body:     google.MessagePartBody{Data: google.EncodeData([]byte(text)), Size: int64(len(text))},
+	}
+	if cte != "" {
+		p.Headers = append(p.Headers, google.Header{Name: "Content-Transfer-Encoding", Value: cte})
+	}
+	return p
+}
+
+func TestFromGmailKeepsDecodedBodies(t *testing.T) {
+	// Gmail serves body.data already transfer-decoded, even when the part
+	// still declares its original encoding.
+	tests := []struct{ cte, text string }{
+		{"base64", "Thanks see you tomorrow at noon"},
+		{"quoted-printable", "Pick a colour: https://x.com/?c=FF0000&id=AB12"},
+		{"quoted-printable", "Costs =3D 5 euros, soft break =\nhere"},
+	}
+	for _, tt := range tests {
+		m := FromGmail(&google.MessagePart{
+			MimeType: "multipart/alternative",
+			Parts:    []google.MessagePart{gmailText("0", "text/plain", tt.cte, tt.text)},
+		})
+		if m.Text != tt.text {
+			t.Errorf("%s body %q came out as %q", tt.cte, tt.text, m.Text)
+		}
+	}
+}
+
+func TestFromGmailAlternativeAndAttachments(t *testing.T) {
+	m := FromGmail(&google.MessagePart{
+		MimeType: "multipart/mixed",
+		Parts: []google.MessagePart{
+			{
+				PartID:   "0",
+				MimeType: "multipart/alternative",
+				Parts: []google.MessagePart{
+					gmailText("0.0", "text/plain", "", "Plain version"),
+					gmailText("0.1", "text/html", "", "<p>HTML <b>version</b></p>"),
+				},
+			},
+			{
+				PartID:   "1",
+				MimeType: "application/pdf",
+				Filename: "statement.pdf",
+				Body:     google.MessagePartBody{AttachmentID: "att-1", Size: 2048},
+			},
+		},
+	})
+	if m.Text != "Plain version" || m.HTML != "<p>HTML <b>version</b></p>" {
+		t.Errorf("Text %q, HTML %q", m.Text, m.HTML)
+	}
+	if len(m.Attachments) != 1 {
+		t.Fatalf("attachments = %+v", m.Attachments)
+	}
+	if a := m.Attachments[0]; a.PartID != "1" || a.Filename != "statement.pdf" || a.AttachmentID != "att-1" || a.Size != 2048 || a.Data != nil {
+		t.Errorf("attachment = %+v", a)
+	}
+}
+
+func TestParseRaw(t *testing.T) {
+	raw := strings.Join([]string{
+		"From: Ann <ann@example.com>",
+		"Subject: =?UTF-8?Q?R=C3=A9sum=C3=A9?=",
+		"MIME-Version: 1.0",
+		`Content-Type: multipart/mixed; boundary="outer"`,
+		"",
+		"--outer",
+		`Content-Type: multipart/alternative; boundary="inner"`,
+		"",
+		"--inner",
+		"Content-Type: text/plain; charset=iso-8859-1",
+		"Content-Transfer-Encoding: quoted-printable",
+		"",
+		"Caf=E9 at https://x.com/?c=3DFF0000 soon=",
+		"ish",
+		"--inner",
+		"Content-Type: text/html; charset=utf-8",
+		"Content-Transfer-Encoding: base64",
+		"",
+		"PHA+Q2Fmw6k8L3A+",
+		"--inner--",
+		"--outer",
+		"Content-Type: message/rfc822",
+		"",
+		"From: Bob <bob@example.com>",
+		"Subject: Numbers",
+		"Content-Type: text/plain",
+		"",
+		"Q3 figures attached.",
+		"--outer",
+		`Content-Type: text/csv; name="q3.csv"`,
+		"Content-Disposition: attachment; filename=\"q3.csv\"",
+		"Content-Transfer-Encoding: base64",
+		"",
+		"YSxiCjEsMgo=",
+		"--outer--",
+		"",
+	}, "\r\n")
+	m, err := ParseRaw(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Café at https://x.com/?c=FF0000 soonish\n\n" +
+		"---------- Forwarded message ----------\nFrom: Bob <bob@example.com>\nSubject: Numbers\n\nQ3 figures attached."
+	if m.Text != want {
+		t.Errorf("Text = %q\nwant   %q", m.Text, want)
+	}
+	if m.HTML != "<p>Café</p>" {
+		t.Errorf("HTML = %q", m.HTML)
+	}
+	if len(m.Attachments) != 1 || m.Attachments[0].Filename != "q3.csv" || string(m.Attachments[0].Data) != "a,b\n1,2\n" {
+		t.Errorf("attachments = %+v", m.Attachments)
+	}
+}
+
+func TestHTMLOnlyBody(t *testing.T) {
+	m := FromGmail(&gmailPartHTML)
+	if want := "Hello\n\n- one\n- two"; m.Text != want {
+		t.Errorf("Text = %q, want %q", m.Text, want)
+	}
+}
+
+var gmailPartHTML = gmailText("", "text/html", "", "<html><head><style>p{}</style></head><body><p>Hello</p><ul><li>one</li><li>two</li></ul></body></html>")
+
+func TestToUTF8(t *testing.T) {
+	tests := []struct {
+		data      []byte
+		label     string
+		mediaType string
+		want      string
+	}{
+		{[]byte("plain"), "", "text/plain", "plain"},
+		{[]byte("caf\xe9"), "iso-8859-1", "text/plain", "café"},
+		{[]byte("caf\xe9"), "", "text/plain", "café"},
+		{[]byte("\x93quoted\x94"), "us-ascii", "text/plain", "“quoted”"},
+		{[]byte("caf\xc3\xa9"), "x-unknown", "text/plain", "café"},
+		{[]byte(`<meta charset="iso-8859-1"><p>caf` + "\xe9"), "", "text/html", `<meta charset="iso-8859-1"><p>café`},
+	}
+	for _, tt := range tests {
+		if got := ToUTF8(tt.data, tt.label, tt.mediaType); got != tt.want {
+			t.Errorf("ToUTF8(%q, %q) = %q, want %q", tt.data, tt.label, got, tt.want)
+		}
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	if got := DecodeHeader("=?ISO-8859-1?Q?Andr=E9?= Pirard"); got != "André Pirard" {
+		t.Errorf("DecodeHeader = %q", got)
+	}
+	if got := DecodeHeader("=?bogus?Q?x?="); got != "=?bogus?Q?x?=" {
+		t.Errorf("undecodable header = %q", got)
+	}
+	got := AddressList(`"Smith, Sara" <sara@example.com>, bob@example.com`)
+	if strings.Join(got, "|") != "Smith, Sara <sara@example.com>|bob@example.com" {
+		t.Errorf("AddressList = %q", got)
+	}
+	if got := AddressList("not an address, other"); strings.Join(got, "|") != "not an address|other" {
+		t.Errorf("AddressList fallback = %q", got)
+	}
+}
@@ -0,0 +1,240 @@
+// Package mailsend composes RFC 5322 messages and sends them through the
+// user's Gmail account, threading replies and recording what was sent.
+package mailsend
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"aiagentapi/internal/mailparse"
+)
+
+// Message is an outgoing email.
+type Message struct {
+	From        *mail.Address
+	To, Cc, Bcc []*mail.Address
+	Subject     string
+	Text, HTML  string
+	Attachments []Attachment
+	// InReplyTo and References thread a reply; both hold Message-IDs with
+	// their angle brackets.
+	InReplyTo  string
+	References []string
+	// Date and MessageID default to now and a random id on the From domain.
+	Date      time.Time
+	MessageID string
+}
+
+// Attachment is a file sent with a message.
+type Attachment struct {
+	Filename string
+	MimeType string
+	Data     []byte
+}
+
+// ErrNoRecipients is returned when a message has no To, Cc or Bcc address.
+var ErrNoRecipients = errors.New("mailsend: no recipients")
+
+// ParseAddresses parses a comma-separated address list, as typed by a user or
+// a model: "Alice <alice@example.com>, bob@example.com".
+func ParseAddresses(list string) ([]*mail.Address, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	out, err := mail.ParseAddressList(list)
+	if err != nil {
+		return nil, fmt.Errorf("mailsend: bad address list %q: %w", list, err)
+	}
+	return out, nil
+}
+
+// Bytes renders the message. The body is text/plain, or multipart/alternative
+// when there is HTML, wrapped in multipart/mixed when there are attachments.
+// Bcc is kept in the header: Gmail strips it before delivery but keeps it on
+// the sender's copy.
+func (m *Message) Bytes() ([]byte, error) {
+	if len(m.To)+len(m.Cc)+len(m.Bcc) == 0 {
+		return nil, ErrNoRecipients
+	}
+	var b bytes.Buffer
+	header := func(k, v string) {
+		if v != "" {
+			fmt.Fprintf(&b, "%s: %s\r\n", k, v)
+		}
+	}
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	id := m.MessageID
+	if id == "" {
+		id = newMessageID(m.From)
+	}
+	if m.From != nil {
+		header("From", m.From.String())
+	}
+	header("To", addressList(m.To))
+	header("Cc", addressList(m.Cc))
+	header("Bcc", addressList(m.Bcc))
+	header("Subject", EncodeHeader(m.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("Message-ID", id)
+	header("In-Reply-To", m.InReplyTo)
+	header("References", strings.Join(m.References, "\r\n "))
+	header("MIME-Version", "1.0")
+
+	if len(m.Attachments) == 0 {
+		if err := m.writeBody(&b, header); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	}
+	mixed := multipart.NewWriter(&b)
+	header("Content-Type", "multipart/mixed; boundary="+mixed.Boundary())
+	b.WriteString("\r\n")
+	var body bytes.Buffer
+	bodyHeader := textproto.MIMEHeader{}
+	if err := m.writeBody(&body, func(k, v string) { bodyHeader.Set(k, v) }); err != nil {
+		return nil, err
+	}
+	w, err := mixed.CreatePart(bodyHeader)
+	if err != nil {
+		return nil, err
+	}
+	// writeBody ends the header block with a blank line the part header
+	// already provides.
+	w.Write(bytes.TrimPrefix(body.Bytes(), []byte("\r\n")))
+	for _, a := range m.Attachments {
+		if err := writeAttachment(mixed, a); err != nil {
+			return nil, err
+		}
+	}
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// writeBody writes the content headers through header, then a blank line and
+// the text or text+HTML body. HTML-only messages get a text part converted
+// from the HTML.
+func (m *Message) writeBody(w *bytes.Buffer, header func(k, v string)) error {
+	text := m.Text
+	if text == "" && m.HTML != "" {
+		text = mailparse.HTMLToText(m.HTML)
+	}
+	if m.HTML == "" {
+		header("Content-Type", `text/plain; charset="UTF-8"`)
+		header("Content-Transfer-Encoding", "quoted-printable")
+		w.WriteString("\r\n")
+		return writeQP(w, text)
+	}
+	alt := multipart.NewWriter(w)
+	header("Content-Type", "multipart/alternative; boundary="+alt.Boundary())
+	w.WriteString("\r\n")
+	for _, p := range []struct{ typ, body string }{{"text/plain", text}, {"text/html", m.HTML}} {
+		pw, err := alt.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.typ + `; charset="UTF-8"`},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return err
+		}
+		if err := writeQP(pw, p.body); err != nil {
+			return err
+		}
+	}
+	return alt.Close()
+}
+
+func writeQP(w io.Writer, s string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(s)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func writeAttachment(w *multipart.Writer, a Attachment) error {
+	typ := a.MimeType
+	if typ == "" {
+		typ = mime.TypeByExtension(extension(a.Filename))
+	}
+	if typ == "" {
+		typ = "application/octet-stream"
+	}
+	name := a.Filename
+	if name == "" {
+		name = "attachment"
+	}
+	ct := mime.FormatMediaType(typ, map[string]string{"name": name})
+	cd := mime.FormatMediaType("attachment", map[string]string{"filename": name})
+	if ct == "" || cd == "" {
+		return fmt.Errorf("mailsend: bad attachment type %q", typ)
+	}
+	pw, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {ct},
+		"Content-Disposition":       {cd},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return err
+	}
+	// Wrap at 76 characters as RFC 2045 requires.
+	enc := base64.StdEncoding.EncodeToString(a.Data)
+	for len(enc) > 76 {
+		io.WriteString(pw, enc[:76]+"\r\n")
+		enc = enc[76:]
+	}
+	_, err = io.WriteString(pw, enc+"\r\n")
+	return err
+}
+
+func extension(name string) string {
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		return name[i:]
+	}
+	return ""
+}
+
+// EncodeHeader encodes a header value as RFC 2047 words when it isn't plain
+// ASCII, folding between words so no line grows past the 78-character limit.
+func EncodeHeader(s string) string {
+	return strings.ReplaceAll(mime.QEncoding.Encode("utf-8", s), "?= =?", "?=\r\n =?")
+}
+
+func addressList(list []*mail.Address) string {
+	parts := make([]string, len(list))
+	for i, a := range list {
+		parts[i] = a.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+func newMessageID(from *mail.Address) string {
+	var r [12]byte
+	rand.Read(r[:])
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(r[:]), domain(from))
+}
+
+// domain is the domain of the From address, for Message-IDs.
+func domain(from *mail.Address) string {
+	if from != nil {
+		if i := strings.LastIndexByte(from.Address, '@'); i >= 0 {
+			return from.Address[i+1:]
+		}
+	}
+	return "localhost"
+}
@@ -0,0 +1,172 @@
+package mailsend
+
+import (
+	"bytes"
+	"context"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"aiagentapi/internal/google/googletest"
+	"aiagentapi/internal/mailparse"
+)
+
+func mustAddresses(t *testing.T, list string) []*mail.Address {
+	t.Helper()
+	a, err := ParseAddresses(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestBytes(t *testing.T) {
+	m := &Message{
+		From:        &mail.Address{Name: "Advisor", Address: "advisor@example.com"},
+		To:          mustAddresses(t, "Zoë Müller <zoe@example.com>, bob@example.com"),
+		Cc:          mustAddresses(t, "carol@example.com"),
+		Bcc:         mustAddresses(t, "audit@example.com"),
+		Subject:     "Rückblick zum Portfolio – " + strings.Repeat("Quartal ", 8),
+		Text:        "Hello,\nsee attached.",
+		HTML:        "<p>Hello,<br>see <b>attached</b>.</p>",
+		Attachments: []Attachment{{Filename: "report.pdf", Data: bytes.Repeat([]byte("%PDF"), 40)}},
+	}
+	raw, err := m.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(raw), "\r\n") {
+		if len(line) > 998 {
+			t.Fatalf("line longer than 998 characters: %.40q", line)
+		}
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mailparse.DecodeHeader(parsed.Header.Get("Subject")); got != m.Subject {
+		t.Errorf("subject = %q", got)
+	}
+	to, _ := parsed.Header.AddressList("To")
+	if len(to) != 2 || to[0].Name != "Zoë Müller" {
+		t.Errorf("to = %v", to)
+	}
+	for _, k := range []string{"Cc", "Bcc", "Message-ID", "Date"} {
+		if parsed.Header.Get(k) == "" {
+			t.Errorf("missing %s header", k)
+		}
+	}
+
+	body, err := mailparse.ParseRaw(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(body.Text, "see attached.") || !strings.Contains(body.HTML, "<b>attached</b>") {
+		t.Errorf("bodies = %q / %q", body.Text, body.HTML)
+	}
+	if len(body.Attachments) != 1 || body.Attachments[0].MimeType != "application/pdf" || !bytes.Equal(body.Attachments[0].Data, m.Attachments[0].Data) {
+		t.Errorf("attachments = %+v", body.Attachments)
+	}
+
+	if _, err := (&Message{Subject: "nobody"}).Bytes(); err != ErrNoRecipients {
+		t.Errorf("no recipients: err = %v", err)
+	}
+}
+
+func TestComposeReply(t *testing.T) {
+	srv := googletest.New(t)
+	g := srv.Config().NewClient(googletest.RefreshToken)
+	ctx := context.Background()
+	first := srv.AddMail(googletest.Mail{
+		From:    "Alice <alice@example.com>",
+		Subject: "Re: Lunch?",
+		Headers: map[string]string{"Message-ID": "<2@example.com>", "References": "<1@example.com>"},
+	})
+	from := &mail.Address{Address: googletest.UserEmail}
+
+	msg, err := Compose(ctx, g, from, Email{Body: "Tuesday works.", ThreadID: first.ThreadID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "Re: Lunch?" || msg.InReplyTo != "<2@example.com>" {
+		t.Errorf("subject %q, in-reply-to %q", msg.Subject, msg.InReplyTo)
+	}
+	if got := strings.Join(msg.References, " "); got != "<1@example.com> <2@example.com>" {
+		t.Errorf("references = %q", got)
+	}
+	if len(msg.To) != 1 || msg.To[0].Address != "alice@example.com" {
+		t.Errorf("to = %v", msg.To)
+	}
+
+	raw, err := msg.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent, err := g.SendMessage(ctx, raw, first.ThreadID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent.ThreadID != first.ThreadID {
+		t.Errorf("reply filed in thread %s, want %s", sent.ThreadID, first.ThreadID)
+	}
+
+	// A follow-up to our own reply goes to the same recipients.
+	msg, err = Compose(ctx, g, from, Email{Body: "Following up.", ThreadID: first.ThreadID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.To) != 1 || msg.To[0].Address != "alice@example.com" || len(msg.References) != 3 {
+		t.Errorf("follow-up to %v, references %v", msg.To, msg.References)
+	}
+
+	if _, err := Compose(ctx, g, from, Email{To: "not an address", Body: "x"}); err == nil {
+		t.Error("bad address accepted")
+	}
+}
+
+func TestReplySubject(t *testing.T) {
+	for in, want := range map[string]string{
+		"Lunch":          "Re: Lunch",
+		"RE: Re: Lunch":  "Re: Lunch",
+		"Fwd: Statement": "Re: Fwd: Statement",
+	} {
+		if got := ReplySubject(in); got != want {
+			t.Errorf("ReplySubject(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSendWithKey(t *testing.T) {
+	srv := googletest.New(t)
+	g := srv.Config().NewClient(googletest.RefreshToken)
+	ctx := context.Background()
+	from := &mail.Address{Address: googletest.UserEmail}
+	e := Email{To: "alice@example.com", Subject: "Times", Body: "Would Tuesday work?", Key: NewKey()}
+
+	first, err := send(ctx, g, from, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := send(ctx, g, from, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != first.ID || again.ThreadID != first.ThreadID {
+		t.Errorf("retry returned %s/%s, want %s/%s", again.ID, again.ThreadID, first.ID, first.ThreadID)
+	}
+	if n := len(srv.Sent()); n != 1 {
+		t.Errorf("%d messages sent, want 1", n)
+	}
+	if id := srv.Sent()[0].Payload.Header("Message-ID"); !strings.HasPrefix(id, "<"+e.Key+"@") {
+		t.Errorf("Message-ID = %q", id)
+	}
+
+	e.Key = ""
+	if _, err := send(ctx, g, from, e); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(srv.Sent()); n != 2 {
+		t.Errorf("%d messages sent without a key, want 2", n)
+	}
+}
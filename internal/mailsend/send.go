@@ -0,0 +1,222 @@
+package mailsend
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"aiagentapi/internal/google"
+	"aiagentapi/internal/mailparse"
+	"aiagentapi/internal/sync"
+)
+
+// Email is a send request, the payload of a send_email task. Address fields
+// are comma-separated lists. With a ThreadID the message is sent as a reply
+// to the latest message of that Gmail thread: the subject and recipients
+// default to the reply's, and In-Reply-To and References are set.
+type Email struct {
+	To, Cc, Bcc string
+	Subject     string
+	// Body is the plain text body; HTML, when set, is sent as an alternative.
+	Body        string
+	HTML        string
+	ThreadID    string
+	Attachments []Attachment
+	// Key, when set, makes sending idempotent: a message already sent with
+	// that key is returned instead of being sent again. Send records keyed
+	// messages in sent_email as soon as Gmail accepts them; one sent but not
+	// recorded (the process stopped in between) is found by its Message-ID,
+	// whose local part is the key. That relies on Gmail keeping the
+	// Message-ID of messages sent through messages.send, as it does. See
+	// NewKey.
+	Key string
+}
+
+// NewKey returns a random Email.Key.
+func NewKey() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Result identifies a sent message; it is stored as the send_email task
+// result.
+type Result struct {
+	GmailMessageID string `json:"gmail_message_id"`
+	ThreadID       string `json:"thread_id"`
+	// EmailID is the email row of the sent message, when it could be stored.
+	EmailID int64 `json:"email_id,omitempty"`
+}
+
+// Send sends e from the user's Gmail account and stores the sent message in
+// the email table. Once Gmail has accepted the message Send doesn't fail:
+// a message that can't be stored now is picked up by the next sync.
+func Send(ctx context.Context, db *sql.DB, cfg google.Config, userID string, e Email) (*Result, error) {
+	g, err := cfg.ForUser(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+	var from string
+	if err := db.QueryRowContext(ctx, `SELECT email FROM app_user WHERE id=$1`, userID).Scan(&from); err != nil {
+		return nil, fmt.Errorf("load sender: %w", err)
+	}
+	sent, err := sentBefore(ctx, db, userID, e.Key)
+	if err != nil {
+		return nil, err
+	}
+	if sent == nil {
+		if sent, err = send(ctx, g, &mail.Address{Address: from}, e); err != nil {
+			return nil, err
+		}
+		recordSent(ctx, db, userID, e.Key, sent)
+	}
+	res := &Result{GmailMessageID: sent.ID, ThreadID: sent.ThreadID}
+
+	full, err := g.GetMessage(ctx, sent.ID, "full")
+	if err != nil {
+		log.Printf("[mail] fetch sent message %s: %v", sent.ID, err)
+		return res, nil
+	}
+	if res.EmailID, err = sync.StoreMessage(ctx, db, userID, full); err != nil {
+		log.Printf("[mail] store sent message %s: %v", sent.ID, err)
+	}
+	return res, nil
+}
+
+// sentBefore returns the message an earlier attempt recorded for key, or nil.
+func sentBefore(ctx context.Context, db *sql.DB, userID, key string) (*google.Message, error) {
+	if key == "" {
+		return nil, nil
+	}
+	var (
+		m      google.Message
+		thread sql.NullString
+	)
+	err := db.QueryRowContext(ctx, `
+SELECT gmail_message_id, thread_id FROM sent_email WHERE user_id=$1 AND send_key=$2`, userID, key).Scan(&m.ID, &thread)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("look up sent message: %w", err)
+	}
+	m.ThreadID = thread.String
+	log.Printf("[mail] key %s was already sent as %s", key, m.ID)
+	return &m, nil
+}
+
+// recordSent notes that the message for key was sent. db is not the
+// worker's claim transaction, so the record is kept even if the task then
+// fails to complete. Failing to record it is logged: the Message-ID lookup
+// in send still finds the message.
+func recordSent(ctx context.Context, db *sql.DB, userID, key string, m *google.Message) {
+	if key == "" {
+		return
+	}
+	if _, err := db.ExecContext(ctx, `
+INSERT INTO sent_email (user_id, send_key, gmail_message_id, thread_id) VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id, send_key) DO NOTHING`, userID, key, m.ID, m.ThreadID); err != nil {
+		log.Printf("[mail] record sent message %s: %v", m.ID, err)
+	}
+}
+
+// send composes and sends e, or finds the copy sent by an earlier attempt by
+// its Message-ID when e has a Key.
+func send(ctx context.Context, g *google.Client, from *mail.Address, e Email) (*google.Message, error) {
+	msg, err := Compose(ctx, g, from, e)
+	if err != nil {
+		return nil, err
+	}
+	if e.Key != "" {
+		msg.MessageID = "<" + e.Key + "@" + domain(from) + ">"
+		list, err := g.ListMessages(ctx, "rfc822msgid:"+msg.MessageID, "", 1)
+		if err != nil {
+			return nil, fmt.Errorf("look for sent message: %w", err)
+		}
+		if len(list.Messages) > 0 {
+			log.Printf("[mail] %s was already sent as %s", msg.MessageID, list.Messages[0].ID)
+			return &list.Messages[0], nil
+		}
+	}
+	raw, err := msg.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	sent, err := g.SendMessage(ctx, raw, e.ThreadID)
+	if err != nil {
+		return nil, fmt.Errorf("send message: %w", err)
+	}
+	return sent, nil
+}
+
+// Compose builds the message for e, looking up the thread it replies to.
+func Compose(ctx context.Context, g *google.Client, from *mail.Address, e Email) (*Message, error) {
+	msg := &Message{From: from, Subject: e.Subject, Text: e.Body, HTML: e.HTML, Attachments: e.Attachments}
+	var err error
+	if msg.To, err = ParseAddresses(e.To); err != nil {
+		return nil, err
+	}
+	if msg.Cc, err = ParseAddresses(e.Cc); err != nil {
+		return nil, err
+	}
+	if msg.Bcc, err = ParseAddresses(e.Bcc); err != nil {
+		return nil, err
+	}
+	if e.ThreadID == "" {
+		return msg, nil
+	}
+
+	t, err := g.GetThread(ctx, e.ThreadID, "metadata")
+	if err != nil {
+		return nil, fmt.Errorf("load thread %s: %w", e.ThreadID, err)
+	}
+	parent := lastMessage(t)
+	if parent == nil {
+		return msg, nil
+	}
+	h := parent.Payload
+	if id := strings.TrimSpace(h.Header("Message-ID")); id != "" {
+		msg.InReplyTo = id
+		msg.References = append(strings.Fields(h.Header("References")), id)
+	}
+	if msg.Subject == "" {
+		msg.Subject = ReplySubject(mailparse.DecodeHeader(h.Header("Subject")))
+	}
+	if len(msg.To)+len(msg.Cc)+len(msg.Bcc) == 0 {
+		// Replying to our own message goes to its recipients again.
+		list := h.Header("Reply-To")
+		if list == "" {
+			list = h.Header("From")
+		}
+		if parent.HasLabel("SENT") {
+			list = h.Header("To")
+		}
+		if msg.To, err = ParseAddresses(list); err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
+
+// lastMessage returns the newest message of a thread that isn't a draft.
+func lastMessage(t *google.Thread) *google.Message {
+	for i := len(t.Messages) - 1; i >= 0; i-- {
+		if m := &t.Messages[i]; !m.HasLabel("DRAFT") && m.Payload != nil {
+			return m
+		}
+	}
+	return nil
+}
+
+var replyPrefix = regexp.MustCompile(`(?i)^\s*((re|aw)\s*:\s*)+`)
+
+// ReplySubject returns "Re: subject", without stacking prefixes.
+func ReplySubject(subject string) string {
+	return "Re: " + replyPrefix.ReplaceAllString(subject, "")
+}
@@ -0,0 +1,201 @@
+package retrieval
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Chunk is a searchable slice of an email body. Start and End are character
+// (not byte) offsets into the original body, so they line up with Postgres
+// substr(); Text is the chunk content with quoted lines removed.
+type Chunk struct {
+	Seq   int
+	Start int
+	End   int
+	Text  string
+}
+
+type ChunkOptions struct {
+	// Size is the target chunk length in bytes.
+	Size int
+	// Overlap is how much trailing text of a chunk is repeated at the start of
+	// the next one so a sentence is never only seen cut in half.
+	Overlap int
+}
+
+var DefaultChunkOptions = ChunkOptions{Size: 1200, Overlap: 200}
+
+var (
+	// Lines that start quoted reply history; everything after them is dropped.
+	replyHeader = regexp.MustCompile(`(?i)^(on .+wrote:\s*$|-{2,}\s*original message\s*-{2,}|_{10,}\s*$|from:\s.+@.+)`)
+	// Lines that introduce a forwarded message. Its content is kept, along with
+	// the header block (From:, Subject: ...) that follows the marker.
+	forwardMarker = regexp.MustCompile(`(?i)^(-{2,}\s*forwarded message\s*-{2,}|begin forwarded message:)\s*$`)
+	// Lines that start a signature.
+	signature = regexp.MustCompile(`(?i)^(--\s*$|sent from my \w+|get outlook for \w+)`)
+	// Sentence boundaries: terminal punctuation followed by whitespace.
+	sentenceEnd = regexp.MustCompile(`[.!?]["')\]]*\s+`)
+)
+
+// span is a byte range of the body; para marks the first span of a paragraph.
+type span struct {
+	start, end int
+	para       bool
+}
+
+// ChunkEmail strips quoted history and signatures from body and splits what
+// remains into overlapping chunks on paragraph, then sentence, boundaries.
+func ChunkEmail(body string, opt ChunkOptions) []Chunk {
+	if opt.Size <= 0 {
+		opt = DefaultChunkOptions
+	}
+	if opt.Overlap >= opt.Size {
+		opt.Overlap = opt.Size / 4
+	}
+
+	var units []span
+	for _, p := range paragraphs(body) {
+		units = append(units, splitLong(body, p, opt.Size)...)
+	}
+	if len(units) == 0 {
+		return nil
+	}
+
+	var chunks []Chunk
+	for i := 0; i < len(units); {
+		j, size := i, 0
+		for j < len(units) && (j == i || size+units[j].end-units[j].start <= opt.Size) {
+			size += units[j].end - units[j].start
+			j++
+		}
+		chunks = append(chunks, makeChunk(body, len(chunks), units[i:j]))
+		if j >= len(units) {
+			break
+		}
+		// Step back over trailing units that fit in the overlap, but always advance.
+		next, overlap := j, 0
+		for next-1 > i && overlap+units[next-1].end-units[next-1].start <= opt.Overlap {
+			next--
+			overlap += units[next].end - units[next].start
+		}
+		i = next
+	}
+	return chunks
+}
+
+func makeChunk(body string, seq int, units []span) Chunk {
+	var b strings.Builder
+	for i, u := range units {
+		if i > 0 {
+			if u.para {
+				b.WriteString("\n\n")
+			} else {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(strings.TrimSpace(body[u.start:u.end]))
+	}
+	start, end := units[0].start, units[len(units)-1].end
+	return Chunk{
+		Seq:   seq,
+		Start: utf8.RuneCountInString(body[:start]),
+		End:   utf8.RuneCountInString(body[:end]),
+		Text:  b.String(),
+	}
+}
+
+// paragraphs returns the blank-line separated blocks of the body's own
+// content, skipping ">" quoted lines and stopping at reply headers and
+// signatures. Forwarded messages count as content.
+func paragraphs(body string) []span {
+	var (
+		out []span
+		cur = span{-1, -1, true}
+		// fwd is set from a forward marker to the end of its header block.
+		fwd bool
+	)
+	flush := func() {
+		if cur.start >= 0 {
+			out = append(out, cur)
+		}
+		cur = span{-1, -1, true}
+	}
+	for pos := 0; pos < len(body); {
+		end := strings.IndexByte(body[pos:], '\n')
+		if end < 0 {
+			end = len(body)
+		} else {
+			end += pos
+		}
+		line := strings.TrimRight(body[pos:end], "\r")
+		trimmed := strings.TrimSpace(line)
+		if forwardMarker.MatchString(trimmed) {
+			fwd = true
+		} else if trimmed == "" {
+			fwd = false
+		}
+		switch {
+		case fwd:
+			// The forwarded From: line is not a reply header.
+			if cur.start < 0 {
+				cur.start = pos
+			}
+			cur.end = pos + len(line)
+		case replyHeader.MatchString(trimmed), signature.MatchString(line):
+			flush()
+			return out
+		case trimmed == "", strings.HasPrefix(trimmed, ">"):
+			flush()
+		default:
+			if cur.start < 0 {
+				cur.start = pos
+			}
+			cur.end = pos + len(line)
+		}
+		pos = end + 1
+	}
+	flush()
+	return out
+}
+
+// splitLong breaks a paragraph longer than size into sentences, and a
+// sentence longer than size at whitespace.
+func splitLong(body string, p span, size int) []span {
+	if p.end-p.start <= size {
+		return []span{p}
+	}
+	var out []span
+	text := body[p.start:p.end]
+	last := 0
+	for _, m := range sentenceEnd.FindAllStringIndex(text, -1) {
+		out = append(out, hardSplit(body, span{start: p.start + last, end: p.start + m[1]}, size)...)
+		last = m[1]
+	}
+	if last < len(text) {
+		out = append(out, hardSplit(body, span{start: p.start + last, end: p.end}, size)...)
+	}
+	if len(out) > 0 {
+		out[0].para = true
+	}
+	return out
+}
+
+func hardSplit(body string, s span, size int) []span {
+	var out []span
+	for s.end-s.start > size {
+		cut := s.start + size
+		if ws := strings.LastIndexAny(body[s.start:cut], " \t\n"); ws > 0 {
+			cut = s.start + ws
+		}
+		for cut < s.end && !utf8.RuneStart(body[cut]) {
+			cut++
+		}
+		out = append(out, span{start: s.start, end: cut})
+		s.start = cut
+	}
+	if strings.TrimSpace(body[s.start:s.end]) != "" {
+		out = append(out, s)
+	}
+	return out
+}
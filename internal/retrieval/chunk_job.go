@@ -0,0 +1,73 @@
+package retrieval
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// ChunkPending (re)chunks up to batch emails whose body has not been chunked
+// since it was last written (email.chunked_at IS NULL) and returns how many
+// emails were processed.
+func ChunkPending(ctx context.Context, db *sql.DB, batch int) (int, error) {
+	if batch <= 0 {
+		batch = 50
+	}
+	rows, err := db.QueryContext(ctx, `
+SELECT id, user_id, coalesce(nullif(body_text, ''), snippet, '')
+FROM email
+WHERE chunked_at IS NULL
+ORDER BY id DESC
+LIMIT $1`, batch)
+	if err != nil {
+		return 0, fmt.Errorf("select unchunked emails: %w", err)
+	}
+	type pending struct {
+		id     int64
+		userID sql.NullString
+		body   string
+	}
+	var todo []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.userID, &p.body); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		todo = append(todo, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for i, p := range todo {
+		if err := storeChunks(ctx, db, p.id, p.userID, ChunkEmail(p.body, DefaultChunkOptions)); err != nil {
+			return i, fmt.Errorf("chunk email %d: %w", p.id, err)
+		}
+	}
+	return len(todo), nil
+}
+
+func storeChunks(ctx context.Context, db *sql.DB, emailID int64, userID sql.NullString, chunks []Chunk) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM email_chunk WHERE email_id=$1`, emailID); err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO email_chunk (email_id, user_id, seq, start_offset, end_offset, content)
+VALUES ($1, $2, $3, $4, $5, $6)`, emailID, userID, c.Seq, c.Start, c.End, c.Text); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE email SET chunked_at=now() WHERE id=$1`, emailID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
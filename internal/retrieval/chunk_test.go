@@ -0,0 +1,108 @@
+package retrieval
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestChunkEmail(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		opt  ChunkOptions
+		want []string
+	}{
+		{
+			name: "empty",
+			body: "  \n\n",
+			want: nil,
+		},
+		{
+			name: "paragraphs in one chunk",
+			body: "Hi Ann,\n\nMy kid plays baseball\non Saturdays.\n\nThanks",
+			want: []string{"Hi Ann,\n\nMy kid plays baseball\non Saturdays.\n\nThanks"},
+		},
+		{
+			name: "quoted lines skipped",
+			body: "Sounds good.\n> earlier text\n> more\n\nSee you then.",
+			want: []string{"Sounds good.\n\nSee you then."},
+		},
+		{
+			name: "reply history dropped",
+			body: "Yes, sell AAPL.\r\n\r\nOn Mon, Greg <greg@example.com> wrote:\r\n> Should I sell?",
+			want: []string{"Yes, sell AAPL."},
+		},
+		{
+			name: "outlook history dropped",
+			body: "Done.\n\n-----Original Message-----\nFrom: Greg <greg@example.com>\nold text",
+			want: []string{"Done."},
+		},
+		{
+			name: "signature dropped",
+			body: "Call me.\n\n-- \nSara Smith\nAdvisor",
+			want: []string{"Call me."},
+		},
+		{
+			name: "forwarded message kept",
+			body: "FYI below.\n\n---------- Forwarded message ----------\nFrom: Bob <bob@example.com>\nSubject: Numbers\n\nQ3 figures attached.",
+			want: []string{"FYI below.\n\n---------- Forwarded message ----------\nFrom: Bob <bob@example.com>\nSubject: Numbers\n\nQ3 figures attached."},
+		},
+		{
+			name: "history inside a forward dropped",
+			body: "Begin forwarded message:\nFrom: Bob <bob@example.com>\n\nAgreed.\n\nOn Tue, Ann <ann@example.com> wrote:\n> Deal?",
+			want: []string{"Begin forwarded message:\nFrom: Bob <bob@example.com>\n\nAgreed."},
+		},
+		{
+			name: "paragraphs split with overlap",
+			body: "aaaa aaaa\n\nbbbb bbbb\n\ncccc cccc",
+			opt:  ChunkOptions{Size: 20, Overlap: 9},
+			want: []string{"aaaa aaaa\n\nbbbb bbbb", "bbbb bbbb\n\ncccc cccc"},
+		},
+		{
+			name: "long paragraph split on sentences",
+			body: "One two three. Four five six. Seven eight.",
+			opt:  ChunkOptions{Size: 16, Overlap: 1},
+			want: []string{"One two three.", "Four five six.", "Seven eight."},
+		},
+		{
+			name: "long sentence split at whitespace",
+			body: "alpha beta gamma delta",
+			opt:  ChunkOptions{Size: 12, Overlap: 1},
+			want: []string{"alpha beta", "gamma delta"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := ChunkEmail(tt.body, tt.opt)
+			var got []string
+			for i, c := range chunks {
+				got = append(got, c.Text)
+				if c.Seq != i {
+					t.Errorf("chunk %d has Seq %d", i, c.Seq)
+				}
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+				t.Errorf("chunks = %q\nwant     %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChunkEmailOffsets(t *testing.T) {
+	// Offsets count characters, so they line up with Postgres substr().
+	body := "Café déjà vu.\n\nÜber straße.\n\n> quoted"
+	chunks := ChunkEmail(body, ChunkOptions{Size: 16, Overlap: 1})
+	if len(chunks) != 2 {
+		t.Fatalf("chunks = %+v", chunks)
+	}
+	runes := []rune(body)
+	for _, c := range chunks {
+		if got := string(runes[c.Start:c.End]); got != c.Text {
+			t.Errorf("runes[%d:%d] = %q, want %q", c.Start, c.End, got, c.Text)
+		}
+	}
+	if n := utf8.RuneCountInString(body[:strings.Index(body, "Über")]); chunks[1].Start != n {
+		t.Errorf("second chunk starts at %d, want %d", chunks[1].Start, n)
+	}
+}
@@ -0,0 +1,145 @@
+package retrieval
+
+import "strings"
+
+// Every query returns (kind, snippet, source, thread_id, at) rows, best first.
+
+// lexicalSQL ranks email, attachment, note, contact and meeting rows against
+// one query. $2 is the raw question, parsed with websearch_to_tsquery; unless
+// $3 is set (the question used search operators) its terms are OR-ed so a
+// question matches documents containing only some of its words, with ts_rank
+// favouring those that contain more. Headlines are only computed for the rows that
+// survive each per-source LIMIT; an email's snippet comes from its best
+// matching chunk, so quoted history doesn't crowd out the match.
+const lexicalSQL = `
+WITH q AS (
+  SELECT
+    CASE WHEN $3 THEN websearch_to_tsquery('english', $2)
+         ELSE replace(websearch_to_tsquery('english', $2)::text, ' & ', ' | ')::tsquery END AS en,
+    CASE WHEN $3 THEN websearch_to_tsquery('simple', $2)
+         ELSE replace(websearch_to_tsquery('simple', $2)::text, ' & ', ' | ')::tsquery END AS si
+)
+SELECT kind, snippet, source, thread_id, at FROM (
+  SELECT 'email' AS kind,
+         coalesce(e.subject, '') || ' — ' ||
+           ts_headline('english', coalesce(ch.content, left(coalesce(e.body_text, e.snippet, ''), 20000)), q.en, $5) AS snippet,
+         'gmail:' || coalesce(e.gmail_message_id, e.id::text) AS source,
+         e.thread_id, e.sent_at AS at, e.rank
+  FROM (SELECT *, ts_rank(search_tsv, (SELECT en FROM q)) AS rank
+          FROM email
+         WHERE user_id = $1 AND search_tsv @@ (SELECT en FROM q)
+         ORDER BY rank DESC, sent_at DESC NULLS LAST
+         LIMIT $4) e
+  LEFT JOIN LATERAL (
+         SELECT c.content FROM email_chunk c
+          WHERE c.email_id = e.id AND c.search_tsv @@ (SELECT en FROM q)
+          ORDER BY ts_rank(c.search_tsv, (SELECT en FROM q)) DESC, c.seq
+          LIMIT 1) ch ON true, q
+  UNION ALL
+  SELECT 'attachment',
+         coalesce(a.filename, 'attachment') || ' — ' ||
+           ts_headline('english', left(coalesce(a.extracted_text, ''), 20000), q.en, $5),
+         'attachment:' || a.id, e.thread_id, e.sent_at, a.rank
+  FROM (SELECT *, ts_rank(search_tsv, (SELECT en FROM q)) AS rank
+          FROM email_attachment
+         WHERE user_id = $1 AND search_tsv @@ (SELECT en FROM q)
+         ORDER BY rank DESC
+         LIMIT $4) a
+  JOIN email e ON e.id = a.email_id, q
+  UNION ALL
+  SELECT 'note',
+         ts_headline('english', left(coalesce(n.body, ''), 20000), q.en, $5),
+         'note:' || n.id, NULL, n.created_at, n.rank
+  FROM (SELECT *, ts_rank(search_tsv, (SELECT en FROM q)) AS rank
+          FROM note
+         WHERE user_id = $1 AND search_tsv @@ (SELECT en FROM q)
+         ORDER BY rank DESC, created_at DESC
+         LIMIT $4) n, q
+  UNION ALL
+  SELECT 'contact',
+         ts_headline('simple', trim(coalesce(c.first_name, '') || ' ' || coalesce(c.last_name, '')) || ' — ' || coalesce(c.email, ''), q.si, $5),
+         'contact:' || c.id, NULL, NULL::timestamptz, c.rank
+  FROM (SELECT *, ts_rank(search_tsv, (SELECT si FROM q)) AS rank
+          FROM contact
+         WHERE user_id = $1 AND search_tsv @@ (SELECT si FROM q)
+         ORDER BY rank DESC
+         LIMIT $4) c, q
+  UNION ALL
+  SELECT 'meeting',
+         ts_headline('english', coalesce(m.title, ''), q.en, $5),
+         'meeting:' || m.id, NULL, m.start_time, m.rank
+  FROM (SELECT *, ts_rank(search_tsv, (SELECT en FROM q)) AS rank
+          FROM meeting
+         WHERE user_id = $1 AND search_tsv @@ (SELECT en FROM q)
+         ORDER BY rank DESC, start_time DESC NULLS LAST
+         LIMIT $4) m, q
+) hits
+ORDER BY rank DESC, at DESC NULLS LAST
+LIMIT $4`
+
+const headlineOptions = `StartSel=**, StopSel=**, MaxWords=45, MinWords=15, MaxFragments=2, FragmentDelimiter=" … "`
+
+// semanticSQL finds the user's email chunks, notes, contacts and meetings
+// nearest to $2 by cosine distance and keeps those with similarity of at
+// least $4. When a candidate list is read from an HNSW index, the user filter
+// applies to the hnsw.ef_search nearest rows of all users, so a user with
+// few rows in a large table can get fewer than $3 * 10 candidates or none;
+// Retriever.semantic raises ef_search for the query to make that less
+// likely. An email's snippet is the matching chunk; contact and meeting
+// snippets match the keyword ones.
+const semanticSQL = `
+SELECT kind, snippet, source, thread_id, at FROM (
+  SELECT 'email' AS kind,
+         coalesce(e.subject, '') || ' — ' || x.content AS snippet,
+         'gmail:' || coalesce(e.gmail_message_id, e.id::text) AS source,
+         e.thread_id, e.sent_at AS at, x.similarity
+  FROM (SELECT email_id, content, 1 - (embedding <=> $2::vector) AS similarity
+          FROM email_chunk
+         WHERE user_id = $1 AND embedding IS NOT NULL
+         ORDER BY embedding <=> $2::vector
+         LIMIT $3 * 10) x
+  JOIN email e ON e.id = x.email_id
+  UNION ALL
+  SELECT 'note', left(x.body, 300), 'note:' || x.id, NULL, x.created_at, x.similarity
+  FROM (SELECT n.id, n.body, n.created_at, 1 - (ne.embedding <=> $2::vector) AS similarity
+          FROM note_embedding ne
+          JOIN note n ON n.id = ne.note_id
+         WHERE n.user_id = $1
+         ORDER BY ne.embedding <=> $2::vector
+         LIMIT $3 * 10) x
+  UNION ALL
+  SELECT 'contact',
+         trim(coalesce(x.first_name, '') || ' ' || coalesce(x.last_name, '')) || ' — ' || coalesce(x.email, ''),
+         'contact:' || x.id, NULL, NULL::timestamptz, x.similarity
+  FROM (SELECT c.id, c.first_name, c.last_name, c.email, 1 - (ce.embedding <=> $2::vector) AS similarity
+          FROM contact_embedding ce
+          JOIN contact c ON c.id = ce.contact_id
+         WHERE c.user_id = $1
+         ORDER BY ce.embedding <=> $2::vector
+         LIMIT $3 * 10) x
+  UNION ALL
+  SELECT 'meeting', coalesce(x.title, ''), 'meeting:' || x.id, NULL, x.start_time, x.similarity
+  FROM (SELECT m.id, m.title, m.start_time, 1 - (me.embedding <=> $2::vector) AS similarity
+          FROM meeting_embedding me
+          JOIN meeting m ON m.id = me.meeting_id
+         WHERE m.user_id = $1
+         ORDER BY me.embedding <=> $2::vector
+         LIMIT $3 * 10) x
+) hits
+WHERE similarity >= $4
+ORDER BY similarity DESC
+LIMIT $3`
+
+// hasSearchOperators reports whether the query uses websearch syntax (quoted
+// phrases, OR, or -exclusions), in which case it is taken literally.
+func hasSearchOperators(q string) bool {
+	if strings.Contains(q, `"`) {
+		return true
+	}
+	for _, f := range strings.Fields(q) {
+		if f == "OR" || f == "or" || (len(f) > 1 && f[0] == '-') {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,224 @@
+// Package retrieval finds context for the agent by fusing keyword and vector
+// search over the synced email, attachment, note, contact and meeting tables.
+package retrieval
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"aiagentapi/internal/embedding"
+)
+
+const (
+	// DefaultMinSimilarity is the cosine similarity below which semantic matches are dropped.
+	DefaultMinSimilarity = 0.35
+	// DefaultRRFK is the rank constant of reciprocal rank fusion.
+	DefaultRRFK = 60
+	// DefaultEFSearch is the HNSW candidate list size for semantic search.
+	DefaultEFSearch = 400
+	// maxEFSearch is the largest hnsw.ef_search pgvector accepts.
+	maxEFSearch = 1000
+)
+
+// Doc is one retrieved item. Source identifies the row: "gmail:<message id>",
+// "attachment:<id>", "note:<id>", "contact:<id>" or "meeting:<id>".
+type Doc struct {
+	Kind     string
+	Snippet  string
+	Source   string
+	ThreadID string
+	When     time.Time
+	Score    float64
+}
+
+type Retriever struct {
+	DB *sql.DB
+	// Embedder enables the semantic half of the search; without it only
+	// keyword search runs.
+	Embedder      embedding.Embedder
+	MinSimilarity float64
+	RRFK          float64
+	// EFSearch is how many nearest rows an HNSW index scan considers before
+	// the user filter applies; see semanticSQL.
+	EFSearch int
+}
+
+// Search runs keyword and semantic search in parallel, fuses the two rankings
+// with reciprocal rank fusion and keeps the best document per email thread.
+// A failing semantic search degrades to keyword results.
+func (r *Retriever) Search(ctx context.Context, userID, query string, limit int) ([]Doc, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, nil
+	}
+	if limit <= 0 {
+		limit = 6
+	}
+	// Over-fetch so fusion and thread de-duplication still leave limit docs.
+	candidates := limit * 3
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var (
+		wg                sync.WaitGroup
+		lexical, semantic []Doc
+		lexErr, semErr    error
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		lexical, lexErr = queryDocs(ctx, r.DB, lexicalSQL, userID, query, hasSearchOperators(query), candidates, headlineOptions)
+	}()
+	if r.Embedder != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semantic, semErr = r.semantic(ctx, userID, query, candidates)
+		}()
+	}
+	wg.Wait()
+
+	if lexErr != nil {
+		return nil, fmt.Errorf("keyword search: %w", lexErr)
+	}
+	if semErr != nil {
+		log.Printf("[retrieval] semantic search: %v", semErr)
+		semantic = nil
+	}
+
+	k := r.RRFK
+	if k <= 0 {
+		k = DefaultRRFK
+	}
+	return dedupeThreads(Fuse(k, lexical, semantic), limit), nil
+}
+
+func (r *Retriever) semantic(ctx context.Context, userID, query string, limit int) ([]Doc, error) {
+	vecs, err := r.Embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	minSim := r.MinSimilarity
+	if minSim == 0 {
+		minSim = DefaultMinSimilarity
+	}
+	// hnsw.ef_search only lasts for the transaction.
+	tx, err := r.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `SELECT set_config('hnsw.ef_search', $1, true)`, strconv.Itoa(r.efSearch(limit))); err != nil {
+		return nil, fmt.Errorf("set hnsw.ef_search: %w", err)
+	}
+	return queryDocs(ctx, tx, semanticSQL, userID, embedding.Literal(vecs[0]), limit, minSim)
+}
+
+// efSearch is the HNSW candidate list size for a search of limit documents:
+// at least the per-kind candidate limit of semanticSQL, within what pgvector
+// accepts.
+func (r *Retriever) efSearch(limit int) int {
+	ef := r.EFSearch
+	if ef <= 0 {
+		ef = DefaultEFSearch
+	}
+	return min(max(ef, limit*10), maxEFSearch)
+}
+
+// queryer is a *sql.DB or *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func queryDocs(ctx context.Context, db queryer, q string, args ...any) ([]Doc, error) {
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var docs []Doc
+	for rows.Next() {
+		var (
+			d      Doc
+			thread sql.NullString
+			when   sql.NullTime
+		)
+		if err := rows.Scan(&d.Kind, &d.Snippet, &d.Source, &thread, &when); err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(d.Snippet) == "" {
+			continue
+		}
+		d.ThreadID, d.When = thread.String, when.Time
+		docs = append(docs, d)
+	}
+	return docs, rows.Err()
+}
+
+// Fuse merges ranked lists with reciprocal rank fusion: each document scores
+// the sum of 1/(k+rank) over the lists it appears in. When a document appears
+// in several lists the copy from the earliest list is kept, so pass the list
+// with the best snippets first.
+func Fuse(k float64, lists ...[]Doc) []Doc {
+	var (
+		out   []Doc
+		index = map[string]int{}
+	)
+	for _, list := range lists {
+		// A list may hold several hits for one source (e.g. chunks of the
+		// same email); only its best rank counts.
+		rank, seen := 0, map[string]bool{}
+		for _, d := range list {
+			if seen[d.Source] {
+				continue
+			}
+			seen[d.Source] = true
+			rank++
+			score := 1 / (k + float64(rank))
+			if i, ok := index[d.Source]; ok {
+				out[i].Score += score
+				continue
+			}
+			d.Score = score
+			index[d.Source] = len(out)
+			out = append(out, d)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].When.After(out[j].When)
+	})
+	return out
+}
+
+// dedupeThreads keeps the highest ranked email (and attachment) of each
+// thread and at most limit docs.
+func dedupeThreads(docs []Doc, limit int) []Doc {
+	seen := map[string]bool{}
+	out := make([]Doc, 0, limit)
+	for _, d := range docs {
+		if len(out) >= limit {
+			break
+		}
+		if d.ThreadID != "" {
+			key := d.Kind + ":" + d.ThreadID
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		out = append(out, d)
+	}
+	return out
+}
@@ -0,0 +1,122 @@
+package retrieval
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sources(docs []Doc) string {
+	var s []string
+	for _, d := range docs {
+		s = append(s, d.Source)
+	}
+	return strings.Join(s, " ")
+}
+
+func TestFuse(t *testing.T) {
+	day := func(n int) time.Time { return time.Date(2025, 10, n, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		name  string
+		lists [][]Doc
+		want  string
+	}{
+		{
+			name:  "single list keeps its order",
+			lists: [][]Doc{{{Source: "a"}, {Source: "b"}, {Source: "c"}}},
+			want:  "a b c",
+		},
+		{
+			name: "found by both beats first in one",
+			lists: [][]Doc{
+				{{Source: "a"}, {Source: "b"}, {Source: "c"}},
+				{{Source: "d"}, {Source: "c"}},
+			},
+			want: "c a d b",
+		},
+		{
+			name: "repeated source counts once at its best rank",
+			lists: [][]Doc{
+				{{Source: "a"}, {Source: "b"}},
+				{{Source: "b"}, {Source: "b"}, {Source: "a"}},
+			},
+			want: "a b",
+		},
+		{
+			name: "ties go to the newer document",
+			lists: [][]Doc{
+				{{Source: "old", When: day(1)}},
+				{{Source: "new", When: day(2)}},
+			},
+			want: "new old",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sources(Fuse(60, tt.lists...)); got != tt.want {
+				t.Errorf("Fuse = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFuseScoresAndSnippets(t *testing.T) {
+	got := Fuse(60,
+		[]Doc{{Source: "a", Snippet: "keyword"}},
+		[]Doc{{Source: "b"}, {Source: "a", Snippet: "semantic"}},
+	)
+	if got[0].Source != "a" || got[0].Snippet != "keyword" {
+		t.Fatalf("top = %+v, want a with the first list's snippet", got[0])
+	}
+	if want := 1.0/61 + 1.0/62; math.Abs(got[0].Score-want) > 1e-12 {
+		t.Errorf("score = %v, want %v", got[0].Score, want)
+	}
+	if got[1].Score != 1.0/61 {
+		t.Errorf("b score = %v", got[1].Score)
+	}
+}
+
+func TestDedupeThreads(t *testing.T) {
+	docs := []Doc{
+		{Kind: "email", Source: "gmail:1", ThreadID: "t1"},
+		{Kind: "email", Source: "gmail:2", ThreadID: "t1"},
+		{Kind: "attachment", Source: "attachment:1", ThreadID: "t1"},
+		{Kind: "note", Source: "note:1"},
+		{Kind: "note", Source: "note:2"},
+		{Kind: "email", Source: "gmail:3", ThreadID: "t2"},
+		{Kind: "attachment", Source: "attachment:2", ThreadID: "t1"},
+	}
+	tests := []struct {
+		limit int
+		want  string
+	}{
+		{10, "gmail:1 attachment:1 note:1 note:2 gmail:3"},
+		{3, "gmail:1 attachment:1 note:1"},
+		{0, ""},
+	}
+	for _, tt := range tests {
+		if got := sources(dedupeThreads(docs, tt.limit)); got != tt.want {
+			t.Errorf("dedupeThreads(limit %d) = %q, want %q", tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestEFSearch(t *testing.T) {
+	tests := []struct {
+		configured, limit, want int
+	}{
+		{0, 18, DefaultEFSearch},
+		{0, 60, 600},
+		{100, 6, 100},
+		{100, 30, 300},
+		{5000, 6, 1000},
+		{0, 500, 1000},
+	}
+	for _, tt := range tests {
+		r := Retriever{EFSearch: tt.configured}
+		if got := r.efSearch(tt.limit); got != tt.want {
+			t.Errorf("EFSearch %d: efSearch(%d) = %d, want %d", tt.configured, tt.limit, got, tt.want)
+		}
+	}
+}
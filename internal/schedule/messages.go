@@ -0,0 +1,125 @@
+package schedule
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"aiagentapi/internal/contacts"
+)
+
+// The emails of the scheduling workflow are short plain text written as the
+// advisor.
+
+func contactAddress(name, email string) string {
+	return (&mail.Address{Name: name, Address: email}).String()
+}
+
+func greeting(p Proposal) string {
+	if first, _ := contacts.ParseName(p.Name, p.Email); first != "" {
+		return "Hi " + first + ","
+	}
+	return "Hi,"
+}
+
+// meetingPhrase describes the meeting: "a 30-minute meeting (Portfolio
+// review)".
+func meetingPhrase(p Proposal, d time.Duration) string {
+	s := "a meeting"
+	if d > 0 {
+		s = fmt.Sprintf("a %d-minute meeting", int(d/time.Minute))
+	}
+	if t := strings.TrimSpace(p.Title); t != "" {
+		s += " (" + t + ")"
+	}
+	return s
+}
+
+func formatSlot(s Slot, loc *time.Location) string {
+	start, end := s.Start.In(loc), s.End.In(loc)
+	return start.Format("Monday 2 January, 15:04") + "–" + end.Format("15:04")
+}
+
+// formatSlots numbers the slots from 1, one per line.
+func formatSlots(slots []Slot, loc *time.Location) string {
+	var b strings.Builder
+	for i, s := range slots {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, formatSlot(s, loc))
+	}
+	return b.String()
+}
+
+// zoneName names loc with the abbreviation in use for the slots, like
+// "America/New_York (EST)".
+func zoneName(loc *time.Location, slots []Slot) string {
+	name := loc.String()
+	if len(slots) == 0 {
+		return name
+	}
+	if abbr, _ := slots[0].Start.In(loc).Zone(); abbr != name && !strings.HasPrefix(abbr, "+") && !strings.HasPrefix(abbr, "-") {
+		return name + " (" + abbr + ")"
+	}
+	return name
+}
+
+func proposalText(p Proposal, slots []Slot, intro string, loc *time.Location) string {
+	var b strings.Builder
+	b.WriteString(greeting(p) + "\n\n")
+	if intro != "" {
+		b.WriteString(intro + "\n\n")
+	}
+	if m := strings.TrimSpace(p.Message); m != "" {
+		b.WriteString(m + "\n\n")
+	}
+	d := p.Duration
+	if len(slots) > 0 {
+		d = slots[0].End.Sub(slots[0].Start)
+	}
+	fmt.Fprintf(&b, "Would one of these times work for %s?\n\n", meetingPhrase(p, d))
+	b.WriteString(formatSlots(slots, loc))
+	fmt.Fprintf(&b, "\nTimes are in %s. Just reply with the one that suits you best, or suggest another time.\n", zoneName(loc, slots))
+	return b.String()
+}
+
+func confirmText(p Proposal, start, end time.Time, loc *time.Location, conferenceURL string) string {
+	var b strings.Builder
+	b.WriteString(greeting(p) + "\n\n")
+	s := Slot{start, end}
+	fmt.Fprintf(&b, "Thanks, that's booked: %s on %s (%s). You'll receive a calendar invitation shortly.\n",
+		meetingPhrase(p, end.Sub(start)), formatSlot(s, loc), zoneName(loc, []Slot{s}))
+	if conferenceURL != "" {
+		fmt.Fprintf(&b, "\nVideo call: %s\n", conferenceURL)
+	}
+	return b.String()
+}
+
+// quoteHeader matches the line mail clients put above the quoted message.
+var quoteHeader = regexp.MustCompile(`(?i)^(on .+ wrote:|-+ ?original message ?-+|from: .+|sent from my .+)$`)
+
+const maxReplyText = 2000
+
+// replyText keeps the new part of a reply, dropping the quoted history.
+func replyText(s string) string {
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n") {
+		t := strings.TrimSpace(line)
+		if quoteHeader.MatchString(t) {
+			break
+		}
+		if strings.HasPrefix(t, ">") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	out := strings.TrimSpace(strings.Join(lines, "\n"))
+	if out == "" {
+		out = strings.TrimSpace(s)
+	}
+	if utf8.RuneCountInString(out) > maxReplyText {
+		out = string([]rune(out)[:maxReplyText]) + "…"
+	}
+	return out
+}
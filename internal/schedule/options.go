@@ -0,0 +1,151 @@
+// Package schedule finds free meeting slots on the advisor's calendar and
+// books meetings through Google Calendar.
+package schedule
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options describe when the advisor takes meetings.
+type Options struct {
+	// WorkStart and WorkEnd bound meetings each work day, as offsets from
+	// local midnight.
+	WorkStart, WorkEnd time.Duration
+	WorkDays           map[time.Weekday]bool
+	// Buffer is the free time kept before and after existing meetings.
+	Buffer time.Duration
+	// Duration is the meeting length when a request doesn't give one.
+	Duration time.Duration
+	// Step is the spacing of candidate start times.
+	Step time.Duration
+	// MinNotice keeps slots from starting too soon after the search.
+	MinNotice time.Duration
+	// MaxSlots caps the slots returned and PerDay how many come from one day.
+	MaxSlots, PerDay int
+	// Location is used when the user's calendar time zone isn't known.
+	Location *time.Location
+	// ReplyTimeout is how long a contact has to answer proposed times, and
+	// NudgeAfter how long after each email a reminder is sent, at most
+	// MaxNudges times.
+	ReplyTimeout, NudgeAfter time.Duration
+	MaxNudges                int
+}
+
+// DefaultOptions are 09:00–17:00 Monday to Friday, 30-minute meetings with a
+// 15-minute buffer, in UTC. Contacts get one reminder after a day and three
+// days to reply.
+func DefaultOptions() Options {
+	return Options{
+		WorkStart: 9 * time.Hour,
+		WorkEnd:   17 * time.Hour,
+		WorkDays: map[time.Weekday]bool{
+			time.Monday: true, time.Tuesday: true, time.Wednesday: true, time.Thursday: true, time.Friday: true,
+		},
+		Buffer:    15 * time.Minute,
+		Duration:  30 * time.Minute,
+		Step:      30 * time.Minute,
+		MinNotice: time.Hour,
+		MaxSlots:  6,
+		PerDay:    2,
+		Location:  time.UTC,
+
+		ReplyTimeout: 72 * time.Hour,
+		NudgeAfter:   24 * time.Hour,
+		MaxNudges:    1,
+	}
+}
+
+// OptionsFromEnv reads SCHEDULE_WORK_HOURS ("09:00-17:00"),
+// SCHEDULE_WORK_DAYS ("mon,tue,wed,thu,fri"), SCHEDULE_BUFFER_MINUTES,
+// SCHEDULE_DURATION_MINUTES, SCHEDULE_TIME_ZONE, SCHEDULE_REPLY_TIMEOUT_HOURS,
+// SCHEDULE_NUDGE_AFTER_HOURS and SCHEDULE_MAX_NUDGES over DefaultOptions.
+// Malformed values are ignored.
+func OptionsFromEnv() Options {
+	opt := DefaultOptions()
+	if v := strings.TrimSpace(os.Getenv("SCHEDULE_WORK_HOURS")); v != "" {
+		if start, end, err := parseHours(v); err == nil {
+			opt.WorkStart, opt.WorkEnd = start, end
+		}
+	}
+	if v := strings.TrimSpace(os.Getenv("SCHEDULE_WORK_DAYS")); v != "" {
+		if days, err := parseDays(v); err == nil {
+			opt.WorkDays = days
+		}
+	}
+	if v, err := strconv.Atoi(os.Getenv("SCHEDULE_BUFFER_MINUTES")); err == nil && v >= 0 {
+		opt.Buffer = time.Duration(v) * time.Minute
+	}
+	if v, err := strconv.Atoi(os.Getenv("SCHEDULE_DURATION_MINUTES")); err == nil && v > 0 {
+		opt.Duration = time.Duration(v) * time.Minute
+	}
+	if v := strings.TrimSpace(os.Getenv("SCHEDULE_TIME_ZONE")); v != "" {
+		if loc, err := time.LoadLocation(v); err == nil {
+			opt.Location = loc
+		}
+	}
+	if v, err := strconv.Atoi(os.Getenv("SCHEDULE_REPLY_TIMEOUT_HOURS")); err == nil && v > 0 {
+		opt.ReplyTimeout = time.Duration(v) * time.Hour
+	}
+	if v, err := strconv.Atoi(os.Getenv("SCHEDULE_NUDGE_AFTER_HOURS")); err == nil && v > 0 {
+		opt.NudgeAfter = time.Duration(v) * time.Hour
+	}
+	if v, err := strconv.Atoi(os.Getenv("SCHEDULE_MAX_NUDGES")); err == nil && v >= 0 {
+		opt.MaxNudges = v
+	}
+	return opt
+}
+
+func parseHours(v string) (time.Duration, time.Duration, error) {
+	a, b, ok := strings.Cut(v, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("work hours %q: want HH:MM-HH:MM", v)
+	}
+	start, err := parseClock(a)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseClock(b)
+	if err != nil {
+		return 0, 0, err
+	}
+	if end <= start {
+		return 0, 0, fmt.Errorf("work hours %q: end before start", v)
+	}
+	return start, end, nil
+}
+
+func parseClock(v string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(v))
+	if err != nil {
+		if v = strings.TrimSpace(v); v == "24:00" {
+			return 24 * time.Hour, nil
+		}
+		return 0, fmt.Errorf("bad time %q", v)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func parseDays(v string) (map[time.Weekday]bool, error) {
+	days := map[time.Weekday]bool{}
+	for _, d := range strings.Split(v, ",") {
+		key := strings.ToLower(strings.TrimSpace(d))
+		if len(key) > 3 {
+			key = key[:3]
+		}
+		wd, ok := weekdays[key]
+		if !ok {
+			return nil, fmt.Errorf("bad week day %q", d)
+		}
+		days[wd] = true
+	}
+	return days, nil
+}
@@ -0,0 +1,204 @@
+package schedule
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"aiagentapi/internal/google"
+	"aiagentapi/internal/sync"
+)
+
+// Request asks for meeting slots. Zero fields default to the next seven
+// days and Options.Duration.
+type Request struct {
+	From, To time.Time
+	Duration time.Duration
+	// Attendees are email addresses whose calendars are checked too, when
+	// they are shared with the advisor.
+	Attendees []string
+}
+
+// FindSlots ranks free slots on the user's calendar, in the user's time zone.
+func FindSlots(ctx context.Context, db *sql.DB, cfg google.Config, userID string, req Request) ([]Slot, error) {
+	g, err := cfg.ForUser(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+	opt := OptionsFromEnv()
+	opt.Location = UserLocation(ctx, db, userID, opt.Location)
+	return Find(ctx, g, req, opt)
+}
+
+// Find ranks free slots using Calendar freeBusy for the advisor's primary
+// calendar and the attendees'. Attendee calendars Google won't show are
+// skipped; the advisor's must be readable.
+func Find(ctx context.Context, g *google.Client, req Request, opt Options) ([]Slot, error) {
+	from := req.From
+	if earliest := time.Now().Add(opt.MinNotice); from.Before(earliest) {
+		from = earliest
+	}
+	to := req.To
+	if to.IsZero() {
+		to = from.AddDate(0, 0, 7)
+	}
+	if !to.After(from) {
+		return []Slot{}, nil
+	}
+
+	ids := []string{"primary"}
+	seen := map[string]bool{}
+	for _, a := range req.Attendees {
+		a = strings.ToLower(strings.TrimSpace(a))
+		if a != "" && !seen[a] {
+			seen[a] = true
+			ids = append(ids, a)
+		}
+	}
+	calendars, err := g.FreeBusy(ctx, from, to, ids)
+	if _, ok := calendars["primary"]; !ok {
+		if err == nil {
+			err = errors.New("freebusy: no result for the primary calendar")
+		}
+		return nil, err
+	}
+	if err != nil {
+		log.Printf("[schedule] %v", err)
+	}
+
+	var busy []Interval
+	for _, periods := range calendars {
+		for _, p := range periods {
+			busy = append(busy, Interval{p.Start, p.End})
+		}
+	}
+	return Rank(busy, from, to, req.Duration, opt), nil
+}
+
+// UserLocation returns the time zone of the user's primary calendar, as
+// recorded by Calendar sync, or def when it isn't known yet.
+func UserLocation(ctx context.Context, db *sql.DB, userID string, def *time.Location) *time.Location {
+	var tz sql.NullString
+	if err := db.QueryRowContext(ctx, `SELECT time_zone FROM app_user WHERE id=$1`, userID).Scan(&tz); err != nil || tz.String == "" {
+		return def
+	}
+	loc, err := time.LoadLocation(tz.String)
+	if err != nil {
+		return def
+	}
+	return loc
+}
+
+// Event is a meeting to book. End defaults to Start plus Options.Duration.
+type Event struct {
+	// ID, when set, is the calendar event id to create (see NewKey). A
+	// retried booking with the same id finds the event instead of creating a
+	// second one.
+	ID          string
+	Title       string
+	Description string
+	Location    string
+	Start, End  time.Time
+	Attendees   []string
+	// Conference adds a Google Meet link.
+	Conference bool
+}
+
+// CreateEvent books e on the user's primary calendar, inviting the attendees,
+// and stores it in the meeting table. Once Google has created the event
+// CreateEvent doesn't fail: an event that can't be stored now is picked up by
+// the next sync.
+func CreateEvent(ctx context.Context, db *sql.DB, cfg google.Config, userID string, e Event) (*google.Event, error) {
+	g, err := cfg.ForUser(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+	opt := OptionsFromEnv()
+	if e.End.IsZero() && !e.Start.IsZero() {
+		e.End = e.Start.Add(opt.Duration)
+	}
+	ev, err := Book(ctx, g, e, UserLocation(ctx, db, userID, opt.Location))
+	if err != nil {
+		return nil, err
+	}
+	if err := sync.StoreEvent(ctx, db, userID, "primary", ev); err != nil {
+		log.Printf("[schedule] store event %s: %v", ev.ID, err)
+	}
+	return ev, nil
+}
+
+// Book inserts e on the primary calendar with times in loc. Attendees get
+// Google's invitation email.
+func Book(ctx context.Context, g *google.Client, e Event, loc *time.Location) (*google.Event, error) {
+	if e.Start.IsZero() {
+		return nil, errors.New("schedule: start time required")
+	}
+	if !e.End.After(e.Start) {
+		return nil, errors.New("schedule: end must be after start")
+	}
+	if strings.TrimSpace(e.Title) == "" {
+		e.Title = "Meeting"
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	at := func(t time.Time) *google.EventDateTime {
+		return &google.EventDateTime{DateTime: t.In(loc).Format(time.RFC3339), TimeZone: loc.String()}
+	}
+	ev := &google.Event{
+		ID:          e.ID,
+		Summary:     e.Title,
+		Description: e.Description,
+		Location:    e.Location,
+		Start:       at(e.Start),
+		End:         at(e.End),
+	}
+	for _, a := range e.Attendees {
+		if a = strings.TrimSpace(a); a != "" {
+			ev.Attendees = append(ev.Attendees, google.EventAttendee{Email: a})
+		}
+	}
+	opt := google.WriteOptions{SendUpdates: "none"}
+	if len(ev.Attendees) > 0 {
+		opt.SendUpdates = "all"
+	}
+	if e.Conference {
+		ev.ConferenceData = &google.ConferenceData{CreateRequest: &google.CreateConferenceRequest{
+			RequestID:             requestID(),
+			ConferenceSolutionKey: google.ConferenceSolutionKey{Type: "hangoutsMeet"},
+		}}
+		opt.ConferenceDataVersion = 1
+	}
+	out, err := g.InsertEvent(ctx, "primary", ev, opt)
+	if e.ID != "" && google.IsStatus(err, http.StatusConflict) {
+		// An earlier attempt created it.
+		out, err = g.GetEvent(ctx, "primary", e.ID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("insert event: %w", err)
+	}
+	return out, nil
+}
+
+// NewKey returns a random key for Event.ID, Proposal.Key or Replied.Key. It
+// uses the alphabet Calendar accepts for client-chosen event ids (lowercase
+// base32hex), which also suits the local part of a Message-ID.
+func NewKey() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return strings.ToLower(base32.HexEncoding.WithPadding(base32.NoPadding).EncodeToString(b[:]))
+}
+
+func requestID() string {
+	var b [12]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
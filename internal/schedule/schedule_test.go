@@ -0,0 +1,185 @@
+package schedule
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"aiagentapi/internal/google"
+	"aiagentapi/internal/google/googletest"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	return loc
+}
+
+func TestRank(t *testing.T) {
+	ny := mustLoad(t, "America/New_York")
+	opt := DefaultOptions()
+	opt.Location = ny
+	opt.MaxSlots = 0
+	opt.PerDay = 0
+	day := func(d, h, m int) time.Time { return time.Date(2030, 3, d, h, m, 0, 0, ny) }
+
+	// Monday 4 March 2030: busy 10:00-11:00 local.
+	busy := []Interval{{day(4, 10, 0), day(4, 11, 0)}}
+	slots := Rank(busy, day(4, 0, 0), day(5, 0, 0), time.Hour, opt)
+	got := map[string]bool{}
+	for _, s := range slots {
+		got[s.Start.Format("15:04")] = true
+		if s.Start.Location() != ny || s.End.Sub(s.Start) != time.Hour {
+			t.Errorf("slot %v-%v not an hour in New York time", s.Start, s.End)
+		}
+	}
+	for _, want := range []string{"11:30", "16:00"} {
+		if !got[want] {
+			t.Errorf("missing %s slot in %v", want, slots)
+		}
+	}
+	// Slots must keep a 15-minute buffer around the meeting and end by 17:00.
+	for _, bad := range []string{"09:00", "09:30", "10:30", "11:00", "16:30"} {
+		if got[bad] {
+			t.Errorf("unexpected %s slot", bad)
+		}
+	}
+
+	// Weekends are skipped.
+	if s := Rank(nil, day(9, 0, 0), day(11, 0, 0), time.Hour, opt); len(s) != 0 {
+		t.Errorf("weekend slots: %v", s)
+	}
+}
+
+func TestRankOrdersAndSpreads(t *testing.T) {
+	opt := DefaultOptions()
+	opt.MaxSlots = 4
+	from := time.Date(2030, 3, 4, 0, 0, 0, 0, time.UTC) // Monday
+	slots := Rank(nil, from, from.AddDate(0, 0, 3), 30*time.Minute, opt)
+	if len(slots) != 4 {
+		t.Fatalf("got %d slots, want 4", len(slots))
+	}
+	perDay := map[int]int{}
+	for i, s := range slots {
+		perDay[s.Start.Day()]++
+		if i > 0 && s.Start.Day() < slots[i-1].Start.Day() {
+			t.Errorf("slot %d (%v) ranked after a later day", i, s.Start)
+		}
+		if h := s.Start.Hour(); !(h >= 10 && h < 12 || h >= 14 && h < 16) {
+			t.Errorf("slot %v is outside the preferred hours", s.Start)
+		}
+	}
+	if perDay[4] != 2 || perDay[5] != 2 {
+		t.Errorf("per day = %v, want two on each of the first two days", perDay)
+	}
+}
+
+func TestRankAcrossDST(t *testing.T) {
+	ny := mustLoad(t, "America/New_York")
+	opt := DefaultOptions()
+	opt.Location = ny
+	opt.WorkDays[time.Sunday] = true
+	opt.MaxSlots, opt.PerDay = 0, 0
+	// Clocks go forward on Sunday 10 March 2030; work hours stay 09:00-17:00.
+	from := time.Date(2030, 3, 10, 0, 0, 0, 0, ny)
+	slots := Rank(nil, from, from.AddDate(0, 0, 1), time.Hour, opt)
+	if len(slots) == 0 {
+		t.Fatal("no slots")
+	}
+	for _, s := range slots {
+		if s.Start.Hour() < 9 || s.End.Hour() > 17 || (s.End.Hour() == 17 && s.End.Minute() > 0) {
+			t.Errorf("slot %v-%v outside 09:00-17:00", s.Start, s.End)
+		}
+	}
+}
+
+func TestFindAndBook(t *testing.T) {
+	srv := googletest.New(t)
+	g := srv.Config().NewClient(googletest.RefreshToken)
+	ctx := context.Background()
+	opt := DefaultOptions()
+	opt.MaxSlots, opt.PerDay = 0, 0
+
+	day := time.Now().UTC().AddDate(0, 0, 7)
+	for day.Weekday() != time.Tuesday {
+		day = day.AddDate(0, 0, 1)
+	}
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	at := func(h int) time.Time { return day.Add(time.Duration(h) * time.Hour) }
+	srv.AddBusy("primary", at(9), at(12))
+	srv.AddBusy("alice@example.com", at(14), at(17))
+
+	slots, err := Find(ctx, g, Request{From: day, To: day.AddDate(0, 0, 1), Attendees: []string{"Alice@example.com", "hidden@example.com"}}, opt)
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	if len(slots) == 0 {
+		t.Fatal("no slots")
+	}
+	for _, s := range slots {
+		if s.Start.Before(at(12).Add(opt.Buffer)) || s.End.After(at(14).Add(-opt.Buffer)) {
+			t.Errorf("slot %v-%v overlaps a busy calendar", s.Start, s.End)
+		}
+	}
+
+	ev, err := Book(ctx, g, Event{
+		Title:      "Portfolio review",
+		Start:      slots[0].Start,
+		End:        slots[0].End,
+		Attendees:  []string{"alice@example.com"},
+		Conference: true,
+	}, time.UTC)
+	if err != nil {
+		t.Fatalf("Book: %v", err)
+	}
+	if ev.ID == "" || ev.ConferenceURL() == "" {
+		t.Errorf("event = %+v", ev)
+	}
+	stored, ok := srv.Event("primary", ev.ID)
+	if !ok || len(stored.Attendees) != 1 || stored.Start.TimeZone != "UTC" {
+		t.Errorf("stored = %+v", stored)
+	}
+	if inv := srv.Invitations(); len(inv) != 1 || inv[0].EventID != ev.ID {
+		t.Errorf("invitations = %+v", inv)
+	}
+
+	// The booked slot is no longer offered.
+	again, err := Find(ctx, g, Request{From: day, To: day.AddDate(0, 0, 1)}, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range again {
+		if s.Start.Equal(slots[0].Start) {
+			t.Errorf("booked slot %v still offered", s.Start)
+		}
+	}
+
+	// A retried booking with the same id finds the first event.
+	key := NewKey()
+	retry := Event{ID: key, Title: "Retried", Start: at(15), End: at(16), Attendees: []string{"bob@example.com"}}
+	first, err := Book(ctx, g, retry, time.UTC)
+	if err != nil {
+		t.Fatalf("Book with id: %v", err)
+	}
+	second, err := Book(ctx, g, retry, time.UTC)
+	if err != nil {
+		t.Fatalf("Book retry: %v", err)
+	}
+	if first.ID != key || second.ID != key {
+		t.Errorf("ids %q and %q, want %q", first.ID, second.ID, key)
+	}
+	if inv := srv.Invitations(); len(inv) != 2 {
+		t.Errorf("%d invitations after a retried booking, want 2", len(inv))
+	}
+
+	if _, err := Book(ctx, g, Event{Title: "x", Start: at(10), End: at(9)}, time.UTC); err == nil {
+		t.Error("end before start accepted")
+	}
+	srv.FailNext("POST", "/calendar/v3/freeBusy", 500, 1)
+	if _, err := Find(ctx, g, Request{From: day, To: day.AddDate(0, 0, 1)}, opt); !google.IsStatus(err, 500) {
+		t.Errorf("freeBusy failure: err = %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package schedule
+
+import (
+	"sort"
+	"time"
+)
+
+// Interval is a busy period.
+type Interval struct {
+	Start, End time.Time
+}
+
+// Slot is a candidate meeting time, in the user's time zone.
+type Slot struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Rank returns free slots of length d between from and to, best first. A slot
+// is free when it lies within working hours on a work day and is at least
+// opt.Buffer away from every busy interval. Sooner days rank higher, and
+// within a day mid-morning and mid-afternoon starts beat the edges of the
+// day and lunch time. At most opt.PerDay slots come from one day, and the
+// slots returned don't overlap one another.
+func Rank(busy []Interval, from, to time.Time, d time.Duration, opt Options) []Slot {
+	if d <= 0 {
+		d = opt.Duration
+	}
+	step := opt.Step
+	if step <= 0 {
+		step = 30 * time.Minute
+	}
+	loc := opt.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	from, to = from.In(loc), to.In(loc)
+
+	type candidate struct {
+		Slot
+		day   int
+		score float64
+	}
+	var cands []candidate
+	first := dayStart(from, loc)
+	for day, i := first, 0; day.Before(to); i++ {
+		if opt.WorkDays[day.Weekday()] {
+			end := clock(day, opt.WorkEnd, loc)
+			for s := clock(day, opt.WorkStart, loc); !s.Add(d).After(end); s = s.Add(step) {
+				if s.Before(from) {
+					continue
+				}
+				if s.Add(d).After(to) {
+					break
+				}
+				if conflicts(busy, s.Add(-opt.Buffer), s.Add(d+opt.Buffer)) {
+					continue
+				}
+				cands = append(cands, candidate{Slot{s, s.Add(d)}, i, score(s, i)})
+			}
+		}
+		day = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, loc)
+	}
+
+	sort.SliceStable(cands, func(i, j int) bool {
+		if cands[i].score != cands[j].score {
+			return cands[i].score > cands[j].score
+		}
+		return cands[i].Start.Before(cands[j].Start)
+	})
+	out := []Slot{}
+	perDay := map[int]int{}
+	for _, c := range cands {
+		if opt.MaxSlots > 0 && len(out) >= opt.MaxSlots {
+			break
+		}
+		if opt.PerDay > 0 && perDay[c.day] >= opt.PerDay {
+			continue
+		}
+		if overlapsAny(out, c.Slot) {
+			continue
+		}
+		perDay[c.day]++
+		out = append(out, c.Slot)
+	}
+	return out
+}
+
+// score prefers sooner days, then starts between 10:00 and 12:00 or 14:00
+// and 16:00, and avoids 12:00–13:00.
+func score(start time.Time, day int) float64 {
+	s := -float64(day)
+	switch h := start.Hour(); {
+	case h >= 10 && h < 12, h >= 14 && h < 16:
+		s += 0.5
+	case h == 12:
+		s -= 0.5
+	}
+	return s
+}
+
+func dayStart(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// clock returns the wall-clock time offset after midnight on day, so work
+// hours stay put across daylight saving changes.
+func clock(day time.Time, offset time.Duration, loc *time.Location) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), int(offset/time.Hour), int(offset%time.Hour/time.Minute), 0, 0, loc)
+}
+
+func conflicts(busy []Interval, start, end time.Time) bool {
+	for _, b := range busy {
+		if b.Start.Before(end) && b.End.After(start) {
+			return true
+		}
+	}
+	return false
+}
+
+func overlapsAny(slots []Slot, s Slot) bool {
+	for _, o := range slots {
+		if o.Start.Before(s.End) && o.End.After(s.Start) {
+			return true
+		}
+	}
+	return false
+}
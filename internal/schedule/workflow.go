@@ -0,0 +1,409 @@
+package schedule
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"aiagentapi/internal/google"
+	"aiagentapi/internal/llm"
+	"aiagentapi/internal/mailsend"
+	"aiagentapi/internal/when"
+)
+
+// The scheduling workflow agrees a meeting time with a contact by email, as
+// a chain of tasks: schedule_meeting sends a Proposal, wait_email_reply
+// holds the Waiting until the contact answers (nudging them meanwhile), and
+// schedule_reply reads the answer and books the meeting, or proposes new
+// times and waits again.
+
+// proposeSlots is how many times a proposal offers.
+const proposeSlots = 3
+
+// ErrNoSlots is returned when no time in the requested period is free.
+var ErrNoSlots = errors.New("schedule: no free slots")
+
+// Proposal is a meeting to agree with a contact, the payload of a
+// schedule_meeting task. Zero From and To mean the next seven days, and a
+// zero Duration the advisor's usual meeting length.
+type Proposal struct {
+	Name, Email string
+	Title       string
+	From, To    time.Time
+	Duration    time.Duration
+	Conference  bool
+	// Message is an optional note put before the proposed times.
+	Message string
+	// Key, chosen when the task is queued (see NewKey), is the Email.Key of
+	// the proposal email so a retried task doesn't send it twice.
+	Key string
+}
+
+func (p Proposal) address() string {
+	return contactAddress(p.Name, p.Email)
+}
+
+func (p Proposal) title() string {
+	if t := strings.TrimSpace(p.Title); t != "" {
+		return t
+	}
+	return "Meeting"
+}
+
+// Waiting is a proposal awaiting the contact's reply, the payload of a
+// wait_email_reply task. Replies on ThreadID received after SentAt count.
+type Waiting struct {
+	Proposal
+	ThreadID string
+	Slots    []Slot
+	SentAt   time.Time
+	// Deadline ends the wait. NextNudge, when set, is when the contact is
+	// reminded; Nudges counts the reminders sent.
+	Deadline  time.Time
+	NextNudge time.Time
+	Nudges    int
+}
+
+// Due is when the wait next needs attention without a reply: the next
+// reminder or the deadline.
+func (w *Waiting) Due() time.Time {
+	if !w.NextNudge.IsZero() && w.NextNudge.Before(w.Deadline) {
+		return w.NextNudge
+	}
+	return w.Deadline
+}
+
+// planNudge sets the next reminder, if one is left and fits before the
+// deadline.
+func (w *Waiting) planNudge(now time.Time, opt Options) {
+	w.NextNudge = time.Time{}
+	if next := now.Add(opt.NudgeAfter); w.Nudges < opt.MaxNudges && opt.NudgeAfter > 0 && next.Before(w.Deadline) {
+		w.NextNudge = next
+	}
+}
+
+// Reply is an answer found on a proposal's thread.
+type Reply struct {
+	EmailID int64
+	From    string
+	Text    string
+	At      time.Time
+}
+
+// Replied is a Waiting with the reply that ended it, the payload of a
+// schedule_reply task.
+type Replied struct {
+	Waiting
+	Reply Reply
+	// Key, chosen when the task is queued (see NewKey), is the event id the
+	// meeting is booked under and the Email.Key of a new proposal, so a
+	// retried task repeats neither.
+	Key string
+}
+
+// Outcome statuses.
+const (
+	Booked     = "booked"
+	Reproposed = "reproposed"
+	Declined   = "declined"
+	Unclear    = "unclear"
+)
+
+// Outcome is what came of a reply, the result of a schedule_reply task.
+type Outcome struct {
+	Status        string     `json:"status"`
+	EventID       string     `json:"event_id,omitempty"`
+	Start         *time.Time `json:"start,omitempty"`
+	ConferenceURL string     `json:"conference_url,omitempty"`
+}
+
+// userOptions are the environment's options in the user's time zone.
+func userOptions(ctx context.Context, db *sql.DB, userID string) Options {
+	opt := OptionsFromEnv()
+	opt.Location = UserLocation(ctx, db, userID, opt.Location)
+	return opt
+}
+
+// Propose emails the contact up to three free times for p, found on the
+// advisor's and the contact's calendars, and returns the wait for their
+// reply.
+func Propose(ctx context.Context, db *sql.DB, cfg google.Config, userID string, p Proposal) (*Waiting, error) {
+	return propose(ctx, db, cfg, userID, p, "", "")
+}
+
+// propose sends a proposal, as a reply in threadID when it is set, with
+// intro before the times.
+func propose(ctx context.Context, db *sql.DB, cfg google.Config, userID string, p Proposal, threadID, intro string) (*Waiting, error) {
+	g, err := cfg.ForUser(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+	opt := userOptions(ctx, db, userID)
+	slots, err := proposalSlots(ctx, g, p, opt)
+	if err != nil {
+		return nil, err
+	}
+	e := mailsend.Email{To: p.address(), Body: proposalText(p, slots, intro, opt.Location), ThreadID: threadID, Key: p.Key}
+	if threadID == "" {
+		e.Subject = p.title()
+	}
+	res, err := mailsend.Send(ctx, db, cfg, userID, e)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	w := &Waiting{Proposal: p, ThreadID: res.ThreadID, Slots: slots, SentAt: now, Deadline: now.Add(opt.ReplyTimeout)}
+	w.planNudge(now, opt)
+	return w, nil
+}
+
+// proposalSlots picks the times to offer, in chronological order. Over
+// several days they come from different days.
+func proposalSlots(ctx context.Context, g *google.Client, p Proposal, opt Options) ([]Slot, error) {
+	opt.MaxSlots = proposeSlots
+	if !p.From.IsZero() && !p.To.IsZero() && p.To.Sub(p.From) <= 24*time.Hour {
+		opt.PerDay = 0
+	} else {
+		opt.PerDay = 1
+	}
+	slots, err := Find(ctx, g, Request{From: p.From, To: p.To, Duration: p.Duration, Attendees: []string{p.Email}}, opt)
+	if err != nil {
+		return nil, err
+	}
+	if len(slots) == 0 {
+		return nil, ErrNoSlots
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].Start.Before(slots[j].Start) })
+	return slots, nil
+}
+
+// CheckReply returns the first message on the thread received after the
+// proposal that the advisor didn't send, or nil when there is none yet.
+func CheckReply(ctx context.Context, db *sql.DB, userID string, w *Waiting) (*Reply, error) {
+	var (
+		r    Reply
+		text string
+	)
+	err := db.QueryRowContext(ctx, `
+SELECT id, coalesce(sender, ''), coalesce(nullif(body_text, ''), snippet, ''), sent_at
+FROM email
+WHERE user_id=$1 AND thread_id=$2 AND sent_at > $3
+  AND NOT labels && ARRAY['SENT', 'DRAFT']
+ORDER BY sent_at, id
+LIMIT 1`, userID, w.ThreadID, w.SentAt).Scan(&r.EmailID, &r.From, &text, &r.At)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("check reply: %w", err)
+	}
+	r.Text = replyText(text)
+	return &r, nil
+}
+
+// Nudge reminds the contact of a proposal they haven't answered, offering
+// new times when the proposed ones have passed, and plans the next reminder.
+func Nudge(ctx context.Context, db *sql.DB, cfg google.Config, userID string, w *Waiting) error {
+	opt := userOptions(ctx, db, userID)
+	now := time.Now()
+	var slots []Slot
+	for _, s := range w.Slots {
+		if s.Start.After(now.Add(opt.MinNotice)) {
+			slots = append(slots, s)
+		}
+	}
+	if len(slots) == 0 {
+		g, err := cfg.ForUser(ctx, db, userID)
+		if err != nil {
+			return err
+		}
+		p := w.Proposal
+		p.From, p.To = time.Time{}, time.Time{}
+		if slots, err = proposalSlots(ctx, g, p, opt); err != nil {
+			return err
+		}
+	}
+	p := w.Proposal
+	p.Message = ""
+	body := proposalText(p, slots, "Just following up on my email below.", opt.Location)
+	if _, err := mailsend.Send(ctx, db, cfg, userID, mailsend.Email{To: w.address(), Body: body, ThreadID: w.ThreadID}); err != nil {
+		return err
+	}
+	w.Slots = slots
+	w.Nudges++
+	w.planNudge(now, opt)
+	return nil
+}
+
+// Completer runs a single system/user exchange on the route of purpose;
+// *agent.LLM satisfies it.
+type Completer interface {
+	CompleteFor(ctx context.Context, purpose llm.Purpose, system, user string) (string, error)
+}
+
+// Choice is what a reply to a proposal says: the number of the time it
+// accepts, another time it suggests, or that the contact declines. The zero
+// Choice means the reply is unclear.
+type Choice struct {
+	Slot    int    `json:"slot"`
+	Counter string `json:"counter"`
+	Decline bool   `json:"decline"`
+}
+
+const classifyPrompt = `You read replies to an email that proposed meeting times. You get the numbered options and the reply.
+Answer with only a JSON object:
+{"slot": n} if the reply accepts option n;
+{"counter": "..."} if it suggests a different time, written like "2030-03-05 15:00" or "Thursday afternoon";
+{"decline": true} if they don't want to meet;
+{} if it is unclear, for example when they will answer later.`
+
+// Classify asks the model what a reply chose.
+func Classify(ctx context.Context, c Completer, w *Waiting, r Reply, loc *time.Location) (Choice, error) {
+	var b strings.Builder
+	b.WriteString("Options:\n")
+	b.WriteString(formatSlots(w.Slots, loc))
+	fmt.Fprintf(&b, "Times are in %s.\n\nReply received %s:\n%s", zoneName(loc, w.Slots), r.At.In(loc).Format("Monday 2 January 2006 15:04"), r.Text)
+	out, err := c.CompleteFor(ctx, llm.Classify, classifyPrompt, b.String())
+	if err != nil {
+		return Choice{}, fmt.Errorf("classify reply: %w", err)
+	}
+	return parseChoice(out), nil
+}
+
+// parseChoice reads the JSON object in a model answer; anything else is
+// unclear.
+func parseChoice(s string) Choice {
+	var c Choice
+	start, end := strings.IndexByte(s, '{'), strings.LastIndexByte(s, '}')
+	if start < 0 || end < start {
+		return c
+	}
+	if err := json.Unmarshal([]byte(s[start:end+1]), &c); err != nil {
+		return Choice{}
+	}
+	c.Counter = strings.TrimSpace(c.Counter)
+	return c
+}
+
+// HandleReply acts on the contact's reply. An accepted time, or a suggested
+// one that is free, is booked and confirmed in the thread. A suggestion that
+// doesn't fit gets new times around it, and the returned Waiting waits for
+// the answer to those. An unclear reply keeps waiting for another one until
+// the same deadline.
+func HandleReply(ctx context.Context, db *sql.DB, cfg google.Config, c Completer, userID string, rp Replied) (*Outcome, *Waiting, error) {
+	opt := userOptions(ctx, db, userID)
+	loc := opt.Location
+	w := rp.Waiting
+	choice, err := Classify(ctx, c, &w, rp.Reply, loc)
+	if err != nil {
+		return nil, nil, err
+	}
+	duration := w.Duration
+	if duration <= 0 {
+		duration = opt.Duration
+	}
+	switch {
+	case choice.Decline:
+		return &Outcome{Status: Declined}, nil, nil
+	case choice.Slot >= 1 && choice.Slot <= len(w.Slots):
+		s := w.Slots[choice.Slot-1]
+		return book(ctx, db, cfg, userID, &w, rp.Key, s.Start, s.End, loc)
+	case choice.Counter != "":
+		r, err := when.Resolve(choice.Counter, rp.Reply.At, loc)
+		if err != nil {
+			log.Printf("[schedule] counter-proposal %q: %v", choice.Counter, err)
+			break
+		}
+		if r.HasTime {
+			if r.Start.After(time.Now()) {
+				g, err := cfg.ForUser(ctx, db, userID)
+				if err != nil {
+					return nil, nil, err
+				}
+				free, err := isFree(ctx, g, r.Start, r.Start.Add(duration), w.Email)
+				if err != nil {
+					return nil, nil, err
+				}
+				if free {
+					return book(ctx, db, cfg, userID, &w, rp.Key, r.Start, r.Start.Add(duration), loc)
+				}
+			}
+			// Offer other times that day and the next.
+			d := dayStart(r.Start, loc)
+			r = when.Range{Start: d, End: d.AddDate(0, 0, 2)}
+		}
+		next, err := repropose(ctx, db, cfg, userID, w, rp.Key, r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &Outcome{Status: Reproposed}, next, nil
+	}
+	w.SentAt = rp.Reply.At
+	return &Outcome{Status: Unclear}, &w, nil
+}
+
+// repropose offers times within r, or the week after it when r has none.
+func repropose(ctx context.Context, db *sql.DB, cfg google.Config, userID string, w Waiting, key string, r when.Range) (*Waiting, error) {
+	p := w.Proposal
+	p.Message, p.Key = "", key
+	p.From, p.To = r.Start, r.End
+	const intro = "Unfortunately that time doesn't work for me."
+	next, err := propose(ctx, db, cfg, userID, p, w.ThreadID, intro+" Would one of these suit you instead?")
+	if errors.Is(err, ErrNoSlots) {
+		from := r.Start
+		if now := time.Now(); from.Before(now) {
+			from = now
+		}
+		p.From, p.To = from, from.AddDate(0, 0, 7)
+		next, err = propose(ctx, db, cfg, userID, p, w.ThreadID, intro+" Would one of these suit you instead?")
+	}
+	return next, err
+}
+
+// book creates the event with the contact and confirms it in the thread. A
+// confirmation that can't be sent is only logged: the contact still gets
+// Google's invitation.
+func book(ctx context.Context, db *sql.DB, cfg google.Config, userID string, w *Waiting, eventID string, start, end time.Time, loc *time.Location) (*Outcome, *Waiting, error) {
+	ev, err := CreateEvent(ctx, db, cfg, userID, Event{
+		ID:         eventID,
+		Title:      w.title(),
+		Start:      start,
+		End:        end,
+		Attendees:  []string{w.Email},
+		Conference: w.Conference,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	body := confirmText(w.Proposal, start, end, loc, ev.ConferenceURL())
+	if _, err := mailsend.Send(ctx, db, cfg, userID, mailsend.Email{To: w.address(), Body: body, ThreadID: w.ThreadID}); err != nil {
+		log.Printf("[schedule] confirm event %s: %v", ev.ID, err)
+	}
+	return &Outcome{Status: Booked, EventID: ev.ID, Start: &start, ConferenceURL: ev.ConferenceURL()}, nil, nil
+}
+
+// isFree reports whether the advisor, and the contact when their calendar
+// is visible, are free from start to end.
+func isFree(ctx context.Context, g *google.Client, start, end time.Time, email string) (bool, error) {
+	calendars, err := g.FreeBusy(ctx, start, end, []string{"primary", strings.ToLower(email)})
+	if _, ok := calendars["primary"]; !ok {
+		if err == nil {
+			err = errors.New("freebusy: no result for the primary calendar")
+		}
+		return false, err
+	}
+	for _, periods := range calendars {
+		for _, p := range periods {
+			if p.Start.Before(end) && p.End.After(start) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,111 @@
+package schedule
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"aiagentapi/internal/llm"
+)
+
+type fakeCompleter struct {
+	answer  string
+	purpose llm.Purpose
+	user    string
+}
+
+func (f *fakeCompleter) CompleteFor(ctx context.Context, purpose llm.Purpose, system, user string) (string, error) {
+	f.purpose, f.user = purpose, user
+	return f.answer, nil
+}
+
+func testWaiting() *Waiting {
+	day := time.Date(2030, 3, 5, 0, 0, 0, 0, time.UTC)
+	slot := func(h int) Slot {
+		return Slot{day.Add(time.Duration(h) * time.Hour), day.Add(time.Duration(h)*time.Hour + 30*time.Minute)}
+	}
+	return &Waiting{
+		Proposal: Proposal{Name: "Smith, Sara", Email: "sara@example.com", Title: "Annual review", Duration: 30 * time.Minute},
+		ThreadID: "t1",
+		Slots:    []Slot{slot(10), slot(14), slot(15)},
+	}
+}
+
+func TestClassify(t *testing.T) {
+	w := testWaiting()
+	reply := Reply{Text: "The second one works for me.", At: time.Date(2030, 3, 4, 9, 0, 0, 0, time.UTC)}
+	tests := []struct {
+		answer string
+		want   Choice
+	}{
+		{`{"slot": 2}`, Choice{Slot: 2}},
+		{"```json\n{\"counter\": \"Thursday 3pm\"}\n```", Choice{Counter: "Thursday 3pm"}},
+		{`Sure: {"decline": true}`, Choice{Decline: true}},
+		{`{}`, Choice{}},
+		{`I think they want the second slot.`, Choice{}},
+	}
+	for _, tt := range tests {
+		c := &fakeCompleter{answer: tt.answer}
+		got, err := Classify(context.Background(), c, w, reply, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Classify(%q) = %+v, want %+v", tt.answer, got, tt.want)
+		}
+		if c.purpose != llm.Classify {
+			t.Errorf("purpose = %q", c.purpose)
+		}
+		if !strings.Contains(c.user, "2. Tuesday 5 March, 14:00–14:30") || !strings.Contains(c.user, "The second one works") {
+			t.Errorf("prompt lacks the options or the reply:\n%s", c.user)
+		}
+	}
+}
+
+func TestProposalText(t *testing.T) {
+	ny := mustLoad(t, "America/New_York")
+	w := testWaiting()
+	w.Message = "Good to catch up after your call."
+	text := proposalText(w.Proposal, w.Slots, "", ny)
+	for _, want := range []string{
+		"Hi Sara,\n\nGood to catch up after your call.\n\n",
+		"a 30-minute meeting (Annual review)?",
+		"1. Tuesday 5 March, 05:00–05:30\n2. Tuesday 5 March, 09:00–09:30\n",
+		"Times are in America/New_York (EST).",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("proposal lacks %q:\n%s", want, text)
+		}
+	}
+
+	confirm := confirmText(w.Proposal, w.Slots[1].Start, w.Slots[1].End, time.UTC, "https://meet.google.com/abc")
+	if !strings.Contains(confirm, "Tuesday 5 March, 14:00–14:30 (UTC)") || !strings.Contains(confirm, "Video call: https://meet.google.com/abc") {
+		t.Errorf("confirmation:\n%s", confirm)
+	}
+}
+
+func TestReplyText(t *testing.T) {
+	body := "Tuesday at 2 is perfect.\r\n\r\nOn Mon, 4 Mar 2030 at 09:00, Advisor <me@example.com> wrote:\r\n> Would one of these times work?\r\n> 1. Tuesday"
+	if got := replyText(body); got != "Tuesday at 2 is perfect." {
+		t.Errorf("replyText = %q", got)
+	}
+	if got := replyText("> only quoted"); got != "> only quoted" {
+		t.Errorf("replyText of a quote-only body = %q", got)
+	}
+}
+
+func TestWaitingPlan(t *testing.T) {
+	opt := DefaultOptions()
+	now := time.Date(2030, 3, 4, 9, 0, 0, 0, time.UTC)
+	w := &Waiting{SentAt: now, Deadline: now.Add(opt.ReplyTimeout)}
+	w.planNudge(now, opt)
+	if !w.NextNudge.Equal(now.Add(24*time.Hour)) || !w.Due().Equal(w.NextNudge) {
+		t.Errorf("first nudge at %v, due %v", w.NextNudge, w.Due())
+	}
+	w.Nudges = opt.MaxNudges
+	w.planNudge(w.NextNudge, opt)
+	if !w.NextNudge.IsZero() || !w.Due().Equal(w.Deadline) {
+		t.Errorf("after the last nudge: next %v, due %v", w.NextNudge, w.Due())
+	}
+}
@@ -1 +1,314 @@
-package sync; import "time"; func SyncCalendar(userID string, since time.Time) (int, error) { return 0, nil }
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"aiagentapi/internal/google"
+)
+
+// CalendarOptions bounds which events are kept in the meeting table.
+type CalendarOptions struct {
+	// CalendarIDs lists the calendars to sync; "primary" by default.
+	CalendarIDs []string
+	// Past and Horizon bound recurring-event expansion around now.
+	Past    time.Duration
+	Horizon time.Duration
+	// ResyncEvery forces a periodic full sync so the horizon moves forward.
+	ResyncEvery time.Duration
+}
+
+// CalendarOptionsFromEnv reads GCAL_CALENDAR_IDS (comma separated),
+// GCAL_SYNC_PAST_DAYS (default 30) and GCAL_SYNC_HORIZON_DAYS (default 180).
+func CalendarOptionsFromEnv() CalendarOptions {
+	opt := CalendarOptions{
+		CalendarIDs: []string{"primary"},
+		Past:        30 * 24 * time.Hour,
+		Horizon:     180 * 24 * time.Hour,
+		ResyncEvery: 24 * time.Hour,
+	}
+	if v := strings.TrimSpace(os.Getenv("GCAL_CALENDAR_IDS")); v != "" {
+		opt.CalendarIDs = nil
+		for _, id := range strings.Split(v, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				opt.CalendarIDs = append(opt.CalendarIDs, id)
+			}
+		}
+	}
+	if v, err := strconv.Atoi(os.Getenv("GCAL_SYNC_PAST_DAYS")); err == nil && v >= 0 {
+		opt.Past = time.Duration(v) * 24 * time.Hour
+	}
+	if v, err := strconv.Atoi(os.Getenv("GCAL_SYNC_HORIZON_DAYS")); err == nil && v > 0 {
+		opt.Horizon = time.Duration(v) * 24 * time.Hour
+	}
+	return opt
+}
+
+// SyncCalendar mirrors a user's calendars into the meeting table. Recurring
+// events are stored as individual instances. The first sync (and one per
+// ResyncEvery) lists the whole window; later syncs only fetch changes since
+// the stored sync token, and an expired token (410 Gone) triggers a full
+// resync. It returns the number of meetings stored or removed.
+func SyncCalendar(ctx context.Context, db *sql.DB, cfg google.Config, userID string, opt CalendarOptions) (int, error) {
+	g, err := cfg.ForUser(ctx, db, userID)
+	if err != nil {
+		return 0, err
+	}
+	if len(opt.CalendarIDs) == 0 {
+		opt.CalendarIDs = []string{"primary"}
+	}
+	total := 0
+	var errs []error
+	for _, calID := range opt.CalendarIDs {
+		s := &calendarSync{db: db, g: g, userID: userID, calendarID: calID, opt: opt}
+		n, err := s.run(ctx)
+		s.recordResult(ctx, err)
+		total += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("calendar %s: %w", calID, err))
+		}
+	}
+	return total, errors.Join(errs...)
+}
+
+type calendarSync struct {
+	db         *sql.DB
+	g          *google.Client
+	userID     string
+	calendarID string
+	opt        CalendarOptions
+	loc        *time.Location
+}
+
+func (s *calendarSync) run(ctx context.Context) (int, error) {
+	var (
+		token    sql.NullString
+		lastFull sql.NullTime
+	)
+	err := s.db.QueryRowContext(ctx, `
+SELECT sync_token, last_full_sync_at FROM calendar_sync_state
+WHERE user_id=$1 AND calendar_id=$2`, s.userID, s.calendarID).Scan(&token, &lastFull)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("load calendar cursor: %w", err)
+	}
+	stale := !lastFull.Valid || (s.opt.ResyncEvery > 0 && time.Since(lastFull.Time) > s.opt.ResyncEvery)
+	if token.String == "" || stale {
+		return s.full(ctx)
+	}
+	n, err := s.incremental(ctx, token.String)
+	if google.IsStatus(err, http.StatusGone) {
+		log.Printf("[sync] calendar %s sync token expired for user %s; resyncing", s.calendarID, s.userID)
+		return s.full(ctx)
+	}
+	return n, err
+}
+
+// full lists every event instance in the window and then removes stored
+// meetings in the window that Google no longer returned.
+func (s *calendarSync) full(ctx context.Context) (int, error) {
+	started := time.Now()
+	q := google.EventQuery{
+		SingleEvents: true,
+		TimeMin:      started.Add(-s.opt.Past),
+		TimeMax:      started.Add(s.opt.Horizon),
+		MaxResults:   250,
+	}
+	n, token, err := s.apply(ctx, q)
+	if err != nil {
+		return n, err
+	}
+	res, err := s.db.ExecContext(ctx, `
+DELETE FROM meeting
+WHERE user_id=$1 AND calendar_id=$2 AND synced_at < $3 AND end_time >= $4`,
+		s.userID, s.calendarID, started, q.TimeMin)
+	if err != nil {
+		return n, fmt.Errorf("remove stale meetings: %w", err)
+	}
+	removed, _ := res.RowsAffected()
+	return n + int(removed), s.saveCursor(ctx, token, true)
+}
+
+func (s *calendarSync) incremental(ctx context.Context, token string) (int, error) {
+	n, next, err := s.apply(ctx, google.EventQuery{SyncToken: token, SingleEvents: true, MaxResults: 250})
+	if err != nil {
+		return n, err
+	}
+	return n, s.saveCursor(ctx, next, false)
+}
+
+// apply pages through a listing and stores each event. It returns the number
+// of changes and the final nextSyncToken.
+func (s *calendarSync) apply(ctx context.Context, q google.EventQuery) (int, string, error) {
+	n := 0
+	for {
+		list, err := s.g.ListEvents(ctx, s.calendarID, q)
+		if err != nil {
+			return n, "", err
+		}
+		if s.loc == nil && list.TimeZone != "" {
+			s.loc, _ = time.LoadLocation(list.TimeZone)
+			if s.loc != nil && s.calendarID == "primary" {
+				s.saveTimeZone(ctx, list.TimeZone)
+			}
+		}
+		for i := range list.Items {
+			changed, err := s.store(ctx, &list.Items[i])
+			if err != nil {
+				return n, "", err
+			}
+			if changed {
+				n++
+			}
+		}
+		if list.NextPageToken == "" {
+			return n, list.NextSyncToken, nil
+		}
+		q.PageToken = list.NextPageToken
+	}
+}
+
+// store upserts one event instance, or deletes it when it was cancelled or
+// now falls outside the sync window.
+func (s *calendarSync) store(ctx context.Context, e *google.Event) (bool, error) {
+	if e.Status == "cancelled" || e.Start == nil || e.End == nil {
+		return s.delete(ctx, e.ID)
+	}
+	start, ok1 := e.Start.Time(s.loc)
+	end, ok2 := e.End.Time(s.loc)
+	if !ok1 || !ok2 {
+		return false, nil
+	}
+	now := time.Now()
+	if end.Before(now.Add(-s.opt.Past)) || start.After(now.Add(s.opt.Horizon)) {
+		return s.delete(ctx, e.ID)
+	}
+
+	attendees := make([]meetingAttendee, 0, len(e.Attendees))
+	for _, a := range e.Attendees {
+		if a.Resource {
+			continue
+		}
+		attendees = append(attendees, meetingAttendee{
+			Email:          strings.ToLower(a.Email),
+			Name:           a.DisplayName,
+			ResponseStatus: a.ResponseStatus,
+			Organizer:      a.Organizer,
+			Self:           a.Self,
+			Optional:       a.Optional,
+		})
+	}
+	attJSON, _ := json.Marshal(attendees)
+	var organizer string
+	if e.Organizer != nil {
+		organizer = strings.ToLower(e.Organizer.Email)
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+INSERT INTO meeting (user_id, calendar_id, gcal_event_id, recurring_event_id, title, description,
+                     location, html_link, organizer_email, status, response_status, transparent,
+                     all_day, start_time, end_time, attendees, conference_url, synced_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16::jsonb, $17, now())
+ON CONFLICT (user_id, calendar_id, gcal_event_id) DO UPDATE SET
+  recurring_event_id = EXCLUDED.recurring_event_id,
+  title = EXCLUDED.title,
+  description = EXCLUDED.description,
+  location = EXCLUDED.location,
+  html_link = EXCLUDED.html_link,
+  organizer_email = EXCLUDED.organizer_email,
+  status = EXCLUDED.status,
+  response_status = EXCLUDED.response_status,
+  transparent = EXCLUDED.transparent,
+  all_day = EXCLUDED.all_day,
+  start_time = EXCLUDED.start_time,
+  end_time = EXCLUDED.end_time,
+  attendees = EXCLUDED.attendees,
+  conference_url = EXCLUDED.conference_url,
+  synced_at = now()`,
+		s.userID, s.calendarID, e.ID, nullable(e.RecurringEventID), e.Summary, nullable(e.Description),
+		nullable(e.Location), nullable(e.HTMLLink), nullable(organizer), e.Status, nullable(e.SelfResponse()),
+		e.Transparency == "transparent", e.Start.Date != "", start, end, string(attJSON), nullable(e.ConferenceURL()))
+	if err != nil {
+		return false, fmt.Errorf("store event %s: %w", e.ID, err)
+	}
+	return true, nil
+}
+
+// StoreEvent saves an event just created or changed through the API, such
+// as one the agent booked, without waiting for the next sync.
+func StoreEvent(ctx context.Context, db *sql.DB, userID, calendarID string, e *google.Event) error {
+	s := &calendarSync{db: db, userID: userID, calendarID: calendarID, opt: CalendarOptionsFromEnv()}
+	_, err := s.store(ctx, e)
+	return err
+}
+
+// meetingAttendee is the shape of meeting.attendees entries.
+type meetingAttendee struct {
+	Email          string `json:"email"`
+	Name           string `json:"name,omitempty"`
+	ResponseStatus string `json:"response_status,omitempty"`
+	Organizer      bool   `json:"organizer,omitempty"`
+	Self           bool   `json:"self,omitempty"`
+	Optional       bool   `json:"optional,omitempty"`
+}
+
+// delete removes an event, and every instance of it when it is the parent of
+// a recurring series.
+func (s *calendarSync) delete(ctx context.Context, eventID string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `
+DELETE FROM meeting
+WHERE user_id=$1 AND calendar_id=$2 AND (gcal_event_id=$3 OR recurring_event_id=$3)`,
+		s.userID, s.calendarID, eventID)
+	if err != nil {
+		return false, fmt.Errorf("delete event %s: %w", eventID, err)
+	}
+	affected, _ := res.RowsAffected()
+	return affected > 0, nil
+}
+
+// saveTimeZone records the primary calendar's time zone as the user's, for
+// scheduling. Failing to save it doesn't fail the sync.
+func (s *calendarSync) saveTimeZone(ctx context.Context, tz string) {
+	if _, err := s.db.ExecContext(ctx, `
+UPDATE app_user SET time_zone=$2 WHERE id=$1 AND time_zone IS DISTINCT FROM $2`, s.userID, tz); err != nil {
+		log.Printf("[sync] save time zone for user %s: %v", s.userID, err)
+	}
+}
+
+func (s *calendarSync) saveCursor(ctx context.Context, token string, full bool) error {
+	_, err := s.db.ExecContext(ctx, `
+INSERT INTO calendar_sync_state (user_id, calendar_id, sync_token, last_sync_at, last_full_sync_at)
+VALUES ($1, $2, $3, now(), CASE WHEN $4 THEN now() END)
+ON CONFLICT (user_id, calendar_id) DO UPDATE SET
+  sync_token = EXCLUDED.sync_token,
+  last_sync_at = now(),
+  last_full_sync_at = coalesce(EXCLUDED.last_full_sync_at, calendar_sync_state.last_full_sync_at)`,
+		s.userID, s.calendarID, nullable(token), full)
+	return err
+}
+
+func (s *calendarSync) recordResult(ctx context.Context, syncErr error) {
+	var msg any
+	if syncErr != nil {
+		msg = syncErr.Error()
+	}
+	_, _ = s.db.ExecContext(ctx, `
+INSERT INTO calendar_sync_state (user_id, calendar_id, last_error) VALUES ($1, $2, $3)
+ON CONFLICT (user_id, calendar_id) DO UPDATE SET last_error = EXCLUDED.last_error`,
+		s.userID, s.calendarID, msg)
+}
+
+func nullable(s string) any {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,92 @@
+package sync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"aiagentapi/internal/google"
+	"aiagentapi/internal/google/googletest"
+)
+
+func testEvent(id, title string, start time.Time) google.Event {
+	return google.Event{
+		ID:        id,
+		Summary:   title,
+		Start:     &google.EventDateTime{DateTime: start.Format(time.RFC3339)},
+		End:       &google.EventDateTime{DateTime: start.Add(time.Hour).Format(time.RFC3339)},
+		Attendees: []google.EventAttendee{{Email: "Alice@Example.com"}},
+	}
+}
+
+func TestSyncCalendar(t *testing.T) {
+	srv := googletest.New(t)
+	tomorrow := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+	srv.AddEvent("primary", testEvent("review", "Portfolio review", tomorrow))
+	srv.AddEvent("primary", testEvent("ancient", "Long ago", time.Now().Add(-90*24*time.Hour)))
+	db, mem := openMemDB(t, googletest.RefreshToken)
+	ctx := context.Background()
+	opt := CalendarOptions{CalendarIDs: []string{"primary"}, Past: 30 * 24 * time.Hour, Horizon: 60 * 24 * time.Hour, ResyncEvery: time.Hour}
+
+	n, err := SyncCalendar(ctx, db, srv.Config(), "user-1", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || len(mem.meetings) != 1 || mem.meetings["review"] == nil {
+		t.Fatalf("full sync stored %d: %v; want only the event in the window", n, mem.meetings)
+	}
+	if m := mem.meetings["review"]; m.title != "Portfolio review" || !m.start.Equal(tomorrow) {
+		t.Errorf("meeting = %+v", m)
+	}
+	st := mem.calendars["primary"]
+	if st == nil || st.token == nil || st.lastFull == nil || st.lastError != nil {
+		t.Fatalf("sync state = %+v", st)
+	}
+	if mem.timeZone != srv.TimeZone {
+		t.Errorf("time zone = %q, want %q", mem.timeZone, srv.TimeZone)
+	}
+
+	// Changes since the sync token: a new event and a cancellation.
+	token := st.token
+	srv.AddEvent("primary", testEvent("lunch", "Lunch", tomorrow.Add(3*time.Hour)))
+	cancelled := testEvent("review", "Portfolio review", tomorrow)
+	cancelled.Status = "cancelled"
+	srv.AddEvent("primary", cancelled)
+	if n, err = SyncCalendar(ctx, db, srv.Config(), "user-1", opt); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || mem.meetings["lunch"] == nil || mem.meetings["review"] != nil {
+		t.Errorf("incremental sync applied %d: %v; want lunch added and review removed", n, mem.meetings)
+	}
+	if st.token == token {
+		t.Error("sync token not advanced")
+	}
+}
+
+func TestSyncCalendarExpiredToken(t *testing.T) {
+	srv := googletest.New(t)
+	tomorrow := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+	srv.AddEvent("primary", testEvent("review", "Portfolio review", tomorrow))
+	db, mem := openMemDB(t, googletest.RefreshToken)
+	ctx := context.Background()
+	opt := CalendarOptions{CalendarIDs: []string{"primary"}, Past: 30 * 24 * time.Hour, Horizon: 60 * 24 * time.Hour, ResyncEvery: time.Hour}
+	if _, err := SyncCalendar(ctx, db, srv.Config(), "user-1", opt); err != nil {
+		t.Fatal(err)
+	}
+
+	// A meeting Google no longer has, which only a full sync notices.
+	mem.meetings["ghost"] = &memMeeting{calendarID: "primary", title: "Ghost", start: tomorrow, end: tomorrow.Add(time.Hour), syncedAt: time.Now().Add(-time.Minute)}
+	srv.AddEvent("primary", testEvent("lunch", "Lunch", tomorrow.Add(3*time.Hour)))
+	srv.ExpireSyncTokens("primary")
+
+	n, err := SyncCalendar(ctx, db, srv.Config(), "user-1", opt)
+	if err != nil {
+		t.Fatalf("sync after the token expired: %v", err)
+	}
+	if n != 3 || mem.meetings["review"] == nil || mem.meetings["lunch"] == nil || mem.meetings["ghost"] != nil {
+		t.Errorf("resync applied %d: %v; want both events stored and the ghost removed", n, mem.meetings)
+	}
+	if st := mem.calendars["primary"]; st.lastError != nil || st.token == nil {
+		t.Errorf("sync state = %+v", st)
+	}
+}
@@ -0,0 +1,256 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memDB stands in for Postgres in the sync tests. It keeps the rows of one
+// user and understands only the statements this package and
+// google.Config.ForUser run; anything else fails the statement.
+type memDB struct {
+	refreshToken string
+	timeZone     string
+
+	gmail       *gmailState
+	emails      map[string]*memEmail // by gmail_message_id
+	nextEmailID int64
+
+	calendars map[string]*calendarState // by calendar_id
+	meetings  map[string]*memMeeting    // by gcal_event_id
+}
+
+type gmailState struct {
+	historyID any
+	full      bool
+	lastError any
+}
+
+type memEmail struct {
+	id          int64
+	subject     string
+	labels      string
+	attachments int
+}
+
+type calendarState struct {
+	token     any
+	lastFull  any
+	lastError any
+}
+
+type memMeeting struct {
+	calendarID  string
+	recurringID any
+	title       string
+	start, end  time.Time
+	syncedAt    time.Time
+}
+
+// openMemDB returns a database whose user has the given refresh token.
+func openMemDB(t *testing.T, refreshToken string) (*sql.DB, *memDB) {
+	m := &memDB{
+		refreshToken: refreshToken,
+		emails:       map[string]*memEmail{},
+		calendars:    map[string]*calendarState{},
+		meetings:     map[string]*memMeeting{},
+	}
+	db := sql.OpenDB(memConnector{m})
+	t.Cleanup(func() { db.Close() })
+	return db, m
+}
+
+func (m *memDB) exec(q string, args []any) (int64, error) {
+	switch {
+	case strings.HasPrefix(q, "INSERT INTO gmail_sync_state (user_id, history_id,"):
+		if m.gmail == nil {
+			m.gmail = &gmailState{}
+		}
+		m.gmail.historyID = args[1]
+		m.gmail.full = m.gmail.full || args[2].(bool)
+	case strings.HasPrefix(q, "INSERT INTO gmail_sync_state (user_id, last_error)"):
+		if m.gmail == nil {
+			m.gmail = &gmailState{}
+		}
+		m.gmail.lastError = args[1]
+	case strings.HasPrefix(q, "DELETE FROM email_attachment"):
+		for _, e := range m.emails {
+			if e.id == args[0] {
+				e.attachments = 0
+			}
+		}
+	case strings.HasPrefix(q, "INSERT INTO email_attachment"):
+		for _, e := range m.emails {
+			if e.id == args[0] {
+				e.attachments++
+			}
+		}
+	case strings.HasPrefix(q, "UPDATE email SET labels"):
+		e, ok := m.emails[args[1].(string)]
+		if !ok {
+			return 0, nil
+		}
+		e.labels = args[2].(string)
+	case strings.HasPrefix(q, "DELETE FROM email WHERE"):
+		id := args[1].(string)
+		if _, ok := m.emails[id]; !ok {
+			return 0, nil
+		}
+		delete(m.emails, id)
+	case strings.HasPrefix(q, "UPDATE app_user SET time_zone"):
+		m.timeZone = args[1].(string)
+	case strings.HasPrefix(q, "INSERT INTO meeting"):
+		m.meetings[args[2].(string)] = &memMeeting{
+			calendarID:  args[1].(string),
+			recurringID: args[3],
+			title:       args[4].(string),
+			start:       args[13].(time.Time),
+			end:         args[14].(time.Time),
+			syncedAt:    time.Now(),
+		}
+	case strings.HasPrefix(q, "DELETE FROM meeting WHERE user_id=$1 AND calendar_id=$2 AND synced_at"):
+		var n int64
+		for id, mt := range m.meetings {
+			if mt.calendarID == args[1] && mt.syncedAt.Before(args[2].(time.Time)) && !mt.end.Before(args[3].(time.Time)) {
+				delete(m.meetings, id)
+				n++
+			}
+		}
+		return n, nil
+	case strings.HasPrefix(q, "DELETE FROM meeting WHERE user_id=$1 AND calendar_id=$2 AND (gcal_event_id"):
+		var n int64
+		for id, mt := range m.meetings {
+			if mt.calendarID == args[1] && (id == args[2] || mt.recurringID == args[2]) {
+				delete(m.meetings, id)
+				n++
+			}
+		}
+		return n, nil
+	case strings.HasPrefix(q, "INSERT INTO calendar_sync_state (user_id, calendar_id, sync_token,"):
+		st := m.calendar(args[1].(string))
+		st.token = args[2]
+		if args[3].(bool) {
+			st.lastFull = time.Now()
+		}
+	case strings.HasPrefix(q, "INSERT INTO calendar_sync_state (user_id, calendar_id, last_error)"):
+		m.calendar(args[1].(string)).lastError = args[2]
+	default:
+		return 0, fmt.Errorf("memdb: unexpected statement %q", q)
+	}
+	return 1, nil
+}
+
+func (m *memDB) query(q string, args []any) ([]string, [][]any, error) {
+	switch {
+	case strings.HasPrefix(q, "SELECT google_refresh_token FROM app_user"):
+		return []string{"google_refresh_token"}, [][]any{{m.refreshToken}}, nil
+	case strings.HasPrefix(q, "SELECT history_id FROM gmail_sync_state"):
+		if m.gmail == nil {
+			return []string{"history_id"}, nil, nil
+		}
+		return []string{"history_id"}, [][]any{{m.gmail.historyID}}, nil
+	case strings.HasPrefix(q, "INSERT INTO email "):
+		id := args[1].(string)
+		e, ok := m.emails[id]
+		if !ok {
+			m.nextEmailID++
+			e = &memEmail{id: m.nextEmailID}
+			m.emails[id] = e
+		}
+		e.subject, e.labels = args[5].(string), args[11].(string)
+		return []string{"id"}, [][]any{{e.id}}, nil
+	case strings.HasPrefix(q, "SELECT sync_token, last_full_sync_at FROM calendar_sync_state"):
+		cols := []string{"sync_token", "last_full_sync_at"}
+		st, ok := m.calendars[args[1].(string)]
+		if !ok {
+			return cols, nil, nil
+		}
+		return cols, [][]any{{st.token, st.lastFull}}, nil
+	}
+	return nil, nil, fmt.Errorf("memdb: unexpected query %q", q)
+}
+
+func (m *memDB) calendar(id string) *calendarState {
+	st, ok := m.calendars[id]
+	if !ok {
+		st = &calendarState{}
+		m.calendars[id] = st
+	}
+	return st
+}
+
+type memConnector struct{ db *memDB }
+
+func (c memConnector) Connect(context.Context) (driver.Conn, error) { return memConn(c), nil }
+func (memConnector) Driver() driver.Driver                          { return memDriver{} }
+
+type memDriver struct{}
+
+func (memDriver) Open(string) (driver.Conn, error) { return nil, errors.New("memdb: use sql.OpenDB") }
+
+// memConn runs statements directly; transactions are accepted but not
+// isolated, which the sync code doesn't rely on.
+type memConn struct{ db *memDB }
+
+func (memConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("memdb: prepare unsupported")
+}
+func (memConn) Close() error              { return nil }
+func (memConn) Begin() (driver.Tx, error) { return memTx{}, nil }
+
+func (c memConn) ExecContext(_ context.Context, q string, args []driver.NamedValue) (driver.Result, error) {
+	n, err := c.db.exec(normalizeSQL(q), values(args))
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(n), nil
+}
+
+func (c memConn) QueryContext(_ context.Context, q string, args []driver.NamedValue) (driver.Rows, error) {
+	cols, rows, err := c.db.query(normalizeSQL(q), values(args))
+	if err != nil {
+		return nil, err
+	}
+	return &memRows{cols: cols, rows: rows}, nil
+}
+
+type memTx struct{}
+
+func (memTx) Commit() error   { return nil }
+func (memTx) Rollback() error { return nil }
+
+type memRows struct {
+	cols []string
+	rows [][]any
+}
+
+func (r *memRows) Columns() []string { return r.cols }
+func (r *memRows) Close() error      { return nil }
+
+func (r *memRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	for i, v := range r.rows[0] {
+		dest[i] = v
+	}
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func normalizeSQL(q string) string { return strings.Join(strings.Fields(q), " ") }
+
+func values(args []driver.NamedValue) []any {
+	out := make([]any, len(args))
+	for i, a := range args {
+		out[i] = a.Value
+	}
+	return out
+}
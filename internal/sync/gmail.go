@@ -1 +1,304 @@
-package sync; import "time"; func SyncGmail(userID string, since time.Time) (int, error) { return 0, nil }
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"aiagentapi/internal/google"
+)
+
+// GmailOptions controls the initial backfill; later syncs are incremental.
+type GmailOptions struct {
+	// Backfill is how far back the first sync (or a resync) reaches.
+	Backfill time.Duration
+	// MaxMessages caps how many messages a backfill imports.
+	MaxMessages int
+}
+
+// GmailOptionsFromEnv reads GMAIL_BACKFILL_DAYS (default 30) and
+// GMAIL_BACKFILL_MAX (default 500).
+func GmailOptionsFromEnv() GmailOptions {
+	opt := GmailOptions{Backfill: 30 * 24 * time.Hour, MaxMessages: 500}
+	if v, err := strconv.Atoi(os.Getenv("GMAIL_BACKFILL_DAYS")); err == nil && v > 0 {
+		opt.Backfill = time.Duration(v) * 24 * time.Hour
+	}
+	if v, err := strconv.Atoi(os.Getenv("GMAIL_BACKFILL_MAX")); err == nil && v > 0 {
+		opt.MaxMessages = v
+	}
+	return opt
+}
+
+// ConnectedUsers returns the ids of users that have granted Google access.
+func ConnectedUsers(ctx context.Context, db *sql.DB) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id FROM app_user WHERE coalesce(google_refresh_token, '') <> ''`)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// SyncGmail brings one user's email table up to date. Without a stored
+// history id it backfills recent messages; otherwise it applies the changes
+// reported by history.list, falling back to a backfill when Gmail no longer
+// has history that old. It returns the number of messages added, updated or
+// deleted.
+func SyncGmail(ctx context.Context, db *sql.DB, cfg google.Config, userID string, opt GmailOptions) (int, error) {
+	g, err := cfg.ForUser(ctx, db, userID)
+	if err != nil {
+		return 0, err
+	}
+	s := &gmailSync{db: db, g: g, userID: userID, opt: opt}
+
+	historyID, err := s.cursor(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	if historyID == "" {
+		n, err = s.full(ctx)
+	} else {
+		n, err = s.incremental(ctx, historyID)
+		if google.IsStatus(err, http.StatusNotFound) {
+			log.Printf("[sync] gmail history %s expired for user %s; resyncing", historyID, userID)
+			n, err = s.full(ctx)
+		}
+	}
+	s.recordResult(ctx, err)
+	return n, err
+}
+
+type gmailSync struct {
+	db     *sql.DB
+	g      *google.Client
+	userID string
+	opt    GmailOptions
+}
+
+func (s *gmailSync) cursor(ctx context.Context) (string, error) {
+	var id sql.NullInt64
+	err := s.db.QueryRowContext(ctx, `SELECT history_id FROM gmail_sync_state WHERE user_id=$1`, s.userID).Scan(&id)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("load gmail cursor: %w", err)
+	}
+	if !id.Valid {
+		// No sync yet, or the state row only holds an error.
+		return "", nil
+	}
+	return strconv.FormatInt(id.Int64, 10), nil
+}
+
+func (s *gmailSync) saveCursor(ctx context.Context, historyID string, full bool) error {
+	id, err := strconv.ParseInt(historyID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad history id %q", historyID)
+	}
+	_, err = s.db.ExecContext(ctx, `
+INSERT INTO gmail_sync_state (user_id, history_id, last_sync_at, last_full_sync_at)
+VALUES ($1, $2, now(), CASE WHEN $3 THEN now() END)
+ON CONFLICT (user_id) DO UPDATE SET
+  history_id = EXCLUDED.history_id,
+  last_sync_at = now(),
+  last_full_sync_at = coalesce(EXCLUDED.last_full_sync_at, gmail_sync_state.last_full_sync_at)`, s.userID, id, full)
+	return err
+}
+
+func (s *gmailSync) recordResult(ctx context.Context, syncErr error) {
+	var msg any
+	if syncErr != nil {
+		msg = syncErr.Error()
+	}
+	_, _ = s.db.ExecContext(ctx, `
+INSERT INTO gmail_sync_state (user_id, last_error) VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE SET last_error = EXCLUDED.last_error`, s.userID, msg)
+}
+
+// full imports messages newer than the backfill window. The history id is
+// read before listing so changes made during the backfill are picked up by
+// the next incremental sync.
+func (s *gmailSync) full(ctx context.Context) (int, error) {
+	profile, err := s.g.Profile(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("gmail profile: %w", err)
+	}
+	q := fmt.Sprintf("after:%d", time.Now().Add(-s.opt.Backfill).Unix())
+	n, page := 0, ""
+	for n < s.opt.MaxMessages {
+		list, err := s.g.ListMessages(ctx, q, page, min(100, s.opt.MaxMessages-n))
+		if err != nil {
+			return n, fmt.Errorf("list messages: %w", err)
+		}
+		for _, m := range list.Messages {
+			ok, err := s.importMessage(ctx, m.ID)
+			if err != nil {
+				return n, err
+			}
+			if ok {
+				n++
+			}
+		}
+		if list.NextPageToken == "" {
+			break
+		}
+		page = list.NextPageToken
+	}
+	return n, s.saveCursor(ctx, profile.HistoryID, true)
+}
+
+// incremental applies history records after historyID. Deletions win over
+// additions and label changes reported in the same batch.
+func (s *gmailSync) incremental(ctx context.Context, historyID string) (int, error) {
+	var (
+		added   = map[string]bool{}
+		labeled = map[string]bool{}
+		deleted = map[string]bool{}
+		order   []string
+		latest  = historyID
+		page    string
+	)
+	note := func(set map[string]bool, id string) {
+		if !added[id] && !labeled[id] && !deleted[id] {
+			order = append(order, id)
+		}
+		set[id] = true
+	}
+	for {
+		h, err := s.g.ListHistory(ctx, historyID, page)
+		if err != nil {
+			return 0, err
+		}
+		for _, rec := range h.History {
+			for _, m := range rec.MessagesAdded {
+				note(added, m.Message.ID)
+			}
+			for _, m := range rec.LabelsAdded {
+				note(labeled, m.Message.ID)
+			}
+			for _, m := range rec.LabelsRemoved {
+				note(labeled, m.Message.ID)
+			}
+			for _, m := range rec.MessagesDeleted {
+				note(deleted, m.Message.ID)
+			}
+		}
+		if h.HistoryID != "" {
+			latest = h.HistoryID
+		}
+		if h.NextPageToken == "" {
+			break
+		}
+		page = h.NextPageToken
+	}
+
+	n := 0
+	for _, id := range order {
+		var (
+			changed bool
+			err     error
+		)
+		switch {
+		case deleted[id]:
+			changed, err = s.deleteMessage(ctx, id)
+		case added[id]:
+			changed, err = s.importMessage(ctx, id)
+		default:
+			changed, err = s.updateLabels(ctx, id)
+		}
+		if err != nil {
+			return n, err
+		}
+		if changed {
+			n++
+		}
+	}
+	return n, s.saveCursor(ctx, latest, false)
+}
+
+// importMessage fetches a message and upserts it. Drafts and chats are
+// skipped, and a message deleted before it could be fetched is ignored.
+func (s *gmailSync) importMessage(ctx context.Context, id string) (bool, error) {
+	m, err := s.g.GetMessage(ctx, id, "full")
+	if google.IsStatus(err, http.StatusNotFound) {
+		return s.deleteMessage(ctx, id)
+	}
+	if err != nil {
+		return false, fmt.Errorf("get message %s: %w", id, err)
+	}
+	if m.HasLabel("DRAFT") || m.HasLabel("CHAT") {
+		return false, nil
+	}
+	if _, err := upsertEmail(ctx, s.db, s.userID, m); err != nil {
+		return false, fmt.Errorf("store message %s: %w", id, err)
+	}
+	return true, nil
+}
+
+func (s *gmailSync) updateLabels(ctx context.Context, id string) (bool, error) {
+	m, err := s.g.GetMessage(ctx, id, "minimal")
+	if google.IsStatus(err, http.StatusNotFound) {
+		return s.deleteMessage(ctx, id)
+	}
+	if err != nil {
+		return false, fmt.Errorf("get message %s: %w", id, err)
+	}
+	res, err := s.db.ExecContext(ctx, `
+UPDATE email SET labels=$3, history_id=$4, updated_at=now()
+WHERE user_id=$1 AND gmail_message_id=$2`, s.userID, id, pgTextArray(m.LabelIDs), parseInt(m.HistoryID))
+	if err != nil {
+		return false, fmt.Errorf("update labels %s: %w", id, err)
+	}
+	affected, _ := res.RowsAffected()
+	if affected == 0 {
+		// Not stored yet (e.g. it predates the backfill window): import it.
+		return s.importMessage(ctx, id)
+	}
+	return true, nil
+}
+
+func (s *gmailSync) deleteMessage(ctx context.Context, id string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM email WHERE user_id=$1 AND gmail_message_id=$2`, s.userID, id)
+	if err != nil {
+		return false, fmt.Errorf("delete message %s: %w", id, err)
+	}
+	affected, _ := res.RowsAffected()
+	return affected > 0, nil
+}
+
+func parseInt(s string) any {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+// pgTextArray formats values as a Postgres text[] literal.
+func pgTextArray(values []string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteByte('"')
+		b.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
@@ -0,0 +1,120 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"aiagentapi/internal/google"
+	"aiagentapi/internal/mailparse"
+)
+
+// StoreMessage saves a message fetched with format=full, such as one the
+// agent just sent, without waiting for the next sync. It returns its email.id.
+func StoreMessage(ctx context.Context, db *sql.DB, userID string, m *google.Message) (int64, error) {
+	return upsertEmail(ctx, db, userID, m)
+}
+
+// upsertEmail stores a Gmail message with its attachment metadata and returns
+// its email.id. Changing the body clears chunked_at so the indexer re-chunks
+// and re-embeds it.
+func upsertEmail(ctx context.Context, db *sql.DB, userID string, m *google.Message) (int64, error) {
+	var (
+		sender, subject string
+		recipients      []string
+	)
+	body := mailparse.FromGmail(m.Payload)
+	if m.Payload != nil {
+		sender = mailparse.DecodeHeader(m.Payload.Header("From"))
+		subject = mailparse.DecodeHeader(m.Payload.Header("Subject"))
+		for _, h := range []string{"To", "Cc", "Bcc"} {
+			recipients = append(recipients, mailparse.AddressList(m.Payload.Header(h))...)
+		}
+	}
+	var sentAt any
+	if ms, err := strconv.ParseInt(m.InternalDate, 10, 64); err == nil {
+		sentAt = time.UnixMilli(ms).UTC()
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+INSERT INTO email (user_id, gmail_message_id, thread_id, sender, recipients, subject, snippet,
+                   body_text, body_html, sent_at, history_id, labels, updated_at)
+VALUES ($1, $2, $3, $4, $5::text[], $6, $7, $8, $9, $10, $11, $12::text[], now())
+ON CONFLICT (gmail_message_id) DO UPDATE SET
+  thread_id = EXCLUDED.thread_id,
+  sender = EXCLUDED.sender,
+  recipients = EXCLUDED.recipients,
+  subject = EXCLUDED.subject,
+  snippet = EXCLUDED.snippet,
+  body_text = EXCLUDED.body_text,
+  body_html = EXCLUDED.body_html,
+  sent_at = EXCLUDED.sent_at,
+  history_id = EXCLUDED.history_id,
+  labels = EXCLUDED.labels,
+  updated_at = now(),
+  chunked_at = CASE WHEN email.body_text IS DISTINCT FROM EXCLUDED.body_text
+                      OR email.snippet IS DISTINCT FROM EXCLUDED.snippet
+                    THEN NULL ELSE email.chunked_at END
+WHERE email.user_id = EXCLUDED.user_id
+RETURNING id`,
+		userID, m.ID, m.ThreadID, sender, pgTextArray(recipients), subject, m.Snippet,
+		nullable(body.Text), nullable(body.HTML), sentAt, parseInt(m.HistoryID), pgTextArray(m.LabelIDs)).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("message %s belongs to another user", m.ID)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := storeAttachments(ctx, tx, userID, id, body.Attachments); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// storeAttachments replaces the attachment rows of an email, keeping rows
+// whose part is still present so work done on them (e.g. extracted text)
+// survives a resync.
+func storeAttachments(ctx context.Context, tx *sql.Tx, userID string, emailID int64, atts []mailparse.Attachment) error {
+	parts := make([]string, 0, len(atts))
+	for _, a := range atts {
+		parts = append(parts, a.PartID)
+	}
+	if _, err := tx.ExecContext(ctx, `
+DELETE FROM email_attachment WHERE email_id=$1 AND NOT (part_id = ANY($2::text[]))`,
+		emailID, pgTextArray(parts)); err != nil {
+		return fmt.Errorf("prune attachments: %w", err)
+	}
+	for _, a := range atts {
+		var data any
+		if len(a.Data) > 0 {
+			data = a.Data
+		}
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO email_attachment (email_id, user_id, part_id, filename, mime_type, size_bytes,
+                              gmail_attachment_id, content_id, inline, data)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+ON CONFLICT (email_id, part_id) DO UPDATE SET
+  filename = EXCLUDED.filename,
+  mime_type = EXCLUDED.mime_type,
+  size_bytes = EXCLUDED.size_bytes,
+  gmail_attachment_id = EXCLUDED.gmail_attachment_id,
+  content_id = EXCLUDED.content_id,
+  inline = EXCLUDED.inline,
+  data = EXCLUDED.data,
+  updated_at = now()`,
+			emailID, userID, a.PartID, nullable(a.Filename), a.MimeType, a.Size,
+			nullable(a.AttachmentID), nullable(a.ContentID), a.Inline, data); err != nil {
+			return fmt.Errorf("store attachment %s: %w", a.PartID, err)
+		}
+	}
+	return nil
+}
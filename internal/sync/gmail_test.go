@@ -0,0 +1,133 @@
+package sync
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"aiagentapi/internal/google/googletest"
+)
+
+var testGmailOptions = GmailOptions{Backfill: 30 * 24 * time.Hour, MaxMessages: 50}
+
+func TestSyncGmailBackfill(t *testing.T) {
+	srv := googletest.New(t)
+	recent := srv.AddMail(googletest.Mail{From: "alice@example.com", Subject: "Portfolio review"})
+	withFile := srv.AddMail(googletest.Mail{
+		From:        "bob@example.com",
+		Subject:     "Statement",
+		Attachments: []googletest.Attachment{{Filename: "q3.csv", MimeType: "text/csv", Data: []byte("a,b\n1,2\n")}},
+	})
+	srv.AddMail(googletest.Mail{Subject: "Old news", Date: time.Now().Add(-60 * 24 * time.Hour)})
+	srv.AddMail(googletest.Mail{Subject: "Unsent", Labels: []string{"DRAFT"}})
+	db, mem := openMemDB(t, googletest.RefreshToken)
+
+	n, err := SyncGmail(context.Background(), db, srv.Config(), "user-1", testGmailOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || len(mem.emails) != 2 {
+		t.Fatalf("imported %d, stored %d; want the 2 recent non-draft messages", n, len(mem.emails))
+	}
+	if e := mem.emails[recent.ID]; e == nil || e.subject != "Portfolio review" {
+		t.Errorf("recent message stored as %+v", e)
+	}
+	if e := mem.emails[withFile.ID]; e == nil || e.attachments != 1 {
+		t.Errorf("message with attachment stored as %+v", e)
+	}
+	if mem.gmail.historyID != mustInt(t, srv.HistoryID()) || !mem.gmail.full || mem.gmail.lastError != nil {
+		t.Errorf("sync state = %+v, want history id %s after a full sync", mem.gmail, srv.HistoryID())
+	}
+
+	// MaxMessages caps the backfill.
+	db, mem = openMemDB(t, googletest.RefreshToken)
+	if n, err := SyncGmail(context.Background(), db, srv.Config(), "user-1", GmailOptions{Backfill: testGmailOptions.Backfill, MaxMessages: 1}); err != nil || n != 1 || len(mem.emails) != 1 {
+		t.Errorf("capped backfill imported %d (%v), stored %d; want 1", n, err, len(mem.emails))
+	}
+}
+
+func TestSyncGmailIncremental(t *testing.T) {
+	srv := googletest.New(t)
+	gone := srv.AddMail(googletest.Mail{Subject: "Will be deleted"})
+	kept := srv.AddMail(googletest.Mail{Subject: "Will be starred"})
+	db, mem := openMemDB(t, googletest.RefreshToken)
+	ctx := context.Background()
+	if _, err := SyncGmail(ctx, db, srv.Config(), "user-1", testGmailOptions); err != nil {
+		t.Fatal(err)
+	}
+	backfill := len(srv.Requests())
+
+	added := srv.AddMail(googletest.Mail{Subject: "New"})
+	srv.DeleteMail(gone.ID)
+	if _, err := srv.Config().NewClient(googletest.RefreshToken).ModifyLabels(ctx, kept.ID, []string{"STARRED"}, []string{"UNREAD"}); err != nil {
+		t.Fatal(err)
+	}
+	// Added and deleted between syncs: the deletion wins and it is never fetched.
+	brief := srv.AddMail(googletest.Mail{Subject: "Brief"})
+	srv.DeleteMail(brief.ID)
+
+	n, err := SyncGmail(ctx, db, srv.Config(), "user-1", testGmailOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("applied %d changes, want 3", n)
+	}
+	if _, ok := mem.emails[gone.ID]; ok {
+		t.Error("deleted message still stored")
+	}
+	if mem.emails[added.ID] == nil {
+		t.Error("new message not stored")
+	}
+	if e := mem.emails[kept.ID]; e == nil || !strings.Contains(e.labels, `"STARRED"`) || strings.Contains(e.labels, `"UNREAD"`) {
+		t.Errorf("relabelled message stored as %+v", e)
+	}
+	if mem.gmail.historyID != mustInt(t, srv.HistoryID()) {
+		t.Errorf("history id = %v, want %s", mem.gmail.historyID, srv.HistoryID())
+	}
+	reqs := srv.Requests()[backfill:]
+	if slices.Contains(reqs, "GET /gmail/v1/users/me/messages") {
+		t.Errorf("incremental sync listed messages: %v", reqs)
+	}
+	if slices.Contains(reqs, "GET /gmail/v1/users/me/messages/"+brief.ID) {
+		t.Errorf("incremental sync fetched a deleted message: %v", reqs)
+	}
+}
+
+func TestSyncGmailExpiredHistory(t *testing.T) {
+	srv := googletest.New(t)
+	first := srv.AddMail(googletest.Mail{Subject: "First"})
+	db, mem := openMemDB(t, googletest.RefreshToken)
+	ctx := context.Background()
+	if _, err := SyncGmail(ctx, db, srv.Config(), "user-1", testGmailOptions); err != nil {
+		t.Fatal(err)
+	}
+	mem.gmail.full = false
+
+	second := srv.AddMail(googletest.Mail{Subject: "Second"})
+	srv.ExpireHistory()
+	n, err := SyncGmail(ctx, db, srv.Config(), "user-1", testGmailOptions)
+	if err != nil {
+		t.Fatalf("sync after history expired: %v", err)
+	}
+	if n != 2 || mem.emails[first.ID] == nil || mem.emails[second.ID] == nil {
+		t.Errorf("resync imported %d, stored %d; want both messages", n, len(mem.emails))
+	}
+	if !mem.gmail.full || mem.gmail.historyID != mustInt(t, srv.HistoryID()) || mem.gmail.lastError != nil {
+		t.Errorf("sync state = %+v, want a full sync at %s", mem.gmail, srv.HistoryID())
+	}
+	if !slices.Contains(srv.Requests(), "GET /gmail/v1/users/me/history") {
+		t.Error("history.list was not tried first")
+	}
+}
+
+func mustInt(t *testing.T, s string) any {
+	t.Helper()
+	v := parseInt(s)
+	if v == nil {
+		t.Fatalf("bad history id %q", s)
+	}
+	return v
+}
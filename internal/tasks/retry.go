@@ -0,0 +1,76 @@
+package tasks
+
+import (
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy controls how a failed task is rescheduled.
+type RetryPolicy struct {
+	// MaxAttempts counts the first run; after that many failures the task
+	// is left failed.
+	MaxAttempts int
+	// BaseDelay is the wait before the first retry; it doubles for each
+	// further retry up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Jitter is the fraction of the delay that is randomised, drawing the
+	// wait from [delay*(1-Jitter), delay] so tasks that failed together
+	// don't all retry at once.
+	Jitter float64
+}
+
+// Retry reports whether a task that has now failed attempts times (counting
+// this run) gets another try, and after how long.
+func (p RetryPolicy) Retry(attempts int) (time.Duration, bool) {
+	if attempts >= p.MaxAttempts {
+		return 0, false
+	}
+	return p.backoff(attempts-1, rand.Float64), true
+}
+
+// backoff returns the delay before retry number retry+1; rnd is in [0, 1).
+func (p RetryPolicy) backoff(retry int, rnd func() float64) time.Duration {
+	if retry < 0 {
+		retry = 0
+	}
+	delay := p.BaseDelay
+	for i := 0; i < retry && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	if j := min(max(p.Jitter, 0), 1); j > 0 {
+		delay -= time.Duration(j * rnd() * float64(delay))
+	}
+	return delay
+}
+
+// PermanentError marks a task failure that retrying can't fix, such as a
+// malformed payload or a request the remote API rejected outright.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// Permanent wraps err so the task fails without retries. A nil err stays nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// IsPermanent reports whether err, or an error it wraps, was marked with
+// Permanent.
+func IsPermanent(err error) bool {
+	var p *PermanentError
+	return errors.As(err, &p)
+}
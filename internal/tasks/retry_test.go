@@ -0,0 +1,46 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Minute, MaxDelay: 5 * time.Minute, Jitter: 0.5}
+	low := func() float64 { return 0 }
+	high := func() float64 { return 0.999999 }
+	for retry, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute} {
+		if got := p.backoff(retry, low); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", retry, got, want)
+		}
+		if got := p.backoff(retry, high); got <= want/2 || got > want/2+time.Millisecond {
+			t.Errorf("backoff(%d) with full jitter = %v, want about %v", retry, got, want/2)
+		}
+	}
+
+	if d, ok := p.Retry(1); !ok || d < 30*time.Second || d > time.Minute {
+		t.Errorf("Retry(1) = %v, %v", d, ok)
+	}
+	if _, ok := p.Retry(5); ok {
+		t.Error("Retry(5) retried past MaxAttempts")
+	}
+	if _, ok := (RetryPolicy{MaxAttempts: 1}).Retry(1); ok {
+		t.Error("a single-attempt policy retried")
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	base := errors.New("bad payload")
+	err := fmt.Errorf("send_email: %w", Permanent(base))
+	if !IsPermanent(err) || !errors.Is(err, base) {
+		t.Errorf("IsPermanent(%v) = false or the cause was lost", err)
+	}
+	if err.Error() != "send_email: bad payload" {
+		t.Errorf("message = %q", err.Error())
+	}
+	if IsPermanent(base) || Permanent(nil) != nil {
+		t.Error("unmarked errors must stay transient")
+	}
+}
@@ -0,0 +1,766 @@
+package when
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type parser struct {
+	expr string
+	ref  time.Time
+	loc  *time.Location
+}
+
+// period is a part of the day, as offsets from local midnight.
+type period struct {
+	from, to time.Duration
+	pm       bool
+}
+
+var periods = map[string]period{
+	"morning":   {9 * time.Hour, 12 * time.Hour, false},
+	"lunch":     {12 * time.Hour, 14 * time.Hour, true},
+	"lunchtime": {12 * time.Hour, 14 * time.Hour, true},
+	"afternoon": {12 * time.Hour, 17 * time.Hour, true},
+	"evening":   {17 * time.Hour, 21 * time.Hour, true},
+	"night":     {19 * time.Hour, 23 * time.Hour, true},
+}
+
+// state collects the parts of one expression before they are combined.
+type state struct {
+	days    *Range
+	moment  *time.Time
+	weekday *time.Weekday
+	wdMod   string // "", "this", "next" or "last"
+	clock   *clock
+	period  *period
+	sawAt   bool
+	// bareHour lets a number on its own be an hour ("between 2 and 4pm").
+	bareHour bool
+}
+
+type clock struct {
+	hour, min int
+	meridiem  string // "am", "pm" or "" when not given
+}
+
+func (p *parser) fail(format string, args ...any) error {
+	return &Error{p.expr, fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) resolve(toks []string) (Range, error) {
+	st, err := p.parse(toks, false)
+	if err != nil {
+		return Range{}, err
+	}
+	return p.combine(st, nil)
+}
+
+// parse collects the parts of an expression.
+func (p *parser) parse(toks []string, bareHour bool) (*state, error) {
+	st := &state{bareHour: bareHour}
+	for i := 0; i < len(toks); {
+		tok := toks[i]
+		switch tok {
+		case "at", "@":
+			st.sawAt = true
+			i++
+			continue
+		case "on", "around", "about", "approximately", "sometime", "some", "time", "any", "during", "later", "by":
+			i++
+			continue
+		}
+		n, err := p.match(toks, i, st)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, p.fail("didn't understand %q; try e.g. \"next Tuesday at 3pm\", \"tomorrow afternoon\" or an RFC 3339 time", tok)
+		}
+		i += n
+		st.sawAt = false
+	}
+	return st, nil
+}
+
+// match tries each recogniser at toks[i] and returns how many tokens it used.
+func (p *parser) match(toks []string, i int, st *state) (int, error) {
+	for _, fn := range []func([]string, int, *state) (int, error){
+		p.matchNow,
+		p.matchRelative,
+		p.matchDayWord,
+		p.matchOrdinalWeekday,
+		p.matchModified,
+		p.matchMonthDay,
+		p.matchWeekday,
+		p.matchISODate,
+		p.matchPeriod,
+		p.matchClock,
+	} {
+		n, err := fn(toks, i, st)
+		if err != nil || n > 0 {
+			return n, err
+		}
+	}
+	return 0, nil
+}
+
+func (p *parser) setDays(st *state, r Range) error {
+	if st.days != nil || st.moment != nil {
+		return p.fail("names more than one date")
+	}
+	st.days = &r
+	return nil
+}
+
+func (p *parser) setWeekday(st *state, wd time.Weekday, mod string) error {
+	if st.weekday != nil {
+		return p.fail("names more than one weekday")
+	}
+	st.weekday, st.wdMod = &wd, mod
+	return nil
+}
+
+func (p *parser) day(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, p.loc)
+}
+
+func (p *parser) today() time.Time {
+	return p.day(p.ref.Year(), p.ref.Month(), p.ref.Day())
+}
+
+// days returns the n-day range starting at midnight on t's date.
+func (p *parser) days(t time.Time, n int) Range {
+	start := p.day(t.Year(), t.Month(), t.Day())
+	return Range{Start: start, End: p.day(t.Year(), t.Month(), t.Day()+n)}
+}
+
+func (p *parser) matchNow(toks []string, i int, st *state) (int, error) {
+	n := 0
+	if toks[i] == "right" && i+1 < len(toks) && toks[i+1] == "now" {
+		n = 2
+	} else if toks[i] == "now" || toks[i] == "asap" {
+		n = 1
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	if st.days != nil || st.moment != nil {
+		return 0, p.fail("names more than one date")
+	}
+	t := p.ref
+	st.moment = &t
+	return n, nil
+}
+
+var units = map[string]string{
+	"minute": "minute", "minutes": "minute", "min": "minute", "mins": "minute",
+	"hour": "hour", "hours": "hour", "hr": "hour", "hrs": "hour",
+	"day": "day", "days": "day",
+	"week": "week", "weeks": "week",
+	"month": "month", "months": "month",
+}
+
+// matchRelative handles "in N units", "N units from now" and "in half an
+// hour".
+func (p *parser) matchRelative(toks []string, i int, st *state) (int, error) {
+	j := i
+	in := toks[j] == "in"
+	if in {
+		j++
+	}
+	if in && j+2 < len(toks) && toks[j] == "half" && toks[j+1] == "an" && toks[j+2] == "hour" {
+		return p.applyRelative(st, 30, "minute", j+3-i)
+	}
+	n, used := number(toks, j)
+	if used == 0 || j+used >= len(toks) {
+		return 0, nil
+	}
+	unit, ok := units[toks[j+used]]
+	if !ok {
+		return 0, nil
+	}
+	end := j + used + 1
+	if !in {
+		switch {
+		case end+1 < len(toks) && toks[end] == "from" && toks[end+1] == "now":
+			end += 2
+		case end < len(toks) && (toks[end] == "later" || toks[end] == "hence"):
+			end++
+		default:
+			return 0, nil
+		}
+	}
+	return p.applyRelative(st, n, unit, end-i)
+}
+
+func (p *parser) applyRelative(st *state, n int, unit string, used int) (int, error) {
+	switch unit {
+	case "minute", "hour":
+		if st.days != nil || st.moment != nil {
+			return 0, p.fail("names more than one date")
+		}
+		d := time.Duration(n) * time.Minute
+		if unit == "hour" {
+			d = time.Duration(n) * time.Hour
+		}
+		t := p.ref.Add(d)
+		st.moment = &t
+	case "day":
+		return used, p.setDays(st, p.days(p.today().AddDate(0, 0, n), 1))
+	case "week":
+		return used, p.setDays(st, p.days(p.today().AddDate(0, 0, 7*n), 1))
+	case "month":
+		return used, p.setDays(st, p.days(p.today().AddDate(0, n, 0), 1))
+	}
+	return used, nil
+}
+
+func (p *parser) matchDayWord(toks []string, i int, st *state) (int, error) {
+	today := p.today()
+	switch toks[i] {
+	case "today":
+		return 1, p.setDays(st, p.days(today, 1))
+	case "tonight":
+		ev := periods["evening"]
+		st.period = &ev
+		return 1, p.setDays(st, p.days(today, 1))
+	case "tomorrow", "tmrw", "tmr":
+		return 1, p.setDays(st, p.days(today.AddDate(0, 0, 1), 1))
+	case "yesterday":
+		return 1, p.setDays(st, p.days(today.AddDate(0, 0, -1), 1))
+	case "day":
+		if i+2 < len(toks) && toks[i+1] == "after" && toks[i+2] == "tomorrow" {
+			return 3, p.setDays(st, p.days(today.AddDate(0, 0, 2), 1))
+		}
+	}
+	return 0, nil
+}
+
+// matchModified handles "this", "next", "coming" and "last" before a
+// weekday, week, weekend, month, year or part of the day.
+func (p *parser) matchModified(toks []string, i int, st *state) (int, error) {
+	mod := toks[i]
+	switch mod {
+	case "this", "next", "coming", "last", "past", "upcoming":
+	default:
+		return 0, nil
+	}
+	if i+1 >= len(toks) {
+		return 0, nil
+	}
+	switch mod {
+	case "coming", "upcoming":
+		mod = "this"
+	case "past":
+		mod = "last"
+	}
+	word := toks[i+1]
+	if wd, ok := weekday(word); ok {
+		return 2, p.setWeekday(st, wd, mod)
+	}
+	today := p.today()
+	shift := map[string]int{"this": 0, "next": 1, "last": -1}[mod]
+	switch word {
+	case "week":
+		monday := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+		start := monday.AddDate(0, 0, 7*shift)
+		r := Range{start, start.AddDate(0, 0, 7), false}
+		if shift == 0 {
+			r.Start = today
+		}
+		return 2, p.setDays(st, r)
+	case "weekend":
+		// Saturday of this week, or today when it is already the weekend.
+		sat := today.AddDate(0, 0, (int(time.Saturday)-int(today.Weekday())+7)%7)
+		if today.Weekday() == time.Sunday {
+			sat = today.AddDate(0, 0, -1)
+		}
+		start := sat.AddDate(0, 0, 7*shift)
+		r := Range{start, start.AddDate(0, 0, 2), false}
+		if shift == 0 && today.After(start) {
+			r.Start = today
+		}
+		return 2, p.setDays(st, r)
+	case "month":
+		first := p.day(today.Year(), today.Month()+time.Month(shift), 1)
+		r := Range{first, first.AddDate(0, 1, 0), false}
+		if shift == 0 {
+			r.Start = today
+		}
+		return 2, p.setDays(st, r)
+	case "year":
+		first := p.day(today.Year()+shift, 1, 1)
+		r := Range{first, first.AddDate(1, 0, 0), false}
+		if shift == 0 {
+			r.Start = today
+		}
+		return 2, p.setDays(st, r)
+	}
+	if per, ok := periods[word]; ok && mod == "this" {
+		st.period = &per
+		return 2, p.setDays(st, p.days(today, 1))
+	}
+	return 0, nil
+}
+
+// matchOrdinalWeekday handles "first Monday of December", "last Friday of
+// the month" and "second Tuesday in March 2031".
+func (p *parser) matchOrdinalWeekday(toks []string, i int, st *state) (int, error) {
+	if i+3 >= len(toks) {
+		return 0, nil
+	}
+	nth, ok := ordinals[toks[i]]
+	if !ok || nth > 5 {
+		return 0, nil
+	}
+	wd, ok := weekday(toks[i+1])
+	if !ok || (toks[i+2] != "of" && toks[i+2] != "in") {
+		return 0, nil
+	}
+	j := i + 3
+	var year int
+	var month time.Month
+	yearGiven := false
+	switch {
+	case toks[j] == "month" || (toks[j] == "this" && j+1 < len(toks) && toks[j+1] == "month"):
+		if toks[j] == "this" {
+			j++
+		}
+		year, month, yearGiven = p.ref.Year(), p.ref.Month(), true
+		j++
+	case toks[j] == "next" && j+1 < len(toks) && toks[j+1] == "month":
+		next := p.day(p.ref.Year(), p.ref.Month()+1, 1)
+		year, month, yearGiven = next.Year(), next.Month(), true
+		j += 2
+	default:
+		m, ok := monthName(toks[j])
+		if !ok {
+			return 0, p.fail("%q: expected a month after %q", toks[j], toks[i+2])
+		}
+		month = m
+		j++
+		if y, ok := yearAt(toks, j); ok {
+			year, yearGiven = y, true
+			j++
+		}
+	}
+	find := func(y int) (time.Time, bool) {
+		if nth < 0 {
+			last := p.day(y, month+1, 0)
+			return last.AddDate(0, 0, -((int(last.Weekday()) - int(wd) + 7) % 7)), true
+		}
+		first := p.day(y, month, 1)
+		d := first.AddDate(0, 0, (int(wd)-int(first.Weekday())+7)%7+7*(nth-1))
+		return d, d.Month() == month
+	}
+	if !yearGiven {
+		year = p.ref.Year()
+		if d, ok := find(year); ok && d.Before(p.today()) || !ok && month < p.ref.Month() {
+			year++
+		}
+	}
+	d, ok := find(year)
+	if !ok {
+		return 0, p.fail("there is no %s %s in %s %d", toks[i], wd, month, year)
+	}
+	return j - i, p.setDays(st, p.days(d, 1))
+}
+
+// matchMonthDay handles "December 5", "5th of December 2031", "Dec 5th" and
+// a month on its own ("in March").
+func (p *parser) matchMonthDay(toks []string, i int, st *state) (int, error) {
+	j := i
+	if toks[j] == "in" && j+1 < len(toks) {
+		if _, ok := monthName(toks[j+1]); ok {
+			j++
+		}
+	}
+	if m, ok := monthName(toks[j]); ok {
+		j++
+		if j < len(toks) {
+			if d, ok := dayOfMonth(toks[j], true); ok {
+				j++
+				n, err := p.monthDay(toks, j, m, d, st)
+				return j - i + n, err
+			}
+		}
+		// A month on its own.
+		year, yearGiven := p.ref.Year(), false
+		if y, ok := yearAt(toks, j); ok {
+			year, yearGiven = y, true
+			j++
+		}
+		first := p.day(year, m, 1)
+		if !yearGiven && !first.AddDate(0, 1, 0).After(p.today()) {
+			first = first.AddDate(1, 0, 0)
+		}
+		r := Range{first, first.AddDate(0, 1, 0), false}
+		if r.Start.Before(p.today()) {
+			r.Start = p.today()
+		}
+		return j - i, p.setDays(st, r)
+	}
+	if j != i {
+		return 0, nil
+	}
+	d, ok := dayOfMonth(toks[j], true)
+	if !ok {
+		return 0, nil
+	}
+	j++
+	k := j
+	if k < len(toks) && toks[k] == "of" {
+		k++
+	}
+	if k < len(toks) {
+		if m, ok := monthName(toks[k]); ok {
+			k++
+			n, err := p.monthDay(toks, k, m, d, st)
+			return k - i + n, err
+		}
+	}
+	// "the 5th": the next 5th of a month.
+	if _, ok := ordinalSuffix(toks[i]); !ok {
+		return 0, nil
+	}
+	t := p.today()
+	for k := 0; k < 13; k++ {
+		c := p.day(t.Year(), t.Month()+time.Month(k), d)
+		if c.Day() == d && !c.Before(t) {
+			return j - i, p.setDays(st, p.days(c, 1))
+		}
+	}
+	return 0, p.fail("%q is not a day of the month", toks[i])
+}
+
+// monthDay finishes a month and day with an optional year at toks[j],
+// returning the tokens used.
+func (p *parser) monthDay(toks []string, j int, m time.Month, d int, st *state) (int, error) {
+	year, used := p.ref.Year(), 0
+	yearGiven := false
+	if y, ok := yearAt(toks, j); ok {
+		year, used, yearGiven = y, 1, true
+	}
+	t := p.day(year, m, d)
+	if t.Month() != m && (yearGiven || d > 29 || m != time.February) {
+		return 0, p.fail("%s has no day %d", m, d)
+	}
+	// Without a year the date is the next one, which for 29 February may be
+	// a few years off.
+	for y := year + 1; !yearGiven && (t.Before(p.today()) || t.Month() != m); y++ {
+		t = p.day(y, m, d)
+	}
+	return used, p.setDays(st, p.days(t, 1))
+}
+
+func (p *parser) matchWeekday(toks []string, i int, st *state) (int, error) {
+	wd, ok := weekday(toks[i])
+	if !ok {
+		return 0, nil
+	}
+	// "Tuesday next week".
+	if i+2 < len(toks) && (toks[i+1] == "next" || toks[i+1] == "this") && toks[i+2] == "week" {
+		if err := p.setWeekday(st, wd, ""); err != nil {
+			return 0, err
+		}
+		n, err := p.matchModified(toks, i+1, st)
+		return 1 + n, err
+	}
+	return 1, p.setWeekday(st, wd, "")
+}
+
+var isoDateRE = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+func (p *parser) matchISODate(toks []string, i int, st *state) (int, error) {
+	if !isoDateRE.MatchString(toks[i]) {
+		return 0, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", toks[i], p.loc)
+	if err != nil {
+		return 0, p.fail("%q is not a valid date", toks[i])
+	}
+	return 1, p.setDays(st, p.days(t, 1))
+}
+
+func (p *parser) matchPeriod(toks []string, i int, st *state) (int, error) {
+	j := i
+	if toks[j] == "in" && j+1 < len(toks) {
+		j++
+	}
+	per, ok := periods[toks[j]]
+	if !ok {
+		return 0, nil
+	}
+	if st.period != nil {
+		return 0, p.fail("names more than one part of the day")
+	}
+	st.period = &per
+	return j - i + 1, nil
+}
+
+var clockRE = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm|h)?$`)
+
+// matchClock handles "3pm", "3:30 pm", "15:00", "10 o'clock", "noon",
+// "midnight" and "end of day". A bare number is only an hour after "at" or
+// in a range.
+func (p *parser) matchClock(toks []string, i int, st *state) (int, error) {
+	var c clock
+	n := 1
+	switch tok := toks[i]; tok {
+	case "noon", "midday":
+		c = clock{12, 0, "pm"}
+	case "midnight":
+		c = clock{24, 0, "am"}
+	case "eod":
+		c = clock{17, 0, ""}
+	case "end":
+		if i+2 >= len(toks) || toks[i+1] != "of" || (toks[i+2] != "day" && toks[i+2] != "business") {
+			return 0, nil
+		}
+		c, n = clock{17, 0, ""}, 3
+		if i+3 < len(toks) && toks[i+2] == "business" && toks[i+3] == "day" {
+			n = 4
+		}
+	default:
+		m := clockRE.FindStringSubmatch(tok)
+		if m == nil {
+			return 0, nil
+		}
+		c.hour, _ = strconv.Atoi(m[1])
+		if m[2] != "" {
+			c.min, _ = strconv.Atoi(m[2])
+		}
+		c.meridiem = m[3]
+		if c.meridiem == "h" {
+			c.meridiem = ""
+		}
+		if c.meridiem == "" && i+1 < len(toks) {
+			switch toks[i+1] {
+			case "am", "pm":
+				c.meridiem, n = toks[i+1], 2
+			case "o'clock", "oclock":
+				n = 2
+			}
+		}
+		if m[2] == "" && m[3] == "" && n == 1 && !st.sawAt && !st.bareHour {
+			return 0, nil
+		}
+		if c.min > 59 || c.hour > 23 || c.meridiem != "" && (c.hour == 0 || c.hour > 12) {
+			return 0, p.fail("%q is not a valid time of day", strings.Join(toks[i:i+n], " "))
+		}
+	}
+	if st.clock != nil || st.moment != nil {
+		return 0, p.fail("names more than one time of day")
+	}
+	st.clock = &c
+	return n, nil
+}
+
+// combine turns the parts into a range. An expression without a date falls
+// on day when it is given and otherwise on the next day the time is still
+// ahead.
+func (p *parser) combine(st *state, day *Range) (Range, error) {
+	if st.moment != nil {
+		if st.clock != nil || st.period != nil || st.weekday != nil {
+			return Range{}, p.fail("mixes a relative time with a date or time of day")
+		}
+		return Range{*st.moment, *st.moment, true}, nil
+	}
+	if err := p.applyWeekday(st); err != nil {
+		return Range{}, err
+	}
+	days, defaulted := st.days, false
+	if days == nil {
+		if st.clock == nil && st.period == nil {
+			return Range{}, p.fail("no date or time found")
+		}
+		r := p.days(p.today(), 1)
+		if day != nil {
+			r = p.days(day.Start, 1)
+		} else {
+			defaulted = true
+		}
+		days = &r
+	}
+	single := days.Start.AddDate(0, 0, 1).Equal(days.End)
+	if (st.clock != nil || st.period != nil) && !single {
+		return Range{}, p.fail("covers several days; name one day for a time of day")
+	}
+	d := days.Start
+	if st.clock != nil {
+		hour := st.clock.hour
+		switch {
+		case st.clock.meridiem == "pm" && hour < 12:
+			hour += 12
+		case st.clock.meridiem == "am" && hour == 12:
+			hour = 0
+		case st.clock.meridiem == "" && st.period != nil && st.period.pm && hour < 12:
+			hour += 12
+		case st.clock.meridiem == "" && st.period == nil && hour >= 1 && hour <= 6:
+			// Nobody means 3 in the morning for a meeting "at 3".
+			hour += 12
+		}
+		t := time.Date(d.Year(), d.Month(), d.Day(), hour, st.clock.min, 0, 0, p.loc)
+		if defaulted && !t.After(p.ref) {
+			t = time.Date(d.Year(), d.Month(), d.Day()+1, hour, st.clock.min, 0, 0, p.loc)
+		}
+		return Range{t, t, true}, nil
+	}
+	if st.period != nil {
+		at := func(d time.Time, off time.Duration) time.Time {
+			return time.Date(d.Year(), d.Month(), d.Day(), int(off/time.Hour), int(off%time.Hour/time.Minute), 0, 0, p.loc)
+		}
+		r := Range{at(d, st.period.from), at(d, st.period.to), false}
+		if defaulted && !r.End.After(p.ref) {
+			next := d.AddDate(0, 0, 1)
+			r = Range{at(next, st.period.from), at(next, st.period.to), false}
+		}
+		return r, nil
+	}
+	return *days, nil
+}
+
+// applyWeekday resolves a weekday against the other parts: on its own it is
+// the next such day (after today for "next", before it for "last"), within a
+// week or month it picks that day, and with a date it must agree.
+func (p *parser) applyWeekday(st *state) error {
+	if st.weekday == nil {
+		return nil
+	}
+	wd := *st.weekday
+	if st.days == nil {
+		today := p.today()
+		var d time.Time
+		switch st.wdMod {
+		case "next":
+			d = today.AddDate(0, 0, (int(wd)-int(today.Weekday())+6)%7+1)
+		case "last":
+			d = today.AddDate(0, 0, -((int(today.Weekday())-int(wd)+6)%7 + 1))
+		default:
+			d = today.AddDate(0, 0, (int(wd)-int(today.Weekday())+7)%7)
+		}
+		r := p.days(d, 1)
+		st.days = &r
+		return nil
+	}
+	for d := st.days.Start; d.Before(st.days.End); d = d.AddDate(0, 0, 1) {
+		if d.Weekday() == wd {
+			if st.days.Start.AddDate(0, 0, 1).Equal(st.days.End) {
+				return nil
+			}
+			r := p.days(d, 1)
+			st.days = &r
+			return nil
+		}
+	}
+	if st.days.Start.AddDate(0, 0, 1).Equal(st.days.End) {
+		return p.fail("%s is a %s, not a %s", st.days.Start.Format("2 January 2006"), st.days.Start.Weekday(), wd)
+	}
+	return p.fail("there is no %s in that period", wd)
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "tues": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func weekday(w string) (time.Weekday, bool) {
+	wd, ok := weekdayNames[strings.TrimSuffix(w, "s")]
+	if !ok {
+		wd, ok = weekdayNames[w]
+	}
+	return wd, ok
+}
+
+var monthNames = map[string]time.Month{
+	"january": time.January, "february": time.February, "march": time.March, "april": time.April,
+	"may": time.May, "june": time.June, "july": time.July, "august": time.August,
+	"september": time.September, "october": time.October, "november": time.November, "december": time.December,
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April, "jun": time.June,
+	"jul": time.July, "aug": time.August, "sep": time.September, "sept": time.September,
+	"oct": time.October, "nov": time.November, "dec": time.December,
+}
+
+func monthName(w string) (time.Month, bool) {
+	m, ok := monthNames[strings.TrimSuffix(w, ".")]
+	return m, ok
+}
+
+var numbers = map[string]int{
+	"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6,
+	"seven": 7, "eight": 8, "nine": 9, "ten": 10, "eleven": 11, "twelve": 12,
+	"fifteen": 15, "twenty": 20, "thirty": 30, "forty": 40, "forty-five": 45, "fifty": 50,
+	"few": 3,
+}
+
+// number reads a count at toks[i]: digits, a word or "a couple of".
+func number(toks []string, i int) (int, int) {
+	if i >= len(toks) {
+		return 0, 0
+	}
+	if (toks[i] == "a" || toks[i] == "couple") && i+2 < len(toks) {
+		j := i
+		if toks[j] == "a" {
+			j++
+		}
+		if toks[j] == "couple" && toks[j+1] == "of" {
+			return 2, j + 2 - i
+		}
+	}
+	if toks[i] == "a" && i+1 < len(toks) && toks[i+1] == "few" {
+		return 3, 2
+	}
+	if n, err := strconv.Atoi(toks[i]); err == nil && n >= 0 && n < 1000 {
+		return n, 1
+	}
+	if n, ok := numbers[toks[i]]; ok {
+		return n, 1
+	}
+	return 0, 0
+}
+
+var ordinals = map[string]int{
+	"first": 1, "second": 2, "third": 3, "fourth": 4, "fifth": 5, "last": -1,
+	"1st": 1, "2nd": 2, "3rd": 3, "4th": 4, "5th": 5,
+	"sixth": 6, "seventh": 7, "eighth": 8, "ninth": 9, "tenth": 10,
+}
+
+var ordinalRE = regexp.MustCompile(`^(\d{1,2})(st|nd|rd|th)$`)
+
+func ordinalSuffix(w string) (int, bool) {
+	if m := ordinalRE.FindStringSubmatch(w); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		return n, true
+	}
+	if n, ok := ordinals[w]; ok && n > 0 {
+		return n, true
+	}
+	return 0, false
+}
+
+// dayOfMonth reads "5", "5th" or "fifth". Plain numbers count only after a
+// month name.
+func dayOfMonth(w string, plain bool) (int, bool) {
+	if n, ok := ordinalSuffix(w); ok {
+		return n, n >= 1 && n <= 31
+	}
+	if !plain {
+		return 0, false
+	}
+	n, err := strconv.Atoi(w)
+	return n, err == nil && n >= 1 && n <= 31 && len(w) <= 2
+}
+
+func yearAt(toks []string, i int) (int, bool) {
+	if i >= len(toks) || len(toks[i]) != 4 {
+		return 0, false
+	}
+	y, err := strconv.Atoi(toks[i])
+	return y, err == nil && y >= 1970 && y < 2200
+}
@@ -0,0 +1,157 @@
+// Package when resolves the date and time expressions people (and models)
+// use when scheduling, such as "next Tuesday at 3pm", "tomorrow afternoon",
+// "in two days at 10" or "first Monday of December", into concrete ranges
+// relative to a reference time in the user's time zone.
+package when
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Range is a resolved expression: [Start, End) in the user's time zone.
+// When the expression names a time of day ("at 3pm", "in 2 hours") HasTime
+// is set and Start is that moment; End then equals Start.
+type Range struct {
+	Start, End time.Time
+	HasTime    bool
+}
+
+// Error explains why an expression couldn't be resolved, in words a model
+// can act on.
+type Error struct {
+	Expr   string
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("cannot resolve %q: %s", e.Expr, e.Reason)
+}
+
+// Resolve interprets expr relative to ref in loc. Besides natural language it
+// accepts RFC 3339 timestamps and ISO dates ("2030-03-04", "2030-03-04
+// 15:00"). A time of day on its own means the next such time, and a bare
+// weekday or month the next one, today included; "next Tuesday" is the first
+// Tuesday after today. Ranges can be written "from X to Y", "X until Y" or
+// "between X and Y".
+func Resolve(expr string, ref time.Time, loc *time.Location) (Range, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	ref = ref.In(loc)
+	s := strings.TrimSpace(expr)
+	if s == "" {
+		return Range{}, &Error{expr, "empty expression"}
+	}
+	if r, ok := absolute(s, loc); ok {
+		return r, nil
+	}
+	norm := normalize(s)
+	if a, b, ok := splitRange(norm); ok {
+		return resolveRange(expr, a, b, ref, loc)
+	}
+	p := &parser{expr: expr, ref: ref, loc: loc}
+	return p.resolve(tokenize(norm))
+}
+
+// absolute parses the machine formats.
+func absolute(s string, loc *time.Location) (Range, bool) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		t = t.In(loc)
+		return Range{t, t, true}, true
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02T15:04:05", "2006-01-02 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return Range{t, t, true}, true
+		}
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, loc); err == nil {
+		return Range{t, t.AddDate(0, 0, 1), false}, true
+	}
+	return Range{}, false
+}
+
+var (
+	spaceRE     = regexp.MustCompile(`\s+`)
+	meridiemRE  = regexp.MustCompile(`\b(a|p)\.m\.?`)
+	clockDashRE = regexp.MustCompile(`(^|\s)(\d{1,2}(?::\d{2})?(?:am|pm)?)-(\d{1,2}(?::\d{2})?(?:am|pm)?)(\s|$)`)
+)
+
+func normalize(s string) string {
+	s = strings.ToLower(s)
+	s = meridiemRE.ReplaceAllString(s, "${1}m")
+	s = strings.NewReplacer(",", " ", ";", " ", "’", "'", "–", " - ", "—", " - ").Replace(s)
+	s = clockDashRE.ReplaceAllString(s, "$1$2 - $3$4")
+	return strings.TrimSpace(spaceRE.ReplaceAllString(s, " "))
+}
+
+// tokenize splits a normalized expression into words, dropping "the".
+func tokenize(s string) []string {
+	var toks []string
+	for _, w := range strings.Fields(s) {
+		if w != "the" {
+			toks = append(toks, w)
+		}
+	}
+	return toks
+}
+
+// splitRange recognises "between X and Y", "from X to Y", "X to Y",
+// "X until Y" and "X - Y".
+func splitRange(s string) (string, string, bool) {
+	if rest, ok := strings.CutPrefix(s, "between "); ok {
+		if a, b, ok := strings.Cut(rest, " and "); ok {
+			return a, b, true
+		}
+	}
+	s = strings.TrimPrefix(s, "from ")
+	for _, sep := range []string{" until ", " till ", " to ", " - "} {
+		if a, b, ok := strings.Cut(s, sep); ok {
+			return a, b, true
+		}
+	}
+	return "", "", false
+}
+
+// resolveRange joins two expressions. Either side may be a bare hour
+// ("between 2 and 4pm"). A start without a date takes the end's ("between 2
+// and 4pm tomorrow", "from Monday to Friday next week"), and an end without
+// one falls on the start's day ("from Tuesday 2pm to 4pm"). Weekdays in the
+// end count from the start, so "from next Monday to Friday" ends on the
+// Friday after that Monday.
+func resolveRange(expr, a, b string, ref time.Time, loc *time.Location) (Range, error) {
+	p := &parser{expr: expr, ref: ref, loc: loc}
+	sa, err := p.parse(tokenize(a), true)
+	if err != nil {
+		return Range{}, err
+	}
+	sb, err := p.parse(tokenize(b), true)
+	if err != nil {
+		return Range{}, err
+	}
+	if sa.days == nil && sa.moment == nil && sb.days != nil {
+		days := *sb.days
+		sa.days = &days
+	}
+	start, err := p.combine(sa, nil)
+	if err != nil {
+		return Range{}, err
+	}
+	if start.Start.After(ref) {
+		p = &parser{expr: expr, ref: start.Start, loc: loc}
+	}
+	end, err := p.combine(sb, &start)
+	if err != nil {
+		return Range{}, err
+	}
+	r := Range{Start: start.Start, End: end.End}
+	if end.HasTime {
+		r.End = end.Start
+	}
+	if !r.End.After(r.Start) {
+		return Range{}, &Error{expr, "the end is not after the start"}
+	}
+	return r, nil
+}
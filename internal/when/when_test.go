@@ -0,0 +1,107 @@
+package when
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestResolve(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	// Wednesday 16 October 2030, 14:20 in New York.
+	ref := time.Date(2030, 10, 16, 14, 20, 0, 0, ny)
+	at := func(m time.Month, d, h, min int) time.Time { return time.Date(2030, m, d, h, min, 0, 0, ny) }
+	day := func(m time.Month, d int) time.Time { return at(m, d, 0, 0) }
+
+	tests := []struct {
+		expr       string
+		start, end time.Time
+		hasTime    bool
+	}{
+		{"2030-10-20T15:00:00Z", time.Date(2030, 10, 20, 15, 0, 0, 0, time.UTC), time.Date(2030, 10, 20, 15, 0, 0, 0, time.UTC), true},
+		{"2030-10-20", day(10, 20), day(10, 21), false},
+		{"2030-10-20 09:30", at(10, 20, 9, 30), at(10, 20, 9, 30), true},
+		{"today", day(10, 16), day(10, 17), false},
+		{"tomorrow", day(10, 17), day(10, 18), false},
+		{"tomorrow afternoon", at(10, 17, 12, 0), at(10, 17, 17, 0), false},
+		{"Tomorrow at 3pm", at(10, 17, 15, 0), at(10, 17, 15, 0), true},
+		{"3 p.m. tomorrow", at(10, 17, 15, 0), at(10, 17, 15, 0), true},
+		{"this afternoon", at(10, 16, 12, 0), at(10, 16, 17, 0), false},
+		{"morning", at(10, 17, 9, 0), at(10, 17, 12, 0), false},
+		{"at 10", at(10, 17, 10, 0), at(10, 17, 10, 0), true},
+		{"at 3", at(10, 16, 15, 0), at(10, 16, 15, 0), true},
+		{"4:45pm", at(10, 16, 16, 45), at(10, 16, 16, 45), true},
+		{"noon on Friday", at(10, 18, 12, 0), at(10, 18, 12, 0), true},
+		{"in two days at 10", at(10, 18, 10, 0), at(10, 18, 10, 0), true},
+		{"in 3 weeks", day(11, 6), day(11, 7), false},
+		{"in 2 hours", at(10, 16, 16, 20), at(10, 16, 16, 20), true},
+		{"in half an hour", at(10, 16, 14, 50), at(10, 16, 14, 50), true},
+		{"two days from now", day(10, 18), day(10, 19), false},
+		{"day after tomorrow", day(10, 18), day(10, 19), false},
+		{"Wednesday", day(10, 16), day(10, 17), false},
+		{"next Wednesday", day(10, 23), day(10, 24), false},
+		{"next Tuesday at 3pm", at(10, 22, 15, 0), at(10, 22, 15, 0), true},
+		{"Friday morning", at(10, 18, 9, 0), at(10, 18, 12, 0), false},
+		{"last Monday", day(10, 14), day(10, 15), false},
+		{"this week", day(10, 16), day(10, 21), false},
+		{"next week", day(10, 21), day(10, 28), false},
+		{"Tuesday next week", day(10, 22), day(10, 23), false},
+		{"next week on Thursday at 9:30", at(10, 24, 9, 30), at(10, 24, 9, 30), true},
+		{"this weekend", day(10, 19), day(10, 21), false},
+		{"next month", day(11, 1), day(12, 1), false},
+		{"first Monday of December", day(12, 2), day(12, 3), false},
+		{"last Friday of the month", day(10, 25), day(10, 26), false},
+		{"second Tuesday in next month", day(11, 12), day(11, 13), false},
+		{"first Monday of October", time.Date(2031, 10, 6, 0, 0, 0, 0, ny), time.Date(2031, 10, 7, 0, 0, 0, 0, ny), false},
+		{"December 5th at 11am", at(12, 5, 11, 0), at(12, 5, 11, 0), true},
+		{"5 Dec", day(12, 5), day(12, 6), false},
+		{"the 20th", day(10, 20), day(10, 21), false},
+		{"Jan 3", time.Date(2031, 1, 3, 0, 0, 0, 0, ny), time.Date(2031, 1, 4, 0, 0, 0, 0, ny), false},
+		{"march 2031", time.Date(2031, 3, 1, 0, 0, 0, 0, ny), time.Date(2031, 4, 1, 0, 0, 0, 0, ny), false},
+		{"between 2 and 4pm tomorrow", at(10, 17, 14, 0), at(10, 17, 16, 0), false},
+		{"tomorrow 9-11am", at(10, 17, 9, 0), at(10, 17, 11, 0), false},
+		{"from Monday to Friday next week", day(10, 21), day(10, 26), false},
+		{"from next Monday to Friday", day(10, 21), day(10, 26), false},
+		{"tomorrow until end of day", day(10, 17), at(10, 17, 17, 0), false},
+		// The clocks go back on Sunday 3 November 2030; days stay days.
+		{"Sunday 3 November at 9am", at(11, 3, 9, 0), at(11, 3, 9, 0), true},
+	}
+	for _, tt := range tests {
+		r, err := Resolve(tt.expr, ref, ny)
+		if err != nil {
+			t.Errorf("Resolve(%q): %v", tt.expr, err)
+			continue
+		}
+		if !r.Start.Equal(tt.start) || !r.End.Equal(tt.end) || r.HasTime != tt.hasTime {
+			t.Errorf("Resolve(%q) = %v – %v (time %v), want %v – %v (time %v)", tt.expr, r.Start, r.End, r.HasTime, tt.start, tt.end, tt.hasTime)
+		}
+		if r.Start.Location() != ny {
+			t.Errorf("Resolve(%q) in %v, want New York", tt.expr, r.Start.Location())
+		}
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	ref := time.Date(2030, 10, 16, 14, 20, 0, 0, time.UTC)
+	for _, expr := range []string{
+		"",
+		"whenever suits",
+		"next week at 3pm",
+		"25:00",
+		"13pm",
+		"February 30",
+		"fifth Friday of February",
+		"Tuesday 17 October 2030",
+		"tomorrow today",
+		"from 4pm to 2pm",
+	} {
+		_, err := Resolve(expr, ref, time.UTC)
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Errorf("Resolve(%q): err = %v, want *Error", expr, err)
+		}
+	}
+}
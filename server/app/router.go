@@ -68,9 +68,35 @@ func SetupRouter() *gin.Engine {
 	authed.Use(auth.RequireAuth())
 	authed.GET("/", handlers.Home(chatTemplate))
 	authed.POST("/chat", handlers.Chat(db))
+	authed.GET("/chat/stream", handlers.ChatStream(db))
+	authed.POST("/chat/stream", handlers.ChatStream(db))
 	authed.GET("/messages", handlers.Messages(db))
 	authed.POST("/internal/cron/tick", handlers.CronTick(db))
 
+	// Data API: JSON in and out, 401 instead of a redirect when signed out.
+	api := r.Group("/api")
+	api.Use(handlers.APIAuth(db))
+	api.GET("/contacts", handlers.ListContacts(db))
+	api.POST("/contacts", handlers.CreateContact(db))
+	api.GET("/contacts/:id", handlers.GetContact(db))
+	api.PATCH("/contacts/:id", handlers.UpdateContact(db))
+	api.DELETE("/contacts/:id", handlers.DeleteContact(db))
+	api.GET("/contacts/:id/timeline", handlers.ContactTimeline(db))
+	api.GET("/notes", handlers.ListNotes(db))
+	api.POST("/notes", handlers.CreateNote(db))
+	api.GET("/notes/:id", handlers.GetNote(db))
+	api.PATCH("/notes/:id", handlers.UpdateNote(db))
+	api.DELETE("/notes/:id", handlers.DeleteNote(db))
+	api.GET("/meetings", handlers.ListMeetings(db))
+	api.GET("/meetings/:id", handlers.GetMeeting(db))
+	api.GET("/threads", handlers.ListThreads(db))
+	api.POST("/threads", handlers.CreateThread(db))
+	api.GET("/threads/:id", handlers.GetThread(db))
+	api.PATCH("/threads/:id", handlers.UpdateThread(db))
+	api.DELETE("/threads/:id", handlers.DeleteThread(db))
+	api.GET("/tasks/failed", handlers.ListFailedTasks(db))
+	api.POST("/tasks/:id/requeue", handlers.RequeueTask(db))
+
 	return r
 }
 
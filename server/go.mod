@@ -3,6 +3,7 @@ module aiagentapi
 go 1.23
 
 require (
+	aiagentapi/internal v0.0.0
 	github.com/gin-gonic/gin v1.10.0
 	github.com/google/uuid v1.6.0
 	github.com/jackc/pgx/v5 v5.5.4
@@ -43,3 +44,5 @@ require (
 	google.golang.org/protobuf v1.34.1 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace aiagentapi/internal => ../internal
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"aiagentapi/auth"
+	"aiagentapi/storage"
+)
+
+// Error codes of the /api envelope.
+const (
+	codeUnauthenticated = "unauthenticated"
+	codeInvalid         = "invalid_request"
+	codeNotFound        = "not_found"
+	codeConflict        = "conflict"
+	codeInternal        = "internal"
+)
+
+// apiError writes the error envelope shared by the /api routes:
+// {"error": "<message>", "code": "<code>"}. error stays a plain string like
+// the rest of the app's responses, so the chat UI can show it as is.
+func apiError(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, gin.H{"error": message, "code": code})
+}
+
+// storageError maps a storage error onto the envelope: a missing row is a
+// 404 for what, a duplicate a 409, anything else is logged and hidden.
+func storageError(c *gin.Context, err error, what string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		apiError(c, http.StatusNotFound, codeNotFound, what+" not found")
+	case errors.Is(err, storage.ErrConflict):
+		apiError(c, http.StatusConflict, codeConflict, what+" already exists")
+	default:
+		log.Printf("[api] %s %s: %v", c.Request.Method, c.FullPath(), err)
+		apiError(c, http.StatusInternalServerError, codeInternal, "internal error")
+	}
+}
+
+const apiUserKey = "api_user"
+
+// APIAuth resolves the session user for the /api routes. Unlike
+// auth.RequireAuth it answers with a JSON 401 instead of redirecting to the
+// connect page.
+func APIAuth(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := auth.GetCurrentUser(c, db)
+		if err != nil || user == nil {
+			apiError(c, http.StatusUnauthorized, codeUnauthenticated, "not authenticated")
+			return
+		}
+		c.Set(apiUserKey, user)
+		c.Next()
+	}
+}
+
+func apiUser(c *gin.Context) *auth.User {
+	return c.MustGet(apiUserKey).(*auth.User)
+}
+
+// pathID parses the :id route parameter.
+func pathID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		apiError(c, http.StatusBadRequest, codeInvalid, "invalid id")
+		return 0, false
+	}
+	return id, true
+}
+
+// pageQuery reads ?limit= and ?offset=.
+func pageQuery(c *gin.Context) (storage.Page, bool) {
+	var p storage.Page
+	for name, dst := range map[string]*int{"limit": &p.Limit, "offset": &p.Offset} {
+		s := c.Query(name)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			apiError(c, http.StatusBadRequest, codeInvalid, "invalid "+name)
+			return p, false
+		}
+		*dst = n
+	}
+	return p, true
+}
+
+// idQuery reads an optional positive integer query parameter.
+func idQuery(c *gin.Context, name string) (*int64, bool) {
+	s := c.Query(name)
+	if s == "" {
+		return nil, true
+	}
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id <= 0 {
+		apiError(c, http.StatusBadRequest, codeInvalid, "invalid "+name)
+		return nil, false
+	}
+	return &id, true
+}
+
+// timeQuery reads an optional RFC 3339 timestamp or YYYY-MM-DD date (UTC
+// midnight) query parameter.
+func timeQuery(c *gin.Context, name string) (*time.Time, bool) {
+	s := strings.TrimSpace(c.Query(name))
+	if s == "" {
+		return nil, true
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return &t, true
+		}
+	}
+	apiError(c, http.StatusBadRequest, codeInvalid, "invalid "+name+": use RFC 3339 or YYYY-MM-DD")
+	return nil, false
+}
+
+// listResponse writes a page of items. next_offset is null on the last page.
+func listResponse[T any](c *gin.Context, items []T, p storage.Page, more bool) {
+	var next *int
+	if more {
+		n := p.Offset + len(items)
+		next = &n
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "offset": p.Offset, "next_offset": next})
+}
@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"aiagentapi/auth"
+	"aiagentapi/storage"
+)
+
+func init() { gin.SetMode(gin.TestMode) }
+
+func TestPageQuery(t *testing.T) {
+	tests := []struct {
+		query  string
+		want   storage.Page
+		status int
+	}{
+		{"", storage.Page{}, 0},
+		{"limit=10&offset=20", storage.Page{Limit: 10, Offset: 20}, 0},
+		{"limit=0", storage.Page{}, 0},
+		{"limit=-1", storage.Page{}, http.StatusBadRequest},
+		{"offset=ten", storage.Page{}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/notes?"+tt.query, nil)
+		p, ok := pageQuery(c)
+		if tt.status != 0 {
+			if ok || w.Code != tt.status || !strings.Contains(w.Body.String(), `"code":"invalid_request"`) {
+				t.Errorf("%q: ok=%v, %d %s; want a %d envelope", tt.query, ok, w.Code, w.Body, tt.status)
+			}
+			continue
+		}
+		if !ok || p != tt.want {
+			t.Errorf("%q: %+v, %v; want %+v", tt.query, p, ok, tt.want)
+		}
+	}
+}
+
+func TestListResponse(t *testing.T) {
+	tests := []struct {
+		page storage.Page
+		n    int
+		more bool
+		want string
+	}{
+		{storage.Page{Limit: 2}, 2, true, `{"items":[0,0],"next_offset":2,"offset":0}`},
+		{storage.Page{Limit: 2, Offset: 4}, 1, false, `{"items":[0],"next_offset":null,"offset":4}`},
+		{storage.Page{}, 0, false, `{"items":[],"next_offset":null,"offset":0}`},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		listResponse(c, make([]int, tt.n), tt.page, tt.more)
+		if got := w.Body.String(); got != tt.want {
+			t.Errorf("%+v, %d items, more=%v: %s, want %s", tt.page, tt.n, tt.more, got, tt.want)
+		}
+	}
+}
+
+// testDB opens TEST_DATABASE_URL, a disposable Postgres with pgvector, and
+// applies the migrations. Tests that need it are skipped without it.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	dir, err := filepath.Abs(filepath.Join("..", "..", "api", "migrations"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MIGRATIONS_DIR", dir)
+	if err := storage.ApplyMigrations(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// testUser creates a user that is deleted, with everything it owns, when
+// the test ends.
+func testUser(t *testing.T, db *sql.DB) string {
+	t.Helper()
+	var id string
+	email := fmt.Sprintf("api-test-%d@example.com", time.Now().UnixNano())
+	if err := db.QueryRow(`INSERT INTO app_user (email) VALUES ($1) RETURNING id`, email).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM app_user WHERE id=$1`, id) })
+	return id
+}
+
+func apiRouter(db *sql.DB) *gin.Engine {
+	r := gin.New()
+	api := r.Group("/api")
+	api.Use(APIAuth(db))
+	api.GET("/contacts", ListContacts(db))
+	api.GET("/contacts/:id", GetContact(db))
+	api.PATCH("/contacts/:id", UpdateContact(db))
+	api.DELETE("/contacts/:id", DeleteContact(db))
+	api.GET("/contacts/:id/timeline", ContactTimeline(db))
+	api.GET("/notes", ListNotes(db))
+	api.POST("/notes", CreateNote(db))
+	api.GET("/notes/:id", GetNote(db))
+	api.PATCH("/notes/:id", UpdateNote(db))
+	api.DELETE("/notes/:id", DeleteNote(db))
+	api.GET("/meetings", ListMeetings(db))
+	api.GET("/meetings/:id", GetMeeting(db))
+	return r
+}
+
+// call makes a request as userID (no session when empty) and returns the
+// status and decoded body.
+func call(t *testing.T, r http.Handler, userID, method, path, body string) (int, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if userID != "" {
+		req.AddCookie(&http.Cookie{Name: auth.SessionCookie, Value: userID})
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var out map[string]any
+	if w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatalf("%s %s: %v: %s", method, path, err, w.Body)
+		}
+	}
+	return w.Code, out
+}
+
+func TestAPIPagination(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	owner := testUser(t, db)
+	start := time.Now().Truncate(time.Hour)
+	for i := 0; i < 3; i++ {
+		email := fmt.Sprintf("client%d@example.com", i)
+		if _, err := storage.CreateContact(ctx, db, owner, storage.ContactInput{Email: &email}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := storage.CreateNote(ctx, db, owner, nil, fmt.Sprintf("note %d", i)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(`INSERT INTO meeting (user_id, calendar_id, gcal_event_id, title, start_time, end_time)
+VALUES ($1, 'primary', $2, $3, $4, $5)`, owner, fmt.Sprintf("evt%d", i), fmt.Sprintf("Meeting %d", i),
+			start.Add(time.Duration(i)*time.Hour), start.Add(time.Duration(i)*time.Hour+30*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := apiRouter(db)
+
+	for _, path := range []string{"/api/contacts", "/api/notes", "/api/meetings"} {
+		seen := map[float64]bool{}
+		for offset, pages := 0.0, 0; ; pages++ {
+			status, body := call(t, r, owner, http.MethodGet, fmt.Sprintf("%s?limit=2&offset=%d", path, int(offset)), "")
+			if status != http.StatusOK {
+				t.Fatalf("%s: %d %v", path, status, body)
+			}
+			items, _ := body["items"].([]any)
+			for _, it := range items {
+				id := it.(map[string]any)["id"].(float64)
+				if seen[id] {
+					t.Errorf("%s: item %v listed twice", path, id)
+				}
+				seen[id] = true
+			}
+			next, more := body["next_offset"].(float64)
+			if pages == 0 && (len(items) != 2 || !more || next != 2) {
+				t.Errorf("%s first page: %d items, next_offset %v", path, len(items), body["next_offset"])
+			}
+			if !more {
+				break
+			}
+			if pages > 3 {
+				t.Fatalf("%s: pagination does not end", path)
+			}
+			offset = next
+		}
+		if len(seen) != 3 {
+			t.Errorf("%s: paged through %d items, want 3", path, len(seen))
+		}
+	}
+
+	if status, body := call(t, r, owner, http.MethodGet, "/api/notes?limit=x", ""); status != http.StatusBadRequest || body["code"] != "invalid_request" {
+		t.Errorf("bad limit: %d %v", status, body)
+	}
+}
+
+func TestAPIOwnership(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	owner, other := testUser(t, db), testUser(t, db)
+	email := "client@example.com"
+	contact, err := storage.CreateContact(ctx, db, owner, storage.ContactInput{Email: &email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	note, err := storage.CreateNote(ctx, db, owner, &contact.ID, "Prefers morning calls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meetingID int64
+	if err := db.QueryRow(`INSERT INTO meeting (user_id, calendar_id, gcal_event_id, title, start_time, end_time)
+VALUES ($1, 'primary', 'evt-own', 'Review', now(), now() + interval '1 hour') RETURNING id`, owner).Scan(&meetingID); err != nil {
+		t.Fatal(err)
+	}
+	r := apiRouter(db)
+
+	if status, body := call(t, r, "", http.MethodGet, "/api/notes", ""); status != http.StatusUnauthorized || body["code"] != "unauthenticated" {
+		t.Errorf("no session: %d %v", status, body)
+	}
+
+	notFound := []struct{ method, path, body string }{
+		{http.MethodGet, fmt.Sprintf("/api/contacts/%d", contact.ID), ""},
+		{http.MethodPatch, fmt.Sprintf("/api/contacts/%d", contact.ID), `{"first_name": "Mallory"}`},
+		{http.MethodDelete, fmt.Sprintf("/api/contacts/%d", contact.ID), ""},
+		{http.MethodGet, fmt.Sprintf("/api/contacts/%d/timeline", contact.ID), ""},
+		{http.MethodGet, fmt.Sprintf("/api/notes/%d", note.ID), ""},
+		{http.MethodPatch, fmt.Sprintf("/api/notes/%d", note.ID), `{"body": "changed"}`},
+		{http.MethodDelete, fmt.Sprintf("/api/notes/%d", note.ID), ""},
+		{http.MethodPost, "/api/notes", fmt.Sprintf(`{"body": "mine", "contact_id": %d}`, contact.ID)},
+		{http.MethodGet, fmt.Sprintf("/api/meetings/%d", meetingID), ""},
+	}
+	for _, tt := range notFound {
+		if status, body := call(t, r, other, tt.method, tt.path, tt.body); status != http.StatusNotFound || body["code"] != "not_found" {
+			t.Errorf("%s %s as another user: %d %v, want 404", tt.method, tt.path, status, body)
+		}
+	}
+	for _, path := range []string{"/api/contacts", "/api/notes", "/api/meetings", fmt.Sprintf("/api/notes?contact_id=%d", contact.ID)} {
+		if status, body := call(t, r, other, http.MethodGet, path, ""); status != http.StatusOK || len(body["items"].([]any)) != 0 {
+			t.Errorf("%s as another user: %d %v, want no items", path, status, body)
+		}
+	}
+
+	// The owner's rows are untouched and still visible to the owner.
+	if status, body := call(t, r, owner, http.MethodGet, fmt.Sprintf("/api/notes/%d", note.ID), ""); status != http.StatusOK || body["body"] != "Prefers morning calls" {
+		t.Errorf("owner's note: %d %v", status, body)
+	}
+	if status, _ := call(t, r, owner, http.MethodGet, fmt.Sprintf("/api/contacts/%d", contact.ID), ""); status != http.StatusOK {
+		t.Errorf("owner's contact: %d", status)
+	}
+	if status, _ := call(t, r, owner, http.MethodGet, fmt.Sprintf("/api/meetings/%d", meetingID), ""); status != http.StatusOK {
+		t.Errorf("owner's meeting: %d", status)
+	}
+}
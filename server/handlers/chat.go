@@ -3,21 +3,30 @@ package handlers
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
-	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	openai "github.com/sashabaranov/go-openai"
 
 	"aiagentapi/auth"
+	"aiagentapi/internal/agent"
+	"aiagentapi/internal/schedule"
 	"aiagentapi/storage"
 )
 
-// Chat handles POST /chat: saves user message, produces assistant reply, and saves it.
+// Chat handles POST /chat: runs the message through the agent, which loads the
+// thread history, calls tools as needed and stores the exchange (including tool
+// calls) in agent_message. With a thread_id the exchange belongs to that
+// thread, which is named after its first exchange; without one it goes to the
+// user's unthreaded conversation.
 func Chat(db *sql.DB) gin.HandlerFunc {
+	ag := newChatAgent(db)
+
 	return func(c *gin.Context) {
 		user, err := auth.GetCurrentUser(c, db)
 		if err != nil || user == nil {
@@ -26,19 +35,14 @@ func Chat(db *sql.DB) gin.HandlerFunc {
 		}
 		userID := user.ID
 
-		var req struct {
-			Message string `json:"message"`
-		}
+		var req chatRequest
 		if err := c.BindJSON(&req); err != nil || strings.TrimSpace(req.Message) == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "message required"})
 			return
 		}
 
 		ctx := c.Request.Context()
-
-		// Save the user's message
-		if _, err := storage.SaveMessage(ctx, db, userID, "user", req.Message); err != nil {
-			// Return the detailed cause to server logs (and UI JSON for debugging)
+		if err := storage.EnsureSchema(db); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error":  "failed to save message",
 				"detail": err.Error(),
@@ -46,43 +50,124 @@ func Chat(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		// RAG-lite: try to pull snippets
-		snips := findSnippets(ctx, db, userID, req.Message, 6)
-
-		sys := "You are an assistant for a financial advisor.\n" +
-			"Use the provided context snippets when relevant.\n" +
-			"If a user asks to act (email, schedule, log note), describe the next steps you will perform."
-
-		userPrompt := buildUserPrompt(req.Message, snips)
-		reply := callLLM(ctx, sys, userPrompt)
+		thread, ok := chatThread(c, db, userID, req.ThreadID)
+		if !ok {
+			return
+		}
 
-		// Save assistant message
-		if _, err := storage.SaveMessage(ctx, db, userID, "assistant", reply); err != nil {
-			c.JSON(http.StatusOK, gin.H{
-				"reply":    reply,
-				"snippets": snips,
-				"warning":  "failed to save assistant message",
-				"detail":   err.Error(),
+		res, err := ag.HandleThread(ctx, userID, thread.ID, req.Message)
+		var out gin.H
+		switch {
+		case errors.Is(err, agent.ErrSaveMessage):
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":  "failed to save message",
+				"detail": err.Error(),
 			})
 			return
+		case errors.Is(err, agent.ErrNotConfigured):
+			out = gin.H{
+				"reply":      notConfiguredReply,
+				"sources":    []agent.ContextDoc{},
+				"tool_calls": []agent.ToolStep{},
+			}
+		case err != nil:
+			out = gin.H{
+				"reply":      fmt.Sprintf("LLM error: %v", err),
+				"sources":    sources(res),
+				"tool_calls": toolSteps(res),
+			}
+		default:
+			out = gin.H{
+				"reply":      strings.TrimSpace(res.Reply),
+				"sources":    sources(res),
+				"tool_calls": toolSteps(res),
+				"message_id": res.MessageID,
+			}
 		}
 
-		c.JSON(http.StatusOK, gin.H{"reply": reply, "snippets": snips})
+		if thread.ID != "" {
+			reply := ""
+			if err == nil {
+				reply = res.Reply
+			}
+			out["thread_id"] = thread.ID
+			out["thread_title"] = finishThread(ctx, ag, db, userID, thread, req.Message, reply)
+		}
+		c.JSON(http.StatusOK, out)
 	}
 }
 
-// Messages (grouped) handles GET /messages and returns groups by day for History tab.
-func Messages(db *sql.DB) gin.HandlerFunc {
-	type item struct {
-		Role      string    `json:"role"`
-		Content   string    `json:"content"`
-		CreatedAt time.Time `json:"created_at"`
+const notConfiguredReply = "I received your message. To enable AI answers, configure a model provider (e.g. set GROQ_API_KEY) in the environment."
+
+type chatRequest struct {
+	Message  string `json:"message"`
+	ThreadID string `json:"thread_id"`
+}
+
+// newChatAgent builds the agent behind /chat and /chat/stream. Dates in
+// calendar tool calls are resolved in the time zone of the user's calendar.
+func newChatAgent(db *sql.DB) *agent.Agent {
+	return agent.New(agent.Config{
+		Tools:        newChatTools(db),
+		Memory:       agent.PostgresMemory{DB: db},
+		ContextLimit: 6,
+		Location: func(ctx context.Context, userID string) *time.Location {
+			return schedule.UserLocation(ctx, db, userID, schedule.OptionsFromEnv().Location)
+		},
+	})
+}
+
+// chatThread resolves the thread_id of a chat request. Without one the
+// returned thread is the zero Thread, meaning the unthreaded conversation.
+func chatThread(c *gin.Context, db *sql.DB, userID, threadID string) (*storage.Thread, bool) {
+	if strings.TrimSpace(threadID) == "" {
+		return &storage.Thread{}, true
 	}
-	type group struct {
-		Date  string `json:"date"` // YYYY-MM-DD (user local time not applied here; UTC date)
-		Items []item `json:"items"`
+	return userThread(c, db, userID, strings.TrimSpace(threadID))
+}
+
+// finishThread records activity on a thread after an exchange and names it
+// if this was its first. It returns the thread's title.
+func finishThread(ctx context.Context, ag *agent.Agent, db *sql.DB, userID string, thread *storage.Thread, message, reply string) string {
+	if err := storage.TouchThread(ctx, db, userID, thread.ID); err != nil {
+		log.Printf("[agent] touch thread: %v", err)
+	}
+	if thread.Title != "" {
+		return thread.Title
 	}
+	return nameThread(ctx, ag, db, userID, thread, message, reply)
+}
+
+// sources returns the numbered documents the reply may cite as [n].
+func sources(res *agent.Result) []agent.ContextDoc {
+	if res == nil || res.Sources == nil {
+		return []agent.ContextDoc{}
+	}
+	return res.Sources
+}
+
+func toolSteps(res *agent.Result) []agent.ToolStep {
+	if res == nil || res.Steps == nil {
+		return []agent.ToolStep{}
+	}
+	return res.Steps
+}
+
+type messageItem struct {
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type messageGroup struct {
+	Date  string        `json:"date"` // YYYY-MM-DD (user local time not applied here; UTC date)
+	Items []messageItem `json:"items"`
+}
 
+// Messages (grouped) handles GET /messages and returns groups by day for History tab.
+// With ?thread_id= it returns that thread's messages a page at a time: the
+// newest limit messages, then older ones by passing next_cursor back as cursor.
+func Messages(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		user, err := auth.GetCurrentUser(c, db)
 		if err != nil || user == nil {
@@ -91,142 +176,86 @@ func Messages(db *sql.DB) gin.HandlerFunc {
 		}
 
 		ctx := c.Request.Context()
+		if threadID := strings.TrimSpace(c.Query("thread_id")); threadID != "" {
+			threadMessages(c, db, user.ID, threadID)
+			return
+		}
+
 		msgs, err := storage.ListRecentMessages(ctx, db, user.ID, 20)
 		if err != nil {
 			c.JSON(500, gin.H{"error": "failed to load history"})
 			return
 		}
-
-		// Group by UTC date (you can adapt to user tz if needed)
-		groups := make([]group, 0, 8)
-		var cur group
-		var lastDate string
-
-		for _, m := range msgs {
-			d := m.CreatedAt.UTC().Format("2006-01-02")
-			if d != lastDate {
-				if lastDate != "" {
-					groups = append(groups, cur)
-				}
-				cur = group{Date: d, Items: []item{}}
-				lastDate = d
-			}
-			cur.Items = append(cur.Items, item{
-				Role:      m.Role,
-				Content:   m.Content,
-				CreatedAt: m.CreatedAt,
-			})
-		}
-		if lastDate != "" {
-			groups = append(groups, cur)
-		}
-
-		c.JSON(200, gin.H{"groups": groups, "messages": msgs})
+		c.JSON(200, gin.H{"groups": groupByDay(msgs), "messages": msgs})
 	}
 }
 
-func buildUserPrompt(question string, snips []string) string {
-	var b strings.Builder
-	if len(snips) > 0 {
-		b.WriteString("Context snippets:\n")
-		for i, s := range snips {
-			if i >= 6 {
-				break
-			}
-			b.WriteString("- ")
-			if len(s) > 400 {
-				s = s[:400] + "…"
-			}
-			b.WriteString(s)
-			b.WriteString("\n")
+func threadMessages(c *gin.Context, db *sql.DB, userID, threadID string) {
+	thread, ok := userThread(c, db, userID, threadID)
+	if !ok {
+		return
+	}
+	var before int64
+	if cur := c.Query("cursor"); cur != "" {
+		n, err := strconv.ParseInt(cur, 10, 64)
+		if err != nil || n <= 0 {
+			apiError(c, http.StatusBadRequest, codeInvalid, "invalid cursor")
+			return
 		}
-		b.WriteString("\n")
+		before = n
 	}
-	b.WriteString("User question: ")
-	b.WriteString(question)
-	return b.String()
-}
-
-func callLLM(ctx context.Context, system, user string) string {
-	key := os.Getenv("GROQ_API_KEY")
-	model := os.Getenv("GROQ_MODEL")
-	if model == "" {
-		model = "llama-3.1-8b-instant"
+	limit := 0
+	if l := c.Query("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			apiError(c, http.StatusBadRequest, codeInvalid, "invalid limit")
+			return
+		}
+		limit = n
 	}
 
-	baseURL := strings.TrimSpace(os.Getenv("GROQ_BASE_URL"))
-	if baseURL == "" {
-		baseURL = "https://api.groq.com/openai/v1"
+	msgs, next, err := storage.ThreadMessages(c.Request.Context(), db, userID, thread.ID, before, limit)
+	if err != nil {
+		storageError(c, err, "thread")
+		return
 	}
-
-	if strings.TrimSpace(key) == "" {
-		return "I received your message. To enable AI answers, set GROQ_API_KEY in the environment."
+	var cursor *string
+	if next > 0 {
+		s := strconv.FormatInt(next, 10)
+		cursor = &s
 	}
-
-	cfg := openai.DefaultConfig(key)
-	cfg.BaseURL = baseURL
-	client := openai.NewClientWithConfig(cfg)
-	resp, err := client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-		Model: model,
-		Messages: []openai.ChatCompletionMessage{
-			{Role: openai.ChatMessageRoleSystem, Content: system},
-			{Role: openai.ChatMessageRoleUser, Content: user},
-		},
-		Temperature: 0.2,
+	c.JSON(http.StatusOK, gin.H{
+		"thread":      thread,
+		"groups":      groupByDay(msgs),
+		"messages":    msgs,
+		"next_cursor": cursor,
 	})
-	if err != nil || len(resp.Choices) == 0 {
-		if err != nil {
-			return fmt.Sprintf("LLM error: %v", err)
-		}
-		return "No response from model."
-	}
-	return strings.TrimSpace(resp.Choices[0].Message.Content)
 }
 
-func findSnippets(ctx context.Context, db *sql.DB, userID, q string, limit int) []string {
-	q = strings.TrimSpace(q)
-	if q == "" {
-		return nil
-	}
-
-	type row struct{ S string }
-	snips := make([]string, 0, limit)
+// groupByDay groups chronologically ordered messages by UTC date (you can
+// adapt to user tz if needed).
+func groupByDay(msgs []storage.Message) []messageGroup {
+	groups := make([]messageGroup, 0, 8)
+	var cur messageGroup
+	var lastDate string
 
-	run := func(sqlStr string, args ...any) {
-		if len(snips) >= limit {
-			return
-		}
-		ctx2, cancel := context.WithTimeout(ctx, 2*time.Second)
-		defer cancel()
-		rows, err := db.QueryContext(ctx2, sqlStr, args...)
-		if err != nil {
-			return
-		}
-		defer rows.Close()
-		for rows.Next() {
-			if len(snips) >= limit {
-				break
-			}
-			var r row
-			if err := rows.Scan(&r.S); err == nil && strings.TrimSpace(r.S) != "" {
-				snips = append(snips, r.S)
+	for _, m := range msgs {
+		d := m.CreatedAt.UTC().Format("2006-01-02")
+		if d != lastDate {
+			if lastDate != "" {
+				groups = append(groups, cur)
 			}
+			cur = messageGroup{Date: d, Items: []messageItem{}}
+			lastDate = d
 		}
+		cur.Items = append(cur.Items, messageItem{
+			Role:      m.Role,
+			Content:   m.Content,
+			CreatedAt: m.CreatedAt,
+		})
 	}
-
-	like := "%" + q + "%"
-
-	run(`SELECT subject || ' — ' || left(coalesce(body_text,snippet,''), 300)
-	     FROM email WHERE user_id=$1 AND (subject ILIKE $2 OR snippet ILIKE $2 OR coalesce(body_text,'') ILIKE $2)
-	     ORDER BY sent_at DESC LIMIT 5`, userID, like)
-
-	run(`SELECT left(body, 300) FROM note WHERE user_id=$1 AND body ILIKE $2 ORDER BY created_at DESC LIMIT 5`, userID, like)
-
-	run(`SELECT coalesce(first_name,'') || ' ' || coalesce(last_name,'') || ' — ' || coalesce(email,'')
-	     FROM contact WHERE user_id=$1 AND (email ILIKE $2 OR first_name ILIKE $2 OR last_name ILIKE $2) LIMIT 3`, userID, like)
-
-	if len(snips) > limit {
-		return snips[:limit]
+	if lastDate != "" {
+		groups = append(groups, cur)
 	}
-	return snips
+	return groups
 }
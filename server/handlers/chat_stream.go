@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"aiagentapi/auth"
+	"aiagentapi/internal/agent"
+	"aiagentapi/storage"
+)
+
+// ChatStream handles GET /chat/stream?message=&thread_id= and POST
+// /chat/stream with the /chat body. It runs the same exchange as /chat but
+// answers with Server-Sent Events while it runs:
+//
+//	sources     {"sources": [...]}       context documents, numbered for [n]
+//	token       {"text": "..."}          the next piece of the reply
+//	tool_start  {"tool": {...}}          a tool is about to run
+//	tool_end    {"tool": {...}, "error"} the tool's output or error
+//	done        {"message_id", "reply", "sources", "tool_calls", "thread_id", "thread_title"}
+//	error       {"error": "..."}
+//
+// The stream ends after done or error. When the client disconnects the
+// request context is cancelled, which aborts the model request and any
+// running tool.
+func ChatStream(db *sql.DB) gin.HandlerFunc {
+	ag := newChatAgent(db)
+
+	return func(c *gin.Context) {
+		user, err := auth.GetCurrentUser(c, db)
+		if err != nil || user == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+			return
+		}
+		userID := user.ID
+
+		var req chatRequest
+		if c.Request.Method == http.MethodGet {
+			req.Message, req.ThreadID = c.Query("message"), c.Query("thread_id")
+		} else if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "message required"})
+			return
+		}
+		if strings.TrimSpace(req.Message) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "message required"})
+			return
+		}
+		if err := storage.EnsureSchema(db); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":  "failed to save message",
+				"detail": err.Error(),
+			})
+			return
+		}
+		thread, ok := chatThread(c, db, userID, req.ThreadID)
+		if !ok {
+			return
+		}
+
+		h := c.Writer.Header()
+		h.Set("Content-Type", "text/event-stream")
+		h.Set("Cache-Control", "no-cache")
+		h.Set("Connection", "keep-alive")
+		h.Set("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+		c.Writer.Flush()
+
+		ctx := c.Request.Context()
+		send := func(event string, data any) {
+			if ctx.Err() != nil {
+				return
+			}
+			c.SSEvent(event, data)
+			c.Writer.Flush()
+		}
+
+		res, err := ag.HandleThreadStream(ctx, userID, thread.ID, req.Message, func(ev agent.Event) {
+			send(string(ev.Type), ev)
+		})
+		switch {
+		case errors.Is(err, agent.ErrSaveMessage):
+			send("error", gin.H{"error": "failed to save message", "detail": err.Error()})
+			return
+		case errors.Is(err, agent.ErrNotConfigured):
+			res = &agent.Result{Reply: notConfiguredReply}
+			send(string(agent.EventToken), agent.Event{Text: notConfiguredReply})
+		case ctx.Err() != nil:
+			log.Printf("[agent] stream for %s ended early: %v", userID, context.Cause(ctx))
+			return
+		case err != nil:
+			if thread.ID != "" {
+				finishThread(ctx, ag, db, userID, thread, req.Message, "")
+			}
+			send("error", gin.H{"error": "LLM error: " + err.Error()})
+			return
+		}
+
+		done := gin.H{
+			"message_id": res.MessageID,
+			"reply":      strings.TrimSpace(res.Reply),
+			"sources":    sources(res),
+			"tool_calls": toolSteps(res),
+		}
+		if thread.ID != "" {
+			reply := ""
+			if err == nil {
+				reply = res.Reply
+			}
+			done["thread_id"] = thread.ID
+			done["thread_title"] = finishThread(ctx, ag, db, userID, thread, req.Message, reply)
+		}
+		send("done", done)
+	}
+}
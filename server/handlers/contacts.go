@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"aiagentapi/storage"
+)
+
+// ListContacts handles GET /api/contacts?q=&sort=recent|name&limit=&offset=.
+func ListContacts(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, ok := pageQuery(c)
+		if !ok {
+			return
+		}
+		f := storage.ContactFilter{Query: c.Query("q"), Sort: c.DefaultQuery("sort", "recent")}
+		if f.Sort != "recent" && f.Sort != "name" {
+			apiError(c, http.StatusBadRequest, codeInvalid, "sort must be recent or name")
+			return
+		}
+		items, more, err := storage.ListContacts(c.Request.Context(), db, apiUser(c).ID, f, p)
+		if err != nil {
+			storageError(c, err, "contact")
+			return
+		}
+		listResponse(c, items, p, more)
+	}
+}
+
+// GetContact handles GET /api/contacts/:id.
+func GetContact(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := pathID(c)
+		if !ok {
+			return
+		}
+		contact, err := storage.GetContact(c.Request.Context(), db, apiUser(c).ID, id)
+		if err != nil {
+			storageError(c, err, "contact")
+			return
+		}
+		c.JSON(http.StatusOK, contact)
+	}
+}
+
+// CreateContact handles POST /api/contacts. An email address or a name is
+// required.
+func CreateContact(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		in, ok := contactInput(c)
+		if !ok {
+			return
+		}
+		if deref(in.Email) == "" && deref(in.FirstName) == "" && deref(in.LastName) == "" {
+			apiError(c, http.StatusBadRequest, codeInvalid, "email or name required")
+			return
+		}
+		contact, err := storage.CreateContact(c.Request.Context(), db, apiUser(c).ID, in)
+		if err != nil {
+			storageError(c, err, "contact")
+			return
+		}
+		c.JSON(http.StatusCreated, contact)
+	}
+}
+
+// UpdateContact handles PATCH /api/contacts/:id. Omitted fields are left
+// as they are; metadata is merged into the stored object.
+func UpdateContact(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := pathID(c)
+		if !ok {
+			return
+		}
+		in, ok := contactInput(c)
+		if !ok {
+			return
+		}
+		contact, err := storage.UpdateContact(c.Request.Context(), db, apiUser(c).ID, id, in)
+		if err != nil {
+			storageError(c, err, "contact")
+			return
+		}
+		c.JSON(http.StatusOK, contact)
+	}
+}
+
+// DeleteContact handles DELETE /api/contacts/:id. Notes about the contact
+// are kept.
+func DeleteContact(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := pathID(c)
+		if !ok {
+			return
+		}
+		if err := storage.DeleteContact(c.Request.Context(), db, apiUser(c).ID, id); err != nil {
+			storageError(c, err, "contact")
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// ContactTimeline handles GET /api/contacts/:id/timeline?before=&limit=&offset=:
+// the emails, meetings and notes involving the contact, newest first.
+func ContactTimeline(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := pathID(c)
+		if !ok {
+			return
+		}
+		p, ok := pageQuery(c)
+		if !ok {
+			return
+		}
+		before, ok := timeQuery(c, "before")
+		if !ok {
+			return
+		}
+		items, more, err := storage.ContactTimeline(c.Request.Context(), db, apiUser(c).ID, id, before, p)
+		if err != nil {
+			storageError(c, err, "contact")
+			return
+		}
+		listResponse(c, items, p, more)
+	}
+}
+
+// contactInput decodes and validates a contact request body.
+func contactInput(c *gin.Context) (storage.ContactInput, bool) {
+	var in storage.ContactInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		apiError(c, http.StatusBadRequest, codeInvalid, "invalid JSON body")
+		return in, false
+	}
+	if in.Email != nil {
+		e := strings.TrimSpace(*in.Email)
+		if e != "" {
+			a, err := mail.ParseAddress(e)
+			if err != nil || a.Name != "" || a.Address != e {
+				apiError(c, http.StatusBadRequest, codeInvalid, "invalid email address")
+				return in, false
+			}
+		}
+		in.Email = &e
+	}
+	if len(in.Metadata) > 0 {
+		m := bytes.TrimSpace(in.Metadata)
+		if bytes.Equal(m, []byte("null")) {
+			in.Metadata = nil
+		} else if len(m) == 0 || m[0] != '{' {
+			apiError(c, http.StatusBadRequest, codeInvalid, "metadata must be an object")
+			return in, false
+		}
+	}
+	return in, true
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return strings.TrimSpace(*s)
+}
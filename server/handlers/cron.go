@@ -1,13 +1,24 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"log"
 	"net/http"
 	"os"
+	"time"
+
+	"aiagentapi/internal/sync"
+	"aiagentapi/storage"
 
 	"github.com/gin-gonic/gin"
 )
 
+// syncInterval is the shortest gap between two queued syncs of one kind for a user.
+const syncInterval = 5 * time.Minute
+
+var syncKinds = []string{"sync_gmail", "sync_calendar"}
+
 func CronTick(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Simple token check to protect the endpoint
@@ -16,7 +27,26 @@ func CronTick(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		// No-op placeholder until background tasks are wired up.
-		c.JSON(http.StatusOK, gin.H{"ok": true})
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+		users, err := sync.ConnectedUsers(ctx, db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		enqueued := 0
+		for _, userID := range users {
+			for _, kind := range syncKinds {
+				id, err := storage.EnqueueSync(ctx, db, userID, kind, syncInterval)
+				if err != nil {
+					log.Printf("[cron] enqueue %s for %s: %v", kind, userID, err)
+					continue
+				}
+				if id != 0 {
+					enqueued++
+				}
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true, "enqueued": enqueued})
 	}
 }
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"aiagentapi/storage"
+)
+
+// ListMeetings handles GET /api/meetings?from=&to=&contact_id=&q=&order=asc|desc&limit=&offset=.
+// Meetings are synced from Google Calendar, so the API is read-only.
+func ListMeetings(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, ok := pageQuery(c)
+		if !ok {
+			return
+		}
+		f := storage.MeetingFilter{Query: strings.TrimSpace(c.Query("q"))}
+		switch c.DefaultQuery("order", "desc") {
+		case "asc":
+			f.Ascending = true
+		case "desc":
+		default:
+			apiError(c, http.StatusBadRequest, codeInvalid, "order must be asc or desc")
+			return
+		}
+		if f.From, ok = timeQuery(c, "from"); !ok {
+			return
+		}
+		if f.To, ok = timeQuery(c, "to"); !ok {
+			return
+		}
+		if f.ContactID, ok = idQuery(c, "contact_id"); !ok {
+			return
+		}
+		items, more, err := storage.ListMeetings(c.Request.Context(), db, apiUser(c).ID, f, p)
+		if err != nil {
+			storageError(c, err, "meeting")
+			return
+		}
+		listResponse(c, items, p, more)
+	}
+}
+
+// GetMeeting handles GET /api/meetings/:id.
+func GetMeeting(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := pathID(c)
+		if !ok {
+			return
+		}
+		m, err := storage.GetMeeting(c.Request.Context(), db, apiUser(c).ID, id)
+		if err != nil {
+			storageError(c, err, "meeting")
+			return
+		}
+		c.JSON(http.StatusOK, m)
+	}
+}
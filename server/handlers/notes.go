@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"aiagentapi/storage"
+)
+
+// ListNotes handles GET /api/notes?contact_id=&q=&from=&to=&limit=&offset=.
+func ListNotes(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, ok := pageQuery(c)
+		if !ok {
+			return
+		}
+		f := storage.NoteFilter{Query: strings.TrimSpace(c.Query("q"))}
+		if f.ContactID, ok = idQuery(c, "contact_id"); !ok {
+			return
+		}
+		if f.From, ok = timeQuery(c, "from"); !ok {
+			return
+		}
+		if f.To, ok = timeQuery(c, "to"); !ok {
+			return
+		}
+		items, more, err := storage.ListNotes(c.Request.Context(), db, apiUser(c).ID, f, p)
+		if err != nil {
+			storageError(c, err, "note")
+			return
+		}
+		listResponse(c, items, p, more)
+	}
+}
+
+// GetNote handles GET /api/notes/:id.
+func GetNote(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := pathID(c)
+		if !ok {
+			return
+		}
+		note, err := storage.GetNote(c.Request.Context(), db, apiUser(c).ID, id)
+		if err != nil {
+			storageError(c, err, "note")
+			return
+		}
+		c.JSON(http.StatusOK, note)
+	}
+}
+
+// noteRequest is the body of POST and PATCH /api/notes. ContactID is kept raw
+// so a PATCH can tell an explicit null (detach) from an omitted field.
+type noteRequest struct {
+	Body      *string         `json:"body"`
+	ContactID json.RawMessage `json:"contact_id"`
+}
+
+// contact decodes contact_id; set reports whether the field was present.
+func (r noteRequest) contact() (id *int64, set bool, err error) {
+	if len(r.ContactID) == 0 {
+		return nil, false, nil
+	}
+	if err := json.Unmarshal(r.ContactID, &id); err != nil || (id != nil && *id <= 0) {
+		return nil, true, errors.New("invalid contact_id")
+	}
+	return id, true, nil
+}
+
+// CreateNote handles POST /api/notes with {"body": "...", "contact_id": n}.
+func CreateNote(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req noteRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apiError(c, http.StatusBadRequest, codeInvalid, "invalid JSON body")
+			return
+		}
+		if deref(req.Body) == "" {
+			apiError(c, http.StatusBadRequest, codeInvalid, "body required")
+			return
+		}
+		contactID, _, err := req.contact()
+		if err != nil {
+			apiError(c, http.StatusBadRequest, codeInvalid, err.Error())
+			return
+		}
+		note, err := storage.CreateNote(c.Request.Context(), db, apiUser(c).ID, contactID, strings.TrimSpace(*req.Body))
+		if err != nil {
+			storageError(c, err, "contact")
+			return
+		}
+		c.JSON(http.StatusCreated, note)
+	}
+}
+
+// UpdateNote handles PATCH /api/notes/:id. A null contact_id detaches the
+// note from its contact.
+func UpdateNote(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := pathID(c)
+		if !ok {
+			return
+		}
+		var req noteRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apiError(c, http.StatusBadRequest, codeInvalid, "invalid JSON body")
+			return
+		}
+		if req.Body != nil {
+			body := strings.TrimSpace(*req.Body)
+			if body == "" {
+				apiError(c, http.StatusBadRequest, codeInvalid, "body must not be empty")
+				return
+			}
+			req.Body = &body
+		}
+		contactID, setContact, err := req.contact()
+		if err != nil {
+			apiError(c, http.StatusBadRequest, codeInvalid, err.Error())
+			return
+		}
+
+		ctx := c.Request.Context()
+		userID := apiUser(c).ID
+		if contactID != nil {
+			if _, err := storage.GetContact(ctx, db, userID, *contactID); err != nil {
+				storageError(c, err, "contact")
+				return
+			}
+		}
+		note, err := storage.UpdateNote(ctx, db, userID, id, req.Body, setContact, contactID)
+		if err != nil {
+			storageError(c, err, "note")
+			return
+		}
+		c.JSON(http.StatusOK, note)
+	}
+}
+
+// DeleteNote handles DELETE /api/notes/:id.
+func DeleteNote(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := pathID(c)
+		if !ok {
+			return
+		}
+		if err := storage.DeleteNote(c.Request.Context(), db, apiUser(c).ID, id); err != nil {
+			storageError(c, err, "note")
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"aiagentapi/storage"
+)
+
+// ListFailedTasks handles GET /api/tasks/failed?kind=: the dead-letter list
+// of background tasks that failed permanently or used up their retries.
+func ListFailedTasks(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, ok := pageQuery(c)
+		if !ok {
+			return
+		}
+		kind := strings.TrimSpace(c.Query("kind"))
+		items, more, err := storage.ListFailedTasks(c.Request.Context(), db, apiUser(c).ID, kind, p)
+		if err != nil {
+			storageError(c, err, "task")
+			return
+		}
+		listResponse(c, items, p, more)
+	}
+}
+
+// RequeueTask handles POST /api/tasks/:id/requeue, running a failed task
+// again with its retries reset.
+func RequeueTask(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := pathID(c)
+		if !ok {
+			return
+		}
+		t, err := storage.RequeueTask(c.Request.Context(), db, apiUser(c).ID, id)
+		if errors.Is(err, storage.ErrNotFailed) {
+			apiError(c, http.StatusConflict, codeConflict, "only failed tasks can be requeued")
+			return
+		}
+		if err != nil {
+			storageError(c, err, "task")
+			return
+		}
+		c.JSON(http.StatusOK, t)
+	}
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"aiagentapi/internal/agent"
+	"aiagentapi/storage"
+)
+
+// ListThreads handles GET /api/threads?archived=true&limit=&offset=.
+func ListThreads(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, ok := pageQuery(c)
+		if !ok {
+			return
+		}
+		archived := c.Query("archived") == "true"
+		items, more, err := storage.ListThreads(c.Request.Context(), db, apiUser(c).ID, archived, p)
+		if err != nil {
+			storageError(c, err, "thread")
+			return
+		}
+		listResponse(c, items, p, more)
+	}
+}
+
+// CreateThread handles POST /api/threads. The title is optional; an untitled
+// thread is named after its first exchange.
+func CreateThread(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Title string `json:"title"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			apiError(c, http.StatusBadRequest, codeInvalid, "invalid JSON body")
+			return
+		}
+		t, err := storage.CreateThread(c.Request.Context(), db, apiUser(c).ID, strings.TrimSpace(req.Title))
+		if err != nil {
+			storageError(c, err, "thread")
+			return
+		}
+		c.JSON(http.StatusCreated, t)
+	}
+}
+
+// GetThread handles GET /api/threads/:id.
+func GetThread(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := threadPathID(c)
+		if !ok {
+			return
+		}
+		t, err := storage.GetThread(c.Request.Context(), db, apiUser(c).ID, id)
+		if err != nil {
+			storageError(c, err, "thread")
+			return
+		}
+		c.JSON(http.StatusOK, t)
+	}
+}
+
+// UpdateThread handles PATCH /api/threads/:id with {"title": "..."} to
+// rename and/or {"archived": true|false}.
+func UpdateThread(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := threadPathID(c)
+		if !ok {
+			return
+		}
+		var req struct {
+			Title    *string `json:"title"`
+			Archived *bool   `json:"archived"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apiError(c, http.StatusBadRequest, codeInvalid, "invalid JSON body")
+			return
+		}
+		if req.Title == nil && req.Archived == nil {
+			apiError(c, http.StatusBadRequest, codeInvalid, "title or archived required")
+			return
+		}
+		if req.Title != nil {
+			title := strings.TrimSpace(*req.Title)
+			if title == "" {
+				apiError(c, http.StatusBadRequest, codeInvalid, "title must not be empty")
+				return
+			}
+			req.Title = &title
+		}
+		t, err := storage.UpdateThread(c.Request.Context(), db, apiUser(c).ID, id, req.Title, req.Archived)
+		if err != nil {
+			storageError(c, err, "thread")
+			return
+		}
+		c.JSON(http.StatusOK, t)
+	}
+}
+
+// DeleteThread handles DELETE /api/threads/:id, removing its messages too.
+func DeleteThread(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := threadPathID(c)
+		if !ok {
+			return
+		}
+		if err := storage.DeleteThread(c.Request.Context(), db, apiUser(c).ID, id); err != nil {
+			storageError(c, err, "thread")
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func threadPathID(c *gin.Context) (string, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, codeInvalid, "invalid id")
+		return "", false
+	}
+	return id.String(), true
+}
+
+// userThread loads the thread named by a thread_id field or query parameter,
+// writing the error response when it is malformed or not the user's.
+func userThread(c *gin.Context, db *sql.DB, userID, threadID string) (*storage.Thread, bool) {
+	id, err := uuid.Parse(threadID)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, codeInvalid, "invalid thread_id")
+		return nil, false
+	}
+	t, err := storage.GetThread(c.Request.Context(), db, userID, id.String())
+	if err != nil {
+		storageError(c, err, "thread")
+		return nil, false
+	}
+	return t, true
+}
+
+// nameThread titles a thread after its first exchange: the model suggests a
+// title, and the start of the first message is used when it can't. A title
+// the user set in the meantime is kept. It returns the thread's title.
+func nameThread(ctx context.Context, ag *agent.Agent, db *sql.DB, userID string, t *storage.Thread, message, reply string) string {
+	title := agent.FallbackTitle(message)
+	if reply != "" {
+		tctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		suggested, err := ag.Title(tctx, message, reply)
+		cancel()
+		switch {
+		case err == nil && suggested != "":
+			title = suggested
+		case err != nil && !errors.Is(err, agent.ErrNotConfigured):
+			log.Printf("[agent] thread title: %v", err)
+		}
+	}
+	set, err := storage.SetThreadTitle(ctx, db, userID, t.ID, title)
+	if err != nil {
+		log.Printf("[agent] %v", err)
+		return t.Title
+	}
+	if !set {
+		if cur, err := storage.GetThread(ctx, db, userID, t.ID); err == nil {
+			return cur.Title
+		}
+		return t.Title
+	}
+	return title
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"aiagentapi/internal/agent"
+	"aiagentapi/internal/contacts"
+	"aiagentapi/internal/embedding"
+	"aiagentapi/internal/google"
+	"aiagentapi/internal/mailsend"
+	"aiagentapi/internal/schedule"
+	"aiagentapi/storage"
+)
+
+// chatTools is the agent.Toolset behind /chat. Searches go through
+// agent.PostgresToolset; email and meeting arrangements are queued on the
+// task table and run by the worker, while calendar tools call Google
+// directly so the model sees real availability and event ids.
+type chatTools struct {
+	agent.PostgresToolset
+	db *sql.DB
+}
+
+func newChatTools(db *sql.DB) *chatTools {
+	return &chatTools{
+		PostgresToolset: agent.PostgresToolset{DB: db, Embedder: embedding.NewFromEnv()},
+		db:              db,
+	}
+}
+
+func (t *chatTools) SendEmail(ctx context.Context, userID string, email agent.Email) error {
+	if strings.TrimSpace(email.To+email.Cc+email.Bcc) == "" && email.ThreadID == "" {
+		return fmt.Errorf("gmail_send: recipient required")
+	}
+	for _, list := range []string{email.To, email.Cc, email.Bcc} {
+		if _, err := mailsend.ParseAddresses(list); err != nil {
+			return fmt.Errorf("gmail_send: %w", err)
+		}
+	}
+	payload := mailsend.Email{
+		To:       email.To,
+		Cc:       email.Cc,
+		Bcc:      email.Bcc,
+		Subject:  email.Subject,
+		Body:     email.Text,
+		ThreadID: email.ThreadID,
+		Key:      mailsend.NewKey(),
+	}
+	_, err := storage.Enqueue(ctx, t.db, userID, "send_email", payload, nil, nil)
+	return err
+}
+
+// FindSlots ranks free slots from Calendar freeBusy for the advisor and any
+// attendees whose calendars are visible.
+func (t *chatTools) FindSlots(ctx context.Context, userID string, req agent.SlotRequest) ([]agent.TimeSlot, error) {
+	slots, err := schedule.FindSlots(ctx, t.db, google.ConfigFromEnv(), userID, schedule.Request{
+		From:      req.From,
+		To:        req.To,
+		Duration:  req.Duration,
+		Attendees: req.Attendees,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("calendar_find_slots: %w", err)
+	}
+	out := make([]agent.TimeSlot, len(slots))
+	for i, s := range slots {
+		out[i] = agent.TimeSlot{Start: s.Start, End: s.End}
+	}
+	return out, nil
+}
+
+// CreateEvent books the meeting right away so the reply can refer to it, and
+// returns the Google Calendar event id.
+func (t *chatTools) CreateEvent(ctx context.Context, userID string, event agent.EventRequest) (string, error) {
+	if event.Start.IsZero() {
+		return "", fmt.Errorf("calendar_create_event: start time required")
+	}
+	e := schedule.Event{
+		Title:       event.Title,
+		Description: event.Description,
+		Start:       event.Start,
+		Attendees:   event.Attendees,
+		Conference:  event.Conference,
+	}
+	if event.Duration > 0 {
+		e.End = event.Start.Add(event.Duration)
+	}
+	ev, err := schedule.CreateEvent(ctx, t.db, google.ConfigFromEnv(), userID, e)
+	if err != nil {
+		return "", fmt.Errorf("calendar_create_event: %w", err)
+	}
+	return ev.ID, nil
+}
+
+// ScheduleMeeting resolves the contact and queues a schedule_meeting task,
+// the start of the propose–wait–book workflow. A contact that can't be
+// identified is reported to the model so it can ask for an address.
+func (t *chatTools) ScheduleMeeting(ctx context.Context, userID string, req agent.MeetingRequest) (string, error) {
+	m, err := contacts.Lookup(ctx, t.db, userID, req.Contact)
+	if errors.Is(err, contacts.ErrNotFound) || errors.Is(err, contacts.ErrAmbiguous) {
+		return "error: schedule_meeting: " + err.Error(), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("schedule_meeting: %w", err)
+	}
+	id, err := storage.Enqueue(ctx, t.db, userID, "schedule_meeting", schedule.Proposal{
+		Name:       m.Name,
+		Email:      m.Email,
+		Title:      req.Title,
+		From:       req.From,
+		To:         req.To,
+		Duration:   req.Duration,
+		Conference: req.Conference,
+		Message:    req.Message,
+		Key:        schedule.NewKey(),
+	}, nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("schedule_meeting: %w", err)
+	}
+	return fmt.Sprintf("Proposing times to %s by email (task %d). The meeting is booked and confirmed once they reply.", m.Address(), id), nil
+}
@@ -0,0 +1,338 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"aiagentapi/internal/contacts"
+)
+
+type Contact struct {
+	ID              int64           `json:"id"`
+	Email           string          `json:"email"`
+	FirstName       string          `json:"first_name"`
+	LastName        string          `json:"last_name"`
+	Aliases         []string        `json:"aliases"`
+	Metadata        json.RawMessage `json:"metadata"`
+	LastContactedAt *time.Time      `json:"last_contacted_at"`
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+}
+
+// ContactFilter narrows ListContacts. Query matches names and addresses as a
+// case-insensitive substring; Sort is "recent" (last contacted first, the
+// default) or "name".
+type ContactFilter struct {
+	Query string
+	Sort  string
+}
+
+// ContactInput holds the writable fields of a contact. Nil fields are left
+// unchanged by UpdateContact.
+type ContactInput struct {
+	Email     *string         `json:"email"`
+	FirstName *string         `json:"first_name"`
+	LastName  *string         `json:"last_name"`
+	Metadata  json.RawMessage `json:"metadata"`
+}
+
+const contactColumns = `
+c.id, coalesce(c.email, ''), coalesce(c.first_name, ''), coalesce(c.last_name, ''),
+coalesce(c.metadata, '{}'::jsonb)::text,
+coalesce((SELECT array_to_json(array_agg(a.email ORDER BY a.email)) FROM contact_alias a WHERE a.contact_id = c.id), '[]')::text,
+coalesce(c.created_at, now()), coalesce(c.updated_at, c.created_at, now())`
+
+func scanContact(s interface{ Scan(...any) error }) (Contact, error) {
+	var c Contact
+	var meta, aliases string
+	if err := s.Scan(&c.ID, &c.Email, &c.FirstName, &c.LastName, &meta, &aliases, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return c, err
+	}
+	c.Metadata = json.RawMessage(meta)
+	if err := json.Unmarshal([]byte(aliases), &c.Aliases); err != nil {
+		return c, fmt.Errorf("decode aliases: %w", err)
+	}
+	var m struct {
+		LastContactedAt *time.Time `json:"last_contacted_at"`
+	}
+	if json.Unmarshal(c.Metadata, &m) == nil {
+		c.LastContactedAt = m.LastContactedAt
+	}
+	return c, nil
+}
+
+// ListContacts returns one page of the user's contacts and whether another
+// page follows.
+func ListContacts(ctx context.Context, db *sql.DB, userID string, f ContactFilter, p Page) ([]Contact, bool, error) {
+	p = p.normalized()
+	order := `(c.metadata->>'last_contacted_at')::timestamptz DESC NULLS LAST, c.id DESC`
+	if f.Sort == "name" {
+		order = `lower(coalesce(nullif(c.first_name, ''), nullif(c.last_name, ''), c.email)), c.id`
+	}
+	q := `SELECT ` + contactColumns + `
+FROM contact c
+WHERE c.user_id = $1
+  AND ($2 = '' OR c.email ILIKE '%' || $2 || '%'
+       OR (coalesce(c.first_name, '') || ' ' || coalesce(c.last_name, '')) ILIKE '%' || $2 || '%')
+ORDER BY ` + order + `
+LIMIT $3 OFFSET $4`
+	rows, err := db.QueryContext(ctx, q, userID, escapeLike(f.Query), p.Limit+1, p.Offset)
+	if err != nil {
+		return nil, false, fmt.Errorf("select contacts: %w", err)
+	}
+	defer rows.Close()
+
+	out := []Contact{}
+	for rows.Next() {
+		c, err := scanContact(rows)
+		if err != nil {
+			return nil, false, fmt.Errorf("scan contact: %w", err)
+		}
+		out = append(out, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	out, more := trim(out, p.Limit)
+	return out, more, nil
+}
+
+// GetContact returns sql.ErrNoRows when the contact doesn't exist or
+// belongs to another user.
+func GetContact(ctx context.Context, db *sql.DB, userID string, id int64) (*Contact, error) {
+	c, err := scanContact(db.QueryRowContext(ctx, `SELECT `+contactColumns+`
+FROM contact c WHERE c.user_id = $1 AND c.id = $2`, userID, id))
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// CreateContact adds a contact by hand. It returns ErrConflict when a
+// contact with the same normalized address already exists.
+func CreateContact(ctx context.Context, db *sql.DB, userID string, in ContactInput) (*Contact, error) {
+	email := strings.ToLower(strings.TrimSpace(deref(in.Email)))
+	meta := in.Metadata
+	if len(meta) == 0 {
+		meta = json.RawMessage(`{}`)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+INSERT INTO contact (user_id, email, normalized_email, first_name, last_name, metadata)
+VALUES ($1, $2, $3, $4, $5, $6::jsonb)
+RETURNING id`, userID, nullable(email), nullable(normalize(email)),
+		nullable(deref(in.FirstName)), nullable(deref(in.LastName)), string(meta)).Scan(&id)
+	if isUniqueViolation(err) {
+		return nil, ErrConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("insert contact: %w", err)
+	}
+	if err := addAlias(ctx, tx, userID, id, email); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return GetContact(ctx, db, userID, id)
+}
+
+// UpdateContact changes the fields set in in. Metadata is merged into the
+// existing object, so the interaction counts kept by the contact builder
+// survive edits. A new address is also recorded as an alias.
+func UpdateContact(ctx context.Context, db *sql.DB, userID string, id int64, in ContactInput) (*Contact, error) {
+	var email any
+	var norm any
+	if in.Email != nil {
+		e := strings.ToLower(strings.TrimSpace(*in.Email))
+		email, norm = nullable(e), nullable(normalize(e))
+	}
+	var meta any
+	if len(in.Metadata) > 0 {
+		meta = string(in.Metadata)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+UPDATE contact SET
+  email = CASE WHEN $3 THEN $4 ELSE email END,
+  normalized_email = CASE WHEN $3 THEN $5 ELSE normalized_email END,
+  first_name = CASE WHEN $6 THEN $7 ELSE first_name END,
+  last_name = CASE WHEN $8 THEN $9 ELSE last_name END,
+  metadata = coalesce(metadata, '{}'::jsonb) || coalesce($10::jsonb, '{}'::jsonb),
+  updated_at = now()
+WHERE user_id = $1 AND id = $2`,
+		userID, id,
+		in.Email != nil, email, norm,
+		in.FirstName != nil, nullable(deref(in.FirstName)),
+		in.LastName != nil, nullable(deref(in.LastName)),
+		meta)
+	if isUniqueViolation(err) {
+		return nil, ErrConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update contact: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, sql.ErrNoRows
+	}
+	if in.Email != nil {
+		if err := addAlias(ctx, tx, userID, id, strings.ToLower(strings.TrimSpace(*in.Email))); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return GetContact(ctx, db, userID, id)
+}
+
+// DeleteContact removes a contact and its aliases; its notes are kept but
+// detached.
+func DeleteContact(ctx context.Context, db *sql.DB, userID string, id int64) error {
+	res, err := db.ExecContext(ctx, `DELETE FROM contact WHERE user_id = $1 AND id = $2`, userID, id)
+	if err != nil {
+		return fmt.Errorf("delete contact: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// addAlias points an address at a contact. An address that was an alias of
+// another contact moves over, since it was assigned to this one explicitly.
+func addAlias(ctx context.Context, tx *sql.Tx, userID string, contactID int64, email string) error {
+	if email == "" {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO contact_alias (contact_id, user_id, email) VALUES ($1, $2, $3)
+ON CONFLICT (user_id, email) DO UPDATE SET contact_id = EXCLUDED.contact_id`, contactID, userID, email); err != nil {
+		return fmt.Errorf("store alias %s: %w", email, err)
+	}
+	return nil
+}
+
+// TimelineItem is one entry of a contact's history.
+type TimelineItem struct {
+	Kind    string    `json:"kind"` // email, meeting or note
+	ID      int64     `json:"id"`
+	At      time.Time `json:"at"`
+	Title   string    `json:"title"`
+	Snippet string    `json:"snippet"`
+	Source  string    `json:"source"`
+}
+
+// contactTimelineSQL merges the emails sent to or from any of the contact's
+// addresses, the meetings they attended and the notes about them, newest
+// first. Sender and recipients are stored as "Name <addr>", so the address is
+// pulled out of the angle brackets before comparing.
+const contactTimelineSQL = `
+WITH addr AS (
+  SELECT email FROM contact_alias WHERE contact_id = $2
+  UNION
+  SELECT lower(email) FROM contact WHERE id = $2 AND email IS NOT NULL
+)
+SELECT kind, id, at, title, snippet, source FROM (
+  SELECT 'email' AS kind, e.id, e.sent_at AS at, coalesce(e.subject, '') AS title,
+         left(coalesce(e.snippet, e.body_text, ''), 300) AS snippet,
+         'gmail:' || coalesce(e.gmail_message_id, e.id::text) AS source
+  FROM email e
+  WHERE e.user_id = $1 AND e.sent_at IS NOT NULL
+    AND (lower(trim(coalesce(substring(e.sender from '<([^<>]+)>'), e.sender))) IN (SELECT email FROM addr)
+         OR EXISTS (SELECT 1 FROM unnest(e.recipients) r
+                     WHERE lower(trim(coalesce(substring(r from '<([^<>]+)>'), r))) IN (SELECT email FROM addr)))
+  UNION ALL
+  SELECT 'meeting', m.id, m.start_time, coalesce(m.title, ''),
+         left(coalesce(m.description, m.location, ''), 300),
+         'meeting:' || m.id
+  FROM meeting m
+  WHERE m.user_id = $1 AND m.start_time IS NOT NULL AND jsonb_typeof(m.attendees) = 'array'
+    AND EXISTS (SELECT 1 FROM jsonb_array_elements(m.attendees) a
+                 WHERE lower(a->>'email') IN (SELECT email FROM addr))
+  UNION ALL
+  SELECT 'note', n.id, n.created_at, '', left(coalesce(n.body, ''), 300), 'note:' || n.id
+  FROM note n
+  WHERE n.user_id = $1 AND n.contact_id = $2
+) items
+WHERE $3::timestamptz IS NULL OR at < $3
+ORDER BY at DESC, kind, id DESC
+LIMIT $4 OFFSET $5`
+
+// ContactTimeline returns one page of a contact's history, newest first.
+// When before is set only items older than it are returned. It returns
+// sql.ErrNoRows when the contact isn't the user's.
+func ContactTimeline(ctx context.Context, db *sql.DB, userID string, contactID int64, before *time.Time, p Page) ([]TimelineItem, bool, error) {
+	p = p.normalized()
+	var exists bool
+	if err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM contact WHERE user_id = $1 AND id = $2)`,
+		userID, contactID).Scan(&exists); err != nil {
+		return nil, false, err
+	}
+	if !exists {
+		return nil, false, sql.ErrNoRows
+	}
+
+	rows, err := db.QueryContext(ctx, contactTimelineSQL, userID, contactID, before, p.Limit+1, p.Offset)
+	if err != nil {
+		return nil, false, fmt.Errorf("select timeline: %w", err)
+	}
+	defer rows.Close()
+
+	out := []TimelineItem{}
+	for rows.Next() {
+		var it TimelineItem
+		if err := rows.Scan(&it.Kind, &it.ID, &it.At, &it.Title, &it.Snippet, &it.Source); err != nil {
+			return nil, false, fmt.Errorf("scan timeline: %w", err)
+		}
+		out = append(out, it)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	out, more := trim(out, p.Limit)
+	return out, more, nil
+}
+
+func normalize(email string) string {
+	if email == "" {
+		return ""
+	}
+	return contacts.Normalize(email)
+}
+
+func nullable(s string) any {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	return strings.TrimSpace(s)
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// escapeLike escapes the LIKE wildcards in a user-supplied search string.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.TrimSpace(s))
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type Meeting struct {
+	ID             int64           `json:"id"`
+	CalendarID     string          `json:"calendar_id"`
+	EventID        string          `json:"gcal_event_id"`
+	Title          string          `json:"title"`
+	Description    string          `json:"description"`
+	Location       string          `json:"location"`
+	HTMLLink       string          `json:"html_link"`
+	ConferenceURL  string          `json:"conference_url"`
+	Status         string          `json:"status"`
+	ResponseStatus string          `json:"response_status"`
+	AllDay         bool            `json:"all_day"`
+	Start          *time.Time      `json:"start_time"`
+	End            *time.Time      `json:"end_time"`
+	Attendees      json.RawMessage `json:"attendees"`
+}
+
+// MeetingFilter narrows ListMeetings. From and To select meetings
+// overlapping the range; ContactID keeps meetings attended by one of the
+// contact's addresses; Query is a full-text search over titles. Meetings are
+// listed newest first unless Ascending is set.
+type MeetingFilter struct {
+	From, To  *time.Time
+	ContactID *int64
+	Query     string
+	Ascending bool
+}
+
+const meetingColumns = `m.id, m.calendar_id, coalesce(m.gcal_event_id, ''), coalesce(m.title, ''),
+coalesce(m.description, ''), coalesce(m.location, ''), coalesce(m.html_link, ''),
+coalesce(m.conference_url, ''), coalesce(m.status, ''), coalesce(m.response_status, ''), m.all_day, m.start_time, m.end_time,
+coalesce(m.attendees, '[]'::jsonb)::text`
+
+func scanMeeting(s interface{ Scan(...any) error }) (Meeting, error) {
+	var m Meeting
+	var start, end sql.NullTime
+	var attendees string
+	if err := s.Scan(&m.ID, &m.CalendarID, &m.EventID, &m.Title, &m.Description, &m.Location,
+		&m.HTMLLink, &m.ConferenceURL, &m.Status, &m.ResponseStatus, &m.AllDay, &start, &end, &attendees); err != nil {
+		return m, err
+	}
+	if start.Valid {
+		m.Start = &start.Time
+	}
+	if end.Valid {
+		m.End = &end.Time
+	}
+	m.Attendees = json.RawMessage(attendees)
+	return m, nil
+}
+
+// ListMeetings returns one page of the user's synced meetings and whether
+// another page follows.
+func ListMeetings(ctx context.Context, db *sql.DB, userID string, f MeetingFilter, p Page) ([]Meeting, bool, error) {
+	p = p.normalized()
+	order := "DESC"
+	if f.Ascending {
+		order = "ASC"
+	}
+	rows, err := db.QueryContext(ctx, `SELECT `+meetingColumns+`
+FROM meeting m
+WHERE m.user_id = $1
+  AND ($2::timestamptz IS NULL OR m.end_time > $2)
+  AND ($3::timestamptz IS NULL OR m.start_time < $3)
+  AND ($4 = '' OR m.search_tsv @@ websearch_to_tsquery('english', $4))
+  AND ($5::bigint IS NULL OR (jsonb_typeof(m.attendees) = 'array' AND EXISTS (
+        SELECT 1 FROM jsonb_array_elements(m.attendees) a
+        WHERE lower(a->>'email') IN (
+          SELECT email FROM contact_alias WHERE user_id = $1 AND contact_id = $5
+          UNION
+          SELECT lower(email) FROM contact WHERE user_id = $1 AND id = $5))))
+ORDER BY m.start_time `+order+` NULLS LAST, m.id `+order+`
+LIMIT $6 OFFSET $7`, userID, f.From, f.To, f.Query, f.ContactID, p.Limit+1, p.Offset)
+	if err != nil {
+		return nil, false, fmt.Errorf("select meetings: %w", err)
+	}
+	defer rows.Close()
+
+	out := []Meeting{}
+	for rows.Next() {
+		m, err := scanMeeting(rows)
+		if err != nil {
+			return nil, false, fmt.Errorf("scan meeting: %w", err)
+		}
+		out = append(out, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	out, more := trim(out, p.Limit)
+	return out, more, nil
+}
+
+// GetMeeting returns sql.ErrNoRows when the meeting doesn't exist or belongs
+// to another user.
+func GetMeeting(ctx context.Context, db *sql.DB, userID string, id int64) (*Meeting, error) {
+	m, err := scanMeeting(db.QueryRowContext(ctx, `SELECT `+meetingColumns+`
+FROM meeting m WHERE m.user_id = $1 AND m.id = $2`, userID, id))
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
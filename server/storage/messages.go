@@ -66,6 +66,9 @@ RETURNING id;`
 	return id, nil
 }
 
+// LoadMessages returns the newest messages of the user's original, unthreaded
+// chat; threads are read with ThreadMessages. Like ThreadMessages it skips
+// the tool results and tool-call-only assistant turns of the agent trace.
 func LoadMessages(ctx context.Context, db *sql.DB, userID string, limit int) ([]Message, error) {
 	if err := EnsureSchema(db); err != nil {
 		return nil, fmt.Errorf("ensure schema: %w", err)
@@ -78,7 +81,8 @@ func LoadMessages(ctx context.Context, db *sql.DB, userID string, limit int) ([]
 	const q = `
 SELECT id, role, content, created_at
 FROM agent_message
-WHERE user_id IS NOT DISTINCT FROM $1
+WHERE user_id IS NOT DISTINCT FROM $1 AND thread_id IS NULL
+  AND role IN ('user', 'assistant') AND coalesce(content, '') <> ''
 ORDER BY created_at DESC, id DESC
 LIMIT $2;`
 
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type Note struct {
+	ID        int64     `json:"id"`
+	ContactID *int64    `json:"contact_id"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NoteFilter narrows ListNotes. Query is a full-text search over the body;
+// From and To bound created_at.
+type NoteFilter struct {
+	ContactID *int64
+	Query     string
+	From, To  *time.Time
+}
+
+const noteColumns = `n.id, n.contact_id, coalesce(n.body, ''), n.created_at, coalesce(n.updated_at, n.created_at)`
+
+func scanNote(s interface{ Scan(...any) error }) (Note, error) {
+	var n Note
+	var contactID sql.NullInt64
+	if err := s.Scan(&n.ID, &contactID, &n.Body, &n.CreatedAt, &n.UpdatedAt); err != nil {
+		return n, err
+	}
+	if contactID.Valid {
+		n.ContactID = &contactID.Int64
+	}
+	return n, nil
+}
+
+// ListNotes returns one page of the user's notes, newest first, and whether
+// another page follows.
+func ListNotes(ctx context.Context, db *sql.DB, userID string, f NoteFilter, p Page) ([]Note, bool, error) {
+	p = p.normalized()
+	rows, err := db.QueryContext(ctx, `SELECT `+noteColumns+`
+FROM note n
+WHERE n.user_id = $1
+  AND ($2::bigint IS NULL OR n.contact_id = $2)
+  AND ($3 = '' OR n.search_tsv @@ websearch_to_tsquery('english', $3))
+  AND ($4::timestamptz IS NULL OR n.created_at >= $4)
+  AND ($5::timestamptz IS NULL OR n.created_at < $5)
+ORDER BY n.created_at DESC, n.id DESC
+LIMIT $6 OFFSET $7`, userID, f.ContactID, f.Query, f.From, f.To, p.Limit+1, p.Offset)
+	if err != nil {
+		return nil, false, fmt.Errorf("select notes: %w", err)
+	}
+	defer rows.Close()
+
+	out := []Note{}
+	for rows.Next() {
+		n, err := scanNote(rows)
+		if err != nil {
+			return nil, false, fmt.Errorf("scan note: %w", err)
+		}
+		out = append(out, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	out, more := trim(out, p.Limit)
+	return out, more, nil
+}
+
+// GetNote returns sql.ErrNoRows when the note doesn't exist or belongs to
+// another user.
+func GetNote(ctx context.Context, db *sql.DB, userID string, id int64) (*Note, error) {
+	n, err := scanNote(db.QueryRowContext(ctx, `SELECT `+noteColumns+`
+FROM note n WHERE n.user_id = $1 AND n.id = $2`, userID, id))
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// CreateNote stores a note, optionally about one of the user's contacts. It
+// returns sql.ErrNoRows when contactID isn't the user's.
+func CreateNote(ctx context.Context, db *sql.DB, userID string, contactID *int64, body string) (*Note, error) {
+	n, err := scanNote(db.QueryRowContext(ctx, `
+INSERT INTO note (user_id, contact_id, body)
+SELECT $1::uuid, $2::bigint, $3::text
+WHERE $2::bigint IS NULL OR EXISTS (SELECT 1 FROM contact WHERE user_id = $1 AND id = $2)
+RETURNING id, contact_id, body, created_at, updated_at`, userID, contactID, body))
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// UpdateNote replaces a note's body and, when setContact is true, its
+// contact. The note's embedding is dropped so the indexer computes a new one.
+func UpdateNote(ctx context.Context, db *sql.DB, userID string, id int64, body *string, setContact bool, contactID *int64) (*Note, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	n, err := scanNote(tx.QueryRowContext(ctx, `
+UPDATE note SET
+  body = coalesce($3, body),
+  contact_id = CASE WHEN $4 THEN $5 ELSE contact_id END,
+  updated_at = now()
+WHERE user_id = $1 AND id = $2
+  AND ($5::bigint IS NULL OR EXISTS (SELECT 1 FROM contact WHERE user_id = $1 AND id = $5))
+RETURNING id, contact_id, coalesce(body, ''), created_at, updated_at`, userID, id, body, setContact, contactID))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM note_embedding WHERE note_id = $1`, id); err != nil {
+			return nil, fmt.Errorf("reset note embedding: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+func DeleteNote(ctx context.Context, db *sql.DB, userID string, id int64) error {
+	res, err := db.ExecContext(ctx, `DELETE FROM note WHERE user_id = $1 AND id = $2`, userID, id)
+	if err != nil {
+		return fmt.Errorf("delete note: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrConflict is returned when a write would duplicate an existing row, such
+// as a second contact with the same normalized address.
+var ErrConflict = errors.New("already exists")
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// Page selects a window of a list ordered by the list's natural order.
+type Page struct {
+	Limit  int
+	Offset int
+}
+
+func (p Page) normalized() Page {
+	if p.Limit <= 0 {
+		p.Limit = defaultPageSize
+	}
+	if p.Limit > maxPageSize {
+		p.Limit = maxPageSize
+	}
+	if p.Offset < 0 {
+		p.Offset = 0
+	}
+	return p
+}
+
+// trim drops the extra row fetched to detect a following page and reports
+// whether there was one.
+func trim[T any](items []T, limit int) ([]T, bool) {
+	if len(items) > limit {
+		return items[:limit], true
+	}
+	return items, false
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
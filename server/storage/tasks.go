@@ -4,13 +4,16 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
 )
 
 func Enqueue(ctx context.Context, db *sql.DB, userID string, kind string, payload any, runAt *string, dedupeKey *string) (int64, error) {
 	b, _ := json.Marshal(payload)
 	q := `INSERT INTO task (user_id, kind, status, payload, run_at, dedupe_key)
         VALUES ($1,$2,'pending',$3, $4, $5)
-        ON CONFLICT (user_id, dedupe_key) WHERE $5 IS NOT NULL DO NOTHING
+        ON CONFLICT (user_id, dedupe_key) WHERE dedupe_key IS NOT NULL DO NOTHING
         RETURNING id`
 	var id int64
 	err := db.QueryRowContext(ctx, q, userID, kind, string(b), runAt, dedupeKey).Scan(&id)
@@ -20,7 +23,174 @@ func Enqueue(ctx context.Context, db *sql.DB, userID string, kind string, payloa
 	return id, err
 }
 
-func WakeTask(ctx context.Context, db *sql.DB, taskID int64) error {
-	_, err := db.ExecContext(ctx, `UPDATE task SET status='pending', updated_at=now() WHERE id=$1`, taskID)
-	return err
+// EnqueueChild queues a follow-up of task parentID in tx, normally the
+// worker's claim transaction, so the follow-up exists only if the parent's
+// step commits. status is "pending", or "waiting" for a task that runs at
+// runAt unless WakeTask wakes it first.
+func EnqueueChild(ctx context.Context, tx *sql.Tx, parentID int64, userID, kind, status string, payload any, runAt *time.Time) (int64, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+INSERT INTO task (user_id, kind, status, payload, run_at, parent_task_id)
+VALUES ($1, $2, $3::task_status, $4, $5, $6)
+RETURNING id`, userID, kind, status, string(b), runAt, parentID).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("enqueue %s: %w", kind, err)
+	}
+	return id, nil
+}
+
+// WakeTask makes a waiting task runnable now, recording result as what woke
+// it. It reports false when the task isn't waiting (a worker may be running
+// it, or it already finished).
+func WakeTask(ctx context.Context, db *sql.DB, taskID int64, result any) (bool, error) {
+	b, err := json.Marshal(result)
+	if err != nil {
+		return false, err
+	}
+	res, err := db.ExecContext(ctx, `
+UPDATE task SET status='pending', run_at=NULL, result=$2::jsonb, updated_at=now()
+WHERE id=$1 AND status='waiting'`, taskID, string(b))
+	if err != nil {
+		return false, fmt.Errorf("wake task %d: %w", taskID, err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ThreadReply is a message answering a task waiting on an email thread.
+type ThreadReply struct {
+	TaskID   int64
+	EmailID  int64
+	ThreadID string
+	From     string
+}
+
+// WaitingReplies finds a user's waiting wait_email_reply tasks whose thread
+// has a message the user didn't send since the wait began (the payload's
+// ThreadID and SentAt), with the first such message. It looks at stored
+// mail only, so it is called after a Gmail sync.
+func WaitingReplies(ctx context.Context, db *sql.DB, userID string) ([]ThreadReply, error) {
+	rows, err := db.QueryContext(ctx, `
+SELECT t.id, e.id, e.thread_id, e.sender
+FROM task t
+JOIN LATERAL (
+  SELECT id, thread_id, coalesce(sender, '') AS sender
+  FROM email
+  WHERE user_id = t.user_id AND thread_id = t.payload->>'ThreadID'
+    AND sent_at > (t.payload->>'SentAt')::timestamptz
+    AND NOT labels && ARRAY['SENT', 'DRAFT']
+  ORDER BY sent_at, id
+  LIMIT 1) e ON true
+WHERE t.user_id = $1 AND t.kind = 'wait_email_reply' AND t.status = 'waiting'
+  AND coalesce(t.payload->>'ThreadID', '') <> ''
+ORDER BY t.id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("find replies to waiting tasks: %w", err)
+	}
+	defer rows.Close()
+	var out []ThreadReply
+	for rows.Next() {
+		var r ThreadReply
+		if err := rows.Scan(&r.TaskID, &r.EmailID, &r.ThreadID, &r.From); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// EnqueueSync queues a sync task of the given kind for a user unless one was
+// already queued in the current interval, so repeated cron ticks don't pile up.
+func EnqueueSync(ctx context.Context, db *sql.DB, userID, kind string, every time.Duration) (int64, error) {
+	key := fmt.Sprintf("%s:%d", kind, time.Now().Truncate(every).Unix())
+	return Enqueue(ctx, db, userID, kind, struct{}{}, nil, &key)
+}
+
+// ErrNotFailed is returned by RequeueTask for a task that hasn't failed.
+var ErrNotFailed = errors.New("task has not failed")
+
+// Task is a queued task as shown by the API.
+type Task struct {
+	ID           int64           `json:"id"`
+	Kind         string          `json:"kind"`
+	Status       string          `json:"status"`
+	Payload      json.RawMessage `json:"payload"`
+	Result       json.RawMessage `json:"result"`
+	Retries      int             `json:"retries"`
+	LastError    string          `json:"last_error"`
+	ParentTaskID *int64          `json:"parent_task_id"`
+	RunAt        *time.Time      `json:"run_at"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
+
+const taskColumns = `t.id, coalesce(t.kind, ''), t.status::text, coalesce(t.payload, 'null'), coalesce(t.result, 'null'),
+       coalesce(t.retries, 0), coalesce(t.last_error, ''), t.parent_task_id, t.run_at, t.created_at, t.updated_at`
+
+func scanTask(row interface{ Scan(...any) error }) (Task, error) {
+	var (
+		t               Task
+		payload, result []byte
+	)
+	err := row.Scan(&t.ID, &t.Kind, &t.Status, &payload, &result, &t.Retries, &t.LastError,
+		&t.ParentTaskID, &t.RunAt, &t.CreatedAt, &t.UpdatedAt)
+	t.Payload, t.Result = payload, result
+	return t, err
+}
+
+// ListFailedTasks lists a user's dead tasks, those that failed permanently
+// or ran out of retries, most recent first. kind, when set, filters by kind.
+func ListFailedTasks(ctx context.Context, db *sql.DB, userID, kind string, p Page) ([]Task, bool, error) {
+	p = p.normalized()
+	rows, err := db.QueryContext(ctx, `SELECT `+taskColumns+`
+FROM task t
+WHERE t.user_id = $1 AND t.status = 'failed' AND ($2 = '' OR t.kind = $2)
+ORDER BY t.updated_at DESC, t.id DESC
+LIMIT $3 OFFSET $4`, userID, kind, p.Limit+1, p.Offset)
+	if err != nil {
+		return nil, false, fmt.Errorf("select failed tasks: %w", err)
+	}
+	defer rows.Close()
+
+	out := []Task{}
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, false, fmt.Errorf("scan task: %w", err)
+		}
+		out = append(out, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	out, more := trim(out, p.Limit)
+	return out, more, nil
+}
+
+// RequeueTask puts a failed task back in the queue to run now with a fresh
+// set of retries. It returns sql.ErrNoRows for another user's or a missing
+// task, and ErrNotFailed when the task isn't failed.
+func RequeueTask(ctx context.Context, db *sql.DB, userID string, id int64) (*Task, error) {
+	t, err := scanTask(db.QueryRowContext(ctx, `
+UPDATE task t SET status='pending', run_at=NULL, retries=0, claimed_at=NULL, updated_at=now()
+WHERE t.id = $2 AND t.user_id = $1 AND t.status = 'failed'
+RETURNING `+taskColumns, userID, id))
+	if err == nil {
+		return &t, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("requeue task %d: %w", id, err)
+	}
+	var exists bool
+	if err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM task WHERE id = $2 AND user_id = $1)`, userID, id).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrNotFailed
+	}
+	return nil, sql.ErrNoRows
 }
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type Thread struct {
+	ID            string     `json:"id"`
+	Title         string     `json:"title"`
+	Archived      bool       `json:"archived"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	LastMessageAt *time.Time `json:"last_message_at"`
+}
+
+const threadColumns = `t.id::text, coalesce(t.title, ''), t.archived, t.created_at, t.updated_at, t.last_message_at`
+
+func scanThread(s interface{ Scan(...any) error }) (Thread, error) {
+	var t Thread
+	var last sql.NullTime
+	if err := s.Scan(&t.ID, &t.Title, &t.Archived, &t.CreatedAt, &t.UpdatedAt, &last); err != nil {
+		return t, err
+	}
+	if last.Valid {
+		t.LastMessageAt = &last.Time
+	}
+	return t, nil
+}
+
+func CreateThread(ctx context.Context, db *sql.DB, userID, title string) (*Thread, error) {
+	t, err := scanThread(db.QueryRowContext(ctx, `
+INSERT INTO thread AS t (user_id, title) VALUES ($1, $2)
+RETURNING `+threadColumns, userID, nullable(title)))
+	if err != nil {
+		return nil, fmt.Errorf("insert thread: %w", err)
+	}
+	return &t, nil
+}
+
+// ListThreads returns one page of the user's threads, most recently active
+// first, and whether another page follows.
+func ListThreads(ctx context.Context, db *sql.DB, userID string, archived bool, p Page) ([]Thread, bool, error) {
+	p = p.normalized()
+	rows, err := db.QueryContext(ctx, `SELECT `+threadColumns+`
+FROM thread t
+WHERE t.user_id = $1 AND t.archived = $2
+ORDER BY coalesce(t.last_message_at, t.created_at) DESC, t.id
+LIMIT $3 OFFSET $4`, userID, archived, p.Limit+1, p.Offset)
+	if err != nil {
+		return nil, false, fmt.Errorf("select threads: %w", err)
+	}
+	defer rows.Close()
+
+	out := []Thread{}
+	for rows.Next() {
+		t, err := scanThread(rows)
+		if err != nil {
+			return nil, false, fmt.Errorf("scan thread: %w", err)
+		}
+		out = append(out, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	out, more := trim(out, p.Limit)
+	return out, more, nil
+}
+
+// GetThread returns sql.ErrNoRows when the thread doesn't exist or belongs
+// to another user.
+func GetThread(ctx context.Context, db *sql.DB, userID, id string) (*Thread, error) {
+	t, err := scanThread(db.QueryRowContext(ctx, `SELECT `+threadColumns+`
+FROM thread t WHERE t.user_id = $1 AND t.id = $2`, userID, id))
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// UpdateThread renames and/or (un)archives a thread; nil fields are left
+// unchanged.
+func UpdateThread(ctx context.Context, db *sql.DB, userID, id string, title *string, archived *bool) (*Thread, error) {
+	t, err := scanThread(db.QueryRowContext(ctx, `
+UPDATE thread AS t SET
+  title = CASE WHEN $3 THEN $4 ELSE title END,
+  archived = coalesce($5, archived),
+  updated_at = now()
+WHERE t.user_id = $1 AND t.id = $2
+RETURNING `+threadColumns, userID, id, title != nil, nullable(deref(title)), archived))
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// SetThreadTitle names a thread that doesn't have a title yet, so a generated
+// title never replaces one the user chose. It reports whether it was set.
+func SetThreadTitle(ctx context.Context, db *sql.DB, userID, id, title string) (bool, error) {
+	res, err := db.ExecContext(ctx, `
+UPDATE thread SET title = $3, updated_at = now()
+WHERE user_id = $1 AND id = $2 AND coalesce(title, '') = ''`, userID, id, nullable(title))
+	if err != nil {
+		return false, fmt.Errorf("set thread title: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// TouchThread records activity on a thread, moving it to the top of the list.
+func TouchThread(ctx context.Context, db *sql.DB, userID, id string) error {
+	_, err := db.ExecContext(ctx, `
+UPDATE thread SET last_message_at = now() WHERE user_id = $1 AND id = $2`, userID, id)
+	return err
+}
+
+// DeleteThread removes a thread and its messages.
+func DeleteThread(ctx context.Context, db *sql.DB, userID, id string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM thread WHERE user_id = $1 AND id = $2`, userID, id)
+	if err != nil {
+		return fmt.Errorf("delete thread: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	if _, err := tx.ExecContext(ctx, `
+DELETE FROM agent_message WHERE user_id = $1 AND thread_id = $2`, userID, id); err != nil {
+		return fmt.Errorf("delete thread messages: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ThreadMessages returns up to limit user and assistant messages of a thread
+// with ids below before (0 for the newest), oldest first, and the id to pass
+// as before for the previous page (0 when there is none). Tool traffic is left
+// out; it is only kept for replaying the conversation to the model.
+func ThreadMessages(ctx context.Context, db *sql.DB, userID, threadID string, before int64, limit int) ([]Message, int64, error) {
+	if limit <= 0 || limit > maxPageSize {
+		limit = defaultPageSize
+	}
+	rows, err := db.QueryContext(ctx, `
+SELECT id, role, content, created_at
+FROM agent_message
+WHERE user_id = $1 AND thread_id = $2
+  AND role IN ('user', 'assistant') AND coalesce(content, '') <> ''
+  AND ($3::bigint = 0 OR id < $3)
+ORDER BY id DESC
+LIMIT $4`, userID, threadID, before, limit+1)
+	if err != nil {
+		return nil, 0, fmt.Errorf("select thread messages: %w", err)
+	}
+	defer rows.Close()
+
+	out := []Message{}
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.Role, &m.Content, &m.CreatedAt); err != nil {
+			return nil, 0, fmt.Errorf("scan: %w", err)
+		}
+		out = append(out, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	var next int64
+	if len(out) > limit {
+		out = out[:limit]
+		next = out[limit-1].ID
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, next, nil
+}
@@ -0,0 +1,80 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"aiagentapi/internal/extract"
+	"aiagentapi/storage"
+)
+
+// enqueueExtractions queues an extract_attachment task for each of the
+// user's attachments that hasn't been processed yet. Attachments no extractor
+// can read are marked done straight away so they aren't looked at again.
+func enqueueExtractions(ctx context.Context, db *sql.DB, userID string) (int, error) {
+	rows, err := db.QueryContext(ctx, `
+SELECT id, coalesce(mime_type, ''), coalesce(filename, '')
+FROM email_attachment
+WHERE user_id=$1 AND extracted_at IS NULL
+ORDER BY id
+LIMIT 200`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("list attachments: %w", err)
+	}
+	type pending struct {
+		id                 int64
+		mimeType, filename string
+	}
+	var list []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.mimeType, &p.filename); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		list = append(list, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, p := range list {
+		if !extract.Supported(p.mimeType, p.filename) {
+			_, err := db.ExecContext(ctx, `
+UPDATE email_attachment SET extracted_at=now(), extract_error=$2 WHERE id=$1`, p.id, extract.ErrUnsupported.Error())
+			if err != nil {
+				return n, err
+			}
+			continue
+		}
+		key := fmt.Sprintf("extract_attachment:%d", p.id)
+		id, err := storage.Enqueue(ctx, db, userID, "extract_attachment", map[string]int64{"AttachmentID": p.id}, nil, &key)
+		if err != nil {
+			return n, err
+		}
+		if id != 0 {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// gaveUp records what a task that failed for good leaves behind. An
+// attachment whose extraction failed is marked done with the error: its task
+// keeps the dedupe key, so enqueueExtractions would never queue it again.
+func gaveUp(ctx context.Context, tx *sql.Tx, t task, taskErr error) error {
+	if t.Kind != "extract_attachment" {
+		return nil
+	}
+	var p struct{ AttachmentID int64 }
+	if err := decode(t.Payload, &p); err != nil {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `
+UPDATE email_attachment SET extracted_at=now(), extract_error=$2, updated_at=now()
+WHERE id=$1 AND extracted_at IS NULL`, p.AttachmentID, taskErr.Error())
+	return err
+}
@@ -5,34 +5,268 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"log"
+	"time"
+
+	"aiagentapi/internal/agent"
+	"aiagentapi/internal/contacts"
+	"aiagentapi/internal/extract"
+	"aiagentapi/internal/google"
+	"aiagentapi/internal/mailsend"
+	"aiagentapi/internal/schedule"
+	"aiagentapi/internal/sync"
+	"aiagentapi/internal/tasks"
+	"aiagentapi/storage"
 )
 
-func dispatch(ctx context.Context, tx *sql.Tx, id int64, kind, payload string) error {
+type task struct {
+	ID      int64
+	UserID  string
+	Kind    string
+	Payload string
+	// Retries counts the earlier failed attempts.
+	Retries int
+}
+
+// maxTaskTimeout bounds the longest task kind; the claim transaction stays
+// open for the duration of the task.
+const maxTaskTimeout = 5 * time.Minute
+
+func taskTimeout(kind string) time.Duration {
 	switch kind {
+	case "sync_gmail", "sync_calendar":
+		return maxTaskTimeout
+	case "extract_attachment":
+		return 2 * time.Minute
+	case "send_email", "create_calendar_event", "schedule_meeting", "wait_email_reply":
+		return time.Minute
+	case "schedule_reply":
+		return 2 * time.Minute
+	default:
+		return 10 * time.Second
+	}
+}
+
+func dispatch(ctx context.Context, db *sql.DB, tx *sql.Tx, t task) error {
+	payload := t.Payload
+	switch t.Kind {
 	case "send_email":
-		var p struct{ To, Subject, Body, ThreadID string }
-		if err := json.Unmarshal([]byte(payload), &p); err != nil {
+		if t.UserID == "" {
+			return tasks.Permanent(fmt.Errorf("send_email: task has no user"))
+		}
+		var p mailsend.Email
+		if err := decode(payload, &p); err != nil {
 			return err
 		}
-		fmt.Printf("[worker] send_email to=%s subject=%s\n", p.To, p.Subject)
-		return nil
+		res, err := mailsend.Send(ctx, db, google.ConfigFromEnv(), t.UserID, p)
+		if err != nil {
+			return err
+		}
+		log.Printf("[worker] send_email user=%s gmail_id=%s", t.UserID, res.GmailMessageID)
+		return afterWrite(setResult(ctx, tx, t.ID, res))
 	case "create_calendar_event":
-		var p struct {
-			Title, Start, End string
-			Attendees         []string
+		if t.UserID == "" {
+			return tasks.Permanent(fmt.Errorf("create_calendar_event: task has no user"))
 		}
-		if err := json.Unmarshal([]byte(payload), &p); err != nil {
+		var p schedule.Event
+		if err := decode(payload, &p); err != nil {
 			return err
 		}
-		fmt.Printf("[worker] create_event title=%s\n", p.Title)
-		return nil
+		ev, err := schedule.CreateEvent(ctx, db, google.ConfigFromEnv(), t.UserID, p)
+		if err != nil {
+			return err
+		}
+		log.Printf("[worker] create_calendar_event user=%s event=%s", t.UserID, ev.ID)
+		return afterWrite(setResult(ctx, tx, t.ID, map[string]string{"event_id": ev.ID, "html_link": ev.HTMLLink, "conference_url": ev.ConferenceURL()}))
+	case "schedule_meeting":
+		if t.UserID == "" {
+			return tasks.Permanent(fmt.Errorf("schedule_meeting: task has no user"))
+		}
+		var p schedule.Proposal
+		if err := decode(payload, &p); err != nil {
+			return err
+		}
+		w, err := schedule.Propose(ctx, db, google.ConfigFromEnv(), t.UserID, p)
+		if err != nil {
+			return err
+		}
+		waitID, err := wait(ctx, tx, t, w)
+		if err != nil {
+			return afterWrite(err)
+		}
+		log.Printf("[worker] schedule_meeting user=%s thread=%s wait=%d", t.UserID, w.ThreadID, waitID)
+		return afterWrite(setResult(ctx, tx, t.ID, map[string]any{"thread_id": w.ThreadID, "slots": w.Slots, "wait_task_id": waitID}))
 	case "wait_email_reply":
-		var p struct{ ThreadID string }
-		if err := json.Unmarshal([]byte(payload), &p); err != nil {
+		if t.UserID == "" {
+			return tasks.Permanent(fmt.Errorf("wait_email_reply: task has no user"))
+		}
+		var w schedule.Waiting
+		if err := decode(payload, &w); err != nil {
 			return err
 		}
+		return waitEmailReply(ctx, db, tx, t, &w)
+	case "schedule_reply":
+		if t.UserID == "" {
+			return tasks.Permanent(fmt.Errorf("schedule_reply: task has no user"))
+		}
+		var p schedule.Replied
+		if err := decode(payload, &p); err != nil {
+			return err
+		}
+		out, next, err := schedule.HandleReply(ctx, db, google.ConfigFromEnv(), agent.NewLLM(), t.UserID, p)
+		if err != nil {
+			return err
+		}
+		result := map[string]any{"outcome": out}
+		if next != nil {
+			waitID, err := wait(ctx, tx, t, next)
+			if err != nil {
+				return afterWrite(err)
+			}
+			result["wait_task_id"] = waitID
+		}
+		log.Printf("[worker] schedule_reply user=%s thread=%s status=%s", t.UserID, p.ThreadID, out.Status)
+		return afterWrite(setResult(ctx, tx, t.ID, result))
+	case "sync_gmail":
+		if t.UserID == "" {
+			return tasks.Permanent(fmt.Errorf("sync_gmail: task has no user"))
+		}
+		n, err := sync.SyncGmail(ctx, db, google.ConfigFromEnv(), t.UserID, sync.GmailOptionsFromEnv())
+		if err != nil {
+			return err
+		}
+		log.Printf("[worker] sync_gmail user=%s changes=%d", t.UserID, n)
+		if _, err := enqueueExtractions(ctx, db, t.UserID); err != nil {
+			log.Printf("[worker] enqueue attachment extraction: %v", err)
+		}
+		updateContacts(ctx, db, t.UserID)
+		wakeReplyWaits(ctx, db, t.UserID)
 		return nil
+	case "sync_calendar":
+		if t.UserID == "" {
+			return tasks.Permanent(fmt.Errorf("sync_calendar: task has no user"))
+		}
+		n, err := sync.SyncCalendar(ctx, db, google.ConfigFromEnv(), t.UserID, sync.CalendarOptionsFromEnv())
+		if err != nil {
+			return err
+		}
+		log.Printf("[worker] sync_calendar user=%s changes=%d", t.UserID, n)
+		updateContacts(ctx, db, t.UserID)
+		return nil
+	case "extract_attachment":
+		var p struct{ AttachmentID int64 }
+		if err := decode(payload, &p); err != nil {
+			return err
+		}
+		return extract.Attachment(ctx, db, google.ConfigFromEnv(), p.AttachmentID)
 	default:
-		return fmt.Errorf("unknown task kind: %s", kind)
+		return tasks.Permanent(fmt.Errorf("unknown task kind: %s", t.Kind))
+	}
+}
+
+// wait queues a wait_email_reply task for w as a child of t. It sleeps
+// until w is due; a reply picked up by the Gmail sync wakes it earlier.
+func wait(ctx context.Context, tx *sql.Tx, t task, w *schedule.Waiting) (int64, error) {
+	at := w.Due()
+	return storage.EnqueueChild(ctx, tx, t.ID, t.UserID, "wait_email_reply", "waiting", w, &at)
+}
+
+// wakeReplyWaits wakes the tasks waiting on threads that newly synced mail
+// answers, noting the reply in their result. Like updateContacts it only
+// logs failures: the replies are found again after the next sync.
+func wakeReplyWaits(ctx context.Context, db *sql.DB, userID string) {
+	replies, err := storage.WaitingReplies(ctx, db, userID)
+	if err != nil {
+		log.Printf("[worker] find replies: %v", err)
+		return
+	}
+	for _, r := range replies {
+		ok, err := storage.WakeTask(ctx, db, r.TaskID, map[string]any{"status": "reply_received", "email_id": r.EmailID, "from": r.From})
+		if err != nil {
+			log.Printf("[worker] %v", err)
+			continue
+		}
+		if ok {
+			log.Printf("[worker] wait_email_reply task=%d thread=%s woken by email=%d", r.TaskID, r.ThreadID, r.EmailID)
+		}
+	}
+}
+
+// nudgeRetry is how long a wait sleeps after a reminder failed to send.
+const nudgeRetry = 15 * time.Minute
+
+// waitEmailReply runs when a reply woke the wait or it came due. A reply
+// hands over to a schedule_reply task; otherwise the wait expires at its
+// deadline (SCHEDULE_REPLY_TIMEOUT_HOURS after the proposal), or the contact
+// is nudged when a reminder is due and the task waits again.
+func waitEmailReply(ctx context.Context, db *sql.DB, tx *sql.Tx, t task, w *schedule.Waiting) error {
+	reply, err := schedule.CheckReply(ctx, db, t.UserID, w)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	switch {
+	case reply != nil:
+		id, err := storage.EnqueueChild(ctx, tx, t.ID, t.UserID, "schedule_reply", "pending", schedule.Replied{Waiting: *w, Reply: *reply, Key: schedule.NewKey()}, nil)
+		if err != nil {
+			return err
+		}
+		log.Printf("[worker] wait_email_reply user=%s thread=%s replied email=%d", t.UserID, w.ThreadID, reply.EmailID)
+		return setResult(ctx, tx, t.ID, map[string]any{"status": "replied", "email_id": reply.EmailID, "next_task_id": id})
+	case !now.Before(w.Deadline):
+		log.Printf("[worker] wait_email_reply user=%s thread=%s expired", t.UserID, w.ThreadID)
+		return setResult(ctx, tx, t.ID, map[string]any{"status": "expired", "nudges": w.Nudges})
+	case !w.NextNudge.IsZero() && !now.Before(w.NextNudge):
+		err := schedule.Nudge(ctx, db, google.ConfigFromEnv(), t.UserID, w)
+		if err == nil {
+			return afterWrite(park(ctx, tx, t.ID, w.Due(), w))
+		}
+		// Try again a little later rather than failing the wait.
+		log.Printf("[worker] nudge thread %s: %v", w.ThreadID, err)
+	}
+	at := w.Due()
+	if !at.After(now) {
+		at = now.Add(nudgeRetry)
+	}
+	return park(ctx, tx, t.ID, at, w)
+}
+
+// park puts the running task back to 'waiting' until at, with payload as
+// its new payload.
+func park(ctx context.Context, tx *sql.Tx, id int64, at time.Time, payload any) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE task SET status='waiting', run_at=$2, payload=$3::jsonb, updated_at=now() WHERE id=$1`, id, at, string(b))
+	return err
+}
+
+// setResult records a task's result; the worker marks it done afterwards in
+// the same transaction.
+func setResult(ctx context.Context, tx *sql.Tx, id int64, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE task SET result=$2::jsonb WHERE id=$1`, id, string(b))
+	return err
+}
+
+// updateContacts records the people in newly synced mail and meetings. A
+// failure here doesn't fail the sync; the rows stay pending for next time.
+func updateContacts(ctx context.Context, db *sql.DB, userID string) {
+	for {
+		n, err := contacts.ProcessPending(ctx, db, userID, 200)
+		if err != nil {
+			log.Printf("[worker] update contacts: %v", err)
+			return
+		}
+		if n == 0 {
+			break
+		}
+	}
+	if _, err := contacts.MergeDuplicates(ctx, db, userID); err != nil {
+		log.Printf("[worker] merge contacts: %v", err)
 	}
 }
@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"aiagentapi/internal/embedding"
+	"aiagentapi/internal/retrieval"
+)
+
+// startIndexer keeps the retrieval tables current: newly synced emails are
+// chunked and, when an embedding provider is configured, chunks, notes and
+// instructions are embedded for semantic search.
+func startIndexer(db *sql.DB) {
+	emb := embedding.NewFromEnv()
+	if emb == nil {
+		log.Println("[worker] embeddings disabled (set EMBEDDING_API_KEY, OPENAI_API_KEY or LLM_EMBEDDINGS)")
+	} else {
+		log.Printf("[worker] embeddings enabled (model=%s dims=%d)", emb.Model(), emb.Dimensions())
+	}
+	go func() {
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+			n, err := retrieval.ChunkPending(ctx, db, 50)
+			if err != nil {
+				log.Printf("[worker] chunk emails: %v", err)
+			}
+			if emb != nil {
+				m, err := embedding.Backfill(ctx, db, emb, 32)
+				if err != nil {
+					log.Printf("[worker] embedding backfill: %v", err)
+				}
+				n += m
+			}
+			cancel()
+			if n == 0 {
+				time.Sleep(time.Minute)
+			}
+		}
+	}()
+}
@@ -0,0 +1,71 @@
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"aiagentapi/internal/google"
+	"aiagentapi/internal/mailsend"
+	"aiagentapi/internal/schedule"
+	"aiagentapi/internal/tasks"
+)
+
+// retryPolicy is how a task kind recovers from transient failures. Syncs run
+// again on the next cron tick anyway, so they give up sooner; mail and
+// calendar writes keep trying for longer because nothing else redoes them.
+// Retrying those is safe: their payloads carry keys that let a retry find
+// what an earlier attempt wrote (mailsend.Email.Key, schedule.Event.ID), and
+// failures after the write succeeded are permanent (see afterWrite).
+func retryPolicy(kind string) tasks.RetryPolicy {
+	switch kind {
+	case "sync_gmail", "sync_calendar":
+		return tasks.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: 5 * time.Minute, Jitter: 0.3}
+	case "send_email", "create_calendar_event", "schedule_meeting", "schedule_reply", "wait_email_reply":
+		return tasks.RetryPolicy{MaxAttempts: 6, BaseDelay: 30 * time.Second, MaxDelay: time.Hour, Jitter: 0.3}
+	case "extract_attachment":
+		return tasks.RetryPolicy{MaxAttempts: 3, BaseDelay: 2 * time.Minute, MaxDelay: 30 * time.Minute, Jitter: 0.3}
+	default:
+		return tasks.RetryPolicy{MaxAttempts: 3, BaseDelay: 30 * time.Second, MaxDelay: 10 * time.Minute, Jitter: 0.3}
+	}
+}
+
+// permanent reports whether err will fail the same way on every retry: an
+// error marked with tasks.Permanent, or one of the known causes below.
+func permanent(err error) bool {
+	switch {
+	case tasks.IsPermanent(err):
+		return true
+	case errors.Is(err, mailsend.ErrNoRecipients), errors.Is(err, schedule.ErrNoSlots):
+		return true
+	case errors.Is(err, google.ErrNoRefreshToken):
+		// The user has to connect Google again.
+		return true
+	case google.IsStatus(err, http.StatusBadRequest), google.IsStatus(err, http.StatusNotFound),
+		google.IsStatus(err, http.StatusUnauthorized):
+		return true
+	case google.IsStatus(err, http.StatusForbidden):
+		// Google also answers 403 when a rate limit is exceeded.
+		var apiErr *google.APIError
+		return errors.As(err, &apiErr) && !strings.Contains(strings.ToLower(apiErr.Body), "ratelimitexceeded")
+	}
+	return false
+}
+
+// afterWrite marks an error that happened after a task's write to Google (an
+// email sent, an event created) succeeded. A retry would repeat the write,
+// so the error is permanent. A nil err stays nil.
+func afterWrite(err error) error {
+	return tasks.Permanent(err)
+}
+
+// decode unmarshals a task payload. A payload that doesn't decode never
+// will, so the error is permanent.
+func decode(payload string, v any) error {
+	if err := json.Unmarshal([]byte(payload), v); err != nil {
+		return tasks.Permanent(err)
+	}
+	return nil
+}
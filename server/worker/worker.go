@@ -3,11 +3,16 @@ package worker
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"log"
+	"runtime/debug"
 	"time"
+
+	"aiagentapi/internal/tasks"
 )
 
 func Start(db *sql.DB) {
+	startIndexer(db)
 	go func() {
 		log.Println("[worker] loop started")
 		for {
@@ -20,23 +25,23 @@ func Start(db *sql.DB) {
 }
 
 func claimAndRunOne(db *sql.DB) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), maxTaskTimeout+10*time.Second)
 	defer cancel()
 	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
 	if err != nil {
 		return err
 	}
-	var id int64
-	var kind, payload string
+	var t task
 	err = tx.QueryRowContext(ctx, `
     UPDATE task SET status='running', claimed_at=now(), updated_at=now()
      WHERE id = (
        SELECT id FROM task
-        WHERE status IN ('pending') AND (run_at IS NULL OR run_at <= now())
+        WHERE (status = 'pending' AND (run_at IS NULL OR run_at <= now()))
+           OR (status = 'waiting' AND run_at <= now())
         ORDER BY priority ASC, run_at NULLS FIRST, id
         FOR UPDATE SKIP LOCKED
         LIMIT 1)
-    RETURNING id, kind, payload::text`).Scan(&id, &kind, &payload)
+    RETURNING id, coalesce(user_id::text, ''), kind, payload::text, coalesce(retries, 0)`).Scan(&t.ID, &t.UserID, &t.Kind, &t.Payload, &t.Retries)
 	if err == sql.ErrNoRows {
 		tx.Commit()
 		time.Sleep(1500 * time.Millisecond)
@@ -46,15 +51,66 @@ func claimAndRunOne(db *sql.DB) error {
 		tx.Rollback()
 		return err
 	}
-	if err := dispatch(ctx, tx, id, kind, payload); err != nil {
-		_, _ = tx.ExecContext(ctx, `UPDATE task SET status='failed', last_error=$2, updated_at=now() WHERE id=$1`, id, err.Error())
+	// The savepoint lets a failed task drop what it wrote (results, child
+	// tasks) while its failure is still recorded in this transaction.
+	if _, err := tx.ExecContext(ctx, `SAVEPOINT run_task`); err != nil {
+		tx.Rollback()
+		return err
+	}
+	runCtx, cancelRun := context.WithTimeout(ctx, taskTimeout(t.Kind))
+	err = run(runCtx, db, tx, t)
+	cancelRun()
+	if err != nil {
+		if ferr := fail(ctx, tx, t, err); ferr != nil {
+			tx.Rollback()
+			return fmt.Errorf("task %d: %v; recording the failure: %w", t.ID, err, ferr)
+		}
 		tx.Commit()
 		return err
 	}
-	_, err = tx.ExecContext(ctx, `UPDATE task SET status='done', updated_at=now() WHERE id=$1`, id)
+	// A task that parked itself to wait stays 'waiting'.
+	_, err = tx.ExecContext(ctx, `UPDATE task SET status='done', updated_at=now() WHERE id=$1 AND status='running'`, t.ID)
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
 	return tx.Commit()
 }
+
+// run dispatches t, turning a panic into a permanent failure of the task:
+// one bad input, such as an attachment the PDF parser chokes on, must not
+// take the server down.
+func run(ctx context.Context, db *sql.DB, tx *sql.Tx, t task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[worker] %s task=%d panicked: %v\n%s", t.Kind, t.ID, r, debug.Stack())
+			err = tasks.Permanent(fmt.Errorf("%s: panic: %v", t.Kind, r))
+		}
+	}()
+	return dispatch(ctx, db, tx, t)
+}
+
+// fail records a task's failure. A transient error reschedules the task per
+// its kind's retry policy; a permanent one, or the last attempt, leaves it
+// 'failed', where it is listed as dead until requeued.
+func fail(ctx context.Context, tx *sql.Tx, t task, taskErr error) error {
+	if _, err := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT run_task`); err != nil {
+		return err
+	}
+	attempts := t.Retries + 1
+	delay, retry := retryPolicy(t.Kind).Retry(attempts)
+	if retry && !permanent(taskErr) {
+		log.Printf("[worker] %s task=%d attempt %d failed, retrying in %s: %v", t.Kind, t.ID, attempts, delay.Round(time.Second), taskErr)
+		_, err := tx.ExecContext(ctx, `
+UPDATE task SET status='pending', run_at=$2, retries=$3, last_error=$4, updated_at=now()
+WHERE id=$1`, t.ID, time.Now().Add(delay), attempts, taskErr.Error())
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `
+UPDATE task SET status='failed', retries=$2, last_error=$3, updated_at=now()
+WHERE id=$1`, t.ID, attempts, taskErr.Error())
+	if err != nil {
+		return err
+	}
+	return gaveUp(ctx, tx, t, taskErr)
+}
@@ -8,6 +8,10 @@ const tabNew = $("#tab-new");
 const input = $("#msg");
 const sendBtn = $("#sendBtn");
 
+// The thread the chat pane shows; created on the first message after
+// "New thread".
+let threadId = null;
+
 function addBubble(role, text) {
   const d = document.createElement("div");
   d.className = "bubble " + role;
@@ -16,6 +20,21 @@ function addBubble(role, text) {
   window.scrollTo(0, document.body.scrollHeight);
 }
 
+function addSources(sources) {
+  if (!Array.isArray(sources) || sources.length === 0) {
+    return;
+  }
+  const d = document.createElement("div");
+  d.className = "sources";
+  sources.forEach((s) => {
+    const row = document.createElement("div");
+    row.className = s.cited ? "source cited" : "source";
+    row.textContent = "[" + s.ref + "] " + s.kind + ": " + s.snippet;
+    d.appendChild(row);
+  });
+  msgs.appendChild(d);
+}
+
 function renderHistory(groups, fallbackMessages) {
   historyBox.innerHTML = "";
   if (groups.length === 0 && Array.isArray(fallbackMessages)) {
@@ -49,8 +68,28 @@ function renderHistory(groups, fallbackMessages) {
   });
 }
 
+function renderThreads(threads) {
+  historyBox.innerHTML = "";
+  threads.forEach((t) => {
+    const d = document.createElement("div");
+    d.className = "bubble thread";
+    d.style.cursor = "pointer";
+    d.textContent = t.title || "Untitled thread";
+    d.addEventListener("click", () => openThread(t.id));
+    historyBox.appendChild(d);
+  });
+}
+
 async function loadHistory() {
   try {
+    const tr = await fetch("/api/threads");
+    if (tr.ok) {
+      const tj = await tr.json();
+      if (Array.isArray(tj.items) && tj.items.length > 0) {
+        renderThreads(tj.items);
+        return;
+      }
+    }
     const r = await fetch("/messages");
     if (!r.ok) {
       throw new Error("messages fetch failed");
@@ -62,6 +101,65 @@ async function loadHistory() {
   }
 }
 
+async function openThread(id) {
+  try {
+    const r = await fetch("/messages?thread_id=" + encodeURIComponent(id));
+    const j = await r.json();
+    if (!r.ok) {
+      throw new Error(j.error || "messages fetch failed");
+    }
+    threadId = id;
+    msgs.innerHTML = "";
+    (j.messages || []).forEach((m) => addBubble(m.role, m.content));
+    tabChat.click();
+  } catch (e) {
+    addBubble("assistant", "Error: " + e.message);
+  }
+}
+
+async function ensureThread() {
+  if (threadId) {
+    return threadId;
+  }
+  const r = await fetch("/api/threads", { method: "POST" });
+  const j = await r.json();
+  if (!r.ok) {
+    throw new Error(j.error || "could not start a thread");
+  }
+  threadId = j.id;
+  return threadId;
+}
+
+// readEvents parses a text/event-stream response body, calling onEvent with
+// each event name and its decoded JSON data.
+async function readEvents(r, onEvent) {
+  const reader = r.body.getReader();
+  const decoder = new TextDecoder();
+  let buf = "";
+  for (;;) {
+    const { value, done } = await reader.read();
+    if (done) {
+      return;
+    }
+    buf += decoder.decode(value, { stream: true });
+    let i;
+    while ((i = buf.indexOf("\n\n")) >= 0) {
+      const block = buf.slice(0, i);
+      buf = buf.slice(i + 2);
+      let name = "message";
+      let data = "";
+      block.split("\n").forEach((line) => {
+        if (line.startsWith("event:")) {
+          name = line.slice(6).trim();
+        } else if (line.startsWith("data:")) {
+          data += line.slice(5).trim();
+        }
+      });
+      onEvent(name, data ? JSON.parse(data) : {});
+    }
+  }
+}
+
 async function send() {
   const v = input.value.trim();
   if (!v) {
@@ -71,18 +169,35 @@ async function send() {
   addBubble("user", v);
   input.value = "";
   try {
-    const r = await fetch("/chat", {
+    const thread = await ensureThread();
+    const r = await fetch("/chat/stream", {
       method: "POST",
       headers: { "Content-Type": "application/json" },
-      body: JSON.stringify({ message: v }),
+      body: JSON.stringify({ message: v, thread_id: thread }),
     });
-    const j = await r.json();
-    if (j.error) {
-      addBubble("assistant", "Error: " + j.error);
+    if (!r.ok || !r.body) {
+      const j = await r.json();
+      addBubble("assistant", "Error: " + (j.error || r.statusText));
       return;
     }
-    const txt = typeof j.reply === "string" ? j.reply : JSON.stringify(j.reply);
-    addBubble("assistant", txt);
+    let bubble = null;
+    await readEvents(r, (name, ev) => {
+      if (name === "token") {
+        if (!bubble) {
+          addBubble("assistant", "");
+          bubble = msgs.lastChild;
+        }
+        bubble.textContent += ev.text || "";
+        window.scrollTo(0, document.body.scrollHeight);
+      } else if (name === "done") {
+        if (!bubble) {
+          addBubble("assistant", ev.reply || "");
+        }
+        addSources(ev.sources);
+      } else if (name === "error") {
+        addBubble("assistant", "Error: " + ev.error);
+      }
+    });
   } catch (e) {
     addBubble("assistant", "Error: " + e.message);
   } finally {
@@ -105,6 +220,7 @@ tabHistory.addEventListener("click", async () => {
 });
 
 tabNew.addEventListener("click", () => {
+  threadId = null;
   msgs.innerHTML = "";
   tabChat.classList.add("active");
   tabHistory.classList.remove("active");